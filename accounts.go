@@ -0,0 +1,244 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "os"
+  "os/user"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+  "golang.org/x/net/context/ctxhttp"
+  "golang.org/x/oauth2"
+)
+
+// defaultAccount is the name of the account used when neither --account
+// nor default_account in the config file name one
+const defaultAccount = "default"
+
+// accountFlag is the account named with --account
+var accountFlag string
+
+// currentAccount returns the name of the account commands act as
+func currentAccount() string {
+  if accountFlag != "" {
+    return accountFlag
+  }
+  if name := loadConfig().DefaultAccount; name != "" {
+    return name
+  }
+  return defaultAccount
+}
+
+// accountsDir returns the directory holding one cached token per account
+func accountsDir() (string, error) {
+  return configDir("accounts")
+}
+
+// tokenCacheFile generates credential file path/filename for the current
+// account, unless token_file is configured for the default account. A
+// token cached by earlier versions in ~/.credentials becomes the token of
+// the default account.
+// It returns the generated credential path/filename.
+func tokenCacheFile() (string, error) {
+  account := currentAccount()
+  if file := loadConfig().TokenFile; file != "" && account == defaultAccount {
+    return file, nil
+  }
+  dir, err := accountsDir()
+  if err != nil {
+    return "", err
+  }
+  file := filepath.Join(dir, url.QueryEscape(account)+".json")
+
+  if account == defaultAccount {
+    if _, err := os.Stat(file); os.IsNotExist(err) {
+      migrateLegacyToken(file)
+    }
+  }
+  return file, nil
+}
+
+// migrateLegacyToken moves the token cached in ~/.credentials by earlier
+// versions of todo to file, if there is one
+func migrateLegacyToken(file string) {
+  usr, err := user.Current()
+  if err != nil {
+    return
+  }
+  legacy := filepath.Join(usr.HomeDir, ".credentials", url.QueryEscape("tasks-go-quickstart.json"))
+  if err := os.Rename(legacy, file); err == nil {
+    infof("Moved credential file from %s to %s", legacy, file)
+  }
+}
+
+// accountNames returns the names of all accounts with a cached token
+func accountNames() ([]string, error) {
+  dir, err := accountsDir()
+  if err != nil {
+    return nil, err
+  }
+  files, err := ioutil.ReadDir(dir)
+  if err != nil {
+    return nil, err
+  }
+  var names []string
+  seen := map[string]bool{}
+  for _, f := range files {
+    ext := filepath.Ext(f.Name())
+    if ext != ".json" && ext != keyringMarker {
+      continue
+    }
+    name, err := url.QueryUnescape(strings.TrimSuffix(f.Name(), ext))
+    if err == nil && !seen[name] {
+      seen[name] = true
+      names = append(names, name)
+    }
+  }
+  sort.Strings(names)
+  return names, nil
+}
+
+// Lists the accounts todo has credentials for, marking the current one
+func listAccounts() error {
+  names, err := accountNames()
+  if err != nil {
+    return fmt.Errorf("Unable to list accounts: %w", err)
+  }
+  if len(names) == 0 {
+    fmt.Println("No accounts yet, run 'todo auth login' to add one")
+    return nil
+  }
+  current := currentAccount()
+  for _, name := range names {
+    marker := " "
+    if name == current {
+      marker = "*"
+    }
+    fmt.Printf("%s %s\n", marker, name)
+  }
+  return nil
+}
+
+// Google endpoints describing and revoking tokens
+const (
+  tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+  revokeURL    = "https://oauth2.googleapis.com/revoke"
+)
+
+// tokenInfo is what Google tells about an access token
+type tokenInfo struct {
+  Email string `json:"email"`
+  Scope string `json:"scope"`
+}
+
+// tokenLocation describes where the token of the current account is kept
+func tokenLocation() string {
+  if dir, err := accountsDir(); err == nil {
+    if _, err := os.Stat(filepath.Join(dir, url.QueryEscape(currentAccount())+keyringMarker)); err == nil {
+      return "system keyring"
+    }
+  }
+  file, _ := tokenCacheFile()
+  return file
+}
+
+// currentToken returns the cached token of the current account, refreshed
+// if it expired
+func currentToken(ctx context.Context) (*oauth2.Token, error) {
+  tok, err := loadToken()
+  if err != nil {
+    return nil, authError(fmt.Errorf("Account '%s' is not signed in", currentAccount()))
+  }
+  config, err := getConfig()
+  if err != nil {
+    return nil, err
+  }
+  refreshed, err := config.TokenSource(ctx, tok).Token()
+  if err != nil {
+    return nil, fmt.Errorf("Unable to refresh token: %w", err)
+  }
+  return refreshed, nil
+}
+
+// Shows the account todo acts as, with the email address and scopes
+// Google reports for its token and when the token expires
+func showAuthStatus(ctx context.Context) error {
+  tok, err := currentToken(ctx)
+  if err != nil {
+    return err
+  }
+  res, err := ctxhttp.Get(ctx, nil, tokenInfoURL+"?access_token="+url.QueryEscape(tok.AccessToken))
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve token information: %w", err)
+  }
+  defer res.Body.Close()
+  if res.StatusCode != http.StatusOK {
+    return authError(fmt.Errorf("Google rejected the token of account '%s' (%s)", currentAccount(), res.Status))
+  }
+  var info tokenInfo
+  if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+    return fmt.Errorf("Unable to read token information: %w", err)
+  }
+
+  rows := [][]tableCell{{cell("2", "Account"), cell("", currentAccount())}}
+  if info.Email != "" {
+    rows = append(rows, []tableCell{cell("2", "Email"), cell("", info.Email)})
+  }
+  rows = append(rows, []tableCell{cell("2", "Scopes"), cell("", strings.Join(strings.Fields(info.Scope), ", "))})
+  if !tok.Expiry.IsZero() {
+    expiry := tok.Expiry.Local()
+    rows = append(rows, []tableCell{cell("2", "Expires"), cell("", fmt.Sprintf("%s %s (in %s), then renewed with the refresh token",
+      formatDate(expiry), expiry.Format("15:04"), todo.FormatDuration(time.Until(expiry).Round(time.Minute))))})
+  }
+  rows = append(rows, []tableCell{cell("2", "Stored in"), cell("", tokenLocation())})
+  printTable(rows)
+  return nil
+}
+
+// Deletes the cached token of the current account, so todo asks to sign
+// in again
+func logout() error {
+  if _, err := loadToken(); err != nil {
+    return notFoundf("Account '%s' is not signed in", currentAccount())
+  }
+  if err := deleteToken(); err != nil {
+    return err
+  }
+  infof("Account '%s' signed out", currentAccount())
+  return nil
+}
+
+// Revokes the token of the current account with Google, which also
+// invalidates it wherever else it was copied, then deletes it
+func revokeToken(ctx context.Context) error {
+  tok, err := loadToken()
+  if err != nil {
+    return notFoundf("Account '%s' is not signed in", currentAccount())
+  }
+  token := tok.RefreshToken
+  if token == "" {
+    token = tok.AccessToken
+  }
+  res, err := ctxhttp.PostForm(ctx, nil, revokeURL, url.Values{"token": {token}})
+  if err != nil {
+    return fmt.Errorf("Unable to revoke token: %w", err)
+  }
+  res.Body.Close()
+  // a token Google no longer knows is as good as revoked
+  if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusBadRequest {
+    return fmt.Errorf("Unable to revoke token: %s", res.Status)
+  }
+  if err := deleteToken(); err != nil {
+    return err
+  }
+  infof("Access of account '%s' revoked", currentAccount())
+  return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+  "fmt"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+// aliasKeyPrefix starts the config keys of aliases, such as alias.wk
+const aliasKeyPrefix = "alias."
+
+// maxAliasDepth bounds how many aliases may expand into one another
+const maxAliasDepth = 10
+
+// aliasParam matches the $1 to $9 and $@ placeholders of an alias
+var aliasParam = regexp.MustCompile(`\$([1-9@])`)
+
+// aliasKey returns the config key of the alias named name
+func aliasKey(name string) configKey {
+  return configKey{
+    help: "command run by 'todo " + name + "'",
+    get:  func(c *config) string { return c.Aliases[name] },
+    set: func(c *config, v string) error {
+      if lookupCommand(name) != nil {
+        return fmt.Errorf("'%s' is a todo command", name)
+      }
+      if _, err := splitLine(v); err != nil {
+        return err
+      }
+      if v == "" {
+        delete(c.Aliases, name)
+        return nil
+      }
+      if c.Aliases == nil {
+        c.Aliases = map[string]string{}
+      }
+      c.Aliases[name] = v
+      return nil
+    },
+  }
+}
+
+// lookupConfigKey returns the config key named name, which is either one
+// of configKeys or alias.<name>
+func lookupConfigKey(name string) (configKey, bool) {
+  if alias := strings.TrimPrefix(name, aliasKeyPrefix); alias != name && alias != "" {
+    return aliasKey(alias), true
+  }
+  k, ok := configKeys[name]
+  return k, ok
+}
+
+// sortedAliases returns the names of the configured aliases in order
+func sortedAliases() []string {
+  var names []string
+  for name := range loadConfig().Aliases {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// expandAlias replaces the alias args start with, if any, by its command.
+// $1 to $9 in the alias are replaced by the arguments following it and $@
+// by all of them; without placeholders the arguments are appended. Aliases
+// may expand into other aliases, but commands always win over aliases
+func expandAlias(args []string) ([]string, error) {
+  for depth := 0; len(args) > 0 && lookupCommand(args[0]) == nil; depth++ {
+    alias, ok := loadConfig().Aliases[args[0]]
+    if !ok {
+      break
+    }
+    if depth == maxAliasDepth {
+      return nil, invalidf("Alias '%s' expands into itself", args[0])
+    }
+    words, err := splitLine(alias)
+    if err != nil {
+      return nil, invalidf("Invalid alias '%s': %v", args[0], err)
+    }
+    if len(words) == 0 {
+      return nil, invalidf("Alias '%s' is empty", args[0])
+    }
+    params := args[1:]
+    used := false
+    var missing error
+    var expanded []string
+    for _, w := range words {
+      if w == "$@" {
+        expanded = append(expanded, params...)
+        used = true
+        continue
+      }
+      expanded = append(expanded, aliasParam.ReplaceAllStringFunc(w, func(p string) string {
+        used = true
+        if p == "$@" {
+          return strings.Join(params, " ")
+        }
+        i, _ := strconv.Atoi(p[1:])
+        if i > len(params) {
+          missing = invalidf("Alias '%s' needs %d arguments: %s", args[0], i, alias)
+          return ""
+        }
+        return params[i-1]
+      }))
+    }
+    if missing != nil {
+      return nil, missing
+    }
+    if !used {
+      expanded = append(expanded, params...)
+    }
+    verbosef("Alias '%s' expands to %s", args[0], strings.Join(expanded, " "))
+    args = expanded
+  }
+  return args, nil
+}
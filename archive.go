@@ -0,0 +1,319 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/url"
+  "os"
+  "path/filepath"
+  "sync"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// defaultArchiveList is the task list completed tasks are archived into
+const defaultArchiveList = "Archive"
+
+// archiveFile returns the path of the file tasks of the named task list
+// of the current account are archived into with --file
+func archiveFile(name string) (string, error) {
+  dir, err := dataDir("archive", stateName())
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, url.QueryEscape(name)+".json"), nil
+}
+
+// loadArchive reads the tasks archived into the file of the named list
+func loadArchive(name string) ([]*todo.Task, error) {
+  file, err := archiveFile(name)
+  if err != nil {
+    return nil, err
+  }
+  b, err := readPrivate(file)
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  var items []*todo.Task
+  if err := json.Unmarshal(b, &items); err != nil {
+    return nil, fmt.Errorf("Unable to read %s: %w", file, err)
+  }
+  return items, nil
+}
+
+// saveArchive replaces the tasks archived into the file of the named list
+func saveArchive(name string, items []*todo.Task) error {
+  file, err := archiveFile(name)
+  if err != nil {
+    return err
+  }
+  b, err := json.MarshalIndent(items, "", "  ")
+  if err != nil {
+    return err
+  }
+  return writePrivate(file, b)
+}
+
+// archivable returns the top level tasks of the todo list completed
+// before the given time whose subtasks are all completed, and all
+// completed tasks of the list
+func archivable(s *session, before time.Time) ([]*todo.Task, []*todo.Task, error) {
+  if s.offline {
+    return nil, nil, &exitError{code: exitNetwork, err: fmt.Errorf("Completed tasks are not cached, archive needs %s", currentBackend())}
+  }
+  open, err := s.items()
+  if err != nil {
+    return nil, nil, err
+  }
+  completed, err := s.client.Completed(s.ctx, s.todoId, time.Time{}, time.Time{})
+  if err != nil {
+    return nil, nil, fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+  }
+  all := append(append([]*todo.Task{}, open...), completed...)
+  var roots []*todo.Task
+  for _, task := range completed {
+    if task.Parent != "" || !task.Completed.Before(before) {
+      continue
+    }
+    done := true
+    for _, sub := range subtasks(all, task) {
+      done = done && sub.Done()
+    }
+    if done {
+      roots = append(roots, task)
+    }
+  }
+  return roots, completed, nil
+}
+
+// Moves the top level tasks of the todo list completed more than days
+// ago, along with their subtasks, to the task list named into, created if
+// needed, or with toFile set to the archive file of the list
+func archiveTodoItems(s *session, days int, into string, toFile bool) error {
+  roots, completed, err := archivable(s, time.Now().AddDate(0, 0, -days))
+  if err != nil {
+    return err
+  }
+  if len(roots) == 0 {
+    fmt.Printf("No tasks completed more than %s ago in your %s list\n", plural(days, "day"), s.listName)
+    return nil
+  }
+
+  if toFile {
+    archived, err := loadArchive(s.listName)
+    if err != nil {
+      return err
+    }
+    var doomed []*todo.Task
+    for _, task := range roots {
+      subs := subtasks(completed, task)
+      archived = append(append(archived, task), subs...)
+      doomed = append(doomed, subs...)
+    }
+    doomed = append(doomed, roots...)
+    // saved before deleting, so a failure loses nothing
+    if err := saveArchive(s.listName, archived); err != nil {
+      return err
+    }
+    err = inParallel(s.ctx, len(doomed), func(ctx context.Context, i int) error {
+      t := doomed[i]
+      if err := s.client.Delete(ctx, s.todoId, t.ID); err != nil && err != todo.ErrNotFound {
+        return fmt.Errorf("Unable to delete task '%s': %w", t.Title, err)
+      }
+      return nil
+    })
+    if err != nil {
+      return err
+    }
+    for _, task := range roots {
+      infof("Task '%s' archived (id %s)", task.Title, task.ID)
+    }
+    file, _ := archiveFile(s.listName)
+    infof("%s archived into %s", plural(len(roots), "task"), file)
+    return nil
+  }
+
+  archiveID, err := getTodoId(s.ctx, s.client, into, true)
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve task list '%s': %w", into, err)
+  }
+  if archiveID == s.todoId {
+    return invalidf("Your %s list is the archive, see 'todo help archive'", s.listName)
+  }
+  var mu sync.Mutex
+  err = inParallel(s.ctx, len(roots), func(ctx context.Context, i int) error {
+    task := roots[i]
+    if _, err := s.client.Move(ctx, s.todoId, task.ID, todo.Destination{ListID: archiveID}); err != nil {
+      return fmt.Errorf("Unable to archive task '%s': %w", task.Title, err)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    infof("Task '%s' archived (id %s)", task.Title, task.ID)
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+  infof("%s archived into your %s list", plural(len(roots), "task"), into)
+  return nil
+}
+
+// Moves the archived task with the given id, and its subtasks, back into
+// the todo list, from its archive file or else from the task list named
+// from
+func restoreTodoItem(s *session, id string, from string) error {
+  if s.offline {
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Restoring tasks is not queued while offline, try again once %s can be reached", currentBackend())}
+  }
+  archived, err := loadArchive(s.listName)
+  if err != nil {
+    return err
+  }
+  for _, task := range archived {
+    if task.ID == id {
+      return restoreFromFile(s, archived, task)
+    }
+  }
+
+  archiveID, err := getTodoId(s.ctx, s.client, from, false)
+  if err == todo.ErrNotFound {
+    return notFoundf("No archived task with id '%s', see 'todo archive --show'", id)
+  }
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve task list '%s': %w", from, err)
+  }
+  task, err := s.client.Get(s.ctx, archiveID, id)
+  if err == todo.ErrNotFound {
+    return notFoundf("No archived task with id '%s', see 'todo archive --show'", id)
+  }
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve task: %w", err)
+  }
+  if _, err := s.client.Move(s.ctx, archiveID, id, todo.Destination{ListID: s.todoId}); err != nil {
+    return fmt.Errorf("Unable to restore task '%s': %w", task.Title, err)
+  }
+  infof("Task '%s' restored to your %s list", task.Title, s.listName)
+  return nil
+}
+
+// restoreFromFile adds task and its subtasks, taken from the archived
+// tasks of the list's archive file, back to the list, then removes them
+// from the file. The restored tasks get new ids
+func restoreFromFile(s *session, archived []*todo.Task, task *todo.Task) error {
+  restored := map[string]bool{}
+  ids := map[string]string{}
+  for _, t := range append([]*todo.Task{task}, reverse(subtasks(archived, task))...) {
+    c := *t
+    c.Parent = ids[t.Parent]
+    added, err := s.client.Add(s.ctx, s.todoId, &c)
+    if err != nil {
+      return fmt.Errorf("Unable to restore task '%s': %w", t.Title, err)
+    }
+    ids[t.ID] = added.ID
+    restored[t.ID] = true
+  }
+  kept := []*todo.Task{}
+  for _, t := range archived {
+    if !restored[t.ID] {
+      kept = append(kept, t)
+    }
+  }
+  if err := saveArchive(s.listName, kept); err != nil {
+    return err
+  }
+  infof("Task '%s' restored to your %s list", task.Title, s.listName)
+  return nil
+}
+
+// reverse returns items in reverse order
+func reverse(items []*todo.Task) []*todo.Task {
+  reversed := make([]*todo.Task, len(items))
+  for i, t := range items {
+    reversed[len(items)-1-i] = t
+  }
+  return reversed
+}
+
+// Lists the tasks archived from the todo list, in its archive file and in
+// the task list named from, with the ids to restore them by
+func showArchive(s *session, from string) error {
+  items, err := loadArchive(s.listName)
+  if err != nil {
+    return err
+  }
+  if !s.offline {
+    archiveID, err := getTodoId(s.ctx, s.client, from, false)
+    if err != nil && err != todo.ErrNotFound {
+      return fmt.Errorf("Unable to retrieve task list '%s': %w", from, err)
+    }
+    if err == nil && archiveID != s.todoId {
+      completed, err := s.client.Completed(s.ctx, archiveID, time.Time{}, time.Time{})
+      if err != nil {
+        return fmt.Errorf("Unable to retrieve archived tasks: %w", err)
+      }
+      items = append(items, completed...)
+    }
+  }
+  if loadConfig().Output == outputJSON {
+    return listCompletedItems(items)
+  }
+  if len(items) == 0 {
+    fmt.Printf("Nothing archived from your %s list\n", s.listName)
+    return nil
+  }
+  rows := [][]tableCell{{cell("2", "Id"), cell("2", "Task"), cell("2", "Completed")}}
+  for _, task := range items {
+    title := cell("", task.Title)
+    if task.Parent != "" {
+      title = cell("", "  "+task.Title)
+    }
+    rows = append(rows, []tableCell{cell("2", task.ID), title, cell("", formatDate(task.Completed.Local()))})
+  }
+  printTable(rows)
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "archive",
+    usage:   "archive [--days 30] [--into name | --file] | archive --show | archive --restore <id>",
+    summary: "Move old completed tasks out of the list, into an Archive list or file",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      days := fs.Int("days", 30, "archive tasks completed more than this many days ago")
+      into := fs.String("into", defaultArchiveList, "task list to archive tasks into, or restore them from")
+      toFile := fs.Bool("file", false, "archive into a file instead of a task list")
+      show := fs.Bool("show", false, "list archived tasks")
+      restore := fs.String("restore", "", "id of an archived task to move back into the list")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help archive'", args[0])
+      }
+      if *days < 0 {
+        return invalidf("Invalid --days %d, expected a positive number", *days)
+      }
+      if *show && *restore != "" {
+        return invalidf("Give at most one of --show and --restore")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      switch {
+      case *show:
+        return showArchive(s, *into)
+      case *restore != "":
+        return restoreTodoItem(s, *restore, *into)
+      }
+      return archiveTodoItems(s, *days, *into, *toFile)
+    },
+  })
+}
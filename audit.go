@@ -0,0 +1,555 @@
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "encoding/base64"
+  "encoding/json"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// Operations of the audit log besides those of tasks queued offline
+const (
+  auditUncomplete = "uncomplete"
+  auditMove       = "move"
+  auditClear      = "clear"
+  auditCreateList = "create_list"
+  auditRenameList = "rename_list"
+  auditDeleteList = "delete_list"
+)
+
+// runningCommand is the command line being run, after aliases are
+// expanded, as recorded in the audit log
+var runningCommand string
+
+// auditEntry is a change made to a task or task list, with the task as it
+// was before and after the change. Before is nil for additions and when
+// the task could not be read first, After for deletions
+type auditEntry struct {
+  Time    time.Time `json:"time"`
+  Command string    `json:"command,omitempty"`
+  Backend string    `json:"backend"`
+  Account string    `json:"account"`
+  Op      string    `json:"op"`
+  ListID  string    `json:"listId"`
+  List    string    `json:"list,omitempty"`
+  TaskID  string    `json:"taskId,omitempty"`
+  // Title is the new title of a renamed list
+  Title  string     `json:"title,omitempty"`
+  Before *todo.Task `json:"before,omitempty"`
+  After  *todo.Task `json:"after,omitempty"`
+}
+
+// auditFile returns the path of the audit log, which is shared by all
+// backends and accounts
+func auditFile() (string, error) {
+  dir, err := dataDir("audit")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "log.jsonl"), nil
+}
+
+// auditEnabled reports whether changes are recorded, which audit_log can
+// turn off
+func auditEnabled() bool {
+  c := loadConfig()
+  return c.AuditLog == nil || *c.AuditLog
+}
+
+// auditMu serializes the appends of the goroutines of a process
+var auditMu sync.Mutex
+
+// appendAudit adds e to the end of the audit log, one JSON object per
+// line. With the vault set up, lines are encrypted and base64 encoded
+func appendAudit(e *auditEntry) error {
+  file, err := auditFile()
+  if err != nil {
+    return err
+  }
+  b, err := json.Marshal(e)
+  if err != nil {
+    return err
+  }
+  if b, err = sealAuditLine(b); err != nil {
+    return err
+  }
+  auditMu.Lock()
+  defer auditMu.Unlock()
+  f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+  if err != nil {
+    return err
+  }
+  if _, err := f.Write(append(b, '\n')); err != nil {
+    f.Close()
+    return err
+  }
+  return f.Close()
+}
+
+// sealAuditLine encrypts a line of the audit log if the vault is set up
+func sealAuditLine(b []byte) ([]byte, error) {
+  sealedLine, err := sealPrivate(b)
+  if err != nil || !sealed(sealedLine) {
+    return sealedLine, err
+  }
+  return []byte(base64.StdEncoding.EncodeToString(sealedLine)), nil
+}
+
+// openAuditLine decodes a line of the audit log, decrypting it if needed
+func openAuditLine(line []byte) ([]byte, error) {
+  if bytes.HasPrefix(line, []byte("{")) {
+    return line, nil
+  }
+  b, err := base64.StdEncoding.DecodeString(string(line))
+  if err != nil {
+    return nil, err
+  }
+  return openPrivate(b)
+}
+
+// convertAuditLines applies convert, which changes the encryption of the
+// files holding task data, to each line of the audit log b
+func convertAuditLines(b []byte, convert func(b []byte) ([]byte, bool, error)) ([]byte, bool, error) {
+  var out bytes.Buffer
+  changed := false
+  for _, line := range bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n")) {
+    if len(line) == 0 {
+      continue
+    }
+    plain := line
+    if !bytes.HasPrefix(line, []byte("{")) {
+      var err error
+      if plain, err = base64.StdEncoding.DecodeString(string(line)); err != nil {
+        return nil, false, err
+      }
+    }
+    converted, c, err := convert(plain)
+    if err != nil {
+      return nil, false, err
+    }
+    if c {
+      changed = true
+      if sealed(converted) {
+        converted = []byte(base64.StdEncoding.EncodeToString(converted))
+      }
+      line = converted
+    }
+    out.Write(line)
+    out.WriteByte('\n')
+  }
+  return out.Bytes(), changed, nil
+}
+
+// readAudit returns the entries of the audit log made since since, oldest
+// first. Lines that can not be read, such as those encrypted with a vault
+// that is gone, are counted in skipped
+func readAudit(since time.Time) (entries []*auditEntry, skipped int, err error) {
+  file, err := auditFile()
+  if err != nil {
+    return nil, 0, err
+  }
+  f, err := os.Open(file)
+  if os.IsNotExist(err) {
+    return nil, 0, nil
+  }
+  if err != nil {
+    return nil, 0, err
+  }
+  defer f.Close()
+  scanner := bufio.NewScanner(f)
+  scanner.Buffer(nil, 1<<24)
+  for scanner.Scan() {
+    if len(scanner.Bytes()) == 0 {
+      continue
+    }
+    b, err := openAuditLine(scanner.Bytes())
+    e := &auditEntry{}
+    if err == nil {
+      err = json.Unmarshal(b, e)
+    }
+    if err != nil {
+      skipped++
+      continue
+    }
+    if !e.Time.Before(since) {
+      entries = append(entries, e)
+    }
+  }
+  return entries, skipped, scanner.Err()
+}
+
+// auditedBackend records the changes made through a backend in the audit
+// log. Tasks are read before they are changed, for the log to hold them
+// as they were
+type auditedBackend struct {
+  todo.Backend
+  name    string
+  account string
+  mu      sync.Mutex
+  // titles are those of the task lists seen so far, by id
+  titles map[string]string
+}
+
+// auditedClearer is an auditedBackend for backends that are Clearers
+type auditedClearer struct {
+  *auditedBackend
+  clearer todo.Clearer
+}
+
+// withAudit returns client recording its changes in the audit log, unless
+// audit_log is off
+func withAudit(client todo.Backend, name string) todo.Backend {
+  if !auditEnabled() {
+    return client
+  }
+  a := &auditedBackend{Backend: client, name: name, account: currentAccount(), titles: map[string]string{}}
+  if clearer, ok := client.(todo.Clearer); ok {
+    return &auditedClearer{auditedBackend: a, clearer: clearer}
+  }
+  return a
+}
+
+// remember notes the titles of lists
+func (a *auditedBackend) remember(lists ...*todo.TaskList) {
+  a.mu.Lock()
+  defer a.mu.Unlock()
+  for _, l := range lists {
+    if l != nil {
+      a.titles[l.ID] = l.Title
+    }
+  }
+}
+
+// record completes e, a change to a task or a task list, and appends it to
+// the audit log, warning on failure since the change itself was made
+func (a *auditedBackend) record(e *auditEntry) {
+  a.mu.Lock()
+  e.List = a.titles[e.ListID]
+  a.mu.Unlock()
+  e.Time, e.Command, e.Backend, e.Account = time.Now(), runningCommand, a.name, a.account
+  if err := appendAudit(e); err != nil {
+    warnf("Unable to write the audit log: %v", err)
+  }
+}
+
+// before returns the task as it is before a change, nil if it can not be
+// read
+func (a *auditedBackend) before(ctx context.Context, listID string, id string) *todo.Task {
+  task, err := a.Backend.Get(ctx, listID, id)
+  if err != nil {
+    verbosef("Unable to read task %s for the audit log: %v", id, err)
+    return nil
+  }
+  return task
+}
+
+func (a *auditedBackend) Lists(ctx context.Context) ([]*todo.TaskList, error) {
+  lists, err := a.Backend.Lists(ctx)
+  a.remember(lists...)
+  return lists, err
+}
+
+func (a *auditedBackend) FindList(ctx context.Context, title string) (*todo.TaskList, error) {
+  list, err := a.Backend.FindList(ctx, title)
+  if err == nil {
+    a.remember(list)
+  }
+  return list, err
+}
+
+func (a *auditedBackend) CreateList(ctx context.Context, title string) (*todo.TaskList, error) {
+  list, err := a.Backend.CreateList(ctx, title)
+  if err == nil {
+    a.remember(list)
+    a.record(&auditEntry{Op: auditCreateList, ListID: list.ID})
+  }
+  return list, err
+}
+
+func (a *auditedBackend) RenameList(ctx context.Context, listID string, title string) (*todo.TaskList, error) {
+  list, err := a.Backend.RenameList(ctx, listID, title)
+  if err == nil {
+    a.record(&auditEntry{Op: auditRenameList, ListID: listID, Title: list.Title})
+    a.remember(list)
+  }
+  return list, err
+}
+
+func (a *auditedBackend) DeleteList(ctx context.Context, listID string) error {
+  err := a.Backend.DeleteList(ctx, listID)
+  if err == nil {
+    a.record(&auditEntry{Op: auditDeleteList, ListID: listID})
+  }
+  return err
+}
+
+func (a *auditedBackend) Add(ctx context.Context, listID string, task *todo.Task) (*todo.Task, error) {
+  added, err := a.Backend.Add(ctx, listID, task)
+  if err == nil {
+    a.record(&auditEntry{Op: opAdd, ListID: listID, TaskID: added.ID, After: added})
+  }
+  return added, err
+}
+
+func (a *auditedBackend) Complete(ctx context.Context, listID string, id string) (*todo.Task, error) {
+  before := a.before(ctx, listID, id)
+  task, err := a.Backend.Complete(ctx, listID, id)
+  if err == nil {
+    a.record(&auditEntry{Op: opComplete, ListID: listID, TaskID: id, Before: before, After: task})
+  }
+  return task, err
+}
+
+func (a *auditedBackend) Uncomplete(ctx context.Context, listID string, id string) (*todo.Task, error) {
+  before := a.before(ctx, listID, id)
+  task, err := a.Backend.Uncomplete(ctx, listID, id)
+  if err == nil {
+    a.record(&auditEntry{Op: auditUncomplete, ListID: listID, TaskID: id, Before: before, After: task})
+  }
+  return task, err
+}
+
+func (a *auditedBackend) Delete(ctx context.Context, listID string, id string) error {
+  before := a.before(ctx, listID, id)
+  err := a.Backend.Delete(ctx, listID, id)
+  if err == nil {
+    a.record(&auditEntry{Op: opDelete, ListID: listID, TaskID: id, Before: before})
+  }
+  return err
+}
+
+func (a *auditedBackend) Update(ctx context.Context, listID string, id string, patch *todo.Patch) (*todo.Task, error) {
+  before := a.before(ctx, listID, id)
+  task, err := a.Backend.Update(ctx, listID, id, patch)
+  if err == nil {
+    a.record(&auditEntry{Op: opEdit, ListID: listID, TaskID: id, Before: before, After: task})
+  }
+  return task, err
+}
+
+func (a *auditedBackend) Move(ctx context.Context, listID string, id string, dest todo.Destination) (*todo.Task, error) {
+  before := a.before(ctx, listID, id)
+  task, err := a.Backend.Move(ctx, listID, id, dest)
+  if err == nil {
+    to := listID
+    if dest.ListID != "" {
+      to = dest.ListID
+    }
+    a.record(&auditEntry{Op: auditMove, ListID: to, TaskID: id, Before: before, After: task})
+  }
+  return task, err
+}
+
+func (a *auditedClearer) Clear(ctx context.Context, listID string) error {
+  err := a.clearer.Clear(ctx, listID)
+  if err == nil {
+    a.record(&auditEntry{Op: auditClear, ListID: listID})
+  }
+  return err
+}
+
+// auditVerbs describe the operations of the audit log
+var auditVerbs = map[string]string{
+  opAdd:           "added",
+  opComplete:      "completed",
+  auditUncomplete: "reopened",
+  opDelete:        "deleted",
+  opEdit:          "edited",
+  auditMove:       "moved",
+  auditClear:      "cleared",
+  auditCreateList: "created list",
+  auditRenameList: "renamed list",
+  auditDeleteList: "deleted list",
+}
+
+// auditChanges describes what an edit changed of a task
+func auditChanges(before, after *todo.Task) []string {
+  if before == nil || after == nil {
+    return nil
+  }
+  date := func(t time.Time) string {
+    if t.IsZero() {
+      return "none"
+    }
+    return formatDate(t)
+  }
+  var changes []string
+  if before.Title != after.Title {
+    changes = append(changes, fmt.Sprintf("title '%s' → '%s'", before.Title, after.Title))
+  }
+  if before.Notes != after.Notes {
+    changes = append(changes, "notes")
+  }
+  if !before.Due.Equal(after.Due) {
+    changes = append(changes, fmt.Sprintf("due %s → %s", date(before.Due), date(after.Due)))
+  }
+  if before.Priority != after.Priority {
+    changes = append(changes, fmt.Sprintf("priority %s → %s", before.Priority, after.Priority))
+  }
+  for _, tag := range after.Tags {
+    if !containsFold(before.Tags, tag) {
+      changes = append(changes, "+"+tag)
+    }
+  }
+  for _, tag := range before.Tags {
+    if !containsFold(after.Tags, tag) {
+      changes = append(changes, "-"+tag)
+    }
+  }
+  every := func(r *todo.Recurrence) string {
+    if r == nil {
+      return ""
+    }
+    return r.String()
+  }
+  if every(before.Every) != every(after.Every) {
+    changes = append(changes, "recurrence")
+  }
+  if before.Remind != after.Remind {
+    changes = append(changes, "reminder")
+  }
+  if !before.Snooze.Equal(after.Snooze) {
+    changes = append(changes, fmt.Sprintf("snoozed until %s", date(after.Snooze)))
+  }
+  if strings.Join(before.BlockedBy, ",") != strings.Join(after.BlockedBy, ",") {
+    changes = append(changes, "blocked by")
+  }
+  if before.Starred != after.Starred {
+    changes = append(changes, map[bool]string{true: "starred", false: "unstarred"}[after.Starred])
+  }
+  return changes
+}
+
+// describe returns a line describing the change of e
+func (e *auditEntry) describe() string {
+  list := e.List
+  if list == "" {
+    list = e.ListID
+  }
+  task := e.After
+  if task == nil {
+    task = e.Before
+  }
+  verb := auditVerbs[e.Op]
+  if verb == "" {
+    verb = e.Op
+  }
+  var line string
+  switch {
+  case e.Op == auditRenameList:
+    line = fmt.Sprintf("%s %s to %s", verb, list, e.Title)
+  case e.TaskID == "":
+    line = fmt.Sprintf("%s %s", verb, list)
+  case task == nil:
+    line = fmt.Sprintf("%s task %s in %s", verb, e.TaskID, list)
+  case e.Op == auditMove:
+    line = fmt.Sprintf("%s '%s' to %s", verb, task.Title, list)
+  default:
+    line = fmt.Sprintf("%s '%s' in %s", verb, task.Title, list)
+  }
+  if e.Op == opEdit {
+    if changes := auditChanges(e.Before, e.After); len(changes) > 0 {
+      line += ": " + strings.Join(changes, ", ")
+    }
+  }
+  return line
+}
+
+// showAudit prints the changes of the audit log made since since, to
+// tasks with the given id or title if task is set, of the current backend
+// and account unless all is set. At most limit changes are shown, the
+// most recent ones, unless it is zero
+func showAudit(since time.Time, task string, all bool, limit int) error {
+  entries, skipped, err := readAudit(since)
+  if err != nil {
+    return fmt.Errorf("Unable to read the audit log: %w", err)
+  }
+  var shown []*auditEntry
+  for _, e := range entries {
+    if !all && (e.Backend != currentBackend() || e.Account != currentAccount()) {
+      continue
+    }
+    if task != "" && e.TaskID != task && !auditTitleMatches(e, task) {
+      continue
+    }
+    shown = append(shown, e)
+  }
+  if limit > 0 && len(shown) > limit {
+    shown = shown[len(shown)-limit:]
+  }
+  if skipped > 0 {
+    warnf("Skipped %s of the audit log that could not be read", plural(skipped, "line"))
+  }
+  if loadConfig().Output == outputJSON {
+    if shown == nil {
+      shown = []*auditEntry{}
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(shown)
+  }
+  if len(shown) == 0 {
+    fmt.Printf("No changes since %s\n", formatDate(since))
+    return nil
+  }
+  for _, e := range shown {
+    when := e.Time.Local()
+    line := fmt.Sprintf("%s %s  %s", formatDate(when), when.Format("15:04"), e.describe())
+    if all {
+      line += colorize("2", fmt.Sprintf("  %s/%s", e.Backend, e.Account))
+    }
+    if e.Command != "" {
+      line += colorize("2", "  todo "+e.Command)
+    }
+    fmt.Println(line)
+  }
+  return nil
+}
+
+// auditTitleMatches reports whether the task of e had a title containing
+// s, ignoring case
+func auditTitleMatches(e *auditEntry, s string) bool {
+  s = strings.ToLower(s)
+  for _, t := range []*todo.Task{e.Before, e.After} {
+    if t != nil && strings.Contains(strings.ToLower(t.Title), s) {
+      return true
+    }
+  }
+  return false
+}
+
+func init() {
+  register(&command{
+    name:    "log",
+    usage:   "log [--since 7d|date] [--task id|title] [--all] [--limit n]",
+    summary: "Show the changes made to tasks and task lists, from the audit log",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      sinceFlag := fs.String("since", "7d", "how far back to look, e.g. 7d, 2w, 12h or a date")
+      task := fs.String("task", "", "only changes of the task with this id, or a title containing this")
+      all := fs.Bool("all", false, "changes of all backends and accounts, not only the current one")
+      limit := fs.Int("limit", 0, "show only the last n changes")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help log'", args[0])
+      }
+      since, err := parseSince(*sinceFlag, time.Now())
+      if err != nil {
+        return invalidf("Invalid --since: %v", err)
+      }
+      return showAudit(since, *task, *all, *limit)
+    },
+  })
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+  "crypto/rand"
+  "encoding/base64"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "net/url"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "runtime"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+  "golang.org/x/oauth2"
+  "golang.org/x/oauth2/google"
+  "golang.org/x/term"
+)
+
+// authTimeout is how long the loopback flow waits for the user to approve
+// access in the browser
+const authTimeout = 5 * time.Minute
+
+// getClient uses a Context and Config to retrieve a Token
+// then generate a Client. It returns the generated Client.
+func getClient(ctx context.Context, config *oauth2.Config) (*http.Client, error) {
+  tok, err := loadToken()
+  if err == nil {
+    // an expired token is refreshed now rather than by the first request,
+    // so that a revoked refresh token leads to signing in again. ctx
+    // outlives the command, which may be interrupted meanwhile
+    var fresh *oauth2.Token
+    if fresh, err = config.TokenSource(cmdCtx, tok).Token(); err == nil {
+      tok = fresh
+    }
+    if !isInvalidGrant(err) {
+      return config.Client(ctx, tok), nil
+    }
+    if err := deleteToken(); err != nil {
+      return nil, err
+    }
+    if !term.IsTerminal(int(os.Stdin.Fd())) {
+      return nil, authError(fmt.Errorf("The authorization of account '%s' was revoked or has expired", currentAccount()))
+    }
+    fmt.Printf("The authorization of account '%s' was revoked or has expired, sign in again\n", currentAccount())
+  }
+  if err != nil {
+    if tok, err = getTokenFromWeb(config, false); err != nil {
+      return nil, err
+    }
+    if err := storeToken(tok); err != nil {
+      return nil, err
+    }
+  }
+  return config.Client(ctx, tok), nil
+}
+
+// googleHTTPClient returns an HTTP client authorized to use Google Tasks.
+// For servers and CI, where nobody can approve access in a browser, it
+// authenticates with the service account key configured with
+// service_account, impersonating the user set with impersonate, or with
+// the refresh token set with refresh_token. Otherwise it uses the cached
+// token of the current account, authorizing todo if there is none
+func googleHTTPClient(ctx context.Context) (*http.Client, error) {
+  c := loadConfig()
+  if c.ServiceAccount != "" {
+    b, err := ioutil.ReadFile(c.ServiceAccount)
+    if err != nil {
+      return nil, authError(fmt.Errorf("Unable to read service account key: %w", err))
+    }
+    jwt, err := google.JWTConfigFromJSON(b, todo.Scope)
+    if err != nil {
+      return nil, authError(fmt.Errorf("Unable to parse service account key: %w", err))
+    }
+    jwt.Subject = c.Impersonate
+    return jwt.Client(ctx), nil
+  }
+
+  config, err := getConfig()
+  if err != nil {
+    return nil, err
+  }
+  if c.RefreshToken != "" {
+    return config.Client(ctx, &oauth2.Token{RefreshToken: c.RefreshToken}), nil
+  }
+  return getClient(ctx, config)
+}
+
+// getTokenFromWeb uses Config to request a Token through the loopback
+// redirect flow: a temporary HTTP server on localhost receives the
+// authorization code once the user approves access in the browser. With
+// noBrowser set, or when todo is unable to open a browser, the user is
+// asked to paste the address they were redirected to instead.
+// It returns the retrieved Token.
+func getTokenFromWeb(config *oauth2.Config, noBrowser bool) (*oauth2.Token, error) {
+  listener, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    return nil, authError(fmt.Errorf("Unable to start local authorization server: %w", err))
+  }
+  defer listener.Close()
+
+  c := *config
+  c.RedirectURL = fmt.Sprintf("http://%s/", listener.Addr())
+  state, err := randomState()
+  if err != nil {
+    return nil, err
+  }
+  verifier := oauth2.GenerateVerifier()
+  authURL := c.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+
+  var code string
+  if !noBrowser && openBrowser(authURL) == nil {
+    fmt.Printf("Opened your browser to authorize todo. If it did not open, "+
+      "go to the following link: \n%v\n", authURL)
+    code, err = waitForCode(listener, state)
+  } else {
+    fmt.Printf("Go to the following link in your browser, approve access, then "+
+      "paste the address of the page you are redirected to (it may fail "+
+      "to load): \n%v\n", authURL)
+    code, err = readCode(state)
+  }
+  if err != nil {
+    return nil, authError(err)
+  }
+
+  tok, err := c.Exchange(oauth2.NoContext, code, oauth2.VerifierOption(verifier))
+  if err != nil {
+    return nil, authError(fmt.Errorf("Unable to retrieve token from web %w", err))
+  }
+  return tok, nil
+}
+
+// getTokenFromDevice requests a Token through the device authorization
+// flow, for sessions without a browser such as over SSH: the user enters
+// a short code on a page opened on any other device, while todo polls
+// Google until access is approved.
+// It returns the retrieved Token.
+func getTokenFromDevice(config *oauth2.Config) (*oauth2.Token, error) {
+  c := *config
+  if c.Endpoint.DeviceAuthURL == "" {
+    // client secret files do not carry it
+    c.Endpoint.DeviceAuthURL = google.Endpoint.DeviceAuthURL
+  }
+  ctx := cmdCtx
+  da, err := c.DeviceAuth(ctx)
+  if err != nil {
+    return nil, authError(fmt.Errorf("Unable to start device authorization: %w", err))
+  }
+  uri := da.VerificationURIComplete
+  if uri == "" {
+    uri = da.VerificationURI
+  }
+  fmt.Printf("On any device, go to %s and enter the code %s to authorize todo\n", uri, da.UserCode)
+  if !da.Expiry.IsZero() {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithDeadline(ctx, da.Expiry)
+    defer cancel()
+  }
+  tok, err := c.DeviceAccessToken(ctx, da)
+  if err != nil {
+    return nil, authError(fmt.Errorf("Unable to retrieve token: %w", err))
+  }
+  return tok, nil
+}
+
+// randomState returns an unguessable value for the state parameter of the
+// authorization request
+func randomState() (string, error) {
+  b := make([]byte, 16)
+  if _, err := rand.Read(b); err != nil {
+    return "", err
+  }
+  return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// waitForCode serves the loopback redirect on listener until it receives
+// an authorization code for state, or authTimeout passes
+func waitForCode(listener net.Listener, state string) (string, error) {
+  type result struct {
+    code string
+    err  error
+  }
+  results := make(chan result, 1)
+
+  srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    code, err := codeFromQuery(r.URL.Query(), state)
+    if err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+    } else {
+      fmt.Fprintln(w, "todo is now authorized, you can close this window.")
+    }
+    select {
+    case results <- result{code, err}:
+    default:
+    }
+  })}
+  go srv.Serve(listener)
+  defer srv.Close()
+
+  select {
+  case res := <-results:
+    return res.code, res.err
+  case <-time.After(authTimeout):
+    return "", fmt.Errorf("Timed out waiting for authorization")
+  case <-cmdCtx.Done():
+    return "", cmdCtx.Err()
+  }
+}
+
+// readCode reads the address the browser was redirected to, or just the
+// authorization code, from stdin
+func readCode(state string) (string, error) {
+  var input string
+  if _, err := fmt.Scan(&input); err != nil {
+    return "", fmt.Errorf("Unable to read authorization code %w", err)
+  }
+  if !strings.Contains(input, "?") {
+    return input, nil
+  }
+  u, err := url.Parse(input)
+  if err != nil {
+    return "", fmt.Errorf("Unable to parse redirect address: %w", err)
+  }
+  return codeFromQuery(u.Query(), state)
+}
+
+// codeFromQuery extracts the authorization code from the query of the
+// redirect, checking that it belongs to the request with the given state
+func codeFromQuery(q url.Values, state string) (string, error) {
+  if e := q.Get("error"); e != "" {
+    return "", fmt.Errorf("Authorization denied: %s", e)
+  }
+  if q.Get("state") != state {
+    return "", fmt.Errorf("Authorization response does not match the request")
+  }
+  if q.Get("code") == "" {
+    return "", fmt.Errorf("Authorization response contains no code")
+  }
+  return q.Get("code"), nil
+}
+
+// openBrowser opens u in the user's web browser
+func openBrowser(u string) error {
+  var cmd *exec.Cmd
+  switch runtime.GOOS {
+  case "darwin":
+    cmd = exec.Command("open", u)
+  case "windows":
+    cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+  default:
+    cmd = exec.Command("xdg-open", u)
+  }
+  return cmd.Start()
+}
+
+// tokenFromFile retrieves a Token from a given file path.
+// It returns the retrieved Token and any read error encountered.
+func tokenFromFile(file string) (*oauth2.Token, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return nil, err
+  }
+  t := &oauth2.Token{}
+  err = json.NewDecoder(f).Decode(t)
+  defer f.Close()
+  return t, err
+}
+
+// saveToken uses a file path to create a file and store the
+// token in it.
+func saveToken(file string, token *oauth2.Token) error {
+  infof("Saving credential file to: %s", file)
+  f, err := os.Create(file)
+  if err != nil {
+    return fmt.Errorf("Unable to cache oauth token: %w", err)
+  }
+  defer f.Close()
+  return json.NewEncoder(f).Encode(token)
+}
+
+// clientSecretFlag is the client secret file given with --client-secret
+var clientSecretFlag string
+
+// Credentials of the OAuth client used when there is no client secret
+// file, set when building with
+// -ldflags "-X main.embeddedClientID=<id> -X main.embeddedClientSecret=<secret>"
+var (
+  embeddedClientID     string
+  embeddedClientSecret string
+)
+
+// getConfig reads the OAuth client secret given with --client-secret or
+// configured with client_secret, or else client_secret.json in the config
+// directory or next to the binary, falling back to the credentials built
+// into it.
+// It returns the parsed Config.
+func getConfig() (*oauth2.Config, error) {
+  file := clientSecretFlag
+  if file == "" {
+    file = loadConfig().ClientSecret
+  }
+  if dir, err := configDir(); file == "" && err == nil {
+    if _, err := os.Stat(filepath.Join(dir, "client_secret.json")); err == nil {
+      file = filepath.Join(dir, "client_secret.json")
+    }
+  }
+  if file == "" {
+    dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+    if err != nil {
+      return nil, fmt.Errorf("Unable to find client secret file: %w", err)
+    }
+    file = filepath.Join(dir, "client_secret.json")
+    if _, err := os.Stat(file); os.IsNotExist(err) && embeddedClientID != "" {
+      return &oauth2.Config{
+        ClientID:     embeddedClientID,
+        ClientSecret: embeddedClientSecret,
+        Endpoint:     google.Endpoint,
+        Scopes:       []string{todo.Scope},
+      }, nil
+    }
+  }
+
+  b, err := ioutil.ReadFile(file)
+  if err != nil {
+    return nil, authError(fmt.Errorf("Unable to read client secret file: %w", err))
+  }
+
+  config, err := google.ConfigFromJSON(b, todo.Scope)
+  if err != nil {
+    return nil, authError(fmt.Errorf("Unable to parse client secret file to config: %w", err))
+  }
+  return config, nil
+}
+
+func init() {
+  register(&command{
+    name:  "auth",
+    usage: "auth [login [--no-browser | --device] | logout | status | revoke | list | default <account>]",
+    summary: "Authorize todo with your Google account, sign out, list the accounts " +
+      "todo can act as or pick the default one",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      noBrowser := fs.Bool("no-browser", false, "do not open a browser, paste the redirect address instead")
+      device := fs.Bool("device", false, "authorize by entering a code on another device")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        args = []string{"login"}
+      }
+      if *noBrowser && *device {
+        return invalidf("Give at most one of --no-browser and --device")
+      }
+
+      switch {
+      case args[0] == "login" && len(args) == 1:
+        if c := loadConfig(); c.ServiceAccount != "" || c.RefreshToken != "" {
+          return invalidf("todo authenticates with the configured service_account or refresh_token, unset it to sign in")
+        }
+        config, err := getConfig()
+        if err != nil {
+          return err
+        }
+        var tok *oauth2.Token
+        if *device {
+          tok, err = getTokenFromDevice(config)
+        } else {
+          tok, err = getTokenFromWeb(config, *noBrowser)
+        }
+        if err != nil {
+          return err
+        }
+        if err := storeToken(tok); err != nil {
+          return err
+        }
+        infof("Account '%s' is authorized", currentAccount())
+      case args[0] == "logout" && len(args) == 1:
+        return logout()
+      case args[0] == "status" && len(args) == 1:
+        return showAuthStatus(cmdCtx)
+      case args[0] == "revoke" && len(args) == 1:
+        return revokeToken(cmdCtx)
+      case args[0] == "list" && len(args) == 1:
+        return listAccounts()
+      case args[0] == "default" && len(args) == 2:
+        c, err := loadConfigFile()
+        if err != nil {
+          return err
+        }
+        c.DefaultAccount = args[1]
+        if err := c.save(); err != nil {
+          return fmt.Errorf("Unable to save config file: %w", err)
+        }
+        infof("Default account set to %s", args[1])
+      default:
+        return invalidf("Unknown auth command '%s', see 'todo help auth'", strings.Join(args, " "))
+      }
+      return nil
+    },
+  })
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+  "fmt"
+  "net/http"
+  "net/url"
+  "path/filepath"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// Backends todo can keep tasks in
+const (
+  backendGoogle  = "google"
+  backendLocal   = "local"
+  backendTodoist = "todoist"
+  backendCalDAV  = "caldav"
+)
+
+// backendNames lists the backends for messages about unknown ones
+const backendNames = "google, local, todoist or caldav"
+
+// backendFlag is the backend named with --backend
+var backendFlag string
+
+// tokenFlag is the Todoist API token given with --token
+var tokenFlag string
+
+// currentBackend returns the name of the backend commands operate on
+func currentBackend() string {
+  if backendFlag != "" {
+    return backendFlag
+  }
+  if name := loadConfig().Backend; name != "" {
+    return name
+  }
+  return backendGoogle
+}
+
+// stateName names the local state, such as the cache and the journal, of
+// the current backend and account. Google Tasks accounts use their plain
+// name for compatibility with earlier versions
+func stateName() string {
+  if b := currentBackend(); b != backendGoogle {
+    return url.QueryEscape(b + "-" + currentAccount())
+  }
+  return url.QueryEscape(currentAccount())
+}
+
+// localFile returns the path of the file of the local backend
+func localFile() (string, error) {
+  if file := loadConfig().LocalFile; file != "" {
+    return file, nil
+  }
+  dir, err := dataDir("local")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, url.QueryEscape(currentAccount())+".json"), nil
+}
+
+// newClient returns the current backend, authenticating with Google for
+// Google Tasks. Requests to remote backends failing with 429 or 5xx are
+// retried up to max_attempts times unless --no-retry is given
+func newClient() (todo.Backend, error) {
+  key := currentBackend() + "/" + currentAccount()
+  if client, ok := replClients[key]; ok {
+    return client, nil
+  }
+  client, err := newBackend(currentBackend())
+  if err == nil && replClients != nil {
+    replClients[key] = client
+  }
+  return client, err
+}
+
+// newBackend returns the backend with the given name, for the current
+// account, recording the changes made through it in the audit log
+func newBackend(name string) (todo.Backend, error) {
+  client, err := openBackend(name)
+  if err != nil {
+    return nil, err
+  }
+  return withAudit(client, name), nil
+}
+
+// openBackend returns the backend with the given name, for the current
+// account
+func openBackend(name string) (todo.Backend, error) {
+  switch name {
+  case backendGoogle:
+    return newGoogleClient()
+  case backendLocal:
+    file, err := localFile()
+    if err != nil {
+      return nil, err
+    }
+    if isBucketURL(file) {
+      obj, err := newS3Object(file)
+      if err != nil {
+        return nil, invalidf("Invalid local_file: %v", err)
+      }
+      return todo.NewStoredLocal(obj, &bucketSealer{}), nil
+    }
+    return todo.NewSealedLocal(file, privateSealer{}), nil
+  case backendTodoist:
+    return newTodoistClient()
+  case backendCalDAV:
+    return newCalDAVClient()
+  }
+  return nil, invalidf("Unknown backend '%s', expected %s", name, backendNames)
+}
+
+// newTodoistClient returns a Todoist backend authenticating with the token
+// given with --token or todoist_token
+func newTodoistClient() (*todo.Todoist, error) {
+  token := tokenFlag
+  if token == "" {
+    token = loadConfig().TodoistToken
+  }
+  if token == "" {
+    return nil, authError(fmt.Errorf("The todoist backend needs an API token, pass --token or set todoist_token"))
+  }
+  return todo.NewTodoist(token, &http.Client{Transport: retryTransport(http.DefaultTransport)}), nil
+}
+
+// newCalDAVClient returns a CalDAV backend for the server configured with
+// caldav_url, caldav_username and caldav_password
+func newCalDAVClient() (*todo.CalDAV, error) {
+  c := loadConfig()
+  if c.CalDAVURL == "" {
+    return nil, invalidf("The caldav backend needs the address of your calendars, set caldav_url")
+  }
+  client, err := todo.NewCalDAV(c.CalDAVURL, c.CalDAVUsername, c.CalDAVPassword,
+    &http.Client{Transport: retryTransport(http.DefaultTransport)})
+  if err != nil {
+    return nil, invalidf("%v", err)
+  }
+  return client, nil
+}
+
+// retryTransport wraps base to retry failed requests as configured,
+// sending no more than max_qps per second and logging each attempt with
+// --verbose
+func retryTransport(base http.RoundTripper) *todo.RetryTransport {
+  retry := &todo.RetryTransport{
+    Base:        &todo.RateLimitTransport{Base: &logTransport{base: base}, QPS: loadConfig().MaxQPS},
+    MaxAttempts: loadConfig().MaxAttempts,
+    OnRetry: func(req *http.Request, status int, wait time.Duration) {
+      verbosef("Retrying %s %s after status %d in %s", req.Method, req.URL.Redacted(), status, wait)
+    },
+  }
+  if noRetryFlag {
+    retry.MaxAttempts = 1
+  }
+  return retry
+}
+
+// newGoogleClient authenticates with Google.
+// It returns the todo Client.
+func newGoogleClient() (*todo.Client, error) {
+  // not the command's context: the REPL keeps clients across commands
+  ctx := context.Background()
+  httpClient, err := googleHTTPClient(ctx)
+  if err != nil {
+    return nil, err
+  }
+  httpClient.Transport = &etagTransport{base: retryTransport(httpClient.Transport)}
+  return todo.NewClient(ctx, httpClient)
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// backupVersion is the version of the format of backups, checked before
+// restoring one
+const backupVersion = 1
+
+// backup is a snapshot of all task lists of an account, as written by
+// 'todo backup create'
+type backup struct {
+  Version int          `json:"version"`
+  Created time.Time    `json:"created"`
+  Backend string       `json:"backend"`
+  Account string       `json:"account,omitempty"`
+  Lists   []backupList `json:"lists"`
+}
+
+// backupList is a task list in a backup. Tasks holds its open tasks in
+// list order followed by its completed ones, hidden ones included, with
+// all their fields and metadata
+type backupList struct {
+  ID    string       `json:"id"`
+  Title string       `json:"title"`
+  Tasks []*todo.Task `json:"tasks"`
+}
+
+// snapshot returns a backup of all task lists of client and their tasks,
+// completed and hidden ones included
+func snapshot(client todo.Backend) (*backup, error) {
+  lists, err := client.Lists(cmdCtx)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve task lists. %w", err)
+  }
+  results, err := fetchLists(cmdCtx, lists, func(ctx context.Context, list *todo.TaskList) ([]*todo.Task, error) {
+    open, err := client.List(ctx, list.ID)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to retrieve tasks of %s: %w", list.Title, err)
+    }
+    done, err := client.Completed(ctx, list.ID, time.Time{}, time.Time{})
+    if err != nil {
+      return nil, fmt.Errorf("Unable to retrieve completed tasks of %s: %w", list.Title, err)
+    }
+    return append(open, done...), nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  b := &backup{Version: backupVersion, Created: time.Now().UTC(), Backend: currentBackend(), Account: currentAccount()}
+  for i, list := range lists {
+    b.Lists = append(b.Lists, backupList{ID: list.ID, Title: list.Title, Tasks: results[i]})
+  }
+  return b, nil
+}
+
+// encode returns b as indented JSON
+func (b *backup) encode() ([]byte, error) {
+  data, err := json.MarshalIndent(b, "", "  ")
+  if err != nil {
+    return nil, err
+  }
+  return append(data, '\n'), nil
+}
+
+// describe sums up what b holds, as in "3 lists with 40 tasks (12 completed)"
+func (b *backup) describe() string {
+  tasks, done := 0, 0
+  for _, list := range b.Lists {
+    for _, task := range list.Tasks {
+      tasks++
+      if task.Done() {
+        done++
+      }
+    }
+  }
+  return fmt.Sprintf("%s with %s (%d completed)", plural(len(b.Lists), "list"), plural(tasks, "task"), done)
+}
+
+// Writes a backup of all task lists and their tasks, completed and hidden
+// ones included, to the file named path, or to stdout if it is "-". The
+// backup is plain JSON unless encrypt is set, then it is encrypted by the
+// vault and restores anywhere with its passphrase
+func createBackup(path string, encrypt bool) error {
+  client, err := newClient()
+  if err != nil {
+    return err
+  }
+  b, err := snapshot(client)
+  if err != nil {
+    return err
+  }
+  data, err := b.encode()
+  if err != nil {
+    return err
+  }
+  if encrypt {
+    v, err := currentVault()
+    if err != nil {
+      return err
+    }
+    if v == nil {
+      return invalidf("The vault is not set up, 'todo vault lock' sets it up to encrypt backups")
+    }
+    if data, err = v.seal(data); err != nil {
+      return err
+    }
+  }
+  if path == "-" {
+    _, err = os.Stdout.Write(data)
+    return err
+  }
+  tmp := path + ".tmp"
+  if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+    err = os.Rename(tmp, path)
+  }
+  if err != nil {
+    return fmt.Errorf("Unable to write %s: %w", path, err)
+  }
+  infof("Backed up %s to %s", b.describe(), path)
+  return nil
+}
+
+// readBackup reads the backup in r, failing on backups of later versions
+func readBackup(r io.Reader) (*backup, error) {
+  var b backup
+  if err := json.NewDecoder(r).Decode(&b); err != nil {
+    return nil, invalidf("Unable to read the backup: %v", err)
+  }
+  if b.Version < 1 || b.Version > backupVersion {
+    return nil, invalidf("Unsupported backup version %d, expected %d", b.Version, backupVersion)
+  }
+  return &b, nil
+}
+
+// Recreates the task lists of backup b and their tasks, creating the lists
+// that do not exist. Tasks already in a list, with the same title and
+// completion, are skipped, so restoring twice does not duplicate tasks.
+// Restored tasks get new ids; hidden tasks are restored completed but not
+// hidden. Only the lists named in only are restored if any are. The lists
+// and their tasks are counted first and nothing is restored until
+// confirmed, unless force is set
+func restoreBackup(b *backup, only []string, force bool) error {
+  lists := b.Lists
+  if len(only) > 0 {
+    lists = nil
+    for _, name := range only {
+      list, ok := backupListNamed(b, name)
+      if !ok {
+        return notFoundf("No list named '%s' in the backup", name)
+      }
+      lists = append(lists, list)
+    }
+  }
+  if len(lists) == 0 {
+    infof("The backup holds no lists")
+    return nil
+  }
+
+  if !force {
+    total := 0
+    for _, list := range lists {
+      fmt.Printf("  %s: %s\n", list.Title, plural(len(list.Tasks), "task"))
+      total += len(list.Tasks)
+    }
+    if !confirmf("Restore %s and %s from the %s backup of %s?", plural(len(lists), "list"), plural(total, "task"),
+      b.Backend, formatDate(b.Created.Local())) {
+      return nil
+    }
+  }
+
+  client, err := newClient()
+  if err != nil {
+    return err
+  }
+  restored, skipped := 0, 0
+  for _, list := range lists {
+    r, s, err := restoreList(client, list)
+    restored, skipped = restored+r, skipped+s
+    if err != nil {
+      return fmt.Errorf("%w, %d tasks restored so far", err, restored)
+    }
+  }
+  infof("%s restored, %d skipped as already there", plural(restored, "task"), skipped)
+  return nil
+}
+
+// backupListNamed returns the list of b with the given name, ignoring case
+// if no list has exactly that name
+func backupListNamed(b *backup, name string) (backupList, bool) {
+  for _, list := range b.Lists {
+    if list.Title == name {
+      return list, true
+    }
+  }
+  for _, list := range b.Lists {
+    if strings.EqualFold(list.Title, name) {
+      return list, true
+    }
+  }
+  return backupList{}, false
+}
+
+// restoreList restores the tasks of list, parents before their subtasks,
+// and then which tasks block which. It returns the number of tasks
+// restored and skipped
+func restoreList(client todo.Backend, list backupList) (int, int, error) {
+  s := &session{ctx: cmdCtx, client: client, listName: list.Title, cache: loadCache(list.Title)}
+  var err error
+  if s.todoId, err = getTodoId(s.ctx, s.client, list.Title, true); err != nil {
+    return 0, 0, fmt.Errorf("Unable to retrieve task list '%s': %w", list.Title, err)
+  }
+  open, err := s.client.List(s.ctx, s.todoId)
+  if err != nil {
+    return 0, 0, fmt.Errorf("Unable to retrieve tasks of %s: %w", list.Title, err)
+  }
+  done, err := s.client.Completed(s.ctx, s.todoId, time.Time{}, time.Time{})
+  if err != nil {
+    return 0, 0, fmt.Errorf("Unable to retrieve completed tasks of %s: %w", list.Title, err)
+  }
+  // ids maps the ids of tasks in the backup to those of the restored
+  // tasks, or of the tasks found in the list already
+  ids := map[string]string{}
+  existing := map[string]string{}
+  for _, task := range append(open, done...) {
+    existing[restoreKey(task)] = task.ID
+  }
+
+  inBackup := map[string]bool{}
+  for _, task := range list.Tasks {
+    inBackup[task.ID] = true
+  }
+  restored, skipped := 0, 0
+  pending := list.Tasks
+  for len(pending) > 0 {
+    var later []*todo.Task
+    for _, task := range pending {
+      if task.Parent != "" && inBackup[task.Parent] && ids[task.Parent] == "" {
+        // its parent is restored first
+        later = append(later, task)
+        continue
+      }
+      if id, ok := existing[restoreKey(task)]; ok {
+        ids[task.ID] = id
+        skipped++
+        continue
+      }
+      c := *task
+      c.ID, c.Position, c.Etag, c.Parent, c.BlockedBy = "", "", "", ids[task.Parent], nil
+      var added *todo.Task
+      if task.Done() {
+        // completed tasks are left out of the cache of open ones
+        if added, err = s.client.Add(s.ctx, s.todoId, &c); err == nil && !added.Done() {
+          added, err = s.client.Complete(s.ctx, s.todoId, added.ID)
+        }
+      } else {
+        added, err = s.insert(&c)
+      }
+      if err != nil {
+        return restored, skipped, fmt.Errorf("Unable to restore task '%s' of %s: %w", task.Title, list.Title, err)
+      }
+      ids[task.ID] = added.ID
+      restored++
+    }
+    if len(later) == len(pending) {
+      // a cycle of parents, left restored as top level tasks
+      for _, task := range later {
+        task.Parent = ""
+      }
+    }
+    pending = later
+  }
+
+  for _, task := range list.Tasks {
+    var blockers []string
+    for _, id := range task.BlockedBy {
+      if ids[id] != "" {
+        blockers = append(blockers, ids[id])
+      }
+    }
+    if len(blockers) == 0 || ids[task.ID] == "" {
+      continue
+    }
+    if _, err := s.client.Update(s.ctx, s.todoId, ids[task.ID], &todo.Patch{BlockedBy: &blockers}); err != nil {
+      return restored, skipped, fmt.Errorf("Unable to restore what blocks '%s': %w", task.Title, err)
+    }
+  }
+  infof("Restored %s to your %s list", plural(restored, "task"), list.Title)
+  return restored, skipped, nil
+}
+
+// restoreKey identifies task within a list when restoring a backup, by
+// its title and whether it is completed
+func restoreKey(task *todo.Task) string {
+  return fmt.Sprintf("%t/%s", task.Done(), strings.ToLower(task.Title))
+}
+
+// openBackup opens the backup arg names: a file, a scheduled backup in
+// the configured store, or stdin if it is "-"
+func openBackup(arg string) (*backup, error) {
+  if arg == "-" {
+    data, err := ioutil.ReadAll(os.Stdin)
+    if err != nil {
+      return nil, invalidf("Unable to read the backup: %v", err)
+    }
+    if data, err = openPrivate(data); err != nil {
+      return nil, fmt.Errorf("Unable to decrypt the backup: %w", err)
+    }
+    return readBackup(bytes.NewReader(data))
+  }
+  data, err := readPrivate(arg)
+  if err == nil {
+    return readBackup(bytes.NewReader(data))
+  }
+  if !os.IsNotExist(err) || strings.ContainsRune(arg, os.PathSeparator) {
+    return nil, invalidf("Unable to open %s: %v", arg, err)
+  }
+  store, serr := openBackupStore()
+  if serr != nil {
+    return nil, invalidf("Unable to open %s: %v", arg, err)
+  }
+  data, serr = store.get(arg)
+  if serr != nil {
+    return nil, invalidf("Unable to open %s, nor find it in %s: %v", arg, store, serr)
+  }
+  if data, serr = openPrivate(data); serr != nil {
+    return nil, fmt.Errorf("Unable to decrypt %s: %w", arg, serr)
+  }
+  return readBackup(bytes.NewReader(data))
+}
+
+func init() {
+  register(&command{
+    name: "backup",
+    usage: "backup create [--encrypt] [file|-] | backup run [--if-due] | backup list | backup --auto hourly|daily|weekly|off [--keep 14] | " +
+      "backup restore [--lists a,b] [--force] <file|name|->",
+    summary: "Back up all task lists and tasks, completed and hidden ones included, on a schedule or not, or restore such a backup",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      only := fs.String("lists", "", "comma separated lists to restore, all of them if empty")
+      force := fs.Bool("force", false, "restore without asking for confirmation")
+      auto := fs.String("auto", "", "schedule backups, taken by 'todo daemon' or 'todo backup run --if-due': hourly, daily, weekly, a duration or off")
+      keep := fs.Int("keep", 0, "how many scheduled backups to keep, see backup_keep")
+      encrypt := fs.Bool("encrypt", false, "encrypt the backup with the vault, see 'todo vault'")
+      ifDue := fs.Bool("if-due", false, "back up only if the last scheduled backup is older than backup_auto, for cron")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      switch {
+      case *auto != "" || *keep != 0:
+        if len(args) > 0 {
+          return invalidf("--auto and --keep take no command, see 'todo help backup'")
+        }
+        return scheduleBackups(*auto, *keep)
+      case len(args) == 0:
+        return invalidf("Expected create, run, list or restore, see 'todo help backup'")
+      case len(args) == 1 && args[0] == "create":
+        return createBackup(fmt.Sprintf("todo-backup-%s.json", time.Now().Format(defaultDateFormat)), *encrypt)
+      case len(args) == 2 && args[0] == "create":
+        return createBackup(args[1], *encrypt)
+      case len(args) == 1 && args[0] == "run":
+        _, err := runScheduledBackup(*ifDue)
+        return err
+      case len(args) == 1 && args[0] == "list":
+        return listScheduledBackups()
+      case len(args) == 2 && args[0] == "restore":
+        var names []string
+        for _, name := range strings.Split(*only, ",") {
+          if name = strings.TrimSpace(name); name != "" {
+            names = append(names, name)
+          }
+        }
+        if args[1] == "-" && !*force {
+          return invalidf("Restoring from stdin leaves no way to confirm, add --force")
+        }
+        b, err := openBackup(args[1])
+        if err != nil {
+          return err
+        }
+        return restoreBackup(b, names, *force)
+      case len(args) > 0 && args[0] == "restore":
+        return invalidf("Give the backup file to restore, see 'todo help backup'")
+      }
+      return invalidf("Unknown backup command '%s', see 'todo help backup'", strings.Join(args, " "))
+    },
+  })
+}
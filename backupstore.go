@@ -0,0 +1,338 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "regexp"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// defaultBackupKeep is how many scheduled backups are kept unless
+// backup_keep says otherwise
+const defaultBackupKeep = 14
+
+// backupTimeLayout stamps the names of scheduled backups, which sort in
+// the order they were taken
+const backupTimeLayout = "20060102T150405Z"
+
+// backupStore is where scheduled backups are kept, by name
+type backupStore interface {
+  // list returns the names of the backups whose name starts with prefix
+  list(prefix string) ([]string, error)
+  get(name string) ([]byte, error)
+  put(name string, data []byte) error
+  remove(name string) error
+  // String describes the store in messages
+  String() string
+}
+
+// parseBackupInterval parses backup_auto
+func parseBackupInterval(value string) (time.Duration, error) {
+  switch strings.ToLower(value) {
+  case "hourly":
+    return time.Hour, nil
+  case "daily":
+    return 24 * time.Hour, nil
+  case "weekly":
+    return 7 * 24 * time.Hour, nil
+  }
+  d, err := time.ParseDuration(value)
+  if err != nil || d < time.Minute {
+    return 0, fmt.Errorf("backup_auto must be hourly, daily, weekly or a duration of a minute or more, e.g. 12h")
+  }
+  return d, nil
+}
+
+// unsafeName matches the characters left out of the names of backups
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9@._-]+`)
+
+// backupPrefix starts the names of the scheduled backups of the current
+// backend and account, which are rotated apart from those of others
+func backupPrefix() string {
+  return unsafeName.ReplaceAllString(fmt.Sprintf("todo-%s-%s-", currentBackend(), currentAccount()), "_")
+}
+
+// backupTime returns when the backup named name was taken, from its name
+func backupTime(name string) (time.Time, bool) {
+  stamp := strings.TrimSuffix(name[strings.LastIndex(name, "-")+1:], ".json")
+  t, err := time.Parse(backupTimeLayout, stamp)
+  return t, err == nil
+}
+
+// scheduledBackups returns the names of the scheduled backups of the
+// current backend and account in store, oldest first. Names that merely
+// start with the prefix, such as those of an account named like this one
+// with a suffix, are left out
+func scheduledBackups(store backupStore) ([]string, error) {
+  prefix := backupPrefix()
+  all, err := store.list(prefix)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to list the backups in %s: %w", store, err)
+  }
+  var names []string
+  for _, name := range all {
+    stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".json")
+    if _, err := time.Parse(backupTimeLayout, stamp); err == nil && name == prefix+stamp+".json" {
+      names = append(names, name)
+    }
+  }
+  sort.Strings(names)
+  return names, nil
+}
+
+// openBackupStore returns the store configured for scheduled backups: the
+// backup_s3 bucket if set, or else backup_dir
+func openBackupStore() (backupStore, error) {
+  c := loadConfig()
+  if c.BackupS3 != "" {
+    return parseS3URL(c.BackupS3, c.S3Region)
+  }
+  if c.BackupDir != "" {
+    if err := os.MkdirAll(c.BackupDir, 0700); err != nil {
+      return nil, fmt.Errorf("Unable to create %s: %w", c.BackupDir, err)
+    }
+    return dirStore(c.BackupDir), nil
+  }
+  dir, err := dataDir("backups")
+  if err != nil {
+    return nil, err
+  }
+  return dirStore(dir), nil
+}
+
+// Takes a backup of all task lists of the current account into the
+// configured store, then removes the oldest backups beyond backup_keep.
+// With ifDue set, it does nothing unless the last backup is older than
+// backup_auto. It returns when the last backup was taken
+func runScheduledBackup(ifDue bool) (time.Time, error) {
+  store, err := openBackupStore()
+  if err != nil {
+    return time.Time{}, err
+  }
+  names, err := scheduledBackups(store)
+  if err != nil {
+    return time.Time{}, err
+  }
+  if ifDue {
+    if loadConfig().BackupAuto == "" {
+      return time.Time{}, invalidf("No backup schedule, set one with 'todo backup --auto daily'")
+    }
+    interval, err := parseBackupInterval(loadConfig().BackupAuto)
+    if err != nil {
+      return time.Time{}, err
+    }
+    if len(names) > 0 {
+      if last, ok := backupTime(names[len(names)-1]); ok && time.Since(last) < interval {
+        verbosef("Last backup taken %s ago, the next one is due in %s", todo.FormatDuration(time.Since(last).Round(time.Minute)),
+          todo.FormatDuration((interval - time.Since(last)).Round(time.Minute)))
+        return last, nil
+      }
+    }
+  }
+
+  client, err := newClient()
+  if err != nil {
+    return time.Time{}, err
+  }
+  b, err := snapshot(client)
+  if err != nil {
+    return time.Time{}, err
+  }
+  data, err := b.encode()
+  if err != nil {
+    return time.Time{}, err
+  }
+  // backups hold all tasks, so they are encrypted like task data is, and
+  // carry the salt of the key to be restored with the passphrase alone
+  if data, err = sealPrivate(data); err != nil {
+    return time.Time{}, err
+  }
+  name := backupPrefix() + b.Created.Format(backupTimeLayout) + ".json"
+  if err := store.put(name, data); err != nil {
+    return time.Time{}, fmt.Errorf("Unable to write %s to %s: %w", name, store, err)
+  }
+  infof("Backed up %s to %s in %s", b.describe(), name, store)
+
+  names = append(names, name)
+  keep := loadConfig().BackupKeep
+  if keep == 0 {
+    keep = defaultBackupKeep
+  }
+  for len(names) > keep {
+    if err := store.remove(names[0]); err != nil {
+      return b.Created, fmt.Errorf("Unable to remove old backup %s from %s: %w", names[0], store, err)
+    }
+    verbosef("Removed old backup %s", names[0])
+    names = names[1:]
+  }
+  return b.Created, nil
+}
+
+// Saves the schedule of backups, auto being backup_auto or off to stop
+// them and keep, if positive, backup_keep
+func scheduleBackups(auto string, keep int) error {
+  c, err := loadConfigFile()
+  if err != nil {
+    return err
+  }
+  if auto == "off" {
+    c.BackupAuto = ""
+  } else if auto != "" {
+    if err := configKeys["backup_auto"].set(c, auto); err != nil {
+      return invalidf("Invalid --auto: %v", err)
+    }
+  }
+  if keep < 0 {
+    return invalidf("--keep must be a positive number")
+  }
+  if keep > 0 {
+    c.BackupKeep = keep
+  }
+  if err := c.save(); err != nil {
+    return fmt.Errorf("Unable to save config file: %w", err)
+  }
+  if c.BackupAuto == "" {
+    infof("Scheduled backups are off")
+    return nil
+  }
+  n := c.BackupKeep
+  if n == 0 {
+    n = defaultBackupKeep
+  }
+  infof("Backing up %s, keeping the last %d, once 'todo daemon' or 'todo backup run --if-due' from cron runs", c.BackupAuto, n)
+  if daemonRunning() {
+    infof("Restart the daemon for it to pick up the schedule")
+  }
+  return nil
+}
+
+// Prints the scheduled backups of the current account, oldest first
+func listScheduledBackups() error {
+  store, err := openBackupStore()
+  if err != nil {
+    return err
+  }
+  names, err := scheduledBackups(store)
+  if err != nil {
+    return err
+  }
+  if loadConfig().Output == outputJSON {
+    if names == nil {
+      names = []string{}
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(names)
+  }
+  if len(names) == 0 {
+    fmt.Printf("No backups in %s\n", store)
+    return nil
+  }
+  for _, name := range names {
+    when := ""
+    if t, ok := backupTime(name); ok {
+      when = colorize("2", fmt.Sprintf("  %s %s", formatDate(t.Local()), t.Local().Format("15:04")))
+    }
+    fmt.Println(name + when)
+  }
+  fmt.Println(colorize("2", fmt.Sprintf("In %s, restore one with 'todo backup restore <name>'", store)))
+  return nil
+}
+
+// storedBackup is a scheduled backup in a store, which the vault converts
+// like the files holding task data
+type storedBackup struct {
+  store backupStore
+  name  string
+}
+
+func (b storedBackup) Read() ([]byte, string, error) {
+  data, err := b.store.get(b.name)
+  return data, "", err
+}
+
+func (b storedBackup) Write(data []byte, version string) error {
+  return b.store.put(b.name, data)
+}
+
+func (b storedBackup) String() string {
+  return fmt.Sprintf("%s in %s", b.name, b.store)
+}
+
+// storedBackups returns the scheduled backups of all accounts kept in
+// backup_s3 or backup_dir, unless they are kept in the data directory
+// with the other files holding task data
+func storedBackups() ([]todo.Storage, error) {
+  c := loadConfig()
+  if c.BackupS3 == "" && c.BackupDir == "" {
+    return nil, nil
+  }
+  if c.BackupS3 == "" {
+    dir, err := dataDir("backups")
+    if err != nil {
+      return nil, err
+    }
+    if filepath.Clean(c.BackupDir) == filepath.Clean(dir) {
+      return nil, nil
+    }
+  }
+  store, err := openBackupStore()
+  if err != nil {
+    return nil, err
+  }
+  names, err := store.list("todo-")
+  if err != nil {
+    return nil, fmt.Errorf("Unable to list the backups in %s: %w", store, err)
+  }
+  var backups []todo.Storage
+  for _, name := range names {
+    backups = append(backups, storedBackup{store: store, name: name})
+  }
+  return backups, nil
+}
+
+// dirStore keeps backups as files of a directory
+type dirStore string
+
+func (d dirStore) String() string {
+  return string(d)
+}
+
+func (d dirStore) list(prefix string) ([]string, error) {
+  files, err := ioutil.ReadDir(string(d))
+  if err != nil {
+    return nil, err
+  }
+  var names []string
+  for _, f := range files {
+    if !f.IsDir() && strings.HasPrefix(f.Name(), prefix) && strings.HasSuffix(f.Name(), ".json") {
+      names = append(names, f.Name())
+    }
+  }
+  return names, nil
+}
+
+func (d dirStore) get(name string) ([]byte, error) {
+  return ioutil.ReadFile(filepath.Join(string(d), name))
+}
+
+// put writes the backup to a temporary file first, so a backup cut short
+// does not replace one
+func (d dirStore) put(name string, data []byte) error {
+  path := filepath.Join(string(d), name)
+  if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+    return err
+  }
+  return os.Rename(path+".tmp", path)
+}
+
+func (d dirStore) remove(name string) error {
+  return os.Remove(filepath.Join(string(d), name))
+}
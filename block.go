@@ -0,0 +1,217 @@
+package main
+
+import (
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// blockers returns the tasks of items task is blocked by, leaving out
+// those no longer in items because they were completed or deleted
+func blockers(items []*todo.Task, task *todo.Task) []*todo.Task {
+  var open []*todo.Task
+  for _, id := range task.BlockedBy {
+    for _, t := range items {
+      if t.ID == id {
+        open = append(open, t)
+      }
+    }
+  }
+  return open
+}
+
+// blockedIDs returns the ids of the tasks of items blocked by another
+// task of items
+func blockedIDs(items []*todo.Task) map[string]bool {
+  blocked := map[string]bool{}
+  for _, task := range items {
+    if len(blockers(items, task)) > 0 {
+      blocked[task.ID] = true
+    }
+  }
+  return blocked
+}
+
+// dependsOn reports whether task is blocked by on, directly or through
+// the tasks blocking it
+func dependsOn(items []*todo.Task, task *todo.Task, on *todo.Task) bool {
+  seen := map[string]bool{}
+  var walk func(t *todo.Task) bool
+  walk = func(t *todo.Task) bool {
+    if t.ID == on.ID {
+      return true
+    }
+    if seen[t.ID] {
+      return false
+    }
+    seen[t.ID] = true
+    for _, b := range blockers(items, t) {
+      if walk(b) {
+        return true
+      }
+    }
+    return false
+  }
+  return walk(task)
+}
+
+// without returns ids without the ones in drop
+func without(ids []string, drop map[string]bool) []string {
+  kept := []string{}
+  for _, id := range ids {
+    if !drop[id] {
+      kept = append(kept, id)
+    }
+  }
+  return kept
+}
+
+// Marks the todo item at arg as blocked by the one at on, refusing
+// dependencies that would go round in a circle
+func blockTodoItem(s *session, arg string, on string) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  blocker, err := s.taskAt(items, on)
+  if err != nil {
+    return err
+  }
+  if task.ID == blocker.ID {
+    return invalidf("A task cannot be blocked by itself")
+  }
+  if dependsOn(items, blocker, task) {
+    return invalidf("'%s' already depends on '%s'", blocker.Title, task.Title)
+  }
+  for _, id := range task.BlockedBy {
+    if id == blocker.ID {
+      infof("Task '%s' is already blocked by '%s'", task.Title, blocker.Title)
+      return nil
+    }
+  }
+
+  // ids of tasks completed since are dropped while at it
+  blockedBy := []string{}
+  for _, t := range blockers(items, task) {
+    blockedBy = append(blockedBy, t.ID)
+  }
+  blockedBy = append(blockedBy, blocker.ID)
+  if _, err := s.update(task, &todo.Patch{BlockedBy: &blockedBy}); err != nil {
+    return err
+  }
+  infof("Task '%s' blocked by '%s'", task.Title, blocker.Title)
+  return nil
+}
+
+// Removes the dependency of the todo item at arg on the one at on, or
+// with on empty all of its dependencies
+func unblockTodoItem(s *session, arg string, on string) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  drop := map[string]bool{}
+  for _, id := range task.BlockedBy {
+    drop[id] = on == ""
+  }
+  if on != "" {
+    blocker, err := s.taskAt(items, on)
+    if err != nil {
+      return err
+    }
+    if _, ok := drop[blocker.ID]; !ok {
+      return invalidf("'%s' is not blocked by '%s'", task.Title, blocker.Title)
+    }
+    drop[blocker.ID] = true
+  }
+  if len(drop) == 0 {
+    return invalidf("'%s' is not blocked by any task", task.Title)
+  }
+  blockedBy := without(task.BlockedBy, drop)
+  if _, err := s.update(task, &todo.Patch{BlockedBy: &blockedBy}); err != nil {
+    return err
+  }
+  if len(blockers(items, &todo.Task{BlockedBy: blockedBy})) == 0 {
+    infof("Task '%s' is no longer blocked", task.Title)
+  } else {
+    infof("Task '%s' unblocked", task.Title)
+  }
+  return nil
+}
+
+// unblockAfter drops the tasks of done, once completed, from the tasks
+// blocked by them, reporting those no longer blocked
+func unblockAfter(s *session, done []*todo.Task) error {
+  drop := map[string]bool{}
+  for _, task := range done {
+    drop[task.ID] = true
+  }
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  for _, task := range items {
+    blockedBy := without(task.BlockedBy, drop)
+    if len(blockedBy) == len(task.BlockedBy) {
+      continue
+    }
+    if _, err := s.update(task, &todo.Patch{BlockedBy: &blockedBy}); err != nil {
+      return err
+    }
+    if len(blockers(items, &todo.Task{BlockedBy: blockedBy})) == 0 {
+      infof("Task '%s' is no longer blocked", task.Title)
+    }
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "block",
+    usage:   "block <index> --on <index>",
+    summary: "Mark a task as blocked until another one is completed",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      on := fs.String("on", "", "index of the task to complete first")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 || *on == "" {
+        return invalidf("Expected a task index and --on, see 'todo help block'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return blockTodoItem(s, args[0], *on)
+    },
+  })
+  register(&command{
+    name:    "unblock",
+    usage:   "unblock <index> [--on <index>]",
+    summary: "Remove a task's dependency on another one, or all of them",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      on := fs.String("on", "", "index of the task to no longer wait for")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 {
+        return invalidf("Expected a task index, see 'todo help unblock'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return unblockTodoItem(s, args[0], *on)
+    },
+  })
+}
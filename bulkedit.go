@@ -0,0 +1,327 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// bulkEditHeader explains the format of the file 'todo edit --all' opens
+const bulkEditHeader = `# The tasks of your %s list, one per line: its id, [ ] or [x], the title,
+# +tags, due:date and priority:high, med or low. Change a line to edit the
+# task, check it with [x] to complete it, remove it to delete the task or
+# move it to reorder the task among its siblings. Lines without an id add
+# tasks. Indentation shows subtasks and is not read back. Lines starting
+# with '#' are ignored, and a file without tasks changes nothing.
+`
+
+// bulkLine is a task as written in the file of 'todo edit --all'
+type bulkLine struct {
+  // task is the task the line starts with the short id of, nil for
+  // a task to add
+  task     *todo.Task
+  done     bool
+  title    string
+  tags     []string
+  due      time.Time
+  priority todo.Priority
+}
+
+// formatBulkLine writes task, indented by depth, the way parseBulkLine
+// reads it
+func formatBulkLine(task *todo.Task, depth int) string {
+  line := fmt.Sprintf("%s%s [ ] %s", strings.Repeat("  ", depth), shortID(task.ID), task.Title)
+  if len(task.Tags) > 0 {
+    line += " " + formatTags(task.Tags)
+  }
+  if !task.Due.IsZero() {
+    line += " due:" + task.Due.Format(defaultDateFormat)
+  }
+  if task.Priority != todo.PriorityNone {
+    line += " priority:" + task.Priority.String()
+  }
+  return line
+}
+
+// parseBulkLine reads a line of the file of 'todo edit --all', ids holding
+// the tasks of the list by short id
+func parseBulkLine(line string, ids map[string]*todo.Task, now time.Time) (*bulkLine, error) {
+  b := &bulkLine{}
+  rest := strings.TrimSpace(line)
+  if fields := strings.Fields(rest); len(fields) > 0 && ids[fields[0]] != nil {
+    b.task = ids[fields[0]]
+    rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[0]))
+  }
+  switch {
+  case strings.HasPrefix(rest, "[ ]"):
+    rest = rest[3:]
+  case strings.HasPrefix(rest, "[x]"), strings.HasPrefix(rest, "[X]"):
+    b.done, rest = true, rest[3:]
+  }
+
+  var words []string
+  for _, w := range strings.Fields(rest) {
+    var err error
+    switch {
+    case strings.HasPrefix(w, "due:"):
+      if b.due, err = parseDate(strings.TrimPrefix(w, "due:"), now); err != nil {
+        return nil, err
+      }
+    case strings.HasPrefix(w, "priority:"):
+      if b.priority, err = todo.ParsePriority(strings.TrimPrefix(w, "priority:")); err != nil {
+        return nil, err
+      }
+    default:
+      words = append(words, w)
+    }
+  }
+  words, b.tags = splitTags(words)
+  b.title = strings.Join(words, " ")
+  if b.title == "" {
+    return nil, fmt.Errorf("task title can not be empty")
+  }
+  return b, nil
+}
+
+// patch returns the changes from was to b, both read from lines
+func (b *bulkLine) patch(was *bulkLine) *todo.Patch {
+  p := &todo.Patch{}
+  if b.title != was.title {
+    p.Title = &b.title
+  }
+  if strings.Join(b.tags, ",") != strings.Join(was.tags, ",") {
+    p.Tags = &b.tags
+  }
+  if !b.due.Equal(was.due) {
+    p.Due = &b.due
+  }
+  if b.priority != was.priority {
+    p.Priority = &b.priority
+  }
+  return p
+}
+
+// readBulkEdit reads back the file of 'todo edit --all'. It returns nil
+// lines if the file holds no tasks
+func readBulkEdit(text string, ids map[string]*todo.Task, now time.Time) ([]*bulkLine, error) {
+  var lines []*bulkLine
+  seen := map[*todo.Task]bool{}
+  for n, line := range strings.Split(text, "\n") {
+    if strings.HasPrefix(strings.TrimSpace(line), "#") || strings.TrimSpace(line) == "" {
+      continue
+    }
+    b, err := parseBulkLine(line, ids, now)
+    if err != nil {
+      return nil, fmt.Errorf("line %d: %v", n+1, err)
+    }
+    if b.task != nil && seen[b.task] {
+      return nil, fmt.Errorf("line %d: task %s is listed twice", n+1, shortID(b.task.ID))
+    }
+    seen[b.task] = true
+    lines = append(lines, b)
+  }
+  // subtasks are deleted along with their parent
+  byID := map[string]*todo.Task{}
+  for _, task := range ids {
+    byID[task.ID] = task
+  }
+  for _, b := range lines {
+    for p := b.task; p != nil; p = byID[p.Parent] {
+      if !seen[p] {
+        return nil, fmt.Errorf("'%s' is deleted along with '%s', remove its line as well", b.title, p.Title)
+      }
+    }
+  }
+  return lines, nil
+}
+
+// Opens all tasks of the todo list in $EDITOR, one per line, and applies
+// what was changed once the editor quits: edits, completions, deletions,
+// added tasks and the new order of tasks among their siblings
+func bulkEdit(s *session) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  now := time.Now()
+  ids := map[string]*todo.Task{}
+  was := map[*todo.Task]*bulkLine{}
+  var text strings.Builder
+  fmt.Fprintf(&text, bulkEditHeader, s.listName)
+  order, depth := treeOrder(items, indexes(items))
+  for _, i := range order {
+    task := items[i]
+    line := formatBulkLine(task, depth[i])
+    ids[shortID(task.ID)] = task
+    fmt.Fprintln(&text, line)
+  }
+  for _, task := range items {
+    if was[task], err = parseBulkLine(formatBulkLine(task, 0), ids, now); err != nil {
+      // a title the format can not hold, such as one made of tags
+      was[task] = &bulkLine{task: task, title: task.Title, tags: task.Tags, due: task.Due, priority: task.Priority}
+    }
+  }
+
+  f, err := ioutil.TempFile("", "todo-edit-*.txt")
+  if err != nil {
+    return fmt.Errorf("Unable to create temporary file: %w", err)
+  }
+  defer os.Remove(f.Name())
+  content := text.String()
+  var lines []*bulkLine
+  for {
+    if err := ioutil.WriteFile(f.Name(), []byte(content), 0600); err != nil {
+      return fmt.Errorf("Unable to write temporary file: %w", err)
+    }
+    if err := runEditor(f.Name()); err != nil {
+      return fmt.Errorf("Editor failed: %w", err)
+    }
+    b, err := ioutil.ReadFile(f.Name())
+    if err != nil {
+      return fmt.Errorf("Unable to read edited tasks: %w", err)
+    }
+    if lines, err = readBulkEdit(string(b), ids, now); err == nil {
+      break
+    }
+    // the edits are kept for fixing the line in error
+    edited := string(b)
+    if strings.HasPrefix(edited, "# Error: ") {
+      edited = edited[strings.Index(edited, "\n")+1:]
+    }
+    content = fmt.Sprintf("# Error: %v\n%s", err, edited)
+  }
+  if len(lines) == 0 {
+    infof("No tasks left in the file, nothing was changed")
+    return nil
+  }
+  return applyBulkEdit(s, items, was, lines)
+}
+
+// indexes returns the indexes of items
+func indexes(items []*todo.Task) []int {
+  all := make([]int, len(items))
+  for i := range all {
+    all[i] = i
+  }
+  return all
+}
+
+// applyBulkEdit applies the lines read back by bulkEdit to items, was
+// holding the lines as they were written
+func applyBulkEdit(s *session, items []*todo.Task, was map[*todo.Task]*bulkLine, lines []*bulkLine) error {
+  var added, updated, completed, moved int
+  kept := map[*todo.Task]bool{}
+  for _, b := range lines {
+    kept[b.task] = true
+  }
+  var gone []*todo.Task
+  for _, task := range items {
+    if !kept[task] {
+      gone = append(gone, task)
+    }
+  }
+  byID := map[string]*todo.Task{}
+  for _, task := range items {
+    byID[task.ID] = task
+  }
+  var roots []*todo.Task
+  for _, task := range gone {
+    if p := byID[task.Parent]; p == nil || kept[p] {
+      roots = append(roots, task)
+    }
+  }
+  // deleting a task deletes its subtasks
+  if err := s.mutateAll(opDelete, roots, func(*todo.Task) {}); err != nil {
+    return err
+  }
+  deleted := len(gone)
+
+  // the order to give the tasks kept open, by the id of their parent
+  siblings := map[string][]string{}
+  var err error
+  for _, b := range lines {
+    task := b.task
+    if task == nil {
+      task = &todo.Task{Title: b.title, Tags: b.tags, Due: b.due, Priority: b.priority}
+      if task, err = s.insert(task); err != nil {
+        return err
+      }
+      added++
+    } else if p := b.patch(was[task]); !p.Empty() {
+      if task, err = s.update(task, p); err != nil {
+        return err
+      }
+      updated++
+    }
+    if b.done {
+      if err := completeTask(s, task); err != nil {
+        return err
+      }
+      completed++
+      continue
+    }
+    siblings[task.Parent] = append(siblings[task.Parent], task.ID)
+  }
+
+  if items, err = s.items(); err != nil {
+    return err
+  }
+  for parent, want := range siblings {
+    wanted := map[string]bool{}
+    for _, id := range want {
+      wanted[id] = true
+    }
+    var have []string
+    for _, task := range items {
+      if task.Parent == parent && wanted[task.ID] {
+        have = append(have, task.ID)
+      }
+    }
+    k := 0
+    for k < len(want) && k < len(have) && want[k] == have[k] {
+      k++
+    }
+    if k == len(want) {
+      continue
+    }
+    if s.offline {
+      warnf("Reordering tasks is not queued while offline, the order was left unchanged")
+      break
+    }
+    for i := k; i < len(want); i++ {
+      dest := todo.Destination{Parent: parent}
+      if i > 0 {
+        dest.Previous = want[i-1]
+      }
+      if _, err := s.client.Move(s.ctx, s.todoId, want[i], dest); err != nil {
+        return fmt.Errorf("Unable to reorder tasks: %w", err)
+      }
+      moved++
+    }
+  }
+  if moved > 0 {
+    if _, err := s.items(); err != nil {
+      return err
+    }
+  }
+
+  var changes []string
+  for _, c := range []struct {
+    n    int
+    verb string
+  }{{added, "added"}, {updated, "updated"}, {completed, "completed"}, {deleted, "deleted"}, {moved, "moved"}} {
+    if c.n > 0 {
+      changes = append(changes, fmt.Sprintf("%d %s", c.n, c.verb))
+    }
+  }
+  if len(changes) == 0 {
+    infof("Tasks of your %s list left unchanged", s.listName)
+    return nil
+  }
+  infof("Tasks of your %s list: %s", s.listName, strings.Join(changes, ", "))
+  return nil
+}
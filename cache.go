@@ -0,0 +1,567 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net/url"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// Kinds of operations that can be queued while offline
+const (
+  opAdd      = "add"
+  opComplete = "complete"
+  opDelete   = "delete"
+  opEdit     = "edit"
+)
+
+// localIdPrefix marks ids of tasks created offline that the Tasks API has
+// not assigned an id to yet
+const localIdPrefix = "local-"
+
+// backgroundSyncAge is how old the cache may get before list starts a
+// background sync to refresh it
+const backgroundSyncAge = 30 * time.Second
+
+// cachedList is the local copy of a task list, stored as JSON in the
+// cache directory so that it can be read without network access
+type cachedList struct {
+  ListId  string       `json:"listId"`
+  Items   []*todo.Task `json:"items"`
+  Pending []pendingOp  `json:"pending,omitempty"`
+  Synced  time.Time    `json:"synced"`
+  // Listed holds the ids of the tasks at each index of the last listing
+  Listed []string `json:"listed,omitempty"`
+  // ListedView names the view, such as today, the last listing showed
+  // instead of the whole list
+  ListedView string `json:"listedView,omitempty"`
+}
+
+// pendingOp is a write made while offline, to be replayed against the
+// Tasks API on the next successful connection. Task is the task as it was
+// cached when the operation was made, so its Etag can be used to detect
+// whether it changed remotely in the meantime. Patch holds the changes
+// of an edit
+type pendingOp struct {
+  Op    string      `json:"op"`
+  Task  *todo.Task  `json:"task"`
+  Patch *todo.Patch `json:"patch,omitempty"`
+}
+
+// cacheFile returns the path of the cache file for the named task list
+// of the current account
+func cacheFile(name string) (string, error) {
+  dir, err := cacheDir("lists", stateName())
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, url.QueryEscape(name)+".json"), nil
+}
+
+// loadCache reads the cached copy of the named task list. A missing or
+// unreadable cache results in an empty cachedList
+func loadCache(name string) *cachedList {
+  c := &cachedList{}
+  file, err := cacheFile(name)
+  if err != nil {
+    return c
+  }
+  b, err := readPrivate(file)
+  if err != nil {
+    return c
+  }
+  if err := json.Unmarshal(b, c); err != nil {
+    return &cachedList{}
+  }
+  return c
+}
+
+// save writes the cache for the named task list. The file is replaced
+// atomically so a concurrent background sync never sees a partial file
+func (c *cachedList) save(name string) error {
+  file, err := cacheFile(name)
+  if err != nil {
+    return err
+  }
+  b, err := json.MarshalIndent(c, "", "  ")
+  if err != nil {
+    return err
+  }
+  return writePrivate(file, b)
+}
+
+// addItem adds task to the cached items, after its siblings if it is a
+// subtask, and at the end otherwise
+func (c *cachedList) addItem(task *todo.Task) {
+  at := len(c.Items)
+  if task.Parent != "" {
+    for i, item := range c.Items {
+      if item.ID == task.Parent || item.Parent == task.Parent {
+        at = i + 1
+      }
+    }
+  }
+  c.Items = append(c.Items[:at:at], append([]*todo.Task{task}, c.Items[at:]...)...)
+}
+
+// removeItem drops the task with the given id from the cached items. The
+// items are copied, so slices returned by items earlier stay intact
+func (c *cachedList) removeItem(id string) {
+  for i, task := range c.Items {
+    if task.ID == id {
+      c.Items = append(c.Items[:i:i], c.Items[i+1:]...)
+      return
+    }
+  }
+}
+
+// replaceItem swaps the cached item with the same id as task for task
+func (c *cachedList) replaceItem(task *todo.Task) {
+  for i, item := range c.Items {
+    if item.ID == task.ID {
+      c.Items[i] = task
+      return
+    }
+  }
+}
+
+// reparent points subtasks of the local task with id oldId, cached or
+// queued for creation, at the id the server assigned to it
+func (c *cachedList) reparent(oldId string, newId string) {
+  for _, task := range c.Items {
+    if task.Parent == oldId {
+      task.Parent = newId
+    }
+  }
+  for _, op := range c.Pending {
+    if op.Task.Parent == oldId {
+      op.Task.Parent = newId
+    }
+  }
+}
+
+// removePendingAdd drops the queued creation of the local task with the
+// given id
+func (c *cachedList) removePendingAdd(id string) {
+  for i, op := range c.Pending {
+    if op.Op == opAdd && op.Task.ID == id {
+      c.Pending = append(c.Pending[:i], c.Pending[i+1:]...)
+      return
+    }
+  }
+}
+
+// age describes when the cache was last synced
+func (c *cachedList) age() string {
+  if c.Synced.IsZero() {
+    return "never synced"
+  }
+  return "synced " + todo.FormatDuration(time.Since(c.Synced).Round(time.Second)) + " ago"
+}
+
+// saveCache writes the session's cache, warning on failure since the
+// remote list is the source of truth
+func (s *session) saveCache() {
+  if err := s.cache.save(s.listName); err != nil {
+    warnf("Unable to update local cache: %v", err)
+  }
+}
+
+// items returns the current uncompleted items of the todo list. With a
+// daemon, they are those it cached; online, they are fetched from the
+// Tasks API and the cache is refreshed; offline, the cached items are
+// returned
+func (s *session) items() ([]*todo.Task, error) {
+  if s.daemon {
+    reply, err := askDaemon(&daemonRequest{Op: daemonItems, List: s.listName})
+    if err == nil {
+      s.cache.Items, s.cache.Synced = reply.Items, reply.Synced
+      return reply.Items, nil
+    }
+    warnf("Daemon unavailable, fetching tasks: %v", err)
+    s.daemon = false
+  }
+  if s.offline {
+    verbosef("Using the cached %s list, %s", s.listName, s.cache.age())
+    return s.cache.Items, nil
+  }
+  items, err := s.client.List(s.ctx, s.todoId)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve tasks: %w", err)
+  }
+  s.cache.ListId = s.todoId
+  s.cache.Items = items
+  s.cache.Synced = time.Now()
+  s.saveCache()
+  return items, nil
+}
+
+// insert creates task in the todo list, or queues its creation when
+// offline. It returns the created task
+func (s *session) insert(task *todo.Task) (*todo.Task, error) {
+  if s.offline {
+    task.ID = fmt.Sprintf("%s%d", localIdPrefix, time.Now().UnixNano())
+    s.cache.Pending = append(s.cache.Pending, pendingOp{Op: opAdd, Task: task})
+  } else {
+    created, err := s.client.Add(s.ctx, s.todoId, task)
+    if err != nil {
+      return nil, err
+    }
+    task = created
+  }
+  s.cache.addItem(task)
+  if len(s.cache.Listed) > 0 {
+    s.cache.Listed = append(s.cache.Listed, task.ID)
+  }
+  s.saveCache()
+  s.record(opAdd, nil, task)
+  return task, nil
+}
+
+// complete marks task as completed, or queues doing so when offline
+func (s *session) complete(task *todo.Task) error {
+  return s.mutate(opComplete, task)
+}
+
+// remove deletes task, or queues its deletion when offline
+func (s *session) remove(task *todo.Task) error {
+  return s.mutate(opDelete, task)
+}
+
+// mutate applies a complete or delete operation to task and drops it from
+// the cached items
+func (s *session) mutate(op string, task *todo.Task) error {
+  switch {
+  case strings.HasPrefix(task.ID, localIdPrefix):
+    // never reached the server, so there is nothing to replay
+    s.cache.removePendingAdd(task.ID)
+  case s.offline:
+    s.cache.Pending = append(s.cache.Pending, pendingOp{Op: op, Task: task})
+  default:
+    if _, err := s.applyOp(pendingOp{Op: op, Task: task}); err != nil {
+      return fmt.Errorf("Could not %s task %w", op, err)
+    }
+  }
+  s.forget(op, task)
+  return nil
+}
+
+// forget drops task from the cached items and journals op, once op was
+// applied to it
+func (s *session) forget(op string, task *todo.Task) {
+  s.cache.removeItem(task.ID)
+  s.saveCache()
+  s.record(op, task, nil)
+}
+
+// mutateAll applies a complete or delete operation to tasks like
+// mutate, sending the requests in parallel when online. done is called for each task
+// the operation succeeded on, one at a time
+func (s *session) mutateAll(op string, tasks []*todo.Task, done func(task *todo.Task)) error {
+  if s.offline {
+    for _, task := range tasks {
+      if err := s.mutate(op, task); err != nil {
+        return err
+      }
+      done(task)
+    }
+    return nil
+  }
+  var mu sync.Mutex
+  return inParallel(s.ctx, len(tasks), func(ctx context.Context, i int) error {
+    task := tasks[i]
+    if strings.HasPrefix(task.ID, localIdPrefix) {
+      mu.Lock()
+      defer mu.Unlock()
+      if err := s.mutate(op, task); err != nil {
+        return err
+      }
+      done(task)
+      return nil
+    }
+    var err error
+    if op == opDelete {
+      err = s.client.Delete(ctx, s.todoId, task.ID)
+    } else {
+      _, err = s.client.Complete(ctx, s.todoId, task.ID)
+    }
+    if err != nil {
+      return fmt.Errorf("Could not %s task '%s': %w", op, task.Title, err)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    s.forget(op, task)
+    done(task)
+    return nil
+  })
+}
+
+// update applies patch to task, or queues doing so when offline.
+// It returns the updated task
+func (s *session) update(task *todo.Task, patch *todo.Patch) (*todo.Task, error) {
+  before := task
+  switch {
+  case strings.HasPrefix(task.ID, localIdPrefix):
+    task = patch.Apply(task)
+    for _, op := range s.cache.Pending {
+      if op.Op == opAdd && op.Task.ID == task.ID {
+        *op.Task = *task
+      }
+    }
+  case s.offline:
+    s.cache.Pending = append(s.cache.Pending, pendingOp{Op: opEdit, Task: task, Patch: patch})
+    task = patch.Apply(task)
+  default:
+    updated, err := s.applyOp(pendingOp{Op: opEdit, Task: task, Patch: patch})
+    if err != nil {
+      return nil, fmt.Errorf("Could not update task %w", err)
+    }
+    task = updated
+  }
+  s.cache.replaceItem(task)
+  s.saveCache()
+  s.record(opEdit, before, task)
+  return task, nil
+}
+
+// applyOp performs a queued complete, delete or edit operation against the
+// Tasks API. It returns the task as updated by the server, or nil for
+// deletions
+func (s *session) applyOp(op pendingOp) (*todo.Task, error) {
+  switch op.Op {
+  case opDelete:
+    return nil, s.client.Delete(s.ctx, s.todoId, op.Task.ID)
+  case opEdit:
+    return s.client.Update(s.ctx, s.todoId, op.Task.ID, op.Patch)
+  }
+  return s.client.Complete(s.ctx, s.todoId, op.Task.ID)
+}
+
+// replay sends operations queued while offline to the Tasks API. Queued
+// changes to tasks whose etag changed remotely are dropped as conflicts,
+// the remote version wins, as are those the server rejects. Replay stops
+// at the first failure that may pass, leaving the remaining operations
+// queued
+func (s *session) replay() {
+  for len(s.cache.Pending) > 0 {
+    op := s.cache.Pending[0]
+    switch op.Op {
+    case opAdd:
+      created, err := s.client.Add(s.ctx, s.todoId, op.Task)
+      if err != nil && !retryable(err) {
+        warnf("Rejected: could not create task '%s', dropping it: %v", op.Task.Title, err)
+        s.cache.removeItem(op.Task.ID)
+        break
+      }
+      if err != nil {
+        warnf("Sync paused, could not create task '%s': %v", op.Task.Title, err)
+        return
+      }
+      s.cache.removeItem(op.Task.ID)
+      s.cache.addItem(created)
+      s.cache.reparent(op.Task.ID, created.ID)
+      s.cache.relabel(op.Task.ID, created.ID)
+      infof("Synced: added '%s'", op.Task.Title)
+    default:
+      current, err := s.client.Get(s.ctx, s.todoId, op.Task.ID)
+      if err == todo.ErrNotFound {
+        infof("Synced: '%s' no longer exists, skipping %s", op.Task.Title, op.Op)
+        break
+      }
+      if err != nil && !retryable(err) {
+        warnf("Rejected: could not fetch task '%s', skipping %s: %v", op.Task.Title, op.Op, err)
+        break
+      }
+      if err != nil {
+        warnf("Sync paused, could not fetch task '%s': %v", op.Task.Title, err)
+        return
+      }
+      if current.Etag != op.Task.Etag {
+        warnf("Conflict: '%s' changed remotely since it was cached, skipping %s",
+          op.Task.Title, op.Op)
+        break
+      }
+      updated, err := s.applyOp(op)
+      if err != nil && !retryable(err) {
+        warnf("Rejected: could not %s task '%s', skipping it: %v", op.Op, op.Task.Title, err)
+        break
+      }
+      if err != nil {
+        warnf("Sync paused, could not %s task '%s': %v", op.Op, op.Task.Title, err)
+        return
+      }
+      if updated != nil && op.Op == opEdit {
+        s.cache.replaceItem(updated)
+      }
+      if updated != nil {
+        // later operations on the same task were queued against the
+        // version changed here, not a remote change
+        for _, later := range s.cache.Pending[1:] {
+          if later.Task.ID == updated.ID && later.Task.Etag == op.Task.Etag {
+            later.Task.Etag = updated.Etag
+          }
+        }
+      }
+      infof("Synced: %s '%s'", op.Op, op.Task.Title)
+    }
+    s.cache.Pending = s.cache.Pending[1:]
+    s.saveCache()
+  }
+}
+
+// retryable reports whether a queued operation that failed with err may
+// succeed later, once the network, the quota or the credentials are back
+func retryable(err error) bool {
+  switch exitCode(err) {
+  case exitNetwork, exitQuota, exitAuth, exitInterrupted:
+    return true
+  }
+  return errors.Is(err, todo.ErrConflict)
+}
+
+// startBackgroundSync refreshes the cache in a detached 'todo sync'
+// process if it is older than backgroundSyncAge, so the current command
+// does not wait on the network. A running daemon keeps the cache fresh
+// instead
+func startBackgroundSync(c *cachedList) {
+  if time.Since(c.Synced) < backgroundSyncAge || daemonRunning() {
+    return
+  }
+  exe, err := os.Executable()
+  if err != nil {
+    return
+  }
+  cmd := exec.Command(exe, "sync", "--quiet", "--list", currentList(), "--account", currentAccount(),
+    "--backend", currentBackend())
+  if cmd.Start() == nil {
+    cmd.Process.Release()
+  }
+}
+
+// syncCache replays the offline changes of s, adds the next occurrences
+// of recurring tasks completed since the last sync and refreshes the cache.
+// It returns the refreshed items
+func syncCache(s *session) ([]*todo.Task, error) {
+  if s.offline {
+    return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Unable to reach Google Tasks, offline changes remain queued")}
+  }
+  // tasks completed before the last sync have been handled by it
+  since := s.cache.Synced
+  if !since.IsZero() {
+    since = since.Add(-time.Hour)
+  }
+  if _, err := tickRecurring(s, since); err != nil {
+    return nil, err
+  }
+  return s.items()
+}
+
+// Syncs the todo list every interval until interrupted, sending webhook
+// events for the tasks created, completed or deleted between syncs.
+// Failed syncs are retried after the next interval
+func syncDaemon(interval time.Duration) error {
+  bypassDaemon = true
+  hooks, err := newWebhooks()
+  if err != nil {
+    return err
+  }
+  defer hooks.close(30 * time.Second)
+  var known map[string]*todo.Task
+  var last time.Time
+  for {
+    started := time.Now()
+    s, err := newSession()
+    if err == nil {
+      var items []*todo.Task
+      if items, err = syncCache(s); err == nil {
+        if known != nil && hooks != nil {
+          // a minute of slack covers clocks of the backend running behind
+          taskEvents(s.ctx, hooks, s.client, s.todoId, s.listName, known, items, last.Add(-time.Minute))
+        }
+        known = map[string]*todo.Task{}
+        for _, task := range items {
+          known[task.ID] = task
+        }
+        last = started
+        verbosef("Synced your %s list, %s", s.listName, plural(len(items), "task"))
+      }
+    }
+    if cmdCtx.Err() != nil {
+      return nil
+    }
+    if err != nil {
+      warnf("Sync failed, retrying in %s: %v", todo.FormatDuration(interval), err)
+    }
+    select {
+    case <-cmdCtx.Done():
+      return nil
+    case <-time.After(interval):
+    }
+  }
+}
+
+func init() {
+  register(&command{
+    name:    "sync",
+    usage:   "sync [--daemon [--interval 5m]] | sync --from backend --to backend [--two-way]",
+    summary: "Replay offline changes and refresh the local cache, or copy tasks between backends",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      from := fs.String("from", "", "backend to copy the tasks of the list from")
+      to := fs.String("to", "", "backend to copy the tasks of the list to")
+      twoWay := fs.Bool("two-way", false, "also copy changes made in --to back to --from")
+      daemon := fs.Bool("daemon", false, "keep running and sync every interval, sending events to webhook_urls")
+      interval := fs.Duration("interval", 5*time.Minute, "how often the daemon syncs")
+      if _, err := parseFlags(fs, args); err != nil {
+        return err
+      }
+      if *from != "" || *to != "" {
+        if *from == "" || *to == "" {
+          return invalidf("--from and --to must be given together")
+        }
+        if *from == *to {
+          return invalidf("--from and --to name the same backend")
+        }
+        if *daemon {
+          return invalidf("--daemon can not be combined with --from and --to")
+        }
+        stats, err := syncBackends(cmdCtx, *from, *to, currentList(), *twoWay)
+        if err != nil {
+          return err
+        }
+        infof("Synced your %s list from %s to %s: %v", currentList(), *from, *to, stats)
+        return nil
+      }
+      if *daemon {
+        if *interval <= 0 {
+          return invalidf("--interval must be positive")
+        }
+        return syncDaemon(*interval)
+      }
+      if reply, err := askDaemon(&daemonRequest{Op: daemonSync, List: currentList()}); err == nil {
+        infof("Daemon synced your %s list, %s", currentList(), plural(len(reply.Items), "task"))
+        return nil
+      } else if !isNetworkError(err) && !os.IsNotExist(err) {
+        return err
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if _, err := syncCache(s); err != nil {
+        return err
+      }
+      infof("Local cache of your %s list is up to date", s.listName)
+      return nil
+    },
+  })
+}
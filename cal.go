@@ -0,0 +1,147 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// parseMonth parses value as a month of the year of now, such as "march"
+// or "mar", as a month of another year, such as "2024-03", or as "next"
+// for the month after that of now. The empty string is the month of now.
+// It returns the first day of the month
+func parseMonth(value string, now time.Time) (time.Time, error) {
+  first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+  v := strings.ToLower(value)
+  switch v {
+  case "":
+    return first, nil
+  case "next":
+    return first.AddDate(0, 1, 0), nil
+  }
+  if t, err := time.Parse("2006-01", v); err == nil {
+    return t, nil
+  }
+  for m := time.January; m <= time.December; m++ {
+    name := strings.ToLower(m.String())
+    if v == name || len(v) >= 3 && strings.HasPrefix(name, v) {
+      return time.Date(now.Year(), m, 1, 0, 0, 0, 0, time.UTC), nil
+    }
+  }
+  return time.Time{}, fmt.Errorf("unrecognized month '%s', expected e.g. march, 2024-03 or next", value)
+}
+
+// Prints a calendar of the month starting on first, with the days on
+// which tasks of the todo list are due marked, and below it the tasks
+// due each of those days. The tasks are fetched with a due date filter,
+// or taken from the cache when offline
+func showCalendar(s *session, first time.Time) error {
+  last := first.AddDate(0, 1, -1)
+  var items []*todo.Task
+  var err error
+  if s.offline {
+    for _, task := range s.cache.Items {
+      if !task.Due.Before(first) && !task.Due.After(last) {
+        items = append(items, task)
+      }
+    }
+  } else if items, err = s.client.Due(s.ctx, s.todoId, first, last); err != nil {
+    return fmt.Errorf("Unable to retrieve tasks: %w", err)
+  }
+  byDay := map[int][]*todo.Task{}
+  for _, task := range items {
+    byDay[task.Due.Day()] = append(byDay[task.Due.Day()], task)
+  }
+
+  today := todo.Date(time.Now())
+  fmt.Println(colorize("1", first.Format("January 2006")))
+  var header []string
+  for i := 0; i < 7; i++ {
+    header = append(header, ((weekStart() + time.Weekday(i)) % 7).String()[:2])
+  }
+  fmt.Println(colorize("2", strings.Join(header, "  ")))
+  line := strings.Repeat("    ", weekOffset(first))
+  for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+    text := fmt.Sprintf("%2d", day.Day())
+    marker := " "
+    code := ""
+    if len(byDay[day.Day()]) > 0 {
+      marker = "*"
+      code = "33"
+      if day.Before(today) {
+        code = "31"
+      }
+    }
+    if day.Equal(today) {
+      // today is shown in reverse video
+      if code != "" {
+        code += ";"
+      }
+      code += "7"
+    }
+    if code != "" {
+      text = colorize(code, text)
+    }
+    line += text + marker
+    if weekOffset(day) == 6 || day.Equal(last) {
+      fmt.Println(strings.TrimRight(line, " "))
+      line = ""
+    } else {
+      line += " "
+    }
+  }
+
+  var days []int
+  for day := range byDay {
+    days = append(days, day)
+  }
+  sort.Ints(days)
+  if len(days) == 0 {
+    fmt.Printf("\nNothing is due in %s in your %s list\n", first.Format("January"), s.listName)
+    return nil
+  }
+  fmt.Println()
+  for _, day := range days {
+    var titles []string
+    for _, task := range byDay[day] {
+      titles = append(titles, task.Title)
+    }
+    date := first.AddDate(0, 0, day-1)
+    fmt.Printf("%s  %s\n", colorize("2", formatDate(date)), strings.Join(titles, ", "))
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "cal",
+    aliases: []string{"calendar"},
+    usage:   "cal [month]",
+    summary: "Show a month calendar marking the days tasks are due",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 1 {
+        return invalidf("Unexpected argument '%s', see 'todo help cal'", args[1])
+      }
+      month := ""
+      if len(args) == 1 {
+        month = args[0]
+      }
+      first, err := parseMonth(month, time.Now())
+      if err != nil {
+        return invalidf("%v", err)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return showCalendar(s, first)
+    },
+  })
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+  "os"
+  "os/signal"
+  "time"
+
+  "golang.org/x/net/context"
+)
+
+// timeoutFlag is how long a command may take, given with --timeout.
+// Zero means no limit
+var timeoutFlag time.Duration
+
+// cmdCtx is the context of the running command, which requests to the
+// backend are made with. It is cancelled on Ctrl-C and once --timeout
+// passes
+var cmdCtx = context.Background()
+
+// commandContext returns a context cancelled on the first Ctrl-C, and
+// after --timeout if it is given. A second Ctrl-C terminates todo as
+// usual, should the command not stop in time
+func commandContext() (context.Context, context.CancelFunc) {
+  var ctx context.Context
+  var cancel context.CancelFunc
+  if timeoutFlag > 0 {
+    ctx, cancel = context.WithTimeout(context.Background(), timeoutFlag)
+  } else {
+    ctx, cancel = context.WithCancel(context.Background())
+  }
+
+  interrupts := make(chan os.Signal, 1)
+  signal.Notify(interrupts, os.Interrupt)
+  go func() {
+    select {
+    case <-interrupts:
+      verbosef("Interrupted, cancelling")
+      cancel()
+    case <-ctx.Done():
+    }
+    signal.Stop(interrupts)
+  }()
+  return ctx, cancel
+}
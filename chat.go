@@ -0,0 +1,186 @@
+package main
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// chatHelp describes the messages a chat understands
+const chatHelp = "list (or nothing) to list tasks, add <title> or just <title> to add one, done <number|title> to complete one"
+
+// chat answers the messages of chat integrations such as Slack, acting
+// on the task list of one account
+type chat struct {
+  client   todo.Backend
+  listId   string
+  listName string
+}
+
+// newChat returns a chat acting on the current list of the current
+// account
+func newChat(ctx context.Context) (*chat, error) {
+  client, err := newClient()
+  if err != nil {
+    return nil, err
+  }
+  name := currentList()
+  // the default list is created if missing, as by newSession
+  id, err := getTodoId(ctx, client, name, listFlag == "" || listFlag == loadConfig().DefaultList)
+  if err == todo.ErrNotFound {
+    return nil, notFoundf("No task list named '%s', see 'todo lists'", name)
+  }
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve todo task list: %w", err)
+  }
+  return &chat{client: client, listId: id, listName: name}, nil
+}
+
+// chatAccounts returns a chat for each of accounts, acting as it, and for
+// the current account if accounts is empty
+func chatAccounts(ctx context.Context, accounts []string) (map[string]*chat, error) {
+  chats := map[string]*chat{}
+  if len(accounts) == 0 {
+    c, err := newChat(ctx)
+    if err != nil {
+      return nil, err
+    }
+    chats[currentAccount()] = c
+    return chats, nil
+  }
+  saved := accountFlag
+  defer func() { accountFlag = saved }()
+  for _, account := range accounts {
+    if chats[account] != nil {
+      continue
+    }
+    accountFlag = account
+    c, err := newChat(ctx)
+    if err != nil {
+      return nil, fmt.Errorf("Account %s: %w", account, err)
+    }
+    chats[account] = c
+  }
+  return chats, nil
+}
+
+// parseChatUsers parses a comma separated list of user=account pairs,
+// mapping chat users to the accounts they act as
+func parseChatUsers(value string) (map[string]string, error) {
+  users := map[string]string{}
+  for _, pair := range strings.Split(value, ",") {
+    if strings.TrimSpace(pair) == "" {
+      continue
+    }
+    kv := strings.SplitN(pair, "=", 2)
+    if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+      return nil, fmt.Errorf("expected user=account, got '%s'", pair)
+    }
+    users[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+  }
+  return users, nil
+}
+
+// answer runs the command in text and returns the reply, along with the
+// tasks of the list when listing them
+func (c *chat) answer(ctx context.Context, text string) (string, []*todo.Task, error) {
+  words := strings.Fields(text)
+  cmd := ""
+  if len(words) > 0 {
+    cmd = strings.ToLower(strings.TrimPrefix(words[0], "/"))
+  }
+  switch cmd {
+  case "", "list", "ls":
+    items, err := c.client.List(ctx, c.listId)
+    if err != nil {
+      return "", nil, err
+    }
+    if len(items) == 0 {
+      return fmt.Sprintf("Nothing to do in your %s list", c.listName), nil, nil
+    }
+    return c.listing(items), items, nil
+  case "help", "start":
+    return chatHelp, nil, nil
+  case "done", "complete":
+    return c.complete(ctx, strings.Join(words[1:], " "))
+  case "add":
+    words = words[1:]
+  }
+
+  words, tags := splitTags(words)
+  title, due := parseDue(strings.Join(words, " "), time.Now())
+  if title == "" {
+    return "", nil, invalidf("Missing task title")
+  }
+  task, err := c.client.Add(ctx, c.listId, &todo.Task{Title: title, Tags: tags, Due: todo.Date(due)})
+  if err != nil {
+    return "", nil, err
+  }
+  reply := fmt.Sprintf("Added '%s' to your %s list", task.Title, c.listName)
+  if !task.Due.IsZero() {
+    reply += ", due " + formatDate(task.Due)
+  }
+  return reply, nil, nil
+}
+
+// complete marks the task at the 1-based index query of the list, or else
+// the one whose title matches query, as completed
+func (c *chat) complete(ctx context.Context, query string) (string, []*todo.Task, error) {
+  if query == "" {
+    return "", nil, invalidf("Missing task number or title")
+  }
+  items, err := c.client.List(ctx, c.listId)
+  if err != nil {
+    return "", nil, err
+  }
+  var task *todo.Task
+  if i, err := strconv.Atoi(query); err == nil {
+    if i < 1 || i > len(items) {
+      return "", nil, invalidf("No task %d in your %s list", i, c.listName)
+    }
+    task = items[i-1]
+  } else {
+    matches := findTodoItems(items, query)
+    if len(matches) == 0 {
+      return "", nil, notFoundf("No task in your %s list matches '%s'", c.listName, query)
+    }
+    if len(matches) > 1 {
+      return "", nil, invalidf("%d tasks match '%s', complete one by number", len(matches), query)
+    }
+    task = matches[0]
+  }
+  return c.completeID(ctx, task.ID, task.Title)
+}
+
+// completeID marks the task with the given id and title as completed
+func (c *chat) completeID(ctx context.Context, id string, title string) (string, []*todo.Task, error) {
+  if _, err := c.client.Complete(ctx, c.listId, id); err != nil {
+    return "", nil, err
+  }
+  return fmt.Sprintf("Task '%s' marked as completed", title), nil, nil
+}
+
+// listing describes items one per line, numbered
+func (c *chat) listing(items []*todo.Task) string {
+  lines := []string{fmt.Sprintf("Your %s list:", c.listName)}
+  for i, task := range items {
+    lines = append(lines, fmt.Sprintf("%d. %s", i+1, chatTask(task)))
+  }
+  return strings.Join(lines, "\n")
+}
+
+// chatTask describes task on one line, with its tags and due date
+func chatTask(task *todo.Task) string {
+  line := task.Title
+  for _, tag := range task.Tags {
+    line += " +" + tag
+  }
+  if !task.Due.IsZero() {
+    line += " (due " + formatDate(task.Due) + ")"
+  }
+  return line
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+  "fmt"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// Hides the completed tasks of the todo list from Google Tasks apps. With
+// before set, only the tasks completed before then are cleared, which
+// Google Tasks can only do by deleting them, as do backends that can not
+// hide tasks. Tasks whose deletion would take subtasks that are to be
+// kept along are left alone
+func clearTodoItems(s *session, before time.Time) error {
+  if s.offline {
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Completed tasks are not cached, clear needs %s", currentBackend())}
+  }
+  open, err := s.items()
+  if err != nil {
+    return err
+  }
+  completed, err := s.client.Completed(s.ctx, s.todoId, time.Time{}, time.Time{})
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+  }
+  var visible []*todo.Task
+  for _, task := range completed {
+    if !task.Hidden && (before.IsZero() || task.Completed.Before(before)) {
+      visible = append(visible, task)
+    }
+  }
+  if len(visible) == 0 {
+    infof("No completed tasks to clear in your %s list", s.listName)
+    return nil
+  }
+
+  if clearer, ok := s.client.(todo.Clearer); ok && before.IsZero() {
+    if err := clearer.Clear(s.ctx, s.todoId); err != nil {
+      return fmt.Errorf("Unable to clear completed tasks: %w", err)
+    }
+    infof("%s cleared from your %s list", plural(len(visible), "completed task"), s.listName)
+    return nil
+  }
+
+  doomed := map[string]bool{}
+  for _, task := range visible {
+    doomed[task.ID] = true
+  }
+  all := append(append([]*todo.Task{}, open...), completed...)
+  var targets []*todo.Task
+  for _, task := range visible {
+    keep := false
+    for _, sub := range subtasks(all, task) {
+      keep = keep || !doomed[sub.ID]
+    }
+    if !keep {
+      targets = append(targets, task)
+    }
+  }
+  if len(targets) == 0 {
+    infof("No completed tasks to clear in your %s list, all have subtasks to keep", s.listName)
+    return nil
+  }
+
+  // subtasks go along with their parent
+  byID := map[string]*todo.Task{}
+  for _, task := range all {
+    byID[task.ID] = task
+  }
+  selected := map[string]bool{}
+  for _, task := range targets {
+    selected[task.ID] = true
+  }
+  var roots []*todo.Task
+  for _, task := range targets {
+    nested := false
+    for p := byID[task.Parent]; p != nil && !nested; p = byID[p.Parent] {
+      nested = selected[p.ID]
+    }
+    if !nested {
+      roots = append(roots, task)
+    }
+  }
+  err = s.mutateAll(opDelete, roots, func(task *todo.Task) {
+    verbosef("Task '%s' deleted", task.Title)
+  })
+  if err != nil {
+    return err
+  }
+  infof("%s deleted from your %s list", plural(len(targets), "completed task"), s.listName)
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "clear",
+    usage:   "clear [--older-than 30d|date]",
+    summary: "Hide completed tasks from the list, or delete those completed long ago",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      olderThan := fs.String("older-than", "", "only clear tasks completed before this, e.g. 30d or a date, by deleting them")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help clear'", args[0])
+      }
+      var before time.Time
+      if *olderThan != "" {
+        if before, err = parseSince(*olderThan, time.Now()); err != nil {
+          return invalidf("Invalid --older-than: %v", err)
+        }
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return clearTodoItems(s, before)
+    },
+  })
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "os"
+  "os/exec"
+  "runtime"
+  "strings"
+)
+
+// clipboardCommands returns the commands reading and writing the system
+// clipboard, tried in order until one is installed
+func clipboardCommands(write bool) [][]string {
+  switch runtime.GOOS {
+  case "darwin":
+    if write {
+      return [][]string{{"pbcopy"}}
+    }
+    return [][]string{{"pbpaste"}}
+  case "windows":
+    if write {
+      return [][]string{{"powershell", "-NoProfile", "-Command", "$input | Set-Clipboard"}, {"clip"}}
+    }
+    return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}}
+  }
+  var cmds [][]string
+  if os.Getenv("WAYLAND_DISPLAY") != "" {
+    if write {
+      cmds = append(cmds, []string{"wl-copy"})
+    } else {
+      cmds = append(cmds, []string{"wl-paste", "--no-newline"})
+    }
+  }
+  if write {
+    return append(cmds, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+  }
+  return append(cmds, []string{"xclip", "-selection", "clipboard", "-o"}, []string{"xsel", "--clipboard", "--output"})
+}
+
+// clipboard runs the first installed clipboard command with stdin as its
+// input, returning its output
+func clipboard(write bool, stdin string) (string, error) {
+  var names []string
+  for _, args := range clipboardCommands(write) {
+    path, err := exec.LookPath(args[0])
+    if err != nil {
+      names = append(names, args[0])
+      continue
+    }
+    var out, stderr bytes.Buffer
+    cmd := exec.Command(path, args[1:]...)
+    cmd.Stdin, cmd.Stdout, cmd.Stderr = strings.NewReader(stdin), &out, &stderr
+    if err := cmd.Run(); err != nil {
+      return "", fmt.Errorf("Unable to access the clipboard with %s: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+    }
+    return out.String(), nil
+  }
+  return "", fmt.Errorf("Unable to access the clipboard, install one of %s", strings.Join(names, ", "))
+}
+
+// readClipboard returns the text in the system clipboard
+func readClipboard() (string, error) {
+  text, err := clipboard(false, "")
+  if err == nil && strings.TrimSpace(text) == "" {
+    return "", invalidf("The clipboard holds no text")
+  }
+  return text, err
+}
+
+// writeClipboard replaces the contents of the system clipboard with text
+func writeClipboard(text string) error {
+  _, err := clipboard(true, text)
+  return err
+}
+
+// Copies the title of the todo item at the given index to the clipboard,
+// followed by its notes on the next lines unless titleOnly is set, the
+// way add --from-clipboard reads tasks
+func copyTodoItem(s *session, arg string, titleOnly bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  text := task.Title
+  if task.Notes != "" && !titleOnly {
+    text += "\n" + task.Notes
+  }
+  if err := writeClipboard(text); err != nil {
+    return err
+  }
+  infof("Task '%s' copied to the clipboard", task.Title)
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "copy",
+    usage:   "copy [--title] <index>",
+    summary: "Copy the title and notes of a task to the clipboard",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      titleOnly := fs.Bool("title", false, "copy only the title")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 {
+        return invalidf("Expected exactly one task index, see 'todo help copy'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return copyTodoItem(s, args[0], *titleOnly)
+    },
+  })
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "sort"
+  "strings"
+)
+
+// command is a todo subcommand such as add or list
+type command struct {
+  name    string
+  aliases []string
+  usage   string
+  summary string
+  run     func(cmd *command, args []string) error
+}
+
+var commands = map[string]*command{}
+
+// register makes cmd available under its name and aliases. It is meant to
+// be called from init functions of the files implementing each command
+func register(cmd *command) {
+  for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+    if _, ok := commands[name]; ok {
+      panic("todo: command registered twice: " + name)
+    }
+    commands[name] = cmd
+  }
+}
+
+// lookupCommand returns the command registered under name, or nil
+func lookupCommand(name string) *command {
+  return commands[name]
+}
+
+// flags returns a FlagSet for cmd whose usage message describes cmd
+func (cmd *command) flags() *flag.FlagSet {
+  fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+  fs.StringVar(&listFlag, "list", listFlag, "task list to operate on")
+  fs.StringVar(&accountFlag, "account", accountFlag, "account to act as, see 'todo auth list'")
+  fs.BoolVar(&noRetryFlag, "no-retry", noRetryFlag, "do not retry failed Google Tasks requests")
+  fs.StringVar(&backendFlag, "backend", backendFlag, "where tasks are kept: google, local, todoist or caldav")
+  fs.StringVar(&tokenFlag, "token", tokenFlag, "API token of the todoist backend")
+  fs.BoolVar(&noColorFlag, "no-color", noColorFlag, "do not colorize output")
+  fs.StringVar(&clientSecretFlag, "client-secret", clientSecretFlag, "OAuth client secret file to authorize todo with")
+  fs.BoolVar(&quietFlag, "quiet", quietFlag, "do not report what was changed")
+  fs.BoolVar(&quietFlag, "q", quietFlag, "short for --quiet")
+  fs.BoolVar(&verboseFlag, "verbose", verboseFlag, "log HTTP requests, retries and cache use")
+  fs.BoolVar(&verboseFlag, "v", verboseFlag, "short for --verbose")
+  fs.BoolVar(&debugFlag, "debug", debugFlag, "like --verbose, also logging HTTP headers")
+  fs.DurationVar(&timeoutFlag, "timeout", timeoutFlag, "give up on the command after this long, e.g. 30s")
+  fs.StringVar(&outputFlag, "output", outputFlag, "output format: text or json, overriding the output setting")
+  fs.StringVar(&dateFormatFlag, "date-format", dateFormatFlag, "Go time layout to print dates with, e.g. 'Jan 2'")
+  fs.BoolVar(&noContextFlag, "no-context", noContextFlag, "ignore the .todo file of the working directory")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "Usage: todo %s\n\n%s\n", cmd.usage, cmd.summary)
+    if len(cmd.aliases) > 0 {
+      fmt.Fprintf(fs.Output(), "\nAliases: %s\n", strings.Join(cmd.aliases, ", "))
+    }
+    fmt.Fprintf(fs.Output(), "\nFlags:\n")
+    fs.PrintDefaults()
+  }
+  return fs
+}
+
+// parseFlags parses args with fs, allowing flags to appear after positional
+// arguments, and returns the positional arguments. Everything after a "--"
+// argument is treated as positional. Help requests are returned as
+// flag.ErrHelp, the FlagSet has printed the help by then
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+  var rest []string
+  for {
+    if err := fs.Parse(args); err == flag.ErrHelp {
+      return nil, err
+    } else if err != nil {
+      // the FlagSet already printed the error along with its usage
+      return nil, &exitError{code: exitInvalid, err: err, reported: true}
+    }
+    consumed := len(args) - fs.NArg()
+    if consumed > 0 && args[consumed-1] == "--" {
+      return append(rest, fs.Args()...), applyOutputFlag()
+    }
+    if fs.NArg() == 0 {
+      return rest, applyOutputFlag()
+    }
+    rest = append(rest, fs.Arg(0))
+    args = fs.Args()[1:]
+  }
+}
+
+// usage prints the top-level help listing all commands
+func usage() {
+  out := flag.CommandLine.Output()
+  fmt.Fprintf(out, "Usage: todo <command> [flags] [args]\n\n")
+  fmt.Fprintf(out, "Simple interface for interacting with your Google Tasks.\n")
+  fmt.Fprintf(out, "Running todo without a command lists your tasks.\n\n")
+  fmt.Fprintf(out, "Global flags:\n")
+  flag.PrintDefaults()
+  fmt.Fprintf(out, "\nCommands:\n")
+
+  var names []string
+  seen := map[*command]bool{}
+  for _, cmd := range commands {
+    if !seen[cmd] {
+      seen[cmd] = true
+      names = append(names, cmd.name)
+    }
+  }
+  sort.Strings(names)
+  for _, name := range names {
+    fmt.Fprintf(out, "  %-10s %s\n", name, commands[name].summary)
+  }
+  if names := plugins(); len(names) > 0 {
+    fmt.Fprintf(out, "\nPlugins:\n")
+    for _, name := range names {
+      fmt.Fprintf(out, "  %-10s %s\n", name, findPlugin(name))
+    }
+  }
+  if aliases := sortedAliases(); len(aliases) > 0 {
+    fmt.Fprintf(out, "\nAliases:\n")
+    for _, name := range aliases {
+      fmt.Fprintf(out, "  %-10s %s\n", name, loadConfig().Aliases[name])
+    }
+  }
+  fmt.Fprintf(out, "\nRun 'todo help <command>' for more information on a command.\n")
+}
+
+func init() {
+  register(&command{
+    name:    "help",
+    usage:   "help [command]",
+    summary: "Show help for todo or one of its commands",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        usage()
+        return nil
+      }
+      c := lookupCommand(args[0])
+      if c == nil {
+        if plugin := findPlugin(args[0]); plugin != "" {
+          return runPlugin(plugin, args[0], []string{"--help"})
+        }
+        return invalidf("unknown command '%s'", args[0])
+      }
+      // every command defines its flags when run, so let its own
+      // FlagSet print the help
+      return c.run(c, []string{"-h"})
+    },
+  })
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+  "bufio"
+  "fmt"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// findTodoItems returns the tasks whose title matches query, preferring
+// exact matches over substring matches over subsequence matches
+func findTodoItems(items []*todo.Task, query string) []*todo.Task {
+  q := strings.ToLower(query)
+  var exact, substr, subseq []*todo.Task
+  for _, task := range items {
+    title := strings.ToLower(task.Title)
+    switch {
+    case title == q:
+      exact = append(exact, task)
+    case strings.Contains(title, q):
+      substr = append(substr, task)
+    case isSubsequence(q, title):
+      subseq = append(subseq, task)
+    }
+  }
+  if len(exact) > 0 {
+    return exact
+  }
+  if len(substr) > 0 {
+    return substr
+  }
+  return subseq
+}
+
+// isSubsequence reports whether all characters of q appear in s in order
+func isSubsequence(q string, s string) bool {
+  r := []rune(q)
+  if len(r) == 0 {
+    return false
+  }
+  for _, c := range s {
+    if c == r[0] {
+      r = r[1:]
+      if len(r) == 0 {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+// confirmf asks a yes/no question on stdout and reads the answer from
+// stdin. Anything other than y or yes, or their translation, counts as no
+func confirmf(format string, a ...interface{}) bool {
+  fmt.Printf("%s %s ", fmt.Sprintf(tr(format), a...), tr("[y/N]"))
+  answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+  answer = strings.ToLower(strings.TrimSpace(answer))
+  return answer == "y" || answer == "yes" || answer == tr("y") || answer == tr("yes")
+}
+
+// Marks the todo item matching query as completed. When more than one task
+// matches, the user is asked to confirm each one. With cascade set, the
+// subtasks of completed tasks are completed as well. Tasks blocked by
+// completed ones are unblocked
+func completeTodoItem(s *session, query string, cascade bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  matches, err := s.find(items, query)
+  if err != nil {
+    return err
+  }
+  if len(matches) == 0 {
+    return notFoundf("No task in your %s list matches '%s'", s.listName, query)
+  }
+
+  var done []*todo.Task
+  for _, task := range matches {
+    if len(matches) > 1 && !confirmf("Complete '%s'?", task.Title) {
+      continue
+    }
+
+    if cascade {
+      for _, sub := range subtasks(items, task) {
+        if err := s.complete(sub); err != nil {
+          return err
+        }
+        infof("Subtask '%s' marked as completed", sub.Title)
+        done = append(done, sub)
+      }
+    }
+    if err := completeTask(s, task); err != nil {
+      return err
+    }
+    done = append(done, task)
+  }
+  return unblockAfter(s, done)
+}
+
+// completeTask marks task as completed and, if it recurs, adds its next
+// occurrence
+func completeTask(s *session, task *todo.Task) error {
+  recurring := task
+  if task.Every != nil {
+    // the completed task must no longer recur, or it would be
+    // recreated once more by 'todo recur tick'
+    var err error
+    if task, err = s.update(task, &todo.Patch{Every: &todo.Recurrence{}}); err != nil {
+      return err
+    }
+  }
+  if err := s.complete(task); err != nil {
+    return err
+  }
+  infof("Task '%s' marked as completed", task.Title)
+  if recurring.Every != nil {
+    next, err := recur(s, recurring, time.Now())
+    if err != nil {
+      return err
+    }
+    infof("Next occurrence due %s", formatDate(next.Due))
+  }
+  return nil
+}
+
+// Marks the tasks of the todo list with all of tags, and with overdue set
+// only those past their due date, as completed, after listing them and
+// asking for confirmation unless force is set. With cascade set, their
+// subtasks are completed as well. Tasks blocked by completed ones are
+// unblocked
+func completeTodoItems(s *session, tags []string, overdue bool, cascade bool, force bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  today := todo.Date(time.Now())
+  var targets []*todo.Task
+  seen := map[string]bool{}
+  for _, task := range items {
+    if !hasAllTags(task, tags) || overdue && (task.Due.IsZero() || daysUntil(task.Due, today) >= 0) {
+      continue
+    }
+    selected := []*todo.Task{task}
+    if cascade {
+      selected = append(subtasks(items, task), task)
+    }
+    for _, t := range selected {
+      if !seen[t.ID] {
+        seen[t.ID] = true
+        targets = append(targets, t)
+      }
+    }
+  }
+  if len(targets) == 0 {
+    return notFoundf("No task in your %s list to complete", s.listName)
+  }
+
+  if !force {
+    for _, task := range targets {
+      fmt.Printf("  %s\n", task.Title)
+    }
+    if !confirmf("Complete %s?", plural(len(targets), "task")) {
+      return nil
+    }
+  }
+  // recurring tasks are completed one at a time to add their next
+  // occurrence, the others in parallel
+  var plain, done []*todo.Task
+  for _, task := range targets {
+    if task.Every == nil {
+      plain = append(plain, task)
+      continue
+    }
+    if err := completeTask(s, task); err != nil {
+      return err
+    }
+    done = append(done, task)
+  }
+  err = s.mutateAll(opComplete, plain, func(task *todo.Task) {
+    infof("Task '%s' marked as completed", task.Title)
+    done = append(done, task)
+  })
+  if err != nil {
+    return err
+  }
+  return unblockAfter(s, done)
+}
+
+// subtasks returns the tasks in items nested below parent, deepest first
+func subtasks(items []*todo.Task, parent *todo.Task) []*todo.Task {
+  var subs []*todo.Task
+  for _, task := range items {
+    if task.Parent == parent.ID && task != parent {
+      subs = append(subs, subtasks(items, task)...)
+      subs = append(subs, task)
+    }
+  }
+  return subs
+}
+
+func init() {
+  register(&command{
+    name:    "done",
+    aliases: []string{"complete"},
+    usage:   "done [--cascade] <index|title> | done [--cascade] [--force] (--all | --overdue | +tag...)",
+    summary: "Mark a task, or all tasks, overdue ones or those with tags, as completed",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      cascade := fs.Bool("cascade", false, "also complete the task's subtasks")
+      all := fs.Bool("all", false, "complete all tasks of the list")
+      overdue := fs.Bool("overdue", false, "complete the tasks past their due date")
+      force := fs.Bool("force", false, "complete several tasks without asking for confirmation")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      words, tags := splitTags(args)
+      bulk := *all || *overdue || len(words) == 0 && len(tags) > 0
+      if bulk && len(words) > 0 {
+        return invalidf("Unexpected argument '%s' with --all or --overdue, see 'todo help done'", words[0])
+      }
+      if len(args) == 0 && !bulk {
+        return invalidf("Missing task index or title, see 'todo help done'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if bulk {
+        return completeTodoItems(s, tags, *overdue, *cascade, *force)
+      }
+      return completeTodoItem(s, strings.Join(args, " "), *cascade)
+    },
+  })
+}
@@ -0,0 +1,808 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+
+  "gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+  outputText = "text"
+  outputJSON = "json"
+)
+
+// defaultDateFormat is the Go time layout used to print dates unless
+// date_format is set
+const defaultDateFormat = "2006-01-02"
+
+// config holds the settings read from config.yaml in the config directory
+type config struct {
+  DefaultList        string            `yaml:"default_list,omitempty"`
+  DefaultAccount     string            `yaml:"default_account,omitempty"`
+  ClientSecret       string            `yaml:"client_secret,omitempty"`
+  TokenFile          string            `yaml:"token_file,omitempty"`
+  TokenStore         string            `yaml:"token_store,omitempty"`
+  ServiceAccount     string            `yaml:"service_account,omitempty"`
+  Impersonate        string            `yaml:"impersonate,omitempty"`
+  RefreshToken       string            `yaml:"refresh_token,omitempty"`
+  Output             string            `yaml:"output,omitempty"`
+  DateFormat         string            `yaml:"date_format,omitempty"`
+  Color              *bool             `yaml:"color,omitempty"`
+  MaxAttempts        int               `yaml:"max_attempts,omitempty"`
+  MaxQPS             float64           `yaml:"max_qps,omitempty"`
+  DueTime            string            `yaml:"due_time,omitempty"`
+  Backend            string            `yaml:"backend,omitempty"`
+  LocalFile          string            `yaml:"local_file,omitempty"`
+  TodoistToken       string            `yaml:"todoist_token,omitempty"`
+  CalDAVURL          string            `yaml:"caldav_url,omitempty"`
+  CalDAVUsername     string            `yaml:"caldav_username,omitempty"`
+  CalDAVPassword     string            `yaml:"caldav_password,omitempty"`
+  SMTPServer         string            `yaml:"smtp_server,omitempty"`
+  SMTPUsername       string            `yaml:"smtp_username,omitempty"`
+  SMTPPassword       string            `yaml:"smtp_password,omitempty"`
+  SMTPFrom           string            `yaml:"smtp_from,omitempty"`
+  SlackSigningSecret string            `yaml:"slack_signing_secret,omitempty"`
+  SlackUsers         string            `yaml:"slack_users,omitempty"`
+  TelegramToken      string            `yaml:"telegram_token,omitempty"`
+  TelegramUsers      string            `yaml:"telegram_users,omitempty"`
+  IMAPServer         string            `yaml:"imap_server,omitempty"`
+  IMAPUsername       string            `yaml:"imap_username,omitempty"`
+  IMAPPassword       string            `yaml:"imap_password,omitempty"`
+  IMAPMailbox        string            `yaml:"imap_mailbox,omitempty"`
+  GitHubToken        string            `yaml:"github_token,omitempty"`
+  JiraURL            string            `yaml:"jira_url,omitempty"`
+  JiraEmail          string            `yaml:"jira_email,omitempty"`
+  JiraToken          string            `yaml:"jira_token,omitempty"`
+  JiraSprintField    string            `yaml:"jira_sprint_field,omitempty"`
+  WebhookURLs        string            `yaml:"webhook_urls,omitempty"`
+  WebhookSecret      string            `yaml:"webhook_secret,omitempty"`
+  StatusFormat       string            `yaml:"status_format,omitempty"`
+  Picker             string            `yaml:"picker,omitempty"`
+  Unique             bool              `yaml:"unique,omitempty"`
+  Language           string            `yaml:"language,omitempty"`
+  Timezone           string            `yaml:"timezone,omitempty"`
+  WeekStart          string            `yaml:"week_start,omitempty"`
+  Sort               string            `yaml:"sort,omitempty"`
+  BackupAuto         string            `yaml:"backup_auto,omitempty"`
+  BackupKeep         int               `yaml:"backup_keep,omitempty"`
+  BackupDir          string            `yaml:"backup_dir,omitempty"`
+  BackupS3           string            `yaml:"backup_s3,omitempty"`
+  S3Region           string            `yaml:"s3_region,omitempty"`
+  S3AccessKey        string            `yaml:"s3_access_key,omitempty"`
+  S3SecretKey        string            `yaml:"s3_secret_key,omitempty"`
+  Telemetry          bool              `yaml:"telemetry,omitempty"`
+  TelemetryURL       string            `yaml:"telemetry_url,omitempty"`
+  AuditLog           *bool             `yaml:"audit_log,omitempty"`
+  Aliases            map[string]string `yaml:"aliases,omitempty"`
+}
+
+// configKey describes a setting that can be read and changed with
+// 'todo config' and overridden by an environment variable
+type configKey struct {
+  help string
+  // secret keys are masked when listing the configuration
+  secret bool
+  get    func(c *config) string
+  set    func(c *config, value string) error
+}
+
+var configKeys = map[string]configKey{
+  "default_list": {
+    help: "task list used when --list is not given",
+    get:  func(c *config) string { return c.DefaultList },
+    set:  func(c *config, v string) error { c.DefaultList = v; return nil },
+  },
+  "default_account": {
+    help: "account used when --account is not given",
+    get:  func(c *config) string { return c.DefaultAccount },
+    set:  func(c *config, v string) error { c.DefaultAccount = v; return nil },
+  },
+  "backend": {
+    help: "where tasks are kept, google (Google Tasks), local (a JSON file), todoist or caldav",
+    get:  func(c *config) string { return c.Backend },
+    set: func(c *config, v string) error {
+      switch v {
+      case "", backendGoogle, backendLocal, backendTodoist, backendCalDAV:
+      default:
+        return fmt.Errorf("backend must be %s", backendNames)
+      }
+      c.Backend = v
+      return nil
+    },
+  },
+  "local_file": {
+    help: "path to the file of the local backend, or its URL in a bucket such as s3://bucket/tasks.json, local/<account>.json in the data directory by default",
+    get:  func(c *config) string { return c.LocalFile },
+    set: func(c *config, v string) error {
+      if _, err := newS3Object(v); isBucketURL(v) && err != nil {
+        return err
+      }
+      c.LocalFile = v
+      return nil
+    },
+  },
+  "todoist_token": {
+    help:   "API token of the todoist backend, see Todoist's integration settings",
+    secret: true,
+    get:    func(c *config) string { return c.TodoistToken },
+    set:    func(c *config, v string) error { c.TodoistToken = v; return nil },
+  },
+  "caldav_url": {
+    help: "address of the collection holding your calendars, for the caldav backend",
+    get:  func(c *config) string { return c.CalDAVURL },
+    set:  func(c *config, v string) error { c.CalDAVURL = v; return nil },
+  },
+  "caldav_username": {
+    help: "user name to sign in to the CalDAV server with",
+    get:  func(c *config) string { return c.CalDAVUsername },
+    set:  func(c *config, v string) error { c.CalDAVUsername = v; return nil },
+  },
+  "caldav_password": {
+    help:   "password to sign in to the CalDAV server with, preferably an app password",
+    secret: true,
+    get:    func(c *config) string { return c.CalDAVPassword },
+    set:    func(c *config, v string) error { c.CalDAVPassword = v; return nil },
+  },
+  "client_secret": {
+    help: "path to the OAuth client secret JSON file",
+    get:  func(c *config) string { return c.ClientSecret },
+    set:  func(c *config, v string) error { c.ClientSecret = v; return nil },
+  },
+  "token_file": {
+    help: "path to the cached OAuth token of the default account",
+    get:  func(c *config) string { return c.TokenFile },
+    set:  func(c *config, v string) error { c.TokenFile = v; return nil },
+  },
+  "token_store": {
+    help: "where to keep OAuth tokens, file or keyring (the system keychain)",
+    get:  func(c *config) string { return c.TokenStore },
+    set: func(c *config, v string) error {
+      if v != "" && v != tokenStoreFile && v != tokenStoreKeyring {
+        return fmt.Errorf("token_store must be %s or %s", tokenStoreFile, tokenStoreKeyring)
+      }
+      c.TokenStore = v
+      return nil
+    },
+  },
+  "service_account": {
+    help: "path to a service account JSON key to authenticate with instead of signing in",
+    get:  func(c *config) string { return c.ServiceAccount },
+    set:  func(c *config, v string) error { c.ServiceAccount = v; return nil },
+  },
+  "impersonate": {
+    help: "user the service account acts as through domain-wide delegation",
+    get:  func(c *config) string { return c.Impersonate },
+    set:  func(c *config, v string) error { c.Impersonate = v; return nil },
+  },
+  "refresh_token": {
+    help:   "OAuth refresh token to authenticate with instead of the cached token, best set as TODO_REFRESH_TOKEN",
+    secret: true,
+    get:    func(c *config) string { return c.RefreshToken },
+    set:    func(c *config, v string) error { c.RefreshToken = v; return nil },
+  },
+  "output": {
+    help: "output format of listings, text or json",
+    get:  func(c *config) string { return c.Output },
+    set: func(c *config, v string) error {
+      if v != "" && v != outputText && v != outputJSON {
+        return fmt.Errorf("output must be %s or %s", outputText, outputJSON)
+      }
+      c.Output = v
+      return nil
+    },
+  },
+  "date_format": {
+    help: "Go time layout used to print dates, e.g. 'Jan 2' or '02.01.2006'",
+    get:  func(c *config) string { return c.DateFormat },
+    set:  func(c *config, v string) error { c.DateFormat = v; return nil },
+  },
+  "color": {
+    help: "colorize output, true or false; by default only on terminals",
+    get: func(c *config) string {
+      if c.Color == nil {
+        return ""
+      }
+      return strconv.FormatBool(*c.Color)
+    },
+    set: func(c *config, v string) error {
+      if v == "" {
+        c.Color = nil
+        return nil
+      }
+      b, err := strconv.ParseBool(v)
+      if err != nil {
+        return fmt.Errorf("color must be true or false")
+      }
+      c.Color = &b
+      return nil
+    },
+  },
+  "due_time": {
+    help: "time of day tasks are due at for reminders, e.g. 17:00; 09:00 by default",
+    get:  func(c *config) string { return c.DueTime },
+    set: func(c *config, v string) error {
+      if v != "" {
+        if _, err := time.Parse("15:04", v); err != nil {
+          return fmt.Errorf("due_time must be a time such as 09:00")
+        }
+      }
+      c.DueTime = v
+      return nil
+    },
+  },
+  "max_attempts": {
+    help: "how often to try Google Tasks requests failing with 429, 403 rate limits or 5xx, 1 disables retries",
+    get: func(c *config) string {
+      if c.MaxAttempts == 0 {
+        return ""
+      }
+      return strconv.Itoa(c.MaxAttempts)
+    },
+    set: func(c *config, v string) error {
+      if v == "" {
+        c.MaxAttempts = 0
+        return nil
+      }
+      n, err := strconv.Atoi(v)
+      if err != nil || n < 1 {
+        return fmt.Errorf("max_attempts must be a positive number")
+      }
+      c.MaxAttempts = n
+      return nil
+    },
+  },
+  "max_qps": {
+    help: "most requests sent per second, 10 by default",
+    get: func(c *config) string {
+      if c.MaxQPS == 0 {
+        return ""
+      }
+      return strconv.FormatFloat(c.MaxQPS, 'f', -1, 64)
+    },
+    set: func(c *config, v string) error {
+      if v == "" {
+        c.MaxQPS = 0
+        return nil
+      }
+      n, err := strconv.ParseFloat(v, 64)
+      if err != nil || n <= 0 {
+        return fmt.Errorf("max_qps must be a positive number")
+      }
+      c.MaxQPS = n
+      return nil
+    },
+  },
+  "smtp_server": {
+    help: "host:port of the SMTP server digests are sent through, e.g. smtp.example.com:587",
+    get:  func(c *config) string { return c.SMTPServer },
+    set:  func(c *config, v string) error { c.SMTPServer = v; return nil },
+  },
+  "smtp_username": {
+    help: "user name to sign in to the SMTP server with, none to send without signing in",
+    get:  func(c *config) string { return c.SMTPUsername },
+    set:  func(c *config, v string) error { c.SMTPUsername = v; return nil },
+  },
+  "smtp_password": {
+    help:   "password to sign in to the SMTP server with, preferably an app password",
+    secret: true,
+    get:    func(c *config) string { return c.SMTPPassword },
+    set:    func(c *config, v string) error { c.SMTPPassword = v; return nil },
+  },
+  "smtp_from": {
+    help: "sender address of digests, smtp_username by default",
+    get:  func(c *config) string { return c.SMTPFrom },
+    set:  func(c *config, v string) error { c.SMTPFrom = v; return nil },
+  },
+  "slack_signing_secret": {
+    help:   "signing secret of the Slack app of 'todo slack serve', from its Basic Information page",
+    secret: true,
+    get:    func(c *config) string { return c.SlackSigningSecret },
+    set:    func(c *config, v string) error { c.SlackSigningSecret = v; return nil },
+  },
+  "slack_users": {
+    help: "Slack user ids and the accounts they act as, e.g. U012AB3CD=work,U045EF6GH=default",
+    get:  func(c *config) string { return c.SlackUsers },
+    set: func(c *config, v string) error {
+      if _, err := parseChatUsers(v); err != nil {
+        return fmt.Errorf("slack_users: %v", err)
+      }
+      c.SlackUsers = v
+      return nil
+    },
+  },
+  "telegram_token": {
+    help:   "token of the bot of 'todo telegram', from @BotFather",
+    secret: true,
+    get:    func(c *config) string { return c.TelegramToken },
+    set:    func(c *config, v string) error { c.TelegramToken = v; return nil },
+  },
+  "telegram_users": {
+    help: "ids of the Telegram users allowed to use the bot and the accounts they act as, e.g. 12345678=default",
+    get:  func(c *config) string { return c.TelegramUsers },
+    set: func(c *config, v string) error {
+      if _, err := parseChatUsers(v); err != nil {
+        return fmt.Errorf("telegram_users: %v", err)
+      }
+      c.TelegramUsers = v
+      return nil
+    },
+  },
+  "imap_server": {
+    help: "host:port of the IMAP server of 'todo ingest email', over TLS, or imap://host:port for a local bridge",
+    get:  func(c *config) string { return c.IMAPServer },
+    set:  func(c *config, v string) error { c.IMAPServer = v; return nil },
+  },
+  "imap_username": {
+    help: "user name to sign in to the IMAP server with",
+    get:  func(c *config) string { return c.IMAPUsername },
+    set:  func(c *config, v string) error { c.IMAPUsername = v; return nil },
+  },
+  "imap_password": {
+    help:   "password to sign in to the IMAP server with, preferably an app password",
+    secret: true,
+    get:    func(c *config) string { return c.IMAPPassword },
+    set:    func(c *config, v string) error { c.IMAPPassword = v; return nil },
+  },
+  "imap_mailbox": {
+    help: "mailbox to look for messages in, INBOX by default",
+    get:  func(c *config) string { return c.IMAPMailbox },
+    set:  func(c *config, v string) error { c.IMAPMailbox = v; return nil },
+  },
+  "github_token": {
+    help:   "personal access token 'todo github sync' reads issues with, best set as TODO_GITHUB_TOKEN",
+    secret: true,
+    get:    func(c *config) string { return c.GitHubToken },
+    set:    func(c *config, v string) error { c.GitHubToken = v; return nil },
+  },
+  "jira_url": {
+    help: "address of the Jira instance of 'todo jira sync', e.g. https://example.atlassian.net",
+    get:  func(c *config) string { return c.JiraURL },
+    set:  func(c *config, v string) error { c.JiraURL = v; return nil },
+  },
+  "jira_email": {
+    help: "email address to sign in to Jira Cloud with, none for a personal access token of Jira Server",
+    get:  func(c *config) string { return c.JiraEmail },
+    set:  func(c *config, v string) error { c.JiraEmail = v; return nil },
+  },
+  "jira_token": {
+    help:   "API token of Jira Cloud, or personal access token of Jira Server",
+    secret: true,
+    get:    func(c *config) string { return c.JiraToken },
+    set:    func(c *config, v string) error { c.JiraToken = v; return nil },
+  },
+  "jira_sprint_field": {
+    help: "custom field holding the sprints of issues, customfield_10020 by default",
+    get:  func(c *config) string { return c.JiraSprintField },
+    set:  func(c *config, v string) error { c.JiraSprintField = v; return nil },
+  },
+  "webhook_urls": {
+    help: "comma separated URLs 'todo serve' and the daemons POST task events to",
+    get:  func(c *config) string { return c.WebhookURLs },
+    set:  func(c *config, v string) error { c.WebhookURLs = v; return nil },
+  },
+  "webhook_secret": {
+    help:   "key of the HMAC-SHA256 signature of webhook events, in X-Todo-Signature",
+    secret: true,
+    get:    func(c *config) string { return c.WebhookSecret },
+    set:    func(c *config, v string) error { c.WebhookSecret = v; return nil },
+  },
+  "status_format": {
+    help: "template of the line printed by 'todo status' without --format",
+    get:  func(c *config) string { return c.StatusFormat },
+    set:  func(c *config, v string) error { c.StatusFormat = v; return nil },
+  },
+  "picker": {
+    help: "fuzzy finder 'todo pick' runs instead of its own, such as fzf --height 40%",
+    get:  func(c *config) string { return c.Picker },
+    set:  func(c *config, v string) error { c.Picker = v; return nil },
+  },
+  "unique": {
+    help: "true to have 'todo add' skip tasks already in the list, as with --unique",
+    get: func(c *config) string {
+      if !c.Unique {
+        return ""
+      }
+      return "true"
+    },
+    set: func(c *config, v string) error {
+      if v == "" {
+        c.Unique = false
+        return nil
+      }
+      b, err := strconv.ParseBool(v)
+      if err != nil {
+        return fmt.Errorf("unique must be true or false")
+      }
+      c.Unique = b
+      return nil
+    },
+  },
+  "language": {
+    help: "language of messages and dates: en, de, es or fa; by default that of LANG",
+    get:  func(c *config) string { return c.Language },
+    set:  func(c *config, v string) error { c.Language = v; return nil },
+  },
+  "timezone": {
+    help: "time zone deciding when days start, e.g. Europe/Berlin; by default that of the machine",
+    get:  func(c *config) string { return c.Timezone },
+    set: func(c *config, v string) error {
+      if _, err := time.LoadLocation(v); err != nil {
+        return fmt.Errorf("unknown time zone '%s'", v)
+      }
+      c.Timezone = v
+      return nil
+    },
+  },
+  "week_start": {
+    help: "first day of the week, e.g. sunday; monday by default",
+    get:  func(c *config) string { return c.WeekStart },
+    set: func(c *config, v string) error {
+      if _, ok := lookupWeekday(strings.ToLower(v), true); v != "" && !ok {
+        return fmt.Errorf("week_start must be a day of the week, e.g. monday or sunday")
+      }
+      c.WeekStart = strings.ToLower(v)
+      return nil
+    },
+  },
+  "sort": {
+    help: "order of todo list without --sort, e.g. due,priority; list order by default",
+    get:  func(c *config) string { return c.Sort },
+    set: func(c *config, v string) error {
+      if _, err := parseSortKeys(v); err != nil {
+        return fmt.Errorf("sort must be due, created, updated, title or priority, or several separated by commas")
+      }
+      c.Sort = strings.ToLower(v)
+      return nil
+    },
+  },
+  "backup_auto": {
+    help: "how often 'todo daemon' and 'todo backup run --if-due' back up: hourly, daily, weekly or a duration",
+    get:  func(c *config) string { return c.BackupAuto },
+    set: func(c *config, v string) error {
+      if _, err := parseBackupInterval(v); v != "" && err != nil {
+        return err
+      }
+      c.BackupAuto = strings.ToLower(v)
+      return nil
+    },
+  },
+  "backup_keep": {
+    help: "how many scheduled backups to keep, 14 by default",
+    get: func(c *config) string {
+      if c.BackupKeep == 0 {
+        return ""
+      }
+      return strconv.Itoa(c.BackupKeep)
+    },
+    set: func(c *config, v string) error {
+      if v == "" {
+        c.BackupKeep = 0
+        return nil
+      }
+      n, err := strconv.Atoi(v)
+      if err != nil || n < 1 {
+        return fmt.Errorf("backup_keep must be a positive number")
+      }
+      c.BackupKeep = n
+      return nil
+    },
+  },
+  "backup_dir": {
+    help: "directory of scheduled backups, backups in the data directory by default",
+    get:  func(c *config) string { return c.BackupDir },
+    set:  func(c *config, v string) error { c.BackupDir = v; return nil },
+  },
+  "backup_s3": {
+    help: "bucket to keep scheduled backups in instead, s3://bucket/prefix, gs://bucket/prefix or https://host/bucket/prefix for other S3-compatible services",
+    get:  func(c *config) string { return c.BackupS3 },
+    set: func(c *config, v string) error {
+      if _, err := parseS3URL(v, ""); v != "" && err != nil {
+        return err
+      }
+      c.BackupS3 = v
+      return nil
+    },
+  },
+  "s3_region": {
+    help: "region of the buckets of backup_s3 and local_file, us-east-1 by default, auto with gs://",
+    get:  func(c *config) string { return c.S3Region },
+    set:  func(c *config, v string) error { c.S3Region = v; return nil },
+  },
+  "s3_access_key": {
+    help: "access key id for the buckets, or HMAC key with gs://, AWS_ACCESS_KEY_ID by default",
+    get:  func(c *config) string { return c.S3AccessKey },
+    set:  func(c *config, v string) error { c.S3AccessKey = v; return nil },
+  },
+  "s3_secret_key": {
+    help:   "secret access key for the buckets, AWS_SECRET_ACCESS_KEY by default",
+    secret: true,
+    get:    func(c *config) string { return c.S3SecretKey },
+    set:    func(c *config, v string) error { c.S3SecretKey = v; return nil },
+  },
+  "telemetry": {
+    help: "true to count the commands run and their errors for telemetry_url, as with 'todo telemetry on'",
+    get: func(c *config) string {
+      if !c.Telemetry {
+        return ""
+      }
+      return "true"
+    },
+    set: func(c *config, v string) error {
+      if v == "" {
+        c.Telemetry = false
+        return nil
+      }
+      b, err := strconv.ParseBool(v)
+      if err != nil {
+        return fmt.Errorf("telemetry must be true or false")
+      }
+      c.Telemetry = b
+      return nil
+    },
+  },
+  "telemetry_url": {
+    help: "address usage counts are POSTed to as JSON once a week when telemetry is on",
+    get:  func(c *config) string { return c.TelemetryURL },
+    set:  func(c *config, v string) error { c.TelemetryURL = v; return nil },
+  },
+  "audit_log": {
+    help: "false to stop recording the changes made to tasks for 'todo log'",
+    get: func(c *config) string {
+      if c.AuditLog == nil {
+        return ""
+      }
+      return strconv.FormatBool(*c.AuditLog)
+    },
+    set: func(c *config, v string) error {
+      if v == "" {
+        c.AuditLog = nil
+        return nil
+      }
+      b, err := strconv.ParseBool(v)
+      if err != nil {
+        return fmt.Errorf("audit_log must be true or false")
+      }
+      c.AuditLog = &b
+      return nil
+    },
+  },
+}
+
+// envName returns the environment variable overriding the config key
+func envName(key string) string {
+  return "TODO_" + strings.ToUpper(key)
+}
+
+// configFile returns the path of the config file
+func configFile() (string, error) {
+  dir, err := configDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "config.yaml"), nil
+}
+
+// loadConfigFile reads the config file. A missing file results in an
+// empty config
+func loadConfigFile() (*config, error) {
+  c := &config{}
+  file, err := configFile()
+  if err != nil {
+    return nil, fmt.Errorf("Unable to get path to config file. %w", err)
+  }
+  b, err := ioutil.ReadFile(file)
+  if os.IsNotExist(err) {
+    return c, nil
+  }
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read config file: %w", err)
+  }
+  if err := yaml.Unmarshal(b, c); err != nil {
+    return nil, invalidf("Unable to parse config file %s: %v", file, err)
+  }
+  return c, nil
+}
+
+var loadedConfig = &config{}
+
+// initConfig loads the effective settings: the config file with
+// TODO_<KEY> environment variables and --output applied on top, and makes
+// the configured time zone the local one
+func initConfig() error {
+  c, err := loadConfigFile()
+  if err != nil {
+    return err
+  }
+  for key, k := range configKeys {
+    if v, ok := os.LookupEnv(envName(key)); ok {
+      if err := k.set(c, v); err != nil {
+        return invalidf("Invalid %s: %v", envName(key), err)
+      }
+    }
+  }
+  loadedConfig = c
+  if err := applyOutputFlag(); err != nil {
+    return err
+  }
+  applyTimezone()
+  if loadedContext, err = findContext(); err != nil {
+    return err
+  }
+  return initLocale()
+}
+
+// outputFlag is the output format named with --output
+var outputFlag string
+
+// applyOutputFlag makes --output, when given, override the output setting
+func applyOutputFlag() error {
+  if outputFlag == "" {
+    return nil
+  }
+  if err := configKeys["output"].set(loadedConfig, outputFlag); err != nil {
+    return invalidf("Invalid --output: %v", err)
+  }
+  return nil
+}
+
+// loadConfig returns the settings loaded by initConfig
+func loadConfig() *config {
+  return loadedConfig
+}
+
+// save writes c to the config file
+func (c *config) save() error {
+  file, err := configFile()
+  if err != nil {
+    return err
+  }
+  b, err := yaml.Marshal(c)
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(file, b, 0600)
+}
+
+// dateFormatFlag is the date format named with --date-format
+var dateFormatFlag string
+
+// formatDate prints the date part of t using the date format given with
+// --date-format or configured, or else that of the current language
+func formatDate(t time.Time) string {
+  layout := dateFormatFlag
+  if layout == "" {
+    layout = loadConfig().DateFormat
+  }
+  if layout == "" {
+    layout = loadedLocale.dateFormat
+  }
+  if layout == "" {
+    layout = defaultDateFormat
+  }
+  return localizeDate(t.Format(layout))
+}
+
+// noColorFlag is set with --no-color
+var noColorFlag bool
+
+// useColor reports whether output should be colorized. Unless disabled
+// with --no-color, configured or disabled by a NO_COLOR environment
+// variable, it is when stdout is a terminal
+func useColor() bool {
+  if noColorFlag {
+    return false
+  }
+  if c := loadConfig().Color; c != nil {
+    return *c
+  }
+  if os.Getenv("NO_COLOR") != "" {
+    return false
+  }
+  fi, err := os.Stdout.Stat()
+  return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the given ANSI color code if output is colorized
+func colorize(code string, s string) string {
+  if !useColor() {
+    return s
+  }
+  return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+func init() {
+  register(&command{
+    name:    "config",
+    usage:   "config [get [key] | set <key> <value> | path]",
+    summary: "Show or change settings in config.yaml, see 'todo config path'",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      fs.Usage = func() {
+        out := fs.Output()
+        fmt.Fprintf(out, "Usage: todo %s\n\n%s\n\nKeys:\n", cmd.usage, cmd.summary)
+        for _, key := range sortedConfigKeys() {
+          fmt.Fprintf(out, "  %-14s %s\n", key, configKeys[key].help)
+        }
+        fmt.Fprintf(out, "  %-14s %s\n", aliasKeyPrefix+"<name>", "command run by 'todo <name>', e.g. 'list +work', see 'todo help'")
+        fmt.Fprintf(out, "\nEach key can be overridden with an environment variable such as %s.\n",
+          envName("default_list"))
+      }
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        args = []string{"get"}
+      }
+
+      switch {
+      case args[0] == "path" && len(args) == 1:
+        file, err := configFile()
+        if err != nil {
+          return fmt.Errorf("Unable to get path to config file. %w", err)
+        }
+        fmt.Println(file)
+      case args[0] == "get" && len(args) == 1:
+        c := loadConfig()
+        for _, key := range sortedConfigKeys() {
+          value := configKeys[key].get(c)
+          if configKeys[key].secret && value != "" {
+            value = "****"
+          }
+          fmt.Printf("%s: %s\n", key, value)
+        }
+        for _, name := range sortedAliases() {
+          fmt.Printf("%s%s: %s\n", aliasKeyPrefix, name, c.Aliases[name])
+        }
+      case args[0] == "get" && len(args) == 2:
+        k, ok := lookupConfigKey(args[1])
+        if !ok {
+          return invalidf("Unknown config key '%s', see 'todo help config'", args[1])
+        }
+        fmt.Println(k.get(loadConfig()))
+      case args[0] == "set" && (len(args) == 2 || len(args) == 3):
+        k, ok := lookupConfigKey(args[1])
+        if !ok {
+          return invalidf("Unknown config key '%s', see 'todo help config'", args[1])
+        }
+        value := ""
+        if len(args) == 3 {
+          value = args[2]
+        }
+        // env overrides must not end up in the file
+        c, err := loadConfigFile()
+        if err != nil {
+          return err
+        }
+        if err := k.set(c, value); err != nil {
+          return invalidf("Invalid value: %v", err)
+        }
+        if err := c.save(); err != nil {
+          return fmt.Errorf("Unable to save config file: %w", err)
+        }
+      default:
+        fs.Usage()
+        return &exitError{code: exitInvalid, err: fmt.Errorf("invalid config command"), reported: true}
+      }
+      return nil
+    },
+  })
+}
+
+// sortedConfigKeys returns the names of all config keys in order
+func sortedConfigKeys() []string {
+  var keys []string
+  for key := range configKeys {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+
+  "gopkg.in/yaml.v3"
+)
+
+// contextFileName is the name of the file pinning a project directory to
+// a task list and tags
+const contextFileName = ".todo"
+
+// projectContext is the content of a .todo file: the task list commands
+// run below its directory operate on and the tags they scope tasks to
+type projectContext struct {
+  List string   `yaml:"list,omitempty"`
+  Tags []string `yaml:"tags,omitempty"`
+  // file is the path of the .todo file
+  file string
+}
+
+// noContextFlag is set with --no-context
+var noContextFlag bool
+
+// loadedContext is the context found by initConfig
+var loadedContext *projectContext
+
+// findContext reads the nearest .todo file in the working directory or
+// its parents, or returns nil if there is none. Directories named .todo,
+// as earlier versions kept their files in, are skipped
+func findContext() (*projectContext, error) {
+  dir, err := os.Getwd()
+  if err != nil {
+    return nil, nil
+  }
+  for {
+    file := filepath.Join(dir, contextFileName)
+    if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() {
+      b, err := ioutil.ReadFile(file)
+      if err != nil {
+        return nil, fmt.Errorf("Unable to read %s: %w", file, err)
+      }
+      c := &projectContext{file: file}
+      if err := yaml.Unmarshal(b, c); err != nil {
+        return nil, invalidf("Unable to parse %s: %v", file, err)
+      }
+      return c, nil
+    }
+    parent := filepath.Dir(dir)
+    if parent == dir {
+      return nil, nil
+    }
+    dir = parent
+  }
+}
+
+// currentContext returns the context of the working directory, or nil if
+// there is none or --no-context is set
+func currentContext() *projectContext {
+  if noContextFlag {
+    return nil
+  }
+  return loadedContext
+}
+
+// contextTags returns tags with those of the current context added,
+// unless --list names another list than the context's
+func contextTags(tags []string) []string {
+  if c := currentContext(); c != nil && (c.List == "" || c.List == currentList()) {
+    for _, tag := range c.Tags {
+      tags = appendTag(tags, tag)
+    }
+  }
+  return tags
+}
+
+// printContext describes the context of the working directory
+func printContext() error {
+  c := currentContext()
+  if c == nil {
+    fmt.Println("No .todo file in this directory or its parents, 'todo context set' adds one")
+    return nil
+  }
+  fmt.Printf("Context of %s\n", c.file)
+  if c.List != "" {
+    fmt.Printf("  list: %s\n", c.List)
+  }
+  if len(c.Tags) > 0 {
+    fmt.Printf("  tags: %s\n", formatTags(c.Tags))
+  }
+  return nil
+}
+
+// setContext writes a .todo file in the working directory pinning it to
+// list and tags
+func setContext(list string, tags []string) error {
+  if list == "" && len(tags) == 0 {
+    return invalidf("Give the list with --list or tags to scope tasks to, see 'todo help context'")
+  }
+  b, err := yaml.Marshal(&projectContext{List: list, Tags: tags})
+  if err != nil {
+    return err
+  }
+  if err := ioutil.WriteFile(contextFileName, b, 0644); err != nil {
+    return fmt.Errorf("Unable to write %s: %w", contextFileName, err)
+  }
+  switch {
+  case len(tags) == 0:
+    infof("Commands run below this directory now use your %s list", list)
+  case list == "":
+    infof("Commands run below this directory are now scoped to %s", formatTags(tags))
+  default:
+    infof("Commands run below this directory now use your %s list, scoped to %s", list, formatTags(tags))
+  }
+  return nil
+}
+
+// clearContext removes the .todo file of the working directory
+func clearContext() error {
+  err := os.Remove(contextFileName)
+  if os.IsNotExist(err) {
+    return notFoundf("No .todo file in this directory")
+  }
+  if err != nil {
+    return err
+  }
+  infof("Removed the context of this directory")
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "context",
+    usage:   "context [show] | context set [--list name] [+tag...] | context clear",
+    summary: "Show, or pin with a .todo file, the list and tags of a project directory",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        args = []string{"show"}
+      }
+      words, tags := splitTags(args[1:])
+      switch args[0] {
+      case "show":
+        if len(args) > 1 {
+          return invalidf("Unexpected argument '%s', see 'todo help context'", args[1])
+        }
+        return printContext()
+      case "set":
+        if len(words) > 0 {
+          return invalidf("Unexpected argument '%s', tags start with '+'", words[0])
+        }
+        return setContext(listFlag, tags)
+      case "clear":
+        if len(args) > 1 {
+          return invalidf("Unexpected argument '%s', see 'todo help context'", args[1])
+        }
+        return clearContext()
+      }
+      return invalidf("Unknown context command '%s', see 'todo help context'", args[0])
+    },
+  })
+}
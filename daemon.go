@@ -0,0 +1,428 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net"
+  "os"
+  "path/filepath"
+  "sort"
+  "sync"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// Operations a daemon answers on its socket
+const (
+  daemonItems  = "items"
+  daemonSync   = "sync"
+  daemonStatus = "status"
+)
+
+// bypassDaemon is set in the daemon itself, and its sessions go to the
+// backend even if another daemon runs
+var bypassDaemon bool
+
+// daemonRequest is what the CLI sends a daemon, one JSON object per
+// connection. Items returns the cached tasks of List, Sync syncs List
+// first, and Status returns a daemonState
+type daemonRequest struct {
+  Op   string `json:"op"`
+  List string `json:"list,omitempty"`
+  // Create asks for List to be created if it does not exist yet
+  Create bool `json:"create,omitempty"`
+}
+
+// daemonReply is the answer to a daemonRequest
+type daemonReply struct {
+  Error   string       `json:"error,omitempty"`
+  ListId  string       `json:"listId,omitempty"`
+  Items   []*todo.Task `json:"items,omitempty"`
+  Synced  time.Time    `json:"synced,omitempty"`
+  Offline bool         `json:"offline,omitempty"`
+  State   *daemonState `json:"state,omitempty"`
+}
+
+// daemonState describes a running daemon for 'todo daemon status'
+type daemonState struct {
+  PID      int               `json:"pid"`
+  Started  time.Time         `json:"started"`
+  Interval string            `json:"interval"`
+  Lists    []daemonListState `json:"lists"`
+  // Backup is when the last scheduled backup was taken, see backup_auto
+  Backup time.Time `json:"backup,omitempty"`
+}
+
+// daemonListState is the health of a list a daemon syncs
+type daemonListState struct {
+  Name    string    `json:"name"`
+  Synced  time.Time `json:"synced,omitempty"`
+  Tasks   int       `json:"tasks"`
+  Pending int       `json:"pending"`
+  Error   string    `json:"error,omitempty"`
+}
+
+// daemonList is a list a daemon keeps in sync: the current list when it
+// started, and those the CLI asked for since
+type daemonList struct {
+  id string
+  // err is why the last sync failed, nil if it succeeded
+  err error
+  // known holds the tasks of the last sync to send webhook events for
+  // the changes of the next one
+  known map[string]*todo.Task
+  last  time.Time
+}
+
+// daemon syncs task lists every interval, answering the CLI from their
+// cache on a Unix socket so commands do not wait on the network
+type daemon struct {
+  client   todo.Backend
+  interval time.Duration
+  hooks    *webhooks
+  started  time.Time
+
+  // syncing serializes syncs, which write the cache files
+  syncing sync.Mutex
+  mu      sync.Mutex
+  lists   map[string]*daemonList
+  // backedUp is when the last scheduled backup was taken, zero until
+  // the daemon looked
+  backedUp time.Time
+}
+
+// daemonSocket returns the path of the socket of the daemon of the
+// current backend and account
+func daemonSocket() (string, error) {
+  dir, err := cacheDir("daemon")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, stateName()+".sock"), nil
+}
+
+// askDaemon sends req to the daemon of the current backend and account,
+// failing at once if none runs
+func askDaemon(req *daemonRequest) (*daemonReply, error) {
+  sock, err := daemonSocket()
+  if err != nil {
+    return nil, err
+  }
+  conn, err := net.DialTimeout("unix", sock, time.Second)
+  if err != nil {
+    return nil, err
+  }
+  defer conn.Close()
+  // the daemon may have to sync a list it was not asked for before
+  conn.SetDeadline(time.Now().Add(time.Minute))
+  if err := json.NewEncoder(conn).Encode(req); err != nil {
+    return nil, err
+  }
+  reply := &daemonReply{}
+  if err := json.NewDecoder(conn).Decode(reply); err != nil {
+    return nil, fmt.Errorf("Invalid reply of the daemon: %v", err)
+  }
+  if reply.Error != "" {
+    return nil, errors.New(reply.Error)
+  }
+  return reply, nil
+}
+
+// daemonRunning reports whether a daemon runs for the current backend and
+// account
+func daemonRunning() bool {
+  _, err := askDaemon(&daemonRequest{Op: daemonStatus})
+  return err == nil
+}
+
+// list returns the state of the named list, tracking it from now on
+func (d *daemon) list(name string) *daemonList {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  l, ok := d.lists[name]
+  if !ok {
+    l = &daemonList{}
+    d.lists[name] = l
+  }
+  return l
+}
+
+// sync replays the offline changes of the named list and refreshes its
+// cache, sending webhook events for the changes since the last sync
+func (d *daemon) sync(name string, create bool) error {
+  d.syncing.Lock()
+  defer d.syncing.Unlock()
+  l := d.list(name)
+  started := time.Now()
+  err := d.syncList(l, name, create)
+  d.mu.Lock()
+  if err != nil && l.id == "" && !isNetworkError(err) {
+    // not a list the daemon could ever sync
+    delete(d.lists, name)
+  }
+  l.err = err
+  if err == nil {
+    l.last = started
+  }
+  d.mu.Unlock()
+  return err
+}
+
+func (d *daemon) syncList(l *daemonList, name string, create bool) error {
+  s := &session{ctx: cmdCtx, client: d.client, listName: name, cache: loadCache(name)}
+  id, err := getTodoId(s.ctx, s.client, name, create)
+  if err == todo.ErrNotFound {
+    return notFoundf("No task list named '%s', see 'todo lists'", name)
+  }
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve todo task list: %w", err)
+  }
+  s.todoId = id
+  if s.cache.ListId != id {
+    s.cache = &cachedList{ListId: id}
+  }
+  s.replay()
+  items, err := syncCache(s)
+  if err != nil {
+    return err
+  }
+  if l.known != nil && l.id == id {
+    // a minute of slack covers clocks of the backend running behind
+    taskEvents(s.ctx, d.hooks, s.client, id, name, l.known, items, l.last.Add(-time.Minute))
+  }
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  l.id = id
+  l.known = map[string]*todo.Task{}
+  for _, task := range items {
+    l.known[task.ID] = task
+  }
+  verbosef("Synced your %s list, %s", name, plural(len(items), "task"))
+  return nil
+}
+
+// syncAll syncs every tracked list, warning of failures
+func (d *daemon) syncAll() {
+  d.mu.Lock()
+  var names []string
+  for name := range d.lists {
+    names = append(names, name)
+  }
+  d.mu.Unlock()
+  for _, name := range names {
+    if err := d.sync(name, false); err != nil && cmdCtx.Err() == nil {
+      warnf("Unable to sync your %s list, retrying in %s: %v", name, todo.FormatDuration(d.interval), err)
+    }
+  }
+}
+
+// backup takes a scheduled backup if one is due, warning of failures
+func (d *daemon) backup() {
+  interval, err := parseBackupInterval(loadConfig().BackupAuto)
+  if loadConfig().BackupAuto == "" || err != nil {
+    return
+  }
+  d.mu.Lock()
+  due := d.backedUp.IsZero() || time.Since(d.backedUp) >= interval
+  d.mu.Unlock()
+  if !due {
+    return
+  }
+  last, err := runScheduledBackup(true)
+  if err != nil {
+    if cmdCtx.Err() == nil {
+      warnf("Unable to back up, retrying in %s: %v", todo.FormatDuration(d.interval), err)
+    }
+    return
+  }
+  d.mu.Lock()
+  d.backedUp = last
+  d.mu.Unlock()
+}
+
+// answer handles a request of the CLI
+func (d *daemon) answer(req *daemonRequest) *daemonReply {
+  switch req.Op {
+  case daemonStatus:
+    return &daemonReply{State: d.state()}
+  case daemonItems, daemonSync:
+  default:
+    return &daemonReply{Error: fmt.Sprintf("Unknown daemon operation '%s'", req.Op)}
+  }
+  l := d.list(req.List)
+  d.mu.Lock()
+  tracked := l.id != ""
+  d.mu.Unlock()
+  if req.Op == daemonSync || !tracked {
+    // a tracked list that can not be synced is still served from its cache
+    err := d.sync(req.List, req.Create)
+    if err != nil && (req.Op == daemonSync || !tracked || !isNetworkError(err)) {
+      return &daemonReply{Error: err.Error()}
+    }
+  }
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  c := loadCache(req.List)
+  return &daemonReply{ListId: l.id, Items: c.Items, Synced: c.Synced, Offline: l.err != nil && isNetworkError(l.err)}
+}
+
+// state returns the health of the daemon and the lists it syncs
+func (d *daemon) state() *daemonState {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  st := &daemonState{PID: os.Getpid(), Started: d.started, Interval: todo.FormatDuration(d.interval), Backup: d.backedUp}
+  for name, l := range d.lists {
+    c := loadCache(name)
+    ls := daemonListState{Name: name, Synced: c.Synced, Tasks: len(c.Items), Pending: len(c.Pending)}
+    if l.err != nil {
+      ls.Error = l.err.Error()
+    }
+    st.Lists = append(st.Lists, ls)
+  }
+  sort.Slice(st.Lists, func(i, j int) bool { return st.Lists[i].Name < st.Lists[j].Name })
+  return st
+}
+
+// serve answers the requests of the CLI on listener until it is closed
+func (d *daemon) serve(listener net.Listener) {
+  for {
+    conn, err := listener.Accept()
+    if err != nil {
+      return
+    }
+    go func() {
+      defer conn.Close()
+      conn.SetDeadline(time.Now().Add(time.Minute))
+      req := &daemonRequest{}
+      if err := json.NewDecoder(conn).Decode(req); err != nil {
+        return
+      }
+      json.NewEncoder(conn).Encode(d.answer(req))
+    }()
+  }
+}
+
+// Runs the daemon of the current backend and account until interrupted,
+// syncing the current list and those the CLI asks for every interval and
+// taking the backups backup_auto schedules
+func runDaemon(interval time.Duration) error {
+  bypassDaemon = true
+  if reply, err := askDaemon(&daemonRequest{Op: daemonStatus}); err == nil {
+    return invalidf("A daemon is already running as process %d, see 'todo daemon status'", reply.State.PID)
+  }
+  sock, err := daemonSocket()
+  if err != nil {
+    return err
+  }
+  // a daemon that did not exit cleanly leaves its socket behind
+  os.Remove(sock)
+  listener, err := net.Listen("unix", sock)
+  if err != nil {
+    return fmt.Errorf("Unable to listen on %s: %w", sock, err)
+  }
+  defer listener.Close()
+  os.Chmod(sock, 0600)
+
+  client, err := newClient()
+  if err != nil {
+    return err
+  }
+  hooks, err := newWebhooks()
+  if err != nil {
+    return err
+  }
+  defer hooks.close(30 * time.Second)
+  d := &daemon{client: client, interval: interval, hooks: hooks, started: time.Now(), lists: map[string]*daemonList{}}
+  if err := d.sync(currentList(), listFlag == "" || listFlag == loadConfig().DefaultList); err != nil {
+    if !isNetworkError(err) {
+      return err
+    }
+    warnf("Unable to sync your %s list, retrying in %s: %v", currentList(), todo.FormatDuration(interval), err)
+  }
+  go d.serve(listener)
+  infof("Daemon syncing every %s, listening on %s", todo.FormatDuration(interval), sock)
+  d.backup()
+  for {
+    select {
+    case <-cmdCtx.Done():
+      return nil
+    case <-time.After(interval):
+    }
+    d.syncAll()
+    d.backup()
+  }
+}
+
+// Prints the health of the daemon of the current backend and account,
+// failing if none runs or a list fails to sync
+func printDaemonStatus() error {
+  reply, err := askDaemon(&daemonRequest{Op: daemonStatus})
+  if err != nil {
+    return fmt.Errorf("No daemon is running for %s, start one with 'todo daemon'", currentAccount())
+  }
+  st := reply.State
+  if loadConfig().Output == outputJSON {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(st); err != nil {
+      return err
+    }
+  } else {
+    fmt.Printf("Daemon running as process %d since %s %s, syncing every %s\n", st.PID,
+      formatDate(st.Started), st.Started.Local().Format("15:04"), st.Interval)
+    rows := [][]tableCell{{cell("2", "List"), cell("2", "Synced"), cell("2", "Tasks"), cell("2", "Pending"), cell("2", "Status")}}
+    for _, l := range st.Lists {
+      synced := "never"
+      if !l.Synced.IsZero() {
+        synced = todo.FormatDuration(time.Since(l.Synced).Round(time.Second)) + " ago"
+      }
+      status := cell("32", "ok")
+      if l.Error != "" {
+        status = cell("31", l.Error)
+      }
+      rows = append(rows, []tableCell{cell("", l.Name), cell("", synced), cell("", fmt.Sprint(l.Tasks)),
+        cell("", fmt.Sprint(l.Pending)), status})
+    }
+    printTable(rows)
+    if !st.Backup.IsZero() {
+      fmt.Printf("Last backup %s %s\n", formatDate(st.Backup.Local()), st.Backup.Local().Format("15:04"))
+    }
+  }
+  failing := 0
+  for _, l := range st.Lists {
+    if l.Error != "" {
+      failing++
+    }
+  }
+  if failing > 0 {
+    return fmt.Errorf("Daemon unable to sync %s", plural(failing, "list"))
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "daemon",
+    usage:   "daemon [--interval 5m] | daemon status",
+    summary: "Keep the local cache in sync in the background, answering commands from it",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      interval := fs.Duration("interval", 5*time.Minute, "how often the daemon syncs")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      switch {
+      case len(args) == 1 && args[0] == "status":
+        return printDaemonStatus()
+      case len(args) > 0:
+        return invalidf("Unknown daemon command '%s', see 'todo help daemon'", args[0])
+      case *interval <= 0:
+        return invalidf("--interval must be positive")
+      }
+      return runDaemon(*interval)
+    },
+  })
+}
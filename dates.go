@@ -0,0 +1,397 @@
+package main
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+)
+
+var weekdays = map[string]time.Weekday{
+  "sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+  "wednesday": time.Wednesday, "thursday": time.Thursday,
+  "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// weekdayAbbrevs are only recognized after words like "on" or "next",
+// since several of them are ordinary words ("sat", "wed", "sun")
+var weekdayAbbrevs = map[string]time.Weekday{
+  "sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+  "tues": time.Tuesday, "wed": time.Wednesday, "thu": time.Thursday,
+  "thur": time.Thursday, "thurs": time.Thursday, "fri": time.Friday,
+  "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+  "january": time.January, "jan": time.January, "february": time.February,
+  "feb": time.February, "march": time.March, "mar": time.March,
+  "april": time.April, "apr": time.April, "may": time.May,
+  "june": time.June, "jun": time.June, "july": time.July, "jul": time.July,
+  "august": time.August, "aug": time.August, "september": time.September,
+  "sep": time.September, "sept": time.September, "october": time.October,
+  "oct": time.October, "november": time.November, "nov": time.November,
+  "december": time.December, "dec": time.December,
+}
+
+var numberWords = map[string]int{
+  "a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+  "six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// prepositions that are dropped together with a date phrase following them
+var datePrepositions = map[string]bool{
+  "on": true, "by": true, "due": true, "at": true, "before": true,
+}
+
+// parseDue extracts a natural-language date phrase from title, such as
+// "tomorrow 3pm", "next friday", "in 3 days", "march 5th" or "2024-03-05".
+// Weekdays refer to their next occurrence after today and dates without a
+// year to their next occurrence from today on. A time of day on its own
+// refers to today, or tomorrow if it has already passed.
+// It returns the title with the phrase removed and the date at midnight
+// in now's location, or the unchanged title and a zero time if title
+// contains no date
+func parseDue(title string, now time.Time) (string, time.Time) {
+  words := strings.Fields(title)
+  norm := make([]string, len(words))
+  for i, w := range words {
+    norm[i] = strings.ToLower(strings.TrimRight(w, ",.;!?"))
+  }
+  today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+  for i := range norm {
+    prev := ""
+    if i > 0 {
+      prev = norm[i-1]
+    }
+
+    date, n, ok := dateAt(norm, i, prev, today)
+    if ok {
+      if _, _, m, ok := timeAt(norm, i+n); ok {
+        n += m
+      }
+    } else if hour, min, m, ok := timeAt(norm, i); ok {
+      n = m
+      date = today
+      if at := today.Add(time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute); at.Before(now) {
+        date = today.AddDate(0, 0, 1)
+      }
+      if d, k, ok := dateAt(norm, i+n, norm[i+n-1], today); ok {
+        date, n = d, n+k
+      }
+    } else {
+      continue
+    }
+
+    start := i
+    if datePrepositions[prev] {
+      start--
+    }
+    rest := append(append([]string{}, words[:start]...), words[i+n:]...)
+    return strings.Join(rest, " "), date
+  }
+  return title, time.Time{}
+}
+
+// dateAt parses a date phrase starting at words[i], where prev is the word
+// before it. It returns the date and the number of words it spans
+func dateAt(words []string, i int, prev string, today time.Time) (time.Time, int, bool) {
+  if i >= len(words) {
+    return time.Time{}, 0, false
+  }
+  w := words[i]
+  next := func(k int) string {
+    if i+k < len(words) {
+      return words[i+k]
+    }
+    return ""
+  }
+
+  switch w {
+  case "today", "tonight":
+    return today, 1, true
+  case "tomorrow", "tmrw", "tmr":
+    return today.AddDate(0, 0, 1), 1, true
+  case "day":
+    if next(1) == "after" && next(2) == "tomorrow" {
+      return today.AddDate(0, 0, 2), 3, true
+    }
+  case "in":
+    n, ok := numberWords[next(1)]
+    if !ok {
+      var err error
+      if n, err = strconv.Atoi(next(1)); err != nil {
+        break
+      }
+    }
+    if d, ok := addUnit(today, next(2), n); ok {
+      return d, 3, true
+    }
+  case "next", "this":
+    if wd, ok := lookupWeekday(next(1), true); ok {
+      return nextWeekday(today, wd), 2, true
+    }
+    if w == "next" {
+      if d, ok := addUnit(today, next(1), 1); ok {
+        return d, 2, true
+      }
+    }
+  }
+
+  if wd, ok := lookupWeekday(w, datePrepositions[prev]); ok {
+    return nextWeekday(today, wd), 1, true
+  }
+
+  if d, err := time.ParseInLocation("2006-01-02", w, today.Location()); err == nil {
+    return d, 1, true
+  }
+
+  if parts := strings.Split(w, "/"); len(parts) == 2 || len(parts) == 3 {
+    var nums []int
+    for _, p := range parts {
+      n, err := strconv.Atoi(p)
+      if err != nil {
+        break
+      }
+      nums = append(nums, n)
+    }
+    if len(nums) == len(parts) {
+      year := 0
+      if len(nums) == 3 {
+        year = nums[2]
+        if year < 100 {
+          year += 2000
+        }
+      }
+      if d, ok := makeDate(today, year, time.Month(nums[0]), nums[1]); ok {
+        return d, 1, true
+      }
+    }
+  }
+
+  // "march 5", "march 5th, 2025"
+  if m, ok := months[w]; ok {
+    if day, ok := parseDay(next(1)); ok {
+      year, n := parseYear(next(2))
+      if d, ok := makeDate(today, year, m, day); ok {
+        return d, 2 + n, true
+      }
+    }
+  }
+
+  // "5 march", "5th of march 2025"
+  if day, ok := parseDay(w); ok {
+    k := 1
+    if next(k) == "of" {
+      k++
+    }
+    if m, ok := months[next(k)]; ok {
+      year, n := parseYear(next(k + 1))
+      if d, ok := makeDate(today, year, m, day); ok {
+        return d, k + 1 + n, true
+      }
+    }
+  }
+  return time.Time{}, 0, false
+}
+
+// timeAt parses a time of day such as "3pm", "3:30 pm", "15:00" or "noon"
+// starting at words[i]. It returns the hour, minute and number of words
+// the time spans
+func timeAt(words []string, i int) (int, int, int, bool) {
+  if i >= len(words) {
+    return 0, 0, 0, false
+  }
+  n := 0
+  if words[i] == "at" && i+1 < len(words) {
+    i, n = i+1, 1
+  }
+  w := words[i]
+  switch w {
+  case "noon", "midday":
+    return 12, 0, n + 1, true
+  case "midnight":
+    return 0, 0, n + 1, true
+  }
+
+  suffix := ""
+  for _, s := range []string{"am", "pm"} {
+    if strings.HasSuffix(w, s) {
+      suffix, w = s, strings.TrimSuffix(w, s)
+    }
+  }
+  if suffix == "" && i+1 < len(words) && (words[i+1] == "am" || words[i+1] == "pm") {
+    suffix = words[i+1]
+    n++
+  }
+
+  hour, min := 0, 0
+  var err error
+  if parts := strings.SplitN(w, ":", 2); len(parts) == 2 {
+    hour, err = strconv.Atoi(parts[0])
+    if err != nil || len(parts[1]) != 2 {
+      return 0, 0, 0, false
+    }
+    if min, err = strconv.Atoi(parts[1]); err != nil || min > 59 {
+      return 0, 0, 0, false
+    }
+  } else if suffix != "" {
+    if hour, err = strconv.Atoi(w); err != nil {
+      return 0, 0, 0, false
+    }
+  } else {
+    // a bare number is not a time
+    return 0, 0, 0, false
+  }
+
+  switch {
+  case suffix != "" && (hour < 1 || hour > 12):
+    return 0, 0, 0, false
+  case suffix == "pm" && hour != 12:
+    hour += 12
+  case suffix == "am" && hour == 12:
+    hour = 0
+  case hour > 23:
+    return 0, 0, 0, false
+  }
+  return hour, min, n + 1, true
+}
+
+// machineLocal is the time zone of the machine, local unless timezone is set
+var machineLocal = time.Local
+
+// applyTimezone makes the configured time zone, or else that of the
+// machine, the one dates and times are local to, for days to start and
+// tasks to be due when the user expects them to
+func applyTimezone() {
+  time.Local = machineLocal
+  if name := loadConfig().Timezone; name != "" {
+    if loc, err := time.LoadLocation(name); err == nil {
+      time.Local = loc
+    }
+  }
+}
+
+// weekStart returns the configured first day of the week, Monday unless
+// week_start is set
+func weekStart() time.Weekday {
+  if wd, ok := lookupWeekday(loadConfig().WeekStart, true); ok {
+    return wd
+  }
+  return time.Monday
+}
+
+// weekOffset returns how many days into its week day is
+func weekOffset(day time.Time) int {
+  return (int(day.Weekday()) - int(weekStart()) + 7) % 7
+}
+
+// lookupWeekday resolves a weekday name. Abbreviations are only accepted
+// when allowAbbrev is set
+func lookupWeekday(w string, allowAbbrev bool) (time.Weekday, bool) {
+  if wd, ok := weekdays[w]; ok {
+    return wd, true
+  }
+  if wd, ok := weekdayAbbrevs[w]; ok && allowAbbrev {
+    return wd, true
+  }
+  return 0, false
+}
+
+// nextWeekday returns the first day after today falling on wd
+func nextWeekday(today time.Time, wd time.Weekday) time.Time {
+  days := (int(wd)-int(today.Weekday())+6)%7 + 1
+  return today.AddDate(0, 0, days)
+}
+
+// addUnit adds n days, weeks, months or years to today
+func addUnit(today time.Time, unit string, n int) (time.Time, bool) {
+  switch strings.TrimSuffix(unit, "s") {
+  case "day":
+    return today.AddDate(0, 0, n), true
+  case "week":
+    return today.AddDate(0, 0, 7*n), true
+  case "month":
+    return today.AddDate(0, n, 0), true
+  case "year":
+    return today.AddDate(n, 0, 0), true
+  }
+  return time.Time{}, false
+}
+
+// parseDay parses a day of the month such as "5" or "5th"
+func parseDay(w string) (int, bool) {
+  for _, s := range []string{"st", "nd", "rd", "th"} {
+    w = strings.TrimSuffix(w, s)
+  }
+  day, err := strconv.Atoi(w)
+  return day, err == nil && day >= 1 && day <= 31
+}
+
+// parseYear parses a four digit year. It returns the year and 1, or 0 and
+// 0 if w is not a year
+func parseYear(w string) (int, int) {
+  if len(w) != 4 {
+    return 0, 0
+  }
+  year, err := strconv.Atoi(w)
+  if err != nil {
+    return 0, 0
+  }
+  return year, 1
+}
+
+// makeDate builds a date from its parts, rejecting invalid ones such as
+// February 30th. A zero year means the next occurrence from today on
+func makeDate(today time.Time, year int, month time.Month, day int) (time.Time, bool) {
+  if month < time.January || month > time.December {
+    return time.Time{}, false
+  }
+  y := year
+  if y == 0 {
+    y = today.Year()
+  }
+  d := time.Date(y, month, day, 0, 0, 0, 0, today.Location())
+  if d.Day() != day {
+    return time.Time{}, false
+  }
+  if year == 0 && d.Before(today) {
+    d = d.AddDate(1, 0, 0)
+  }
+  return d, true
+}
+
+// parseDate parses value as a date on its own, such as "friday" or
+// "2024-03-05". It fails if value contains anything but a date phrase
+func parseDate(value string, now time.Time) (time.Time, error) {
+  rest, date := parseDue(value, now)
+  if date.IsZero() || strings.TrimSpace(rest) != "" {
+    return time.Time{}, fmt.Errorf("unrecognized date '%s'", value)
+  }
+  return date, nil
+}
+
+// parseSince parses value as a point in the past, either relative to now
+// such as "7d", "2w" or "12h", or as a date such as "2024-03-05"
+func parseSince(value string, now time.Time) (time.Time, error) {
+  units := map[string]string{"d": "day", "w": "week", "y": "year"}
+  if n := len(value) - 1; n > 0 {
+    if unit, ok := units[value[n:]]; ok {
+      if count, err := strconv.Atoi(value[:n]); err == nil && count >= 0 {
+        t, _ := addUnit(now, unit, -count)
+        return t, nil
+      }
+    }
+  }
+  if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+    return now.Add(-d), nil
+  }
+  t, err := parseDate(value, now)
+  if err != nil {
+    return time.Time{}, err
+  }
+  if t.After(now) {
+    return time.Time{}, fmt.Errorf("date '%s' is in the future", value)
+  }
+  return t, nil
+}
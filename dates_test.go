@@ -0,0 +1,119 @@
+package main
+
+import (
+  "testing"
+  "time"
+)
+
+// Wednesday, the last day of January of a leap year, mid-morning
+var testNow = time.Date(2024, time.January, 31, 10, 0, 0, 0, time.UTC)
+
+// Tuesday, the last day of the year
+var testYearEnd = time.Date(2024, time.December, 31, 10, 0, 0, 0, time.UTC)
+
+func TestParseDue(t *testing.T) {
+  tests := []struct {
+    now   time.Time
+    title string
+    rest  string
+    due   string
+  }{
+    // relative dates
+    {testNow, "call mom today", "call mom", "2024-01-31"},
+    {testNow, "call mom tomorrow", "call mom", "2024-02-01"},
+    {testNow, "call mom tmrw", "call mom", "2024-02-01"},
+    {testNow, "pay rent day after tomorrow", "pay rent", "2024-02-02"},
+    {testNow, "gym in 3 days", "gym", "2024-02-03"},
+    {testNow, "gym in two weeks", "gym", "2024-02-14"},
+    {testNow, "review next week", "review", "2024-02-07"},
+    {testNow, "renew next year", "renew", "2025-01-31"},
+
+    // weekdays are the next one after today, wrapping around the week
+    {testNow, "report friday", "report", "2024-02-02"},
+    {testNow, "report on friday", "report", "2024-02-02"},
+    {testNow, "report wednesday", "report", "2024-02-07"},
+    {testNow, "report tuesday", "report", "2024-02-06"},
+    {testNow, "report sunday", "report", "2024-02-04"},
+    {testNow, "report by wed", "report", "2024-02-07"},
+    {testNow, "report next mon", "report", "2024-02-05"},
+    {testNow, "report this fri", "report", "2024-02-02"},
+    {testYearEnd, "report monday", "report", "2025-01-06"},
+    {testYearEnd, "report tuesday", "report", "2025-01-07"},
+
+    // abbreviations are ordinary words unless introduced
+    {testNow, "sat with friends", "sat with friends", ""},
+    {testNow, "eat sun chips", "eat sun chips", ""},
+
+    // explicit dates, next occurrence unless a year is given
+    {testNow, "taxes 2024-03-05", "taxes", "2024-03-05"},
+    {testNow, "taxes 3/5", "taxes", "2024-03-05"},
+    {testNow, "taxes 1/15", "taxes", "2025-01-15"},
+    {testNow, "taxes 3/5/25", "taxes", "2025-03-05"},
+    {testNow, "taxes march 5", "taxes", "2024-03-05"},
+    {testNow, "taxes march 5th, 2025 online", "taxes online", "2025-03-05"},
+    {testNow, "taxes 5th of march", "taxes", "2024-03-05"},
+    {testNow, "taxes 5 mar 2026", "taxes", "2026-03-05"},
+
+    // month ends
+    {testNow, "close books jan 31", "close books", "2024-01-31"},
+    {testNow, "close books jan 30", "close books", "2025-01-30"},
+    {testNow, "close books feb 29", "close books", "2024-02-29"},
+    {testNow, "close books feb 29 2025", "close books feb 29 2025", ""},
+    {testNow, "close books feb 30", "close books feb 30", ""},
+    {testNow, "close books 4/31", "close books 4/31", ""},
+    {testYearEnd, "party dec 31", "party", "2024-12-31"},
+    {testYearEnd, "party tomorrow", "party", "2025-01-01"},
+
+    // times of day, today unless already passed
+    {testNow, "lunch at noon", "lunch", "2024-01-31"},
+    {testNow, "standup 9am", "standup", "2024-02-01"},
+    {testNow, "call at 3pm friday", "call", "2024-02-02"},
+    {testNow, "call tomorrow 3:30 pm", "call", "2024-02-01"},
+    {testYearEnd, "standup 9:00", "standup", "2025-01-01"},
+
+    // no date
+    {testNow, "buy 2 apples", "buy 2 apples", ""},
+    {testNow, "fix bug in 3 places", "fix bug in 3 places", ""},
+  }
+  for _, test := range tests {
+    rest, due := parseDue(test.title, test.now)
+    got := ""
+    if !due.IsZero() {
+      got = due.Format("2006-01-02")
+    }
+    if rest != test.rest || got != test.due {
+      t.Errorf("parseDue(%q, %s) = %q, %q, want %q, %q", test.title, test.now.Format("2006-01-02"), rest, got, test.rest, test.due)
+    }
+  }
+}
+
+func TestParseDate(t *testing.T) {
+  tests := []struct {
+    value string
+    date  string
+  }{
+    {"today", "2024-01-31"},
+    {"friday", "2024-02-02"},
+    {"Next Friday", "2024-02-02"},
+    {"in 1 week", "2024-02-07"},
+    {"2024-02-29", "2024-02-29"},
+    {"feb 29", "2024-02-29"},
+    {"december 25th", "2024-12-25"},
+    {"", ""},
+    {"friday lunch", ""},
+    {"feb 30", ""},
+    {"2024-02-30", ""},
+    {"someday", ""},
+  }
+  for _, test := range tests {
+    date, err := parseDate(test.value, testNow)
+    switch {
+    case test.date == "" && err == nil:
+      t.Errorf("parseDate(%q) = %s, want an error", test.value, date.Format("2006-01-02"))
+    case test.date != "" && err != nil:
+      t.Errorf("parseDate(%q) failed: %v", test.value, err)
+    case test.date != "" && date.Format("2006-01-02") != test.date:
+      t.Errorf("parseDate(%q) = %s, want %s", test.value, date.Format("2006-01-02"), test.date)
+    }
+  }
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+  "fmt"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// deleteConfirmThreshold is the number of tasks that can be deleted at once
+// without asking for confirmation
+const deleteConfirmThreshold = 3
+
+// Deletes the todo items at the given 1-based indexes, as shown by the
+// last listing, keeping them in the trash. Deleting more than
+// deleteConfirmThreshold tasks asks for confirmation unless force is set
+func deleteTodoItems(s *session, args []string, force bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+
+  var targets []*todo.Task
+  seen := map[string]bool{}
+  for _, arg := range args {
+    task, err := s.taskAt(items, arg)
+    if err != nil {
+      return err
+    }
+    if !seen[task.ID] {
+      seen[task.ID] = true
+      targets = append(targets, task)
+    }
+  }
+
+  if len(targets) > deleteConfirmThreshold && !force {
+    for _, task := range targets {
+      fmt.Printf("  %s\n", task.Title)
+    }
+    if !confirmf("Delete these %d tasks?", len(targets)) {
+      return nil
+    }
+  }
+
+  var deleted []*todo.Task
+  err = s.mutateAll(opDelete, targets, func(task *todo.Task) {
+    infof("Task '%s' moved to the trash, 'todo trash restore %s' brings it back", task.Title, shortID(task.ID))
+    deleted = append(deleted, task)
+  })
+  trashTasks(s, items, deleted)
+  return err
+}
+
+func init() {
+  register(&command{
+    name:    "rm",
+    aliases: []string{"delete"},
+    usage:   "rm [--force] <index...>",
+    summary: "Delete one or more tasks",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      force := fs.Bool("force", false, "delete without asking for confirmation")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return invalidf("Missing task index, see 'todo help rm'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return deleteTodoItems(s, args, *force)
+    },
+  })
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "mime"
+  "net"
+  "net/smtp"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// digestDays is how many days ahead and back a digest looks
+const digestDays = 7
+
+// digest summarizes a todo list for an email
+type digest struct {
+  subject string
+  body    string
+  // empty is set when nothing is overdue, due or recently completed
+  empty bool
+}
+
+// composeDigest summarizes the tasks of the todo list that are overdue,
+// due in the next digestDays days and completed in the last digestDays
+// days
+func composeDigest(s *session, now time.Time) (*digest, error) {
+  if s.offline {
+    return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Completed tasks are not cached, digest needs Google Tasks")}
+  }
+  today := todo.Date(now)
+  due, err := s.client.Due(s.ctx, s.todoId, time.Time{}, today.AddDate(0, 0, digestDays-1))
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve tasks: %w", err)
+  }
+  completed, err := s.client.Completed(s.ctx, s.todoId, now.AddDate(0, 0, -digestDays), time.Time{})
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+  }
+
+  var overdue, week []string
+  for _, task := range due {
+    line := fmt.Sprintf("- %s (due %s)", task.Title, formatDate(task.Due))
+    if daysUntil(task.Due, today) < 0 {
+      overdue = append(overdue, line)
+    } else {
+      week = append(week, line)
+    }
+  }
+  var done []string
+  for _, task := range completed {
+    done = append(done, fmt.Sprintf("- %s (completed %s)", task.Title, formatDate(task.Completed.Local())))
+  }
+
+  var body bytes.Buffer
+  section := func(title string, lines []string, none string) {
+    fmt.Fprintf(&body, "%s\n", title)
+    if len(lines) == 0 {
+      lines = []string{none}
+    }
+    fmt.Fprintf(&body, "%s\n\n", strings.Join(lines, "\n"))
+  }
+  section("Overdue", overdue, "Nothing is overdue.")
+  section("Due this week", week, "Nothing is due this week.")
+  section(fmt.Sprintf("Completed in the last %d days", digestDays), done, "Nothing was completed.")
+  return &digest{
+    subject: fmt.Sprintf("Your %s list: %d overdue, %d due this week, %d completed",
+      s.listName, len(overdue), len(week), len(done)),
+    body:  strings.TrimSuffix(body.String(), "\n"),
+    empty: len(overdue)+len(week)+len(done) == 0,
+  }, nil
+}
+
+// sendDigest emails d to the address to through the SMTP server of the
+// config, signing in if smtp_username is set
+func sendDigest(d *digest, to string) error {
+  c := loadConfig()
+  if c.SMTPServer == "" {
+    return invalidf("Set smtp_server to the host:port of an SMTP server to send email, see 'todo config'")
+  }
+  host, _, err := net.SplitHostPort(c.SMTPServer)
+  if err != nil {
+    return invalidf("Invalid smtp_server '%s', expected host:port", c.SMTPServer)
+  }
+  from := c.SMTPFrom
+  if from == "" {
+    from = c.SMTPUsername
+  }
+  if from == "" {
+    from = to
+  }
+  var auth smtp.Auth
+  if c.SMTPUsername != "" {
+    auth = smtp.PlainAuth("", c.SMTPUsername, c.SMTPPassword, host)
+  }
+
+  var msg bytes.Buffer
+  fmt.Fprintf(&msg, "From: %s\r\n", from)
+  fmt.Fprintf(&msg, "To: %s\r\n", to)
+  fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", d.subject))
+  fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+  msg.WriteString("MIME-Version: 1.0\r\n")
+  msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+  msg.WriteString(strings.Replace(d.body, "\n", "\r\n", -1))
+  if err := smtp.SendMail(c.SMTPServer, auth, from, []string{to}, msg.Bytes()); err != nil {
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Unable to send digest to %s: %v", to, err)}
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "digest",
+    usage:   "digest [--email address] [--cron]",
+    summary: "Summarize overdue, upcoming and recently completed tasks, or email the summary",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      email := fs.String("email", "", "send the digest to this address instead of printing it")
+      cron := fs.Bool("cron", false, "print nothing but errors and send no digest when there is nothing in it")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help digest'", args[0])
+      }
+      if *cron {
+        quietFlag = true
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      d, err := composeDigest(s, time.Now())
+      if err != nil {
+        return err
+      }
+      if *cron && d.empty {
+        return nil
+      }
+      if *email == "" {
+        fmt.Printf("%s\n\n%s\n", colorize("1", d.subject), d.body)
+        return nil
+      }
+      if err := sendDigest(d, *email); err != nil {
+        return err
+      }
+      infof("Digest sent to %s", *email)
+      return nil
+    },
+  })
+}
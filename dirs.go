@@ -0,0 +1,125 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "os/user"
+  "path/filepath"
+  "runtime"
+  "sync"
+)
+
+// Where todo keeps its files, following the conventions of each system:
+// settings, credentials and templates in the config directory
+// ($XDG_CONFIG_HOME/todo, ~/Library/Application Support/todo or
+// %AppData%\todo), cached task lists in the cache directory
+// ($XDG_CACHE_HOME/todo, ~/Library/Caches/todo or %LocalAppData%\todo)
+// and the journal, archives and tasks of the local backend in the data
+// directory ($XDG_DATA_HOME/todo, or the config directory elsewhere than
+// on Linux and BSDs)
+const appName = "todo"
+
+// legacyEntry is where a file of ~/.todo, where earlier versions kept
+// everything, now belongs: name inside the todo directory of base
+type legacyEntry struct {
+  base func() (string, error)
+  name string
+}
+
+var legacyEntries = map[string]legacyEntry{
+  "config.yaml":  {os.UserConfigDir, "config.yaml"},
+  "accounts":     {os.UserConfigDir, "accounts"},
+  "templates":    {os.UserConfigDir, "templates"},
+  "cache":        {os.UserCacheDir, "lists"},
+  "journal":      {userDataDir, "journal"},
+  "archive":      {userDataDir, "archive"},
+  "local":        {userDataDir, "local"},
+  "reminders":    {userDataDir, "reminders"},
+  "repl_history": {userDataDir, "repl_history"},
+}
+
+var migrateOnce sync.Once
+
+// userDataDir returns the directory user data such as the journal is
+// kept in, $XDG_DATA_HOME on Linux and BSDs
+func userDataDir() (string, error) {
+  switch runtime.GOOS {
+  case "windows", "darwin", "ios", "plan9":
+    return os.UserConfigDir()
+  }
+  if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+    return dir, nil
+  }
+  home, err := os.UserHomeDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(home, ".local", "share"), nil
+}
+
+// migrateTodoDir moves the files earlier versions kept in ~/.todo to the
+// directories they now belong in, unless they already exist there, and
+// removes ~/.todo once it is empty
+func migrateTodoDir() {
+  usr, err := user.Current()
+  if err != nil {
+    return
+  }
+  legacy := filepath.Join(usr.HomeDir, ".todo")
+  files, err := ioutil.ReadDir(legacy)
+  if err != nil {
+    return
+  }
+  for _, f := range files {
+    entry, ok := legacyEntries[f.Name()]
+    if !ok {
+      continue
+    }
+    dir, err := entry.base()
+    if err != nil {
+      continue
+    }
+    from, to := filepath.Join(legacy, f.Name()), filepath.Join(dir, appName, entry.name)
+    if _, err := os.Stat(to); !os.IsNotExist(err) {
+      continue
+    }
+    if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+      continue
+    }
+    if err := os.Rename(from, to); err == nil {
+      warnf("Moved %s to %s", from, to)
+    }
+  }
+  // only succeeds once nothing is left
+  os.Remove(legacy)
+}
+
+// todoPath returns the path of elem inside the todo directory of base,
+// creating the directories leading to it
+func todoPath(base func() (string, error), elem ...string) (string, error) {
+  migrateOnce.Do(migrateTodoDir)
+  root, err := base()
+  if err != nil {
+    return "", err
+  }
+  dir := filepath.Join(append([]string{root, appName}, elem...)...)
+  return dir, os.MkdirAll(dir, 0700)
+}
+
+// configDir returns the directory elem inside todo's config directory,
+// creating it if needed
+func configDir(elem ...string) (string, error) {
+  return todoPath(os.UserConfigDir, elem...)
+}
+
+// cacheDir returns the directory elem inside todo's cache directory,
+// creating it if needed
+func cacheDir(elem ...string) (string, error) {
+  return todoPath(os.UserCacheDir, elem...)
+}
+
+// dataDir returns the directory elem inside todo's data directory,
+// creating it if needed
+func dataDir(elem ...string) (string, error) {
+  return todoPath(userDataDir, elem...)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// editTemplate is the text presented in $EDITOR when editing a task
+const editTemplate = `# Lines starting with '#' above Notes are ignored, everything below
+# Notes is kept. Leave Due empty to clear it, dates like 'friday' or
+# 'in 3 days' are understood. Priority is one of high, med, low or none.
+Title: %s
+Due: %s
+Priority: %s
+Notes:
+%s
+`
+
+// Edits the todo item at the given 1-based index. Fields set in patch are
+// applied directly; with an empty patch the task is opened in $EDITOR
+func editTodoItem(s *session, arg string, patch *todo.Patch) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+
+  if patch.Empty() {
+    if patch, err = editInEditor(task); err != nil {
+      return err
+    }
+    if patch == nil {
+      infof("Task '%s' left unchanged", task.Title)
+      return nil
+    }
+  }
+
+  if task, err = s.update(task, patch); err != nil {
+    return err
+  }
+  infof("Task '%s' updated", task.Title)
+  return nil
+}
+
+// editInEditor opens task in the user's editor and returns a patch of the
+// fields that were changed, or nil if nothing changed
+func editInEditor(task *todo.Task) (*todo.Patch, error) {
+  f, err := ioutil.TempFile("", "todo-edit-*.txt")
+  if err != nil {
+    return nil, fmt.Errorf("Unable to create temporary file: %w", err)
+  }
+  defer os.Remove(f.Name())
+
+  due := ""
+  if !task.Due.IsZero() {
+    due = task.Due.Format(defaultDateFormat)
+  }
+  fmt.Fprintf(f, editTemplate, task.Title, due, task.Priority, task.Notes)
+  f.Close()
+
+  if err := runEditor(f.Name()); err != nil {
+    return nil, fmt.Errorf("Editor failed: %w", err)
+  }
+
+  b, err := ioutil.ReadFile(f.Name())
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read edited task: %w", err)
+  }
+  title, newDue, priority, notes := parseEditedTask(string(b))
+  if title == "" {
+    return nil, invalidf("Task title can not be empty")
+  }
+  p, err := todo.ParsePriority(priority)
+  if err != nil {
+    return nil, invalidf("%v", err)
+  }
+
+  patch := &todo.Patch{}
+  if title != task.Title {
+    patch.Title = &title
+  }
+  if notes != strings.TrimSpace(task.Notes) {
+    patch.Notes = &notes
+  }
+  if p != task.Priority {
+    patch.Priority = &p
+  }
+  if newDue != due {
+    if err := setDue(patch, newDue); err != nil {
+      return nil, invalidf("Invalid due date: %v", err)
+    }
+  }
+  if patch.Empty() {
+    return nil, nil
+  }
+  return patch, nil
+}
+
+// runEditor opens file in $VISUAL or $EDITOR, falling back to vi
+func runEditor(file string) error {
+  editor := os.Getenv("VISUAL")
+  if editor == "" {
+    editor = os.Getenv("EDITOR")
+  }
+  if editor == "" {
+    editor = "vi"
+  }
+  args := strings.Fields(editor)
+  cmd := exec.Command(args[0], append(args[1:], file)...)
+  cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+  return cmd.Run()
+}
+
+// parseEditedTask reads back the title, due date, priority and notes of
+// editTemplate. Notes run to the end, '#' lines included
+func parseEditedTask(text string) (string, string, string, string) {
+  var title, due, priority string
+  var notes []string
+  inNotes := false
+  scanner := bufio.NewScanner(strings.NewReader(text))
+  for scanner.Scan() {
+    line := scanner.Text()
+    switch {
+    case inNotes:
+      notes = append(notes, line)
+    case strings.HasPrefix(line, "#"):
+    case strings.HasPrefix(line, "Title:"):
+      title = strings.TrimSpace(strings.TrimPrefix(line, "Title:"))
+    case strings.HasPrefix(line, "Due:"):
+      due = strings.TrimSpace(strings.TrimPrefix(line, "Due:"))
+    case strings.HasPrefix(line, "Priority:"):
+      priority = strings.TrimSpace(strings.TrimPrefix(line, "Priority:"))
+    case strings.HasPrefix(line, "Notes:"):
+      inNotes = true
+      if rest := strings.TrimSpace(strings.TrimPrefix(line, "Notes:")); rest != "" {
+        notes = append(notes, rest)
+      }
+    }
+  }
+  return title, due, priority, strings.TrimSpace(strings.Join(notes, "\n"))
+}
+
+// setDue parses value and sets it as the due date of patch. An empty
+// value clears the due date
+func setDue(patch *todo.Patch, value string) error {
+  due := time.Time{}
+  if value != "" {
+    var err error
+    if due, err = parseDate(value, time.Now()); err != nil {
+      return err
+    }
+  }
+  patch.Due = &due
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "edit",
+    usage:   "edit [--title text] [--notes text] [--due date] [--priority p] [--every rule] [--remind 30m] <index> | edit --all",
+    summary: "Change the title, notes, due date, priority, recurrence or reminder of a task",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      title := fs.String("title", "", "new title")
+      notes := fs.String("notes", "", "new notes, empty to clear")
+      due := fs.String("due", "", "new due date such as 'friday' or '2024-03-05', empty to clear")
+      priority := fs.String("priority", "", "new priority: high, med, low or none")
+      every := fs.String("every", "", "new recurrence such as 3d or weekly, none to stop recurring")
+      remind := fs.Duration("remind", 0, "remind this long before the task is due, 0 to remove the reminder")
+      all := fs.Bool("all", false, "edit all tasks of the list at once in $EDITOR, one per line")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 && !*all {
+        return invalidf("Expected exactly one task index, see 'todo help edit'")
+      }
+
+      patch := &todo.Patch{}
+      fs.Visit(func(f *flag.Flag) {
+        switch f.Name {
+        case "title":
+          if *title == "" {
+            err = invalidf("Task title can not be empty")
+          }
+          patch.Title = title
+        case "notes":
+          patch.Notes = notes
+        case "due":
+          if e := setDue(patch, *due); e != nil {
+            err = invalidf("Invalid due date: %v", e)
+          }
+        case "priority":
+          p, e := todo.ParsePriority(*priority)
+          if e != nil {
+            err = invalidf("%v", e)
+          }
+          patch.Priority = &p
+        case "every":
+          r, e := parseEvery(*every)
+          if e != nil {
+            err = e
+          }
+          patch.Every = r
+        case "remind":
+          if *remind < 0 {
+            err = invalidf("--remind must not be negative")
+          }
+          patch.Remind = remind
+        }
+      })
+      if err != nil {
+        return err
+      }
+      if *all && (len(args) > 0 || !patch.Empty()) {
+        return invalidf("--all takes no task index or fields to change, see 'todo help edit'")
+      }
+
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if *all {
+        return bulkEdit(s)
+      }
+      return editTodoItem(s, args[0], patch)
+    },
+  })
+}
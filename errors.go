@@ -0,0 +1,241 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net"
+  "net/http"
+  "net/url"
+  "os"
+  "strings"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+  "golang.org/x/oauth2"
+  "google.golang.org/api/googleapi"
+)
+
+// Exit codes of the todo binary
+const (
+  exitOK       = 0
+  exitFailure  = 1
+  exitNotFound = 2
+  exitAuth     = 3
+  exitNetwork  = 4
+  exitInvalid  = 5
+  exitQuota    = 6
+  // exitInterrupted is what shells report for processes killed by Ctrl-C
+  exitInterrupted = 130
+)
+
+// exitError is an error that makes todo terminate with a specific code.
+// Reported errors have already been shown to the user
+type exitError struct {
+  code     int
+  err      error
+  reported bool
+}
+
+func (e *exitError) Error() string {
+  return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+  return e.err
+}
+
+// invalidf returns an error about invalid input from the user
+func invalidf(format string, a ...interface{}) error {
+  return &exitError{code: exitInvalid, err: fmt.Errorf(tr(format), a...)}
+}
+
+// notFoundf returns an error about a task or task list that does not exist
+func notFoundf(format string, a ...interface{}) error {
+  return &exitError{code: exitNotFound, err: fmt.Errorf(tr(format), a...)}
+}
+
+// authError marks err as an authentication failure
+func authError(err error) error {
+  return &exitError{code: exitAuth, err: err}
+}
+
+// exitCode classifies err into one of the exit codes
+func exitCode(err error) int {
+  var e *exitError
+  if errors.As(err, &e) {
+    return e.code
+  }
+  switch {
+  case errors.Is(err, context.Canceled):
+    return exitInterrupted
+  case errors.Is(err, context.DeadlineExceeded):
+    return exitNetwork
+  case errors.Is(err, todo.ErrNotFound):
+    return exitNotFound
+  case isQuotaError(err):
+    return exitQuota
+  case isAuthError(err):
+    return exitAuth
+  case isNetworkError(err):
+    return exitNetwork
+  }
+  return exitFailure
+}
+
+// isAuthError reports whether err means the user's credentials were
+// missing, rejected or revoked
+func isAuthError(err error) bool {
+  var re *oauth2.RetrieveError
+  if errors.As(err, &re) {
+    return true
+  }
+  var te *todo.TodoistError
+  if errors.As(err, &te) {
+    return te.Code == http.StatusUnauthorized || te.Code == http.StatusForbidden
+  }
+  var ce *todo.CalDAVError
+  if errors.As(err, &ce) {
+    return ce.Code == http.StatusUnauthorized || ce.Code == http.StatusForbidden
+  }
+  var ge *googleapi.Error
+  return errors.As(err, &ge) &&
+    (ge.Code == http.StatusUnauthorized || ge.Code == http.StatusForbidden)
+}
+
+// quotaReasons are the reasons Google APIs give for refusing requests
+// with 403 because of rate limits or quotas, rather than denied access
+var quotaReasons = map[string]bool{
+  "rateLimitExceeded":     true,
+  "userRateLimitExceeded": true,
+  "quotaExceeded":         true,
+  "dailyLimitExceeded":    true,
+}
+
+// isQuotaError reports whether err means requests were refused because
+// they came too fast or the daily quota is used up
+func isQuotaError(err error) bool {
+  var te *todo.TodoistError
+  if errors.As(err, &te) {
+    return te.Code == http.StatusTooManyRequests
+  }
+  var ce *todo.CalDAVError
+  if errors.As(err, &ce) {
+    return ce.Code == http.StatusTooManyRequests
+  }
+  var ge *googleapi.Error
+  if !errors.As(err, &ge) {
+    return false
+  }
+  if ge.Code == http.StatusTooManyRequests {
+    return true
+  }
+  for _, item := range ge.Errors {
+    if ge.Code == http.StatusForbidden && quotaReasons[item.Reason] {
+      return true
+    }
+  }
+  return false
+}
+
+// isInvalidGrant reports whether err means Google rejected a refresh
+// token, because it was revoked or has expired
+func isInvalidGrant(err error) bool {
+  var re *oauth2.RetrieveError
+  return errors.As(err, &re) && re.ErrorCode == "invalid_grant"
+}
+
+// isNetworkError reports whether err means Google Tasks could not be
+// reached, or failed on its side
+func isNetworkError(err error) bool {
+  var ne net.Error
+  if errors.As(err, &ne) {
+    return true
+  }
+  var ue *url.Error
+  if errors.As(err, &ue) {
+    return true
+  }
+  var te *todo.TodoistError
+  if errors.As(err, &te) {
+    return te.Code >= 500
+  }
+  var ce *todo.CalDAVError
+  if errors.As(err, &ce) {
+    return ce.Code >= 500
+  }
+  var ge *googleapi.Error
+  return errors.As(err, &ge) && ge.Code >= 500
+}
+
+// friendlyMessage describes err for the user, with a hint on how to
+// resolve it where there is one
+func friendlyMessage(err error) string {
+  switch {
+  case errors.Is(err, context.Canceled):
+    return tr("Interrupted")
+  case errors.Is(err, context.DeadlineExceeded):
+    return fmt.Sprintf("%v\n"+tr("Gave up after --timeout %s"), err, timeoutFlag)
+  }
+  switch exitCode(err) {
+  case exitAuth:
+    switch currentBackend() {
+    case backendTodoist:
+      return fmt.Sprintf("%v\n%s", err, tr("Authorization failed, check your Todoist API token"))
+    case backendCalDAV:
+      return fmt.Sprintf("%v\n%s", err, tr("Authorization failed, check caldav_username and caldav_password"))
+    }
+    if c := loadConfig(); c.ServiceAccount != "" {
+      return fmt.Sprintf("%v\n%s", err, tr("Authorization failed, check service_account and impersonate"))
+    } else if c.RefreshToken != "" {
+      return fmt.Sprintf("%v\n%s", err, tr("Authorization failed, check refresh_token"))
+    }
+    return fmt.Sprintf("%v\n%s", err, tr("Authorization failed, run 'todo auth' to sign in again"))
+  case exitNetwork:
+    return fmt.Sprintf("%v\n%s", err, tr("Unable to reach Google Tasks, check your network connection"))
+  case exitQuota:
+    return fmt.Sprintf("%v\n%s", err,
+      tr("Too many requests, or the daily quota is used up. Wait a while and try again, or lower max_qps"))
+  }
+  return err.Error()
+}
+
+// errorKinds names the exit codes in JSON error reports
+var errorKinds = map[int]string{
+  exitFailure:     "failure",
+  exitNotFound:    "not_found",
+  exitAuth:        "auth",
+  exitNetwork:     "network",
+  exitInvalid:     "invalid",
+  exitQuota:       "quota",
+  exitInterrupted: "interrupted",
+}
+
+// errorReport is the JSON form of an error, printed with --output json
+type errorReport struct {
+  Code    int    `json:"code"`
+  Kind    string `json:"kind"`
+  Message string `json:"message"`
+  Hint    string `json:"hint,omitempty"`
+}
+
+// reportError shows err to the user on stderr, unless it has been already.
+// With --output json it is printed as {"error": {...}} in any case, for
+// scripts to tell failures apart without parsing messages
+func reportError(err error) {
+  e, ok := err.(*exitError)
+  if loadConfig().Output != outputJSON {
+    if !ok || !e.reported {
+      fmt.Fprintf(os.Stderr, "todo: %s\n", friendlyMessage(err))
+    }
+    return
+  }
+  r := errorReport{Code: exitCode(err), Message: friendlyMessage(err)}
+  r.Kind = errorKinds[r.Code]
+  if hint := strings.TrimPrefix(r.Message, err.Error()+"\n"); hint != r.Message {
+    r.Message, r.Hint = err.Error(), hint
+  }
+  enc := json.NewEncoder(os.Stderr)
+  enc.SetIndent("", "  ")
+  enc.Encode(map[string]errorReport{"error": r})
+}
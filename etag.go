@@ -0,0 +1,161 @@
+package main
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "time"
+)
+
+// etagMaxAge is how long cached responses are kept after they were last
+// used, since requests for ranges of dates rarely repeat
+const etagMaxAge = 7 * 24 * time.Hour
+
+// cachedResponse is a response to a GET request kept with its ETag, to
+// be served again when the server answers 304 Not Modified
+type cachedResponse struct {
+  URL         string `json:"url"`
+  ETag        string `json:"etag"`
+  ContentType string `json:"contentType,omitempty"`
+  Body        []byte `json:"body"`
+}
+
+// etagTransport sends the ETag of the last response to each GET request
+// as If-None-Match, so that unchanged task lists are answered with an
+// empty 304 Not Modified, and then replies with the cached response
+type etagTransport struct {
+  base http.RoundTripper
+}
+
+// etagFile returns the path of the file holding the cached response to
+// rawURL for the current account
+func etagFile(rawURL string) (string, error) {
+  dir, err := cacheDir("http", stateName())
+  if err != nil {
+    return "", err
+  }
+  sum := sha256.Sum256([]byte(rawURL))
+  return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// loadResponse reads the cached response to rawURL, or returns nil if
+// there is none
+func loadResponse(rawURL string) *cachedResponse {
+  file, err := etagFile(rawURL)
+  if err != nil {
+    return nil
+  }
+  b, err := readPrivate(file)
+  if err != nil {
+    return nil
+  }
+  cached := &cachedResponse{}
+  if err := json.Unmarshal(b, cached); err != nil || cached.URL != rawURL {
+    return nil
+  }
+  return cached
+}
+
+// save writes the cached response, replacing the file atomically since
+// lists may be fetched concurrently, and removes the responses unused
+// for etagMaxAge
+func (c *cachedResponse) save() error {
+  file, err := etagFile(c.URL)
+  if err != nil {
+    return err
+  }
+  if entries, err := ioutil.ReadDir(filepath.Dir(file)); err == nil {
+    for _, e := range entries {
+      if time.Since(e.ModTime()) > etagMaxAge {
+        os.Remove(filepath.Join(filepath.Dir(file), e.Name()))
+      }
+    }
+  }
+  b, err := json.Marshal(c)
+  if err != nil {
+    return err
+  }
+  if b, err = sealPrivate(b); err != nil {
+    return err
+  }
+  tmp, err := ioutil.TempFile(filepath.Dir(file), "response")
+  if err != nil {
+    return err
+  }
+  if _, err := tmp.Write(b); err != nil {
+    tmp.Close()
+    os.Remove(tmp.Name())
+    return err
+  }
+  if err := tmp.Close(); err != nil {
+    os.Remove(tmp.Name())
+    return err
+  }
+  return os.Rename(tmp.Name(), file)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" {
+    return t.base.RoundTrip(req)
+  }
+  rawURL := req.URL.String()
+  cached := loadResponse(rawURL)
+  if cached != nil {
+    // RoundTrip must not modify the request it was given
+    req = req.Clone(req.Context())
+    req.Header.Set("If-None-Match", cached.ETag)
+  }
+  res, err := t.base.RoundTrip(req)
+  if err != nil {
+    return nil, err
+  }
+
+  switch {
+  case res.StatusCode == http.StatusNotModified && cached != nil:
+    res.Body.Close()
+    verbosef("Using the cached response to %s", req.URL.Redacted())
+    if file, err := etagFile(rawURL); err == nil {
+      now := time.Now()
+      os.Chtimes(file, now, now)
+    }
+    return cached.response(req), nil
+  case res.StatusCode == http.StatusOK && res.Header.Get("ETag") != "":
+    body, err := ioutil.ReadAll(res.Body)
+    res.Body.Close()
+    if err != nil {
+      return nil, err
+    }
+    res.Body = ioutil.NopCloser(bytes.NewReader(body))
+    c := &cachedResponse{URL: rawURL, ETag: res.Header.Get("ETag"), ContentType: res.Header.Get("Content-Type"), Body: body}
+    if err := c.save(); err != nil {
+      verbosef("Unable to cache the response to %s: %v", req.URL.Redacted(), err)
+    }
+  }
+  return res, nil
+}
+
+// response returns the cached response as a reply to req
+func (c *cachedResponse) response(req *http.Request) *http.Response {
+  header := http.Header{}
+  header.Set("ETag", c.ETag)
+  if c.ContentType != "" {
+    header.Set("Content-Type", c.ContentType)
+  }
+  return &http.Response{
+    Status:        "200 OK",
+    StatusCode:    http.StatusOK,
+    Proto:         "HTTP/1.1",
+    ProtoMajor:    1,
+    ProtoMinor:    1,
+    Header:        header,
+    Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+    ContentLength: int64(len(c.Body)),
+    Request:       req,
+  }
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+  "bufio"
+  "encoding/csv"
+  "fmt"
+  "io"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// exporters write tasks in the formats export supports
+var exporters = map[string]func(w io.Writer, items []*todo.Task) error{
+  "md":  exportMarkdown,
+  "csv": exportCSV,
+  "ics": exportICS,
+}
+
+// exportMarkdown writes items as a Markdown checklist that import reads
+// back, with subtasks indented below their parent
+func exportMarkdown(w io.Writer, items []*todo.Task) error {
+  all := make([]int, len(items))
+  for i := range all {
+    all[i] = i
+  }
+  order, depth := treeOrder(items, all)
+  for _, i := range order {
+    task := items[i]
+    check := " "
+    if task.Done() {
+      check = "x"
+    }
+    line := fmt.Sprintf("%s- [%s] %s", strings.Repeat("  ", depth[i]), check, task.Title)
+    if !task.Due.IsZero() {
+      line += " due " + task.Due.Format("2006-01-02")
+    }
+    for _, tag := range task.Tags {
+      line += " +" + tag
+    }
+    if _, err := fmt.Fprintln(w, line); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// exportCSV writes items as CSV with a header row and all task fields
+func exportCSV(w io.Writer, items []*todo.Task) error {
+  cw := csv.NewWriter(w)
+  cw.Write([]string{"id", "title", "notes", "due", "priority", "tags", "parent", "completed", "updated"})
+  for _, task := range items {
+    cw.Write([]string{
+      task.ID,
+      task.Title,
+      task.Notes,
+      csvTime(task.Due, "2006-01-02"),
+      task.Priority.String(),
+      strings.Join(task.Tags, ","),
+      task.Parent,
+      csvTime(task.Completed, time.RFC3339),
+      csvTime(task.Updated, time.RFC3339),
+    })
+  }
+  cw.Flush()
+  return cw.Error()
+}
+
+// csvTime formats t with layout, or as an empty field if it is zero
+func csvTime(t time.Time, layout string) string {
+  if t.IsZero() {
+    return ""
+  }
+  return t.Format(layout)
+}
+
+// icsPriorities maps priorities to the PRIORITY values of iCalendar, where
+// 1 is the highest and 9 the lowest
+var icsPriorities = map[todo.Priority]int{
+  todo.PriorityHigh:   1,
+  todo.PriorityMedium: 5,
+  todo.PriorityLow:    9,
+}
+
+// exportICS writes items as an iCalendar file of VTODO components
+func exportICS(w io.Writer, items []*todo.Task) error {
+  bw := bufio.NewWriter(w)
+  line := func(s string) {
+    bw.WriteString(foldICS(s) + "\r\n")
+  }
+  stamp := time.Now().UTC().Format("20060102T150405Z")
+
+  line("BEGIN:VCALENDAR")
+  line("VERSION:2.0")
+  line("PRODID:-//PedramPejman//todo//EN")
+  for _, task := range items {
+    line("BEGIN:VTODO")
+    line("UID:" + escapeICS(task.ID))
+    line("DTSTAMP:" + stamp)
+    line("SUMMARY:" + escapeICS(task.Title))
+    if task.Notes != "" {
+      line("DESCRIPTION:" + escapeICS(task.Notes))
+    }
+    if !task.Due.IsZero() {
+      line("DUE;VALUE=DATE:" + task.Due.Format("20060102"))
+    }
+    if p, ok := icsPriorities[task.Priority]; ok {
+      line(fmt.Sprintf("PRIORITY:%d", p))
+    }
+    if len(task.Tags) > 0 {
+      var tags []string
+      for _, tag := range task.Tags {
+        tags = append(tags, escapeICS(tag))
+      }
+      line("CATEGORIES:" + strings.Join(tags, ","))
+    }
+    if task.Parent != "" {
+      line("RELATED-TO:" + escapeICS(task.Parent))
+    }
+    if !task.Updated.IsZero() {
+      line("LAST-MODIFIED:" + task.Updated.UTC().Format("20060102T150405Z"))
+    }
+    if task.Done() {
+      line("STATUS:COMPLETED")
+      line("COMPLETED:" + task.Completed.UTC().Format("20060102T150405Z"))
+    } else {
+      line("STATUS:NEEDS-ACTION")
+    }
+    line("END:VTODO")
+  }
+  line("END:VCALENDAR")
+  return bw.Flush()
+}
+
+// escapeICS escapes s for use as an iCalendar TEXT value
+func escapeICS(s string) string {
+  return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICS splits a content line longer than 75 octets into continuation
+// lines, without breaking up UTF-8 sequences
+func foldICS(s string) string {
+  var b strings.Builder
+  n := 0
+  for _, r := range s {
+    size := len(string(r))
+    if n+size > 75 {
+      b.WriteString("\r\n ")
+      n = 1
+    }
+    b.WriteRune(r)
+    n += size
+  }
+  return b.String()
+}
+
+// Writes the tasks of the todo list, or with allLists set of all task
+// lists, to w with export, one of exporters. With all set, completed tasks
+// are included
+func exportTodoItems(s *session, w io.Writer, export func(io.Writer, []*todo.Task) error, all bool, allLists bool) error {
+  if allLists {
+    items, err := allListsItems(s, all)
+    if err != nil {
+      return err
+    }
+    return export(w, items)
+  }
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  if all {
+    if s.offline {
+      return &exitError{code: exitNetwork, err: fmt.Errorf("Completed tasks are not cached, --all needs Google Tasks")}
+    }
+    completed, err := s.client.Completed(s.ctx, s.todoId, time.Time{}, time.Time{})
+    if err != nil {
+      return fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+    }
+    items = append(append([]*todo.Task{}, items...), completed...)
+  }
+  return export(w, items)
+}
+
+// allListsItems returns the tasks of all task lists, one list after the
+// other, fetching the lists concurrently. With all set, completed tasks
+// are included
+func allListsItems(s *session, all bool) ([]*todo.Task, error) {
+  if s.offline {
+    return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Other lists are not cached, --all-lists needs Google Tasks")}
+  }
+  lists, err := s.client.Lists(s.ctx)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve task lists. %w", err)
+  }
+  results, err := fetchLists(s.ctx, lists, func(ctx context.Context, list *todo.TaskList) ([]*todo.Task, error) {
+    items, err := s.client.List(ctx, list.ID)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to retrieve tasks of %s: %w", list.Title, err)
+    }
+    if all {
+      completed, err := s.client.Completed(ctx, list.ID, time.Time{}, time.Time{})
+      if err != nil {
+        return nil, fmt.Errorf("Unable to retrieve completed tasks of %s: %w", list.Title, err)
+      }
+      items = append(items, completed...)
+    }
+    return items, nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  var items []*todo.Task
+  for _, r := range results {
+    items = append(items, r...)
+  }
+  return items, nil
+}
+
+func init() {
+  register(&command{
+    name:    "export",
+    usage:   "export [--format md|csv|ics] [--out file] [--all] [--all-lists]",
+    summary: "Write your tasks as a Markdown checklist, CSV or iCalendar file",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      format := fs.String("format", "md", "output format: md, csv or ics")
+      out := fs.String("out", "", "file to write to instead of stdout")
+      all := fs.Bool("all", false, "include completed tasks")
+      allLists := fs.Bool("all-lists", false, "export the tasks of all task lists")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help export'", args[0])
+      }
+      export, ok := exporters[*format]
+      if !ok {
+        return invalidf("Unknown export format '%s', expected md, csv or ics", *format)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if *out == "" {
+        return exportTodoItems(s, os.Stdout, export, *all, *allLists)
+      }
+
+      f, err := os.Create(*out)
+      if err != nil {
+        return fmt.Errorf("Unable to create %s: %w", *out, err)
+      }
+      if err := exportTodoItems(s, f, export, *all, *allLists); err != nil {
+        f.Close()
+        return err
+      }
+      if err := f.Close(); err != nil {
+        return err
+      }
+      what := "your " + s.listName + " list"
+      if *allLists {
+        what = "all your lists"
+      }
+      fmt.Fprintf(os.Stderr, "Exported %s to %s\n", what, *out)
+      return nil
+    },
+  })
+}
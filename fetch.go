@@ -0,0 +1,75 @@
+package main
+
+import (
+  "sync"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// fetchWorkers bounds how many requests are sent at once
+const fetchWorkers = 8
+
+// inParallel calls do for each index below n, with at most fetchWorkers
+// calls running at once. The first error cancels the context passed to
+// the calls still running and is returned
+func inParallel(ctx context.Context, n int, do func(ctx context.Context, i int) error) error {
+  ctx, cancel := context.WithCancel(ctx)
+  defer cancel()
+
+  next := make(chan int)
+  var (
+    wg       sync.WaitGroup
+    once     sync.Once
+    firstErr error
+  )
+  workers := fetchWorkers
+  if n < workers {
+    workers = n
+  }
+  for w := 0; w < workers; w++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for i := range next {
+        if err := do(ctx, i); err != nil {
+          once.Do(func() {
+            firstErr = err
+            cancel()
+          })
+        }
+      }
+    }()
+  }
+
+feed:
+  for i := 0; i < n; i++ {
+    select {
+    case next <- i:
+    case <-ctx.Done():
+      break feed
+    }
+  }
+  close(next)
+  wg.Wait()
+
+  if firstErr != nil {
+    return firstErr
+  }
+  return ctx.Err()
+}
+
+// fetchLists calls fetch for each of lists in parallel and returns the
+// results in the order of lists
+func fetchLists(ctx context.Context, lists []*todo.TaskList, fetch func(ctx context.Context, list *todo.TaskList) ([]*todo.Task, error)) ([][]*todo.Task, error) {
+  results := make([][]*todo.Task, len(lists))
+  err := inParallel(ctx, len(lists), func(ctx context.Context, i int) error {
+    items, err := fetch(ctx, lists[i])
+    results[i] = items
+    return err
+  })
+  if err != nil {
+    return nil, err
+  }
+  return results, nil
+}
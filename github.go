@@ -0,0 +1,222 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "regexp"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// githubAPI is the address of the GitHub REST API
+const githubAPI = "https://api.github.com"
+
+// metaGitHub is the metadata key identifying the issue a task mirrors, as
+// owner/name#number
+const metaGitHub = "github"
+
+// githubNext finds the address of the next page in a Link header
+var githubNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// githubIssue is the part of a GitHub issue sync uses
+type githubIssue struct {
+  Number    int    `json:"number"`
+  Title     string `json:"title"`
+  HTMLURL   string `json:"html_url"`
+  State     string `json:"state"`
+  Milestone *struct {
+    DueOn *time.Time `json:"due_on"`
+  } `json:"milestone"`
+  // set for pull requests, which the issues API lists as well
+  PullRequest *struct{} `json:"pull_request"`
+}
+
+// githubClient calls the GitHub REST API with a personal access token
+type githubClient struct {
+  api    string
+  token  string
+  client *http.Client
+}
+
+// get decodes the JSON response to a GET of u into v and returns the
+// address of the next page, if any
+func (g *githubClient) get(ctx context.Context, u string, v interface{}) (string, error) {
+  req, err := http.NewRequest(http.MethodGet, u, nil)
+  if err != nil {
+    return "", err
+  }
+  req.Header.Set("Accept", "application/vnd.github+json")
+  req.Header.Set("Authorization", "Bearer "+g.token)
+  res, err := g.client.Do(req.WithContext(ctx))
+  if err != nil {
+    return "", &exitError{code: exitNetwork, err: fmt.Errorf("Unable to reach GitHub: %w", err)}
+  }
+  defer res.Body.Close()
+  if res.StatusCode != http.StatusOK {
+    var body struct {
+      Message string `json:"message"`
+    }
+    json.NewDecoder(res.Body).Decode(&body)
+    if body.Message == "" {
+      body.Message = http.StatusText(res.StatusCode)
+    }
+    err := fmt.Errorf("GitHub: %s (%d)", body.Message, res.StatusCode)
+    switch res.StatusCode {
+    case http.StatusUnauthorized:
+      return "", fmt.Errorf("%v, check github_token", err)
+    case http.StatusNotFound:
+      return "", notFoundf("%v", err)
+    }
+    return "", err
+  }
+  if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+    return "", fmt.Errorf("Invalid response of GitHub: %v", err)
+  }
+  next := ""
+  if m := githubNext.FindStringSubmatch(res.Header.Get("Link")); m != nil {
+    next = m[1]
+  }
+  return next, nil
+}
+
+// assignedIssues returns the issues of repo assigned to the owner of the
+// token, open and closed, leaving out pull requests
+func (g *githubClient) assignedIssues(ctx context.Context, repo string) ([]*githubIssue, error) {
+  var me struct {
+    Login string `json:"login"`
+  }
+  if _, err := g.get(ctx, g.api+"/user", &me); err != nil {
+    return nil, err
+  }
+  var issues []*githubIssue
+  u := fmt.Sprintf("%s/repos/%s/issues?assignee=%s&state=all&per_page=100", g.api, repo, me.Login)
+  for u != "" {
+    var page []*githubIssue
+    next, err := g.get(ctx, u, &page)
+    if err != nil {
+      return nil, err
+    }
+    for _, issue := range page {
+      if issue.PullRequest == nil {
+        issues = append(issues, issue)
+      }
+    }
+    u = next
+  }
+  return issues, nil
+}
+
+// issueDue returns the due date of the milestone of issue, or zero
+func issueDue(issue *githubIssue) time.Time {
+  if issue.Milestone == nil || issue.Milestone.DueOn == nil {
+    return time.Time{}
+  }
+  return todo.Date(*issue.Milestone.DueOn)
+}
+
+// Mirrors the issues of repo assigned to the user as tasks: a task is
+// added for each open issue without one, titled like the issue, with its
+// address in the notes and due when its milestone is, and existing tasks
+// are updated. With closeDone set, the tasks of closed issues are
+// completed
+func syncGitHub(s *session, g *githubClient, repo string, closeDone bool) error {
+  issues, err := g.assignedIssues(s.ctx, repo)
+  if err != nil {
+    return err
+  }
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  tasks := map[string]*todo.Task{}
+  for _, task := range items {
+    if key := task.Meta[metaGitHub]; key != "" {
+      tasks[key] = task
+    }
+  }
+
+  added, updated := 0, 0
+  var closed []*todo.Task
+  for _, issue := range issues {
+    key := fmt.Sprintf("%s#%d", repo, issue.Number)
+    task, ok := tasks[key]
+    due := issueDue(issue)
+    switch {
+    case issue.State == "closed":
+      if ok && closeDone {
+        closed = append(closed, task)
+      }
+    case !ok:
+      task = &todo.Task{Title: issue.Title, Notes: issue.HTMLURL, Due: due,
+        Meta: map[string]string{metaGitHub: key}}
+      if _, err := s.insert(task); err != nil {
+        return fmt.Errorf("Could not create task %w", err)
+      }
+      infof("Task '%s' added for %s", issue.Title, key)
+      added++
+    default:
+      patch := &todo.Patch{}
+      if task.Title != issue.Title {
+        patch.Title = &issue.Title
+      }
+      if !task.Due.Equal(due) {
+        patch.Due = &due
+      }
+      if patch.Empty() {
+        continue
+      }
+      if _, err := s.update(task, patch); err != nil {
+        return err
+      }
+      infof("Task '%s' updated for %s", issue.Title, key)
+      updated++
+    }
+  }
+  err = s.mutateAll(opComplete, closed, func(task *todo.Task) {
+    infof("Task '%s' completed, %s is closed", task.Title, task.Meta[metaGitHub])
+  })
+  if err != nil {
+    return err
+  }
+  infof("%d added, %d updated and %d completed", added, updated, len(closed))
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "github",
+    usage:   "github sync --repo owner/name [--close]",
+    summary: "Mirror the GitHub issues assigned to you as tasks",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      repo := fs.String("repo", "", "repository whose issues to mirror, as owner/name")
+      closeDone := fs.Bool("close", false, "complete the tasks of closed issues")
+      api := fs.String("api-url", githubAPI, "address of the GitHub API, for GitHub Enterprise Server")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 || args[0] != "sync" {
+        return invalidf("Unknown github command, see 'todo help github'")
+      }
+      if parts := strings.Split(*repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+        return invalidf("Expected --repo owner/name, see 'todo help github'")
+      }
+      token := loadConfig().GitHubToken
+      if token == "" {
+        return invalidf("Set github_token to a personal access token that can read the issues of %s", *repo)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      g := &githubClient{api: strings.TrimSuffix(*api, "/"), token: token,
+        client: &http.Client{Transport: retryTransport(http.DefaultTransport)}}
+      return syncGitHub(s, g, *repo, *closeDone)
+    },
+  })
+}
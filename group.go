@@ -0,0 +1,182 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "os"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// dueGroups are the sections of 'todo list --group-by due', in order
+var dueGroups = []string{"Overdue", "Today", "Tomorrow", "This week", "Later", "No due date"}
+
+// noTag is the section of 'todo list --group-by tag' holding untagged tasks
+const noTag = "No tag"
+
+// taskGroup is a section of a grouped listing: the tasks of items at the
+// indexes in order, with their depth below their parent
+type taskGroup struct {
+  name    string
+  items   []*todo.Task
+  order   []int
+  depth   map[int]int
+  blocked map[string]bool
+}
+
+// dueGroup returns which of dueGroups task falls in, this week ending
+// before the next week_start
+func dueGroup(task *todo.Task, today time.Time) string {
+  if task.Due.IsZero() {
+    return "No due date"
+  }
+  switch days := daysUntil(task.Due, today); {
+  case days < 0:
+    return "Overdue"
+  case days == 0:
+    return "Today"
+  case days == 1:
+    return "Tomorrow"
+  case days < 7-weekOffset(today):
+    return "This week"
+  }
+  return "Later"
+}
+
+// groupTasks splits the tasks of items at the indexes in order into
+// sections by their due date or, with by set to tag, by tag, listing tasks
+// with several tags under each one. Subtasks are listed with their parent
+func groupTasks(items []*todo.Task, order []int, depth map[int]int, blocked map[string]bool, by string) ([]*taskGroup, error) {
+  var names []string
+  switch by {
+  case "due":
+    names = dueGroups
+  case "tag":
+  default:
+    return nil, invalidf("Unknown grouping '%s', expected due, tag or list", by)
+  }
+
+  today := todo.Date(time.Now())
+  groups := map[string]*taskGroup{}
+  var current []string
+  for _, i := range order {
+    task := items[i]
+    if depth[i] == 0 {
+      current = nil
+      if by == "due" {
+        current = append(current, dueGroup(task, today))
+      }
+      if by == "tag" {
+        for _, tag := range task.Tags {
+          current = append(current, strings.ToLower(tag))
+        }
+        if len(current) == 0 {
+          current = append(current, noTag)
+        }
+      }
+    }
+    for _, name := range current {
+      g := groups[name]
+      if g == nil {
+        g = &taskGroup{name: name, items: items, depth: depth, blocked: blocked}
+        groups[name] = g
+        if by == "tag" {
+          names = append(names, name)
+        }
+      }
+      g.order = append(g.order, i)
+    }
+  }
+  if by == "tag" {
+    sort.Slice(names, func(a, b int) bool {
+      return names[b] == noTag || names[a] != noTag && names[a] < names[b]
+    })
+  }
+
+  var sections []*taskGroup
+  for _, name := range names {
+    if g := groups[name]; g != nil {
+      if by == "due" || name == noTag {
+        g.name = tr(name)
+      } else {
+        g.name = "+" + name
+      }
+      sections = append(sections, g)
+    }
+  }
+  return sections, nil
+}
+
+// listAllLists lists the tasks of every task list under a header for each
+// list, each one selected and ordered as opts says
+func listAllLists(opts listOptions) error {
+  client, err := newClient()
+  if err != nil {
+    return err
+  }
+  lists, err := client.Lists(cmdCtx)
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve task lists. %w", err)
+  }
+  results, err := fetchLists(cmdCtx, lists, func(ctx context.Context, list *todo.TaskList) ([]*todo.Task, error) {
+    items, err := client.List(ctx, list.ID)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to retrieve tasks of %s: %w", list.Title, err)
+    }
+    return items, nil
+  })
+  if err != nil {
+    return err
+  }
+
+  var groups []*taskGroup
+  for l, list := range lists {
+    order, depth, blocked, err := listOrder(results[l], opts)
+    if err != nil {
+      return err
+    }
+    if len(order) > 0 {
+      groups = append(groups, &taskGroup{name: list.Title, items: results[l], order: order, depth: depth, blocked: blocked})
+    }
+  }
+  return printGroups(groups, opts)
+}
+
+// printGroups prints each group under a bold header, as a table or with
+// opts.plain set one task per line, or as a JSON array of groups
+func printGroups(groups []*taskGroup, opts listOptions) error {
+  if loadConfig().Output == outputJSON {
+    type jsonGroup struct {
+      Group string       `json:"group"`
+      Tasks []*todo.Task `json:"tasks"`
+    }
+    out := []jsonGroup{}
+    for _, g := range groups {
+      jg := jsonGroup{Group: g.name}
+      for _, i := range g.order {
+        jg.Tasks = append(jg.Tasks, g.items[i])
+      }
+      out = append(out, jg)
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(out)
+  }
+
+  for n, g := range groups {
+    if n > 0 {
+      fmt.Println()
+    }
+    fmt.Println(colorize("1", g.name))
+    if opts.plain {
+      printTaskLines(g.items, g.order, g.depth, g.blocked, opts.ids)
+    } else {
+      printTaskTable(g.items, g.order, g.depth, g.blocked, opts.ids)
+    }
+  }
+  return nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+  "crypto/subtle"
+  "fmt"
+  "net"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "github.com/PedramPejman/todo/pkg/todopb"
+  "golang.org/x/net/context"
+  "google.golang.org/grpc"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/metadata"
+  "google.golang.org/grpc/status"
+  "google.golang.org/protobuf/types/known/durationpb"
+  "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultWatchInterval is how often WatchTasks polls for changes unless
+// the request says otherwise
+const defaultWatchInterval = 30 * time.Second
+
+// grpcServer implements the todo.v1.Todo gRPC service on top of the same
+// server as the REST API
+type grpcServer struct {
+  todopb.UnimplementedTodoServer
+  *server
+}
+
+// grpcStatus maps the exit code err would result in to a gRPC status
+func grpcStatus(err error) error {
+  if _, ok := status.FromError(err); ok {
+    return err
+  }
+  code := codes.Internal
+  switch exitCode(err) {
+  case exitNotFound:
+    code = codes.NotFound
+  case exitInvalid:
+    code = codes.InvalidArgument
+  case exitAuth:
+    code = codes.Unauthenticated
+  case exitNetwork:
+    code = codes.Unavailable
+  case exitQuota:
+    code = codes.ResourceExhausted
+  }
+  return status.Error(code, err.Error())
+}
+
+// checkToken fails unless the metadata of ctx carries the bearer token of
+// the server, if it has one
+func (srv *grpcServer) checkToken(ctx context.Context) error {
+  if srv.token == "" {
+    return nil
+  }
+  md, _ := metadata.FromIncomingContext(ctx)
+  for _, auth := range md.Get("authorization") {
+    if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+srv.token)) == 1 {
+      return nil
+    }
+  }
+  return status.Error(codes.Unauthenticated, "missing or wrong bearer token")
+}
+
+// unaryInterceptor checks the token and translates errors of unary calls
+func (srv *grpcServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+  if err := srv.checkToken(ctx); err != nil {
+    return nil, err
+  }
+  res, err := handler(ctx, req)
+  if err != nil {
+    return nil, grpcStatus(err)
+  }
+  return res, nil
+}
+
+// streamInterceptor checks the token and translates errors of streams
+func (srv *grpcServer) streamInterceptor(s interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+  if err := srv.checkToken(ss.Context()); err != nil {
+    return err
+  }
+  if err := handler(s, ss); err != nil {
+    return grpcStatus(err)
+  }
+  return nil
+}
+
+// toProto converts a task to its protobuf message
+func toProto(t *todo.Task) *todopb.Task {
+  p := &todopb.Task{
+    Id:       t.ID,
+    Title:    t.Title,
+    Notes:    t.Notes,
+    Priority: todopb.Priority(t.Priority),
+    Tags:     t.Tags,
+    Parent:   t.Parent,
+    Position: t.Position,
+    Etag:     t.Etag,
+  }
+  if !t.Due.IsZero() {
+    p.Due = t.Due.Format("2006-01-02")
+  }
+  if t.Every != nil {
+    p.Every = t.Every.String()
+  }
+  if t.Remind > 0 {
+    p.Remind = durationpb.New(t.Remind)
+  }
+  if t.Done() {
+    p.Completed = timestamppb.New(t.Completed)
+  }
+  if !t.Updated.IsZero() {
+    p.Updated = timestamppb.New(t.Updated)
+  }
+  return p
+}
+
+// fromProto converts a task message into a task to create
+func fromProto(p *todopb.Task) (*todo.Task, error) {
+  t := &todo.Task{
+    Title:    p.Title,
+    Notes:    p.Notes,
+    Priority: todo.Priority(p.Priority),
+    Tags:     p.Tags,
+    Parent:   p.Parent,
+  }
+  var err error
+  if p.Due != "" {
+    if t.Due, err = time.Parse("2006-01-02", p.Due); err != nil {
+      return nil, invalidf("Invalid due date '%s', expected YYYY-MM-DD", p.Due)
+    }
+  }
+  if p.Every != "" {
+    if t.Every, err = todo.ParseRecurrence(p.Every); err != nil {
+      return nil, invalidf("%v", err)
+    }
+  }
+  if p.Remind != nil {
+    t.Remind = p.Remind.AsDuration()
+  }
+  return t, nil
+}
+
+func (srv *grpcServer) ListTaskLists(ctx context.Context, req *todopb.ListTaskListsRequest) (*todopb.ListTaskListsResponse, error) {
+  lists, err := srv.client.Lists(ctx)
+  if err != nil {
+    return nil, err
+  }
+  res := &todopb.ListTaskListsResponse{}
+  for _, l := range lists {
+    res.Lists = append(res.Lists, &todopb.TaskList{Id: l.ID, Title: l.Title})
+  }
+  return res, nil
+}
+
+func (srv *grpcServer) ListTasks(ctx context.Context, req *todopb.ListTasksRequest) (*todopb.ListTasksResponse, error) {
+  listId, err := srv.listId(ctx, req.List)
+  if err != nil {
+    return nil, err
+  }
+  items, err := srv.client.List(ctx, listId)
+  if err != nil {
+    return nil, err
+  }
+  res := &todopb.ListTasksResponse{}
+  for _, t := range items {
+    res.Tasks = append(res.Tasks, toProto(t))
+  }
+  return res, nil
+}
+
+func (srv *grpcServer) GetTask(ctx context.Context, req *todopb.GetTaskRequest) (*todopb.Task, error) {
+  listId, err := srv.listId(ctx, req.List)
+  if err != nil {
+    return nil, err
+  }
+  t, err := srv.client.Get(ctx, listId, req.Id)
+  if err != nil {
+    return nil, err
+  }
+  return toProto(t), nil
+}
+
+func (srv *grpcServer) CreateTask(ctx context.Context, req *todopb.CreateTaskRequest) (*todopb.Task, error) {
+  if req.Task == nil || req.Task.Title == "" {
+    return nil, invalidf("Task title can not be empty")
+  }
+  task, err := fromProto(req.Task)
+  if err != nil {
+    return nil, err
+  }
+  listId, err := srv.listId(ctx, req.List)
+  if err != nil {
+    return nil, err
+  }
+  created, err := srv.create(ctx, listId, task)
+  if err != nil {
+    return nil, err
+  }
+  return toProto(created), nil
+}
+
+func (srv *grpcServer) UpdateTask(ctx context.Context, req *todopb.UpdateTaskRequest) (*todopb.Task, error) {
+  patch := &todo.Patch{Title: req.Title, Notes: req.Notes}
+  if req.Due != nil {
+    due := time.Time{}
+    if *req.Due != "" {
+      var err error
+      if due, err = time.Parse("2006-01-02", *req.Due); err != nil {
+        return nil, invalidf("Invalid due date '%s', expected YYYY-MM-DD", *req.Due)
+      }
+    }
+    patch.Due = &due
+  }
+  if req.Priority != nil {
+    p := todo.Priority(*req.Priority)
+    patch.Priority = &p
+  }
+  if req.Tags != nil {
+    patch.Tags = &req.Tags.Tags
+  }
+  if req.Every != nil {
+    every, err := parseEvery(*req.Every)
+    if err != nil {
+      return nil, err
+    }
+    patch.Every = every
+  }
+  if req.Remind != nil {
+    remind := req.Remind.AsDuration()
+    patch.Remind = &remind
+  }
+  if patch.Empty() {
+    return nil, invalidf("Update changes nothing")
+  }
+
+  listId, err := srv.listId(ctx, req.List)
+  if err != nil {
+    return nil, err
+  }
+  updated, err := srv.client.Update(ctx, listId, req.Id, patch)
+  if err != nil {
+    return nil, err
+  }
+  return toProto(updated), nil
+}
+
+func (srv *grpcServer) CompleteTask(ctx context.Context, req *todopb.CompleteTaskRequest) (*todopb.Task, error) {
+  listId, err := srv.listId(ctx, req.List)
+  if err != nil {
+    return nil, err
+  }
+  t, err := srv.complete(ctx, listId, req.Id)
+  if err != nil {
+    return nil, err
+  }
+  return toProto(t), nil
+}
+
+func (srv *grpcServer) DeleteTask(ctx context.Context, req *todopb.DeleteTaskRequest) (*todopb.DeleteTaskResponse, error) {
+  listId, err := srv.listId(ctx, req.List)
+  if err != nil {
+    return nil, err
+  }
+  if err := srv.remove(ctx, listId, req.Id); err != nil {
+    return nil, err
+  }
+  return &todopb.DeleteTaskResponse{}, nil
+}
+
+// WatchTasks polls the task list and sends an event for every task that
+// appeared, changed or went away since the previous poll
+func (srv *grpcServer) WatchTasks(req *todopb.WatchTasksRequest, stream grpc.ServerStreamingServer[todopb.TaskEvent]) error {
+  ctx := stream.Context()
+  interval := defaultWatchInterval
+  if req.Interval != nil {
+    if interval = req.Interval.AsDuration(); interval < time.Second {
+      return invalidf("Watch interval must be at least a second")
+    }
+  }
+  listId, err := srv.listId(ctx, req.List)
+  if err != nil {
+    return err
+  }
+
+  known := map[string]string{}
+  for {
+    items, err := srv.client.List(ctx, listId)
+    if err != nil {
+      return err
+    }
+    current := map[string]string{}
+    for _, t := range items {
+      current[t.ID] = t.Etag
+      event := todopb.TaskEvent_ADDED
+      if etag, ok := known[t.ID]; ok {
+        if etag == t.Etag {
+          continue
+        }
+        event = todopb.TaskEvent_CHANGED
+      }
+      if err := stream.Send(&todopb.TaskEvent{Type: event, Task: toProto(t)}); err != nil {
+        return err
+      }
+    }
+    for id := range known {
+      if _, ok := current[id]; !ok {
+        removed := &todopb.TaskEvent{Type: todopb.TaskEvent_REMOVED, Task: &todopb.Task{Id: id}}
+        if err := stream.Send(removed); err != nil {
+          return err
+        }
+      }
+    }
+    known = current
+
+    select {
+    case <-ctx.Done():
+      return nil
+    case <-time.After(interval):
+    }
+  }
+}
+
+// serveGRPC serves the todo.v1.Todo service on addr until it fails or
+// ctx is done
+func serveGRPC(ctx context.Context, srv *server, addr string) error {
+  listener, err := net.Listen("tcp", addr)
+  if err != nil {
+    return fmt.Errorf("Unable to listen on %s: %w", addr, err)
+  }
+  g := &grpcServer{server: srv}
+  s := grpc.NewServer(grpc.UnaryInterceptor(g.unaryInterceptor), grpc.StreamInterceptor(g.streamInterceptor))
+  todopb.RegisterTodoServer(s, g)
+  infof("Serving gRPC on %s", addr)
+  go func() {
+    <-ctx.Done()
+    s.Stop()
+  }()
+  return s.Serve(listener)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// Lists completed todo items to stdout along with when they were
+// completed, or as a JSON array with output set to json
+func listCompletedItems(items []*todo.Task) error {
+  if loadConfig().Output == outputJSON {
+    if items == nil {
+      items = []*todo.Task{}
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(items)
+  }
+  for _, task := range items {
+    done := task.Completed.Local()
+    fmt.Printf("%s %s %s\n", colorize("32", "✓"), task.Title,
+      colorize("2", "(completed "+formatDate(done)+" "+done.Format("15:04")+")"))
+  }
+  return nil
+}
+
+// Lists the tasks of the todo list completed since the given time, or ever
+// if it is zero, that carry all of tags. A positive limit caps the number
+// of tasks listed
+func showHistory(s *session, since time.Time, tags []string, limit int) error {
+  if s.offline {
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Completed tasks are not cached, history needs Google Tasks")}
+  }
+  items, err := s.client.Completed(s.ctx, s.todoId, since, time.Time{})
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+  }
+  var selected []*todo.Task
+  for _, task := range items {
+    if hasAllTags(task, tags) {
+      selected = append(selected, task)
+    }
+  }
+  if limit > 0 && len(selected) > limit {
+    selected = selected[:limit]
+  }
+  if len(selected) == 0 && loadConfig().Output != outputJSON {
+    if since.IsZero() {
+      fmt.Printf("No completed tasks in your %s list\n", s.listName)
+    } else {
+      fmt.Printf("No tasks completed in your %s list since %s\n", s.listName, formatDate(since))
+    }
+    return nil
+  }
+  return listCompletedItems(selected)
+}
+
+func init() {
+  register(&command{
+    name:    "history",
+    usage:   "history [--since 7d|date] [+tag...]",
+    summary: "Show recently completed tasks with their completion times",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      sinceFlag := fs.String("since", "7d", "how far back to look, e.g. 7d, 2w, 12h or a date")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      words, tags := splitTags(args)
+      if len(words) > 0 {
+        return invalidf("Unexpected argument '%s', tags to filter by start with '+'", words[0])
+      }
+      since, err := parseSince(*sinceFlag, time.Now())
+      if err != nil {
+        return invalidf("Invalid --since: %v", err)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return showHistory(s, since, tags, 0)
+    },
+  })
+}
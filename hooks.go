@@ -0,0 +1,165 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "sort"
+  "strings"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// pluginPrefix starts the names of the executables on PATH that become
+// todo commands, such as todo-hello for 'todo hello'
+const pluginPrefix = "todo-"
+
+// hookChange is a change made by a command, as given to its post hook
+type hookChange struct {
+  Op   string     `json:"op"`
+  List string     `json:"list"`
+  Task *todo.Task `json:"task"`
+}
+
+// hookChanges collects the changes of the running command when it has a
+// post hook, and is nil otherwise
+var hookChanges *[]hookChange
+
+// recordHookChange adds the change of a task to those given to the post
+// hook of the running command. Before is the task before the change and
+// after the task after it, nil for completions and deletions
+func recordHookChange(op string, list string, before *todo.Task, after *todo.Task) {
+  if hookChanges == nil {
+    return
+  }
+  task := after
+  if task == nil {
+    task = before
+  }
+  *hookChanges = append(*hookChanges, hookChange{Op: op, List: list, Task: task})
+}
+
+// hookPath returns the path of the executable hooks/<stage>-<name> in the
+// config directory, or "" if there is none
+func hookPath(stage string, name string) string {
+  dir, err := configDir()
+  if err != nil {
+    return ""
+  }
+  file := filepath.Join(dir, "hooks", stage+"-"+name)
+  if fi, err := os.Stat(file); err != nil || !fi.Mode().IsRegular() || fi.Mode()&0111 == 0 {
+    return ""
+  }
+  return file
+}
+
+// extensionEnv is the environment of hooks and plugins: that of todo with
+// what they need to call it back on the same list
+func extensionEnv(name string) []string {
+  exe, _ := os.Executable()
+  return append(os.Environ(), "TODO_BIN="+exe, "TODO_COMMAND="+name, "TODO_LIST="+currentList(),
+    "TODO_ACCOUNT="+currentAccount(), "TODO_BACKEND="+currentBackend())
+}
+
+// runHook runs the hook file of the command name with the arguments of the
+// command. Post hooks read the changes the command made as a JSON array on
+// stdin
+func runHook(file string, name string, args []string, changes []hookChange) error {
+  cmd := exec.Command(file, args...)
+  cmd.Env = extensionEnv(name)
+  cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+  if changes != nil {
+    b, err := json.MarshalIndent(changes, "", "  ")
+    if err != nil {
+      return err
+    }
+    cmd.Stdin = bytes.NewReader(b)
+  }
+  return cmd.Run()
+}
+
+// runWithHooks runs cmd between its pre and post hooks, if it has them. A
+// failing pre hook stops the command, while a failing post hook is only
+// reported since the command is done by then
+func runWithHooks(cmd *command, args []string) error {
+  if pre := hookPath("pre", cmd.name); pre != "" {
+    verbosef("Running hook %s", pre)
+    if err := runHook(pre, cmd.name, args, nil); err != nil {
+      return fmt.Errorf("Hook %s stopped the command: %w", pre, err)
+    }
+  }
+  post := hookPath("post", cmd.name)
+  if post == "" {
+    return cmd.run(cmd, args)
+  }
+  outer := hookChanges
+  changes := []hookChange{}
+  hookChanges = &changes
+  err := cmd.run(cmd, args)
+  hookChanges = outer
+  if err != nil {
+    return err
+  }
+  verbosef("Running hook %s", post)
+  if err := runHook(post, cmd.name, args, changes); err != nil {
+    warnf("Hook %s failed: %v", post, err)
+  }
+  return nil
+}
+
+// findPlugin returns the path of the plugin named name on PATH, or "" if
+// there is none
+func findPlugin(name string) string {
+  if name == "" || strings.ContainsAny(name, `/\`) {
+    return ""
+  }
+  path, err := exec.LookPath(pluginPrefix + name)
+  if err != nil {
+    return ""
+  }
+  return path
+}
+
+// runPlugin runs the plugin at path as the command name, on the terminal
+// of todo, exiting with its exit code
+func runPlugin(path string, name string, args []string) error {
+  verbosef("Running plugin %s", path)
+  cmd := exec.Command(path, args...)
+  cmd.Env = extensionEnv(name)
+  cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+  err := cmd.Run()
+  var ee *exec.ExitError
+  if errors.As(err, &ee) {
+    return &exitError{code: ee.ExitCode(), err: fmt.Errorf("%s failed: %w", path, err), reported: true}
+  }
+  return err
+}
+
+// plugins returns the names of the plugins on PATH, in order
+func plugins() []string {
+  seen := map[string]bool{}
+  var names []string
+  for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+    entries, err := ioutil.ReadDir(dir)
+    if err != nil {
+      continue
+    }
+    for _, e := range entries {
+      name := strings.TrimPrefix(e.Name(), pluginPrefix)
+      if name == e.Name() || name == "" || seen[name] || lookupCommand(name) != nil {
+        continue
+      }
+      if e.Mode().IsRegular() && e.Mode()&0111 != 0 {
+        seen[name] = true
+        names = append(names, name)
+      }
+    }
+  }
+  sort.Strings(names)
+  return names
+}
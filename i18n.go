@@ -0,0 +1,122 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "gopkg.in/yaml.v3"
+)
+
+// locale holds what todo needs to speak a language
+type locale struct {
+  // dateFormat is the Go time layout dates are printed with unless
+  // date_format is set
+  dateFormat string
+  // months are the names of the months from January, and days those of
+  // the weekdays from Sunday, in full and abbreviated
+  months, shortMonths [12]string
+  days, shortDays     [7]string
+  // messages maps messages as todo writes them in English to their
+  // translation
+  messages map[string]string
+  // names replaces the English month and weekday names in dates
+  names *strings.Replacer
+}
+
+// locales are the languages todo speaks besides English
+var locales = map[string]*locale{
+  "de": &localeDE,
+  "es": &localeES,
+  "fa": &localeFA,
+}
+
+// loadedLocale is the locale loaded by initLocale
+var loadedLocale = &locale{}
+
+// language returns the language todo speaks: the language setting, or else
+// the one of the LC_ALL, LC_MESSAGES or LANG environment variables, such as
+// "de" for de_DE.UTF-8
+func language() string {
+  lang := loadConfig().Language
+  for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+    if lang == "" {
+      lang = os.Getenv(name)
+    }
+  }
+  if i := strings.IndexAny(lang, "_.@-"); i >= 0 {
+    lang = lang[:i]
+  }
+  switch lang = strings.ToLower(lang); lang {
+  case "", "c", "posix":
+    return "en"
+  }
+  return lang
+}
+
+// initLocale loads the locale of the current language, with the messages
+// of locales/<language>.yaml in the config directory, if there is one,
+// added to its own. That file maps English messages to their translation,
+// and so can also teach todo a language of its own
+func initLocale() error {
+  lang := language()
+  l := &locale{messages: map[string]string{}}
+  if builtin, ok := locales[lang]; ok {
+    *l = *builtin
+    l.messages = map[string]string{}
+    for k, v := range builtin.messages {
+      l.messages[k] = v
+    }
+  }
+  dir, err := configDir()
+  if err != nil {
+    return err
+  }
+  file := filepath.Join(dir, "locales", lang+".yaml")
+  b, err := ioutil.ReadFile(file)
+  if err != nil && !os.IsNotExist(err) {
+    return fmt.Errorf("Unable to read %s: %w", file, err)
+  }
+  if err := yaml.Unmarshal(b, &l.messages); err != nil {
+    return invalidf("Unable to parse %s: %v", file, err)
+  }
+  if l.months[0] != "" {
+    var pairs []string
+    for i := range l.months {
+      pairs = append(pairs, time.Month(i+1).String(), l.months[i])
+    }
+    for i := range l.days {
+      pairs = append(pairs, time.Weekday(i).String(), l.days[i])
+    }
+    for i := range l.shortMonths {
+      pairs = append(pairs, time.Month(i + 1).String()[:3], l.shortMonths[i])
+    }
+    for i := range l.shortDays {
+      pairs = append(pairs, time.Weekday(i).String()[:3], l.shortDays[i])
+    }
+    l.names = strings.NewReplacer(pairs...)
+  }
+  loadedLocale = l
+  return nil
+}
+
+// tr returns the translation of message into the current language, or
+// message itself if there is none
+func tr(message string) string {
+  if t := loadedLocale.messages[message]; t != "" {
+    return t
+  }
+  return message
+}
+
+// localizeDate translates the month and weekday names in date, as
+// printed by time.Format
+func localizeDate(date string) string {
+  if loadedLocale.names == nil {
+    return date
+  }
+  return loadedLocale.names.Replace(date)
+}
@@ -0,0 +1,74 @@
+package main
+
+// localeDE is German
+var localeDE = locale{
+  dateFormat:  "02.01.2006",
+  months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+  shortMonths: [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+  days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+  shortDays:   [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+  messages: map[string]string{
+    "Task '%s' successfully added to your %s list":                   "Aufgabe '%s' zu deiner Liste %s hinzugefügt",
+    "Task '%s' will be added to your %s list on next sync":           "Aufgabe '%s' wird beim nächsten Sync zu deiner Liste %s hinzugefügt",
+    "Task '%s' is already in your %s list, not adding it again":      "Aufgabe '%s' ist schon in deiner Liste %s und wird nicht erneut hinzugefügt",
+    "Task '%s' is already in your %s list, moved its due date to %s": "Aufgabe '%s' ist schon in deiner Liste %s und ist jetzt am %s fällig",
+    "Due %s":                           "Fällig am %s",
+    "Task '%s' marked as completed":    "Aufgabe '%s' als erledigt markiert",
+    "Subtask '%s' marked as completed": "Unteraufgabe '%s' als erledigt markiert",
+    "Next occurrence due %s":           "Nächstes Mal fällig am %s",
+    "Task '%s' updated":                "Aufgabe '%s' aktualisiert",
+    "Task '%s' left unchanged":         "Aufgabe '%s' unverändert",
+    "Task '%s' moved to the trash, 'todo trash restore %s' brings it back": "Aufgabe '%s' in den Papierkorb verschoben, 'todo trash restore %s' holt sie zurück",
+    "Notes of task '%s' updated":                                       "Notizen der Aufgabe '%s' aktualisiert",
+    "No task in your %s list matches '%s'":                             "Keine Aufgabe in deiner Liste %s passt zu '%s'",
+    "No task in your %s list to complete":                              "Keine Aufgabe in deiner Liste %s zu erledigen",
+    "Invalid task index '%s', run 'todo list' to see the current ones": "Ungültiger Aufgabenindex '%s', 'todo list' zeigt die aktuellen",
+    "Missing task title, see 'todo help add'":                          "Aufgabentitel fehlt, siehe 'todo help add'",
+    "Missing task index or title, see 'todo help done'":                "Aufgabenindex oder -titel fehlt, siehe 'todo help done'",
+    "Missing task index, see 'todo help rm'":                           "Aufgabenindex fehlt, siehe 'todo help rm'",
+    "No task list named '%s', see 'todo lists'":                        "Keine Aufgabenliste namens '%s', siehe 'todo lists'",
+    "Working offline: %v":                                              "Offline: %v",
+    "Local cache of your %s list is up to date":                        "Lokaler Cache deiner Liste %s ist aktuell",
+    "Complete '%s'?":                                                   "'%s' erledigen?",
+    "Complete %s?":                                                     "%s erledigen?",
+    "Delete these %d tasks?":                                           "Diese %d Aufgaben löschen?",
+    "[y/N]":                                                            "[j/N]",
+    "y":                                                                "j",
+    "yes":                                                              "ja",
+    "%d task":                                                          "%d Aufgabe",
+    "%d tasks":                                                         "%d Aufgaben",
+    "%s: %d overdue, %d today, %d without a due date":                  "%s: %d überfällig, %d heute, %d ohne Fälligkeit",
+    "Task":                       "Aufgabe",
+    "Due":                        "Fällig",
+    "Tags":                       "Tags",
+    "Overdue":                    "Überfällig",
+    "Today":                      "Heute",
+    "Tomorrow":                   "Morgen",
+    "This week":                  "Diese Woche",
+    "Later":                      "Später",
+    "No due date":                "Ohne Fälligkeit",
+    "No tag":                     "Ohne Tag",
+    "snoozed":                    "zurückgestellt",
+    "blocked":                    "blockiert",
+    "List":                       "Liste",
+    "Subtask of":                 "Teil von",
+    "Subtasks":                   "Teilaufgaben",
+    "Priority":                   "Priorität",
+    "Every":                      "Alle",
+    "Remind":                     "Erinnern",
+    "Snoozed":                    "Zurückgestellt",
+    "Starred":                    "Markiert",
+    "Blocked by":                 "Blockiert von",
+    "Time":                       "Zeit",
+    "Updated":                    "Geändert",
+    "Interrupted":                "Abgebrochen",
+    "Gave up after --timeout %s": "Nach --timeout %s aufgegeben",
+    "Authorization failed, check your Todoist API token":                                             "Autorisierung fehlgeschlagen, prüfe dein Todoist-API-Token",
+    "Authorization failed, check caldav_username and caldav_password":                                "Autorisierung fehlgeschlagen, prüfe caldav_username und caldav_password",
+    "Authorization failed, check service_account and impersonate":                                    "Autorisierung fehlgeschlagen, prüfe service_account und impersonate",
+    "Authorization failed, check refresh_token":                                                      "Autorisierung fehlgeschlagen, prüfe refresh_token",
+    "Authorization failed, run 'todo auth' to sign in again":                                         "Autorisierung fehlgeschlagen, melde dich mit 'todo auth' erneut an",
+    "Unable to reach Google Tasks, check your network connection":                                    "Google Tasks ist nicht erreichbar, prüfe deine Netzwerkverbindung",
+    "Too many requests, or the daily quota is used up. Wait a while and try again, or lower max_qps": "Zu viele Anfragen, oder das Tageskontingent ist aufgebraucht. Warte eine Weile und versuche es erneut, oder senke max_qps",
+  },
+}
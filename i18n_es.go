@@ -0,0 +1,74 @@
+package main
+
+// localeES is Spanish
+var localeES = locale{
+  dateFormat:  "02/01/2006",
+  months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+  shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+  days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+  shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+  messages: map[string]string{
+    "Task '%s' successfully added to your %s list":                   "Tarea '%s' añadida a tu lista %s",
+    "Task '%s' will be added to your %s list on next sync":           "La tarea '%s' se añadirá a tu lista %s en la próxima sincronización",
+    "Task '%s' is already in your %s list, not adding it again":      "La tarea '%s' ya está en tu lista %s, no se añade de nuevo",
+    "Task '%s' is already in your %s list, moved its due date to %s": "La tarea '%s' ya está en tu lista %s, ahora vence el %s",
+    "Due %s":                           "Vence el %s",
+    "Task '%s' marked as completed":    "Tarea '%s' marcada como completada",
+    "Subtask '%s' marked as completed": "Subtarea '%s' marcada como completada",
+    "Next occurrence due %s":           "La próxima vez vence el %s",
+    "Task '%s' updated":                "Tarea '%s' actualizada",
+    "Task '%s' left unchanged":         "La tarea '%s' no ha cambiado",
+    "Task '%s' moved to the trash, 'todo trash restore %s' brings it back": "Tarea '%s' movida a la papelera, 'todo trash restore %s' la recupera",
+    "Notes of task '%s' updated":                                       "Notas de la tarea '%s' actualizadas",
+    "No task in your %s list matches '%s'":                             "Ninguna tarea de tu lista %s coincide con '%s'",
+    "No task in your %s list to complete":                              "No hay tareas que completar en tu lista %s",
+    "Invalid task index '%s', run 'todo list' to see the current ones": "Índice de tarea '%s' no válido, ejecuta 'todo list' para ver los actuales",
+    "Missing task title, see 'todo help add'":                          "Falta el título de la tarea, consulta 'todo help add'",
+    "Missing task index or title, see 'todo help done'":                "Falta el índice o el título de la tarea, consulta 'todo help done'",
+    "Missing task index, see 'todo help rm'":                           "Falta el índice de la tarea, consulta 'todo help rm'",
+    "No task list named '%s', see 'todo lists'":                        "No hay ninguna lista llamada '%s', consulta 'todo lists'",
+    "Working offline: %v":                                              "Trabajando sin conexión: %v",
+    "Local cache of your %s list is up to date":                        "La caché local de tu lista %s está al día",
+    "Complete '%s'?":                                                   "¿Completar '%s'?",
+    "Complete %s?":                                                     "¿Completar %s?",
+    "Delete these %d tasks?":                                           "¿Eliminar estas %d tareas?",
+    "[y/N]":                                                            "[s/N]",
+    "y":                                                                "s",
+    "yes":                                                              "sí",
+    "%d task":                                                          "%d tarea",
+    "%d tasks":                                                         "%d tareas",
+    "%s: %d overdue, %d today, %d without a due date":                  "%s: %d vencidas, %d para hoy, %d sin fecha",
+    "Task":                       "Tarea",
+    "Due":                        "Vence",
+    "Tags":                       "Etiquetas",
+    "Overdue":                    "Vencidas",
+    "Today":                      "Hoy",
+    "Tomorrow":                   "Mañana",
+    "This week":                  "Esta semana",
+    "Later":                      "Más adelante",
+    "No due date":                "Sin fecha",
+    "No tag":                     "Sin etiqueta",
+    "snoozed":                    "pospuesta",
+    "blocked":                    "bloqueada",
+    "List":                       "Lista",
+    "Subtask of":                 "Subtarea de",
+    "Subtasks":                   "Subtareas",
+    "Priority":                   "Prioridad",
+    "Every":                      "Cada",
+    "Remind":                     "Aviso",
+    "Snoozed":                    "Pospuesta",
+    "Starred":                    "Destacada",
+    "Blocked by":                 "Bloqueada por",
+    "Time":                       "Tiempo",
+    "Updated":                    "Actualizada",
+    "Interrupted":                "Interrumpido",
+    "Gave up after --timeout %s": "Abandonado tras --timeout %s",
+    "Authorization failed, check your Todoist API token":                                             "Falló la autorización, revisa tu token de la API de Todoist",
+    "Authorization failed, check caldav_username and caldav_password":                                "Falló la autorización, revisa caldav_username y caldav_password",
+    "Authorization failed, check service_account and impersonate":                                    "Falló la autorización, revisa service_account e impersonate",
+    "Authorization failed, check refresh_token":                                                      "Falló la autorización, revisa refresh_token",
+    "Authorization failed, run 'todo auth' to sign in again":                                         "Falló la autorización, ejecuta 'todo auth' para volver a iniciar sesión",
+    "Unable to reach Google Tasks, check your network connection":                                    "No se puede conectar con Google Tasks, revisa tu conexión de red",
+    "Too many requests, or the daily quota is used up. Wait a while and try again, or lower max_qps": "Demasiadas solicitudes, o se agotó la cuota diaria. Espera un rato y vuelve a intentarlo, o reduce max_qps",
+  },
+}
@@ -0,0 +1,74 @@
+package main
+
+// localeFA is Farsi, with dates of the Gregorian calendar
+var localeFA = locale{
+  dateFormat:  "2006/01/02",
+  months:      [12]string{"ژانویه", "فوریه", "مارس", "آوریل", "مه", "ژوئن", "ژوئیه", "اوت", "سپتامبر", "اکتبر", "نوامبر", "دسامبر"},
+  shortMonths: [12]string{"ژانویه", "فوریه", "مارس", "آوریل", "مه", "ژوئن", "ژوئیه", "اوت", "سپتامبر", "اکتبر", "نوامبر", "دسامبر"},
+  days:        [7]string{"یکشنبه", "دوشنبه", "سه‌شنبه", "چهارشنبه", "پنجشنبه", "جمعه", "شنبه"},
+  shortDays:   [7]string{"یکشنبه", "دوشنبه", "سه‌شنبه", "چهارشنبه", "پنجشنبه", "جمعه", "شنبه"},
+  messages: map[string]string{
+    "Task '%s' successfully added to your %s list":                   "کار '%s' به فهرست %s شما افزوده شد",
+    "Task '%s' will be added to your %s list on next sync":           "کار '%s' در همگام‌سازی بعدی به فهرست %s شما افزوده می‌شود",
+    "Task '%s' is already in your %s list, not adding it again":      "کار '%s' از قبل در فهرست %s شما هست و دوباره افزوده نمی‌شود",
+    "Task '%s' is already in your %s list, moved its due date to %s": "کار '%s' از قبل در فهرست %s شما هست، سررسید آن به %s تغییر کرد",
+    "Due %s":                           "سررسید %s",
+    "Task '%s' marked as completed":    "کار '%s' انجام‌شده علامت خورد",
+    "Subtask '%s' marked as completed": "زیرکار '%s' انجام‌شده علامت خورد",
+    "Next occurrence due %s":           "سررسید نوبت بعد %s",
+    "Task '%s' updated":                "کار '%s' به‌روز شد",
+    "Task '%s' left unchanged":         "کار '%s' تغییری نکرد",
+    "Task '%s' moved to the trash, 'todo trash restore %s' brings it back": "کار '%s' به سطل زباله رفت، 'todo trash restore %s' آن را برمی‌گرداند",
+    "Notes of task '%s' updated":                                       "یادداشت‌های کار '%s' به‌روز شد",
+    "No task in your %s list matches '%s'":                             "هیچ کاری در فهرست %s شما با '%s' جور نیست",
+    "No task in your %s list to complete":                              "کاری برای انجام در فهرست %s شما نیست",
+    "Invalid task index '%s', run 'todo list' to see the current ones": "شمارهٔ کار '%s' نامعتبر است، برای دیدن شماره‌های فعلی 'todo list' را اجرا کنید",
+    "Missing task title, see 'todo help add'":                          "عنوان کار داده نشده، 'todo help add' را ببینید",
+    "Missing task index or title, see 'todo help done'":                "شماره یا عنوان کار داده نشده، 'todo help done' را ببینید",
+    "Missing task index, see 'todo help rm'":                           "شمارهٔ کار داده نشده، 'todo help rm' را ببینید",
+    "No task list named '%s', see 'todo lists'":                        "فهرستی به نام '%s' نیست، 'todo lists' را ببینید",
+    "Working offline: %v":                                              "کار بدون اتصال: %v",
+    "Local cache of your %s list is up to date":                        "حافظهٔ محلی فهرست %s شما به‌روز است",
+    "Complete '%s'?":                                                   "'%s' انجام شود؟",
+    "Complete %s?":                                                     "%s انجام شود؟",
+    "Delete these %d tasks?":                                           "این %d کار حذف شوند؟",
+    "[y/N]":                                                            "[بله/خیر]",
+    "y":                                                                "ب",
+    "yes":                                                              "بله",
+    "%d task":                                                          "%d کار",
+    "%d tasks":                                                         "%d کار",
+    "%s: %d overdue, %d today, %d without a due date":                  "%s: %d عقب‌افتاده، %d امروز، %d بدون موعد",
+    "Task":                       "کار",
+    "Due":                        "سررسید",
+    "Tags":                       "برچسب‌ها",
+    "Overdue":                    "عقب‌افتاده",
+    "Today":                      "امروز",
+    "Tomorrow":                   "فردا",
+    "This week":                  "این هفته",
+    "Later":                      "بعداً",
+    "No due date":                "بدون موعد",
+    "No tag":                     "بدون برچسب",
+    "snoozed":                    "به تعویق افتاده",
+    "blocked":                    "مسدود",
+    "List":                       "فهرست",
+    "Subtask of":                 "زیرکارِ",
+    "Subtasks":                   "زیرکارها",
+    "Priority":                   "اولویت",
+    "Every":                      "تکرار",
+    "Remind":                     "یادآوری",
+    "Snoozed":                    "به تعویق افتاده",
+    "Starred":                    "ستاره‌دار",
+    "Blocked by":                 "مسدود با",
+    "Time":                       "زمان",
+    "Updated":                    "به‌روزرسانی",
+    "Interrupted":                "قطع شد",
+    "Gave up after --timeout %s": "پس از --timeout %s رها شد",
+    "Authorization failed, check your Todoist API token":                                             "احراز هویت ناموفق بود، توکن API تودوئیست را بررسی کنید",
+    "Authorization failed, check caldav_username and caldav_password":                                "احراز هویت ناموفق بود، caldav_username و caldav_password را بررسی کنید",
+    "Authorization failed, check service_account and impersonate":                                    "احراز هویت ناموفق بود، service_account و impersonate را بررسی کنید",
+    "Authorization failed, check refresh_token":                                                      "احراز هویت ناموفق بود، refresh_token را بررسی کنید",
+    "Authorization failed, run 'todo auth' to sign in again":                                         "احراز هویت ناموفق بود، برای ورود دوباره 'todo auth' را اجرا کنید",
+    "Unable to reach Google Tasks, check your network connection":                                    "دسترسی به Google Tasks ممکن نیست، اتصال شبکه را بررسی کنید",
+    "Too many requests, or the daily quota is used up. Wait a while and try again, or lower max_qps": "درخواست‌ها بیش از حد است یا سهمیهٔ روزانه تمام شده. کمی صبر کنید و دوباره امتحان کنید، یا max_qps را کم کنید",
+  },
+}
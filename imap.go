@@ -0,0 +1,182 @@
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "crypto/tls"
+  "fmt"
+  "io"
+  "net"
+  "strconv"
+  "strings"
+
+  "golang.org/x/net/context"
+)
+
+// imapConn is a connection to an IMAP server, speaking just enough of
+// IMAP4rev1 (RFC 3501) to find, fetch and flag messages
+type imapConn struct {
+  conn net.Conn
+  r    *bufio.Reader
+  tag  int
+}
+
+// imapResponse is an untagged response of the server, with the literals
+// it carried
+type imapResponse struct {
+  text     string
+  literals [][]byte
+}
+
+// dialIMAP connects to the IMAP server at addr, host:port over TLS or
+// imap://host:port without, for bridges listening on localhost. The
+// connection is closed once ctx is done
+func dialIMAP(ctx context.Context, addr string) (*imapConn, error) {
+  var conn net.Conn
+  var err error
+  if plain := strings.TrimPrefix(addr, "imap://"); plain != addr {
+    conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", plain)
+  } else {
+    host, _, splitErr := net.SplitHostPort(addr)
+    if splitErr != nil {
+      return nil, invalidf("Invalid imap_server '%s', expected host:port", addr)
+    }
+    d := &tls.Dialer{Config: &tls.Config{ServerName: host}}
+    conn, err = d.DialContext(ctx, "tcp", addr)
+  }
+  if err != nil {
+    return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Unable to reach %s: %w", addr, err)}
+  }
+  go func() {
+    <-ctx.Done()
+    conn.Close()
+  }()
+  c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+  greeting, err := c.read()
+  if err != nil {
+    conn.Close()
+    return nil, err
+  }
+  if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+    conn.Close()
+    return nil, fmt.Errorf("Unexpected IMAP greeting: %s", greeting.text)
+  }
+  return c, nil
+}
+
+// read reads a response line, along with the literals it contains
+func (c *imapConn) read() (*imapResponse, error) {
+  res := &imapResponse{}
+  var text strings.Builder
+  for {
+    line, err := c.r.ReadString('\n')
+    if err != nil {
+      return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Lost connection to the IMAP server: %w", err)}
+    }
+    line = strings.TrimRight(line, "\r\n")
+    text.WriteString(line)
+    // a literal {n} ends the line and is followed by n bytes
+    i := strings.LastIndex(line, "{")
+    if i < 0 || !strings.HasSuffix(line, "}") {
+      break
+    }
+    n, err := strconv.Atoi(line[i+1 : len(line)-1])
+    if err != nil {
+      break
+    }
+    literal := make([]byte, n)
+    if _, err := io.ReadFull(c.r, literal); err != nil {
+      return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Lost connection to the IMAP server: %w", err)}
+    }
+    res.literals = append(res.literals, literal)
+  }
+  res.text = text.String()
+  return res, nil
+}
+
+// cmd sends a command and returns the untagged responses to it, failing
+// unless the server completes it with OK
+func (c *imapConn) cmd(command string) ([]*imapResponse, error) {
+  c.tag++
+  tag := fmt.Sprintf("a%d", c.tag)
+  if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+    return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Lost connection to the IMAP server: %w", err)}
+  }
+  var untagged []*imapResponse
+  for {
+    res, err := c.read()
+    if err != nil {
+      return nil, err
+    }
+    if !strings.HasPrefix(res.text, tag+" ") {
+      untagged = append(untagged, res)
+      continue
+    }
+    status := strings.TrimPrefix(res.text, tag+" ")
+    if !strings.HasPrefix(status, "OK") {
+      verb := strings.Fields(command)[0]
+      if verb == "UID" {
+        verb += " " + strings.Fields(command)[1]
+      }
+      return nil, fmt.Errorf("IMAP %s failed: %s", verb, status)
+    }
+    return untagged, nil
+  }
+}
+
+// imapQuote quotes s as an IMAP string
+func imapQuote(s string) string {
+  return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// login signs in and selects mailbox
+func (c *imapConn) login(username string, password string, mailbox string) error {
+  if _, err := c.cmd("LOGIN " + imapQuote(username) + " " + imapQuote(password)); err != nil {
+    return fmt.Errorf("%v, check imap_username and imap_password", err)
+  }
+  _, err := c.cmd("SELECT " + imapQuote(mailbox))
+  return err
+}
+
+// search returns the UIDs of the messages of the selected mailbox matching
+// the IMAP search criteria
+func (c *imapConn) search(criteria string) ([]string, error) {
+  untagged, err := c.cmd("UID SEARCH " + criteria)
+  if err != nil {
+    return nil, err
+  }
+  var uids []string
+  for _, res := range untagged {
+    if fields := strings.Fields(res.text); len(fields) > 1 && fields[1] == "SEARCH" {
+      uids = append(uids, fields[2:]...)
+    }
+  }
+  return uids, nil
+}
+
+// fetch returns the message with the given UID, without marking it seen
+func (c *imapConn) fetch(uid string) ([]byte, error) {
+  untagged, err := c.cmd("UID FETCH " + uid + " BODY.PEEK[]")
+  if err != nil {
+    return nil, err
+  }
+  for _, res := range untagged {
+    if strings.Contains(res.text, "FETCH") && len(res.literals) > 0 {
+      return bytes.TrimLeft(res.literals[0], "\r\n"), nil
+    }
+  }
+  return nil, fmt.Errorf("IMAP server sent no message %s", uid)
+}
+
+// store changes the flags of the message with the given UID, as with
+// "+FLAGS (\Seen)"
+func (c *imapConn) store(uid string, change string) error {
+  _, err := c.cmd("UID STORE " + uid + " " + change)
+  return err
+}
+
+// logout ends the session and closes the connection
+func (c *imapConn) logout() {
+  c.cmd("LOGOUT")
+  c.conn.Close()
+}
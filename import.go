@@ -0,0 +1,296 @@
+package main
+
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "regexp"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// checklistItem matches a Markdown checklist item such as "- [ ] buy milk",
+// capturing its indentation, whether it is checked and its text
+var checklistItem = regexp.MustCompile(`^(\s*)[-*+] \[([ xX])\] (.*)$`)
+
+// importItem is a task read from an import file. Depth is the nesting
+// level of checklist items, deeper items are subtasks of the item before
+// them with a smaller depth. Task holds the fields of items read from
+// formats with columns for them, whose title is taken as is; it is nil
+// for items whose title may hold tags and a due date. Row numbers the
+// item in its file for reporting err, why it can not be imported. Project
+// is the project of another app the item was exported from, if any
+type importItem struct {
+  title   string
+  depth   int
+  done    bool
+  task    *todo.Task
+  row     int
+  err     error
+  project string
+}
+
+// importOptions control how importTodoItems creates tasks
+type importOptions struct {
+  // literal leaves due dates and tags in titles as they are
+  literal bool
+  // preview lists the tasks and asks for confirmation first
+  preview bool
+  // completed creates completed items as completed tasks rather than
+  // skipping them
+  completed bool
+}
+
+// importedParent is a task created by an import along with the depth of
+// the item it was created from
+type importedParent struct {
+  depth int
+  id    string
+}
+
+// parseImport reads tasks from r. If it contains Markdown checklist items,
+// only they are read; otherwise every non-empty line is a task, with any
+// leading list bullet removed
+func parseImport(r io.Reader) ([]importItem, error) {
+  var lines []string
+  scanner := bufio.NewScanner(r)
+  for scanner.Scan() {
+    lines = append(lines, scanner.Text())
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+
+  var items []importItem
+  for _, line := range lines {
+    m := checklistItem.FindStringSubmatch(line)
+    if m == nil {
+      continue
+    }
+    indent := strings.Replace(m[1], "\t", "    ", -1)
+    items = append(items, importItem{
+      title: strings.TrimSpace(m[3]),
+      depth: len(indent) / 2,
+      done:  m[2] != " ",
+    })
+  }
+  if len(items) > 0 {
+    return items, nil
+  }
+
+  for _, line := range lines {
+    line = strings.TrimSpace(line)
+    for _, bullet := range []string{"- ", "* ", "+ "} {
+      line = strings.TrimPrefix(line, bullet)
+    }
+    if line != "" {
+      items = append(items, importItem{title: line})
+    }
+  }
+  return items, nil
+}
+
+// Creates the tasks of items in the todo list. Tasks whose title is
+// already in the list are skipped, as are items that could not be read,
+// each one reported, and completed items unless opts say otherwise
+func importTodoItems(s *session, items []importItem, opts importOptions) error {
+  existing, err := s.items()
+  if err != nil {
+    return err
+  }
+  seen := map[string]bool{}
+  for _, task := range existing {
+    seen[strings.ToLower(task.Title)] = true
+  }
+
+  if opts.preview && !previewImport(s, items, seen, opts) {
+    return nil
+  }
+
+  // tasks are created one at a time rather than in parallel, which would
+  // leave them in no particular order
+  created, skipped, failed := 0, 0, 0
+  // parents holds the tasks created so far that later, deeper items may
+  // be subtasks of, innermost last. Items not imported are held with no
+  // id, their subtasks being imported at the top level
+  var parents []importedParent
+  for _, item := range items {
+    for len(parents) > 0 && parents[len(parents)-1].depth >= item.depth {
+      parents = parents[:len(parents)-1]
+    }
+    if item.err != nil {
+      warnf("Row %d: %v", item.row, item.err)
+      parents = append(parents, importedParent{depth: item.depth})
+      failed++
+      continue
+    }
+    task := item.task
+    if task == nil {
+      words, tags := splitTags([]string{item.title})
+      task = &todo.Task{Title: strings.Join(words, " "), Tags: tags}
+    }
+    if item.task == nil && !opts.literal {
+      var due time.Time
+      task.Title, due = parseDue(task.Title, time.Now())
+      task.Due = todo.Date(due)
+    }
+    if item.done && !opts.completed || task.Title == "" || seen[strings.ToLower(task.Title)] {
+      infof("Skipped '%s'", item.title)
+      parents = append(parents, importedParent{depth: item.depth})
+      skipped++
+      continue
+    }
+    if len(parents) > 0 {
+      task.Parent = parents[len(parents)-1].id
+    }
+
+    task, err := s.insert(task)
+    if err != nil {
+      return fmt.Errorf("Could not create task '%s', %d created so far: %w", item.title, created, err)
+    }
+    seen[strings.ToLower(task.Title)] = true
+    parents = append(parents, importedParent{depth: item.depth, id: task.ID})
+    if item.done {
+      if err := s.complete(task); err != nil {
+        return fmt.Errorf("Could not complete task '%s': %w", task.Title, err)
+      }
+      infof("Created '%s', completed", task.Title)
+    } else {
+      infof("Created '%s'", task.Title)
+    }
+    created++
+  }
+  infof("%d tasks created, %d skipped in your %s list", created, skipped, s.listName)
+  if failed > 0 {
+    return invalidf("%s could not be imported, see above", plural(failed, "row"))
+  }
+  return nil
+}
+
+// previewImport lists the tasks importTodoItems would create from items
+// and the rows it would skip or fail on, and asks for confirmation
+func previewImport(s *session, items []importItem, seen map[string]bool, opts importOptions) bool {
+  n := 0
+  dup := map[string]bool{}
+  for title := range seen {
+    dup[title] = true
+  }
+  for _, item := range items {
+    switch {
+    case item.err != nil:
+      fmt.Printf("  %s %s\n", colorize("31", fmt.Sprintf("row %d:", item.row)), item.err)
+    case item.done && !opts.completed || dup[strings.ToLower(item.task.Title)]:
+      fmt.Printf("  %s %s\n", colorize("2", fmt.Sprintf("row %d: skipped", item.row)), item.task.Title)
+    default:
+      var extra []string
+      if !item.task.Due.IsZero() {
+        extra = append(extra, "due "+formatDate(item.task.Due))
+      }
+      if item.task.Priority != todo.PriorityNone {
+        extra = append(extra, item.task.Priority.String())
+      }
+      if len(item.task.Tags) > 0 {
+        extra = append(extra, formatTags(item.task.Tags))
+      }
+      line := item.task.Title
+      if len(extra) > 0 {
+        line += " (" + strings.Join(extra, ", ") + ")"
+      }
+      fmt.Printf("  %s %s\n", colorize("2", fmt.Sprintf("row %d:", item.row)), line)
+      dup[strings.ToLower(item.task.Title)] = true
+      n++
+    }
+  }
+  if n == 0 {
+    infof("Nothing to import")
+    return false
+  }
+  return confirmf("Import %s into your %s list?", plural(n, "task"), s.listName)
+}
+
+func init() {
+  register(&command{
+    name:    "import",
+    usage:   "import [--literal] [--format text|csv|todoist|wunderlist|anydo] [--map title=1,due=2,...] [--no-header] [--projects lists|tags] [--skip-completed] [--force] <file|->",
+    summary: "Add the tasks in a Markdown checklist or plain text file, one per line, a CSV file or the export of another todo app",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      literal := fs.Bool("literal", false, "do not look for due dates and tags in titles")
+      format := fs.String("format", "", "format of the file: text, csv, the default for .csv files, or the export of todoist, wunderlist or anydo")
+      mapping := fs.String("map", "", "CSV columns of title, notes, due, priority, tags and done, by number or header name, e.g. title=2,due=5")
+      noHeader := fs.Bool("no-header", false, "read the first CSV row as a task rather than the header")
+      projects := fs.String("projects", "lists", "import the projects of other apps as lists or as tags of the current list")
+      skipCompleted := fs.Bool("skip-completed", false, "leave out completed CSV rows and the completed tasks of other apps")
+      force := fs.Bool("force", false, "import CSV files and other apps' exports without asking for confirmation")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 {
+        return invalidf("Expected one file to import, see 'todo help import'")
+      }
+      if *format == "" {
+        *format = "text"
+        if strings.HasSuffix(strings.ToLower(args[0]), ".csv") {
+          *format = "csv"
+        }
+      }
+      app := appImporters[*format]
+      if *format != "text" && *format != "csv" && app == nil {
+        return invalidf("Unknown import format '%s', expected text, csv, todoist, wunderlist or anydo", *format)
+      }
+      if *projects != "lists" && *projects != "tags" {
+        return invalidf("Invalid --projects '%s', expected lists or tags", *projects)
+      }
+      var columns map[string]string
+      if *mapping != "" {
+        if *format != "csv" {
+          return invalidf("--map only applies to --format csv")
+        }
+        if columns, err = parseCSVMap(*mapping); err != nil {
+          return err
+        }
+      }
+      if args[0] == "-" && *format != "text" && !*force {
+        return invalidf("Importing %s from stdin leaves no way to confirm, add --force", *format)
+      }
+      var r io.Reader = os.Stdin
+      if args[0] != "-" {
+        f, err := os.Open(args[0])
+        if err != nil {
+          return invalidf("Unable to open %s: %v", args[0], err)
+        }
+        defer f.Close()
+        r = f
+      }
+      var items []importItem
+      switch {
+      case app != nil:
+        var data []byte
+        if data, err = ioutil.ReadAll(r); err == nil {
+          items, err = app(data)
+        }
+      case *format == "csv":
+        items, err = parseCSVImport(r, columns, *noHeader)
+      default:
+        items, err = parseImport(r)
+      }
+      if err != nil {
+        return invalidf("Unable to read tasks: %v", err)
+      }
+      if app != nil {
+        return importAppItems(items, importOptions{completed: !*skipCompleted}, *projects == "tags", *force)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      opts := importOptions{literal: *literal, preview: *format == "csv" && !*force, completed: *format == "csv" && !*skipCompleted}
+      return importTodoItems(s, items, opts)
+    },
+  })
+}
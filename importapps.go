@@ -0,0 +1,524 @@
+package main
+
+import (
+  "archive/zip"
+  "bytes"
+  "encoding/csv"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "path"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// appImporters read the exports of other todo apps, by --format name.
+// Each item holds its task as well as the project it belongs to, empty
+// for tasks of no particular one
+var appImporters = map[string]func(data []byte) ([]importItem, error){
+  "todoist":    parseTodoist,
+  "wunderlist": parseWunderlist,
+  "anydo":      parseAnyDo,
+}
+
+// isZip reports whether data is a zip archive, as Todoist backups and
+// Wunderlist exports are
+func isZip(data []byte) bool {
+  return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// zipFiles returns the contents of the files of the zip archive data whose
+// name ends with suffix, by name
+func zipFiles(data []byte, suffix string) (map[string][]byte, error) {
+  zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+  if err != nil {
+    return nil, err
+  }
+  files := map[string][]byte{}
+  for _, f := range zr.File {
+    if f.FileInfo().IsDir() || !strings.HasSuffix(strings.ToLower(f.Name), strings.ToLower(suffix)) {
+      continue
+    }
+    r, err := f.Open()
+    if err != nil {
+      return nil, err
+    }
+    b, err := ioutil.ReadAll(r)
+    r.Close()
+    if err != nil {
+      return nil, fmt.Errorf("%s: %v", f.Name, err)
+    }
+    files[f.Name] = b
+  }
+  if len(files) == 0 {
+    return nil, fmt.Errorf("no %s files in the archive", suffix)
+  }
+  return files, nil
+}
+
+// sortedNames returns the names of files in order
+func sortedNames(files map[string][]byte) []string {
+  var names []string
+  for name := range files {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// wordTags moves the words of title starting with prefix, such as the
+// @labels of Todoist, to tags
+func wordTags(title string, prefix string) (string, []string) {
+  var words, tags []string
+  for _, w := range strings.Fields(title) {
+    if len(w) > len(prefix) && strings.HasPrefix(w, prefix) {
+      tags = appendTag(tags, strings.ToLower(strings.TrimPrefix(w, prefix)))
+    } else {
+      words = append(words, w)
+    }
+  }
+  return strings.Join(words, " "), tags
+}
+
+// projectTag returns the tag of the tasks of project, with --projects tags
+func projectTag(project string) string {
+  return strings.Join(strings.Fields(strings.ToLower(project)), "-")
+}
+
+// todoistIDSuffix matches the project id Todoist appends to the names of
+// the files of a backup, as in "Work [2203306141].csv"
+var todoistIDSuffix = regexp.MustCompile(`\s*\[\d+\]$`)
+
+// parseTodoist reads a Todoist backup, a zip archive holding a CSV file
+// per project, or the CSV file of a single project
+func parseTodoist(data []byte) ([]importItem, error) {
+  if !isZip(data) {
+    return parseTodoistCSV(data, "")
+  }
+  files, err := zipFiles(data, ".csv")
+  if err != nil {
+    return nil, err
+  }
+  var items []importItem
+  for _, name := range sortedNames(files) {
+    project := todoistIDSuffix.ReplaceAllString(strings.TrimSuffix(path.Base(name), path.Ext(name)), "")
+    projectItems, err := parseTodoistCSV(files[name], project)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %v", name, err)
+    }
+    items = append(items, projectItems...)
+  }
+  return items, nil
+}
+
+// parseTodoistCSV reads the tasks of a project exported by Todoist as CSV.
+// Its rows are tasks, sections and the comments of the task before them,
+// which become its notes. Labels are the words of the content starting
+// with '@', priority 1 is the highest and 4 none, and the indent nests
+// subtasks
+func parseTodoistCSV(data []byte, project string) ([]importItem, error) {
+  cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+  cr.FieldsPerRecord, cr.LazyQuotes = -1, true
+  rows, err := cr.ReadAll()
+  if err != nil {
+    return nil, err
+  }
+  if len(rows) == 0 {
+    return nil, nil
+  }
+  columns := map[string]int{}
+  for i, name := range rows[0] {
+    columns[strings.ToUpper(strings.TrimSpace(name))] = i
+  }
+  if _, ok := columns["CONTENT"]; !ok {
+    return nil, fmt.Errorf("not a Todoist export, it has no CONTENT column")
+  }
+
+  now := time.Now()
+  var items []importItem
+  for n, row := range rows[1:] {
+    value := func(column string) string {
+      if i, ok := columns[column]; ok && i < len(row) {
+        return strings.TrimSpace(row[i])
+      }
+      return ""
+    }
+    switch strings.ToLower(value("TYPE")) {
+    case "task", "":
+    case "note":
+      if len(items) > 0 && value("CONTENT") != "" {
+        task := items[len(items)-1].task
+        task.Notes = strings.TrimSpace(task.Notes + "\n\n" + value("CONTENT"))
+      }
+      continue
+    default:
+      continue
+    }
+    title, tags := wordTags(value("CONTENT"), "@")
+    task := &todo.Task{Title: title, Tags: tags, Notes: value("DESCRIPTION")}
+    switch value("PRIORITY") {
+    case "1":
+      task.Priority = todo.PriorityHigh
+    case "2":
+      task.Priority = todo.PriorityMedium
+    case "3":
+      task.Priority = todo.PriorityLow
+    }
+    if date := value("DATE"); date != "" {
+      if every := todoistEvery(date); every != nil {
+        task.Every = every
+      } else if due, err := parseCSVDate(date, now); err == nil {
+        task.Due = todo.Date(due)
+      } else {
+        // kept rather than losing the task or its date
+        task.Notes = strings.TrimSpace(task.Notes + "\n\nDue: " + date)
+      }
+    }
+    depth := 0
+    if indent, err := strconv.Atoi(value("INDENT")); err == nil && indent > 1 {
+      depth = indent - 1
+    }
+    items = append(items, importItem{row: n + 2, title: title, depth: depth, task: task, project: project})
+  }
+  return items, nil
+}
+
+// todoistEvery returns the recurrence of a Todoist date such as "every
+// day" or "every 2 weeks", nil if date does not recur or recurs in a way
+// recurring tasks can not
+func todoistEvery(date string) *todo.Recurrence {
+  words := strings.Fields(strings.ToLower(date))
+  if len(words) < 2 || words[0] != "every" && words[0] != "every!" {
+    return nil
+  }
+  n, unit := 1, words[len(words)-1]
+  switch {
+  case len(words) == 3 && words[1] == "other":
+    n = 2
+  case len(words) == 3:
+    var err error
+    if n, err = strconv.Atoi(words[1]); err != nil {
+      return nil
+    }
+  case len(words) != 2:
+    return nil
+  }
+  switch strings.TrimSuffix(unit, "s") {
+  case "workday", "weekday":
+    if n == 1 {
+      every, _ := todo.ParseRecurrence("weekdays")
+      return every
+    }
+    return nil
+  case "day":
+    unit = "d"
+  case "week":
+    unit = "w"
+  case "month":
+    unit = "m"
+  case "year":
+    unit = "y"
+  default:
+    return nil
+  }
+  every, err := todo.ParseRecurrence(fmt.Sprintf("%d%s", n, unit))
+  if err != nil {
+    return nil
+  }
+  return every
+}
+
+// wunderlistTask is a task of a Wunderlist export, either of the backup
+// JSON file Wunderlist made, whose fields refer to other objects by id, or
+// of the Tasks.json files of the archive exported after Wunderlist closed,
+// which nest subtasks and notes
+type wunderlistTask struct {
+  ID              wunderlistID `json:"id"`
+  ListID          wunderlistID `json:"list_id"`
+  TaskID          wunderlistID `json:"task_id"`
+  Title           string       `json:"title"`
+  Completed       bool         `json:"completed"`
+  Starred         bool         `json:"starred"`
+  DueDate         string       `json:"due_date"`
+  DueDate2        string       `json:"dueDate"`
+  RecurrenceType  string       `json:"recurrence_type"`
+  RecurrenceCount int          `json:"recurrence_count"`
+  Content         string       `json:"content"`
+
+  Subtasks []wunderlistTask `json:"subtasks"`
+  Notes    []wunderlistTask `json:"notes"`
+}
+
+// wunderlistID is the id of a Wunderlist object, a number in backups and
+// a string in later exports
+type wunderlistID string
+
+func (id *wunderlistID) UnmarshalJSON(b []byte) error {
+  *id = wunderlistID(strings.Trim(string(b), `"`))
+  return nil
+}
+
+// wunderlistBackup is the backup JSON file of Wunderlist
+type wunderlistBackup struct {
+  Data struct {
+    Lists []struct {
+      ID    wunderlistID `json:"id"`
+      Title string       `json:"title"`
+    } `json:"lists"`
+    Tasks    []wunderlistTask `json:"tasks"`
+    Subtasks []wunderlistTask `json:"subtasks"`
+    Notes    []wunderlistTask `json:"notes"`
+  } `json:"data"`
+}
+
+// parseWunderlist reads a Wunderlist export: the zip archive with a
+// folder holding Tasks.json for each list, a Tasks.json file on its own,
+// or the JSON backup file of Wunderlist
+func parseWunderlist(data []byte) ([]importItem, error) {
+  if isZip(data) {
+    files, err := zipFiles(data, "Tasks.json")
+    if err != nil {
+      return nil, err
+    }
+    var items []importItem
+    for _, name := range sortedNames(files) {
+      var tasks []wunderlistTask
+      if err := json.Unmarshal(files[name], &tasks); err != nil {
+        return nil, fmt.Errorf("%s: %v", name, err)
+      }
+      items = append(items, wunderlistItems(tasks, path.Base(path.Dir(name)))...)
+    }
+    return items, nil
+  }
+  if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+    var tasks []wunderlistTask
+    if err := json.Unmarshal(data, &tasks); err != nil {
+      return nil, err
+    }
+    return wunderlistItems(tasks, ""), nil
+  }
+
+  var backup wunderlistBackup
+  if err := json.Unmarshal(data, &backup); err != nil {
+    return nil, err
+  }
+  lists := map[wunderlistID]string{}
+  for _, list := range backup.Data.Lists {
+    lists[list.ID] = list.Title
+  }
+  byID := map[wunderlistID]*wunderlistTask{}
+  for i := range backup.Data.Tasks {
+    byID[backup.Data.Tasks[i].ID] = &backup.Data.Tasks[i]
+  }
+  for _, sub := range backup.Data.Subtasks {
+    if task := byID[sub.TaskID]; task != nil {
+      task.Subtasks = append(task.Subtasks, sub)
+    }
+  }
+  for _, note := range backup.Data.Notes {
+    if task := byID[note.TaskID]; task != nil {
+      task.Notes = append(task.Notes, note)
+    }
+  }
+  var items []importItem
+  for _, list := range backup.Data.Lists {
+    var tasks []wunderlistTask
+    for _, task := range backup.Data.Tasks {
+      if task.ListID == list.ID {
+        tasks = append(tasks, task)
+      }
+    }
+    items = append(items, wunderlistItems(tasks, lists[list.ID])...)
+  }
+  return items, nil
+}
+
+// wunderlistItems returns the items of the tasks of a Wunderlist list,
+// each followed by its subtasks. Hashtags in titles become tags
+func wunderlistItems(tasks []wunderlistTask, project string) []importItem {
+  now := time.Now()
+  var items []importItem
+  for n, wt := range tasks {
+    title, tags := wordTags(wt.Title, "#")
+    task := &todo.Task{Title: title, Tags: tags, Starred: wt.Starred}
+    var notes []string
+    for _, note := range wt.Notes {
+      if strings.TrimSpace(note.Content) != "" {
+        notes = append(notes, strings.TrimSpace(note.Content))
+      }
+    }
+    task.Notes = strings.Join(notes, "\n\n")
+    for _, date := range []string{wt.DueDate, wt.DueDate2} {
+      if len(date) >= 10 {
+        if due, err := parseCSVDate(date[:10], now); err == nil {
+          task.Due = todo.Date(due)
+        }
+      }
+    }
+    units := map[string]string{"day": "d", "week": "w", "month": "m", "year": "y"}
+    if unit, ok := units[wt.RecurrenceType]; ok && wt.RecurrenceCount > 0 {
+      task.Every, _ = todo.ParseRecurrence(fmt.Sprintf("%d%s", wt.RecurrenceCount, unit))
+    }
+    items = append(items, importItem{row: n + 1, title: title, done: wt.Completed, task: task, project: project})
+    for _, sub := range wt.Subtasks {
+      subtask := &todo.Task{Title: strings.TrimSpace(sub.Title)}
+      items = append(items, importItem{row: n + 1, title: subtask.Title, depth: 1, done: wt.Completed || sub.Completed, task: subtask, project: project})
+    }
+  }
+  return items
+}
+
+// anydoTask is a task of an Any.do JSON export. Its due date is in
+// milliseconds since the epoch, zero if it has none
+type anydoTask struct {
+  ID                 string   `json:"id"`
+  GlobalTaskID       string   `json:"globalTaskId"`
+  ParentGlobalTaskID string   `json:"parentGlobalTaskId"`
+  CategoryID         string   `json:"categoryId"`
+  Title              string   `json:"title"`
+  Note               string   `json:"note"`
+  Status             string   `json:"status"`
+  Priority           string   `json:"priority"`
+  DueDate            int64    `json:"dueDate"`
+  Labels             []string `json:"labels"`
+}
+
+// parseAnyDo reads an Any.do JSON export, whose categories are projects
+func parseAnyDo(data []byte) ([]importItem, error) {
+  var export struct {
+    Categories []struct {
+      ID   string `json:"id"`
+      Name string `json:"name"`
+    } `json:"categories"`
+    Tasks []anydoTask `json:"tasks"`
+    Items []anydoTask `json:"items"`
+  }
+  if err := json.Unmarshal(data, &export); err != nil {
+    return nil, err
+  }
+  tasks := append(export.Tasks, export.Items...)
+  if len(tasks) == 0 {
+    return nil, fmt.Errorf("not an Any.do export, it has no tasks")
+  }
+  categories := map[string]string{}
+  for _, c := range export.Categories {
+    categories[c.ID] = c.Name
+  }
+  subtasks := map[string][]anydoTask{}
+  for _, t := range tasks {
+    if t.ParentGlobalTaskID != "" {
+      subtasks[t.ParentGlobalTaskID] = append(subtasks[t.ParentGlobalTaskID], t)
+    }
+  }
+
+  var items []importItem
+  var add func(t anydoTask, depth int, project string)
+  add = func(t anydoTask, depth int, project string) {
+    task := &todo.Task{Title: strings.TrimSpace(t.Title), Notes: strings.TrimSpace(t.Note)}
+    for _, label := range t.Labels {
+      task.Tags = appendTag(task.Tags, projectTag(label))
+    }
+    if strings.EqualFold(t.Priority, "high") {
+      task.Priority = todo.PriorityHigh
+    }
+    if t.DueDate > 0 {
+      task.Due = todo.Date(time.Unix(0, t.DueDate*int64(time.Millisecond)).Local())
+    }
+    done := strings.EqualFold(t.Status, "checked") || strings.EqualFold(t.Status, "done")
+    items = append(items, importItem{row: len(items) + 1, title: task.Title, depth: depth, done: done, task: task, project: project})
+    id := t.GlobalTaskID
+    if id == "" {
+      id = t.ID
+    }
+    for _, sub := range subtasks[id] {
+      add(sub, depth+1, project)
+    }
+  }
+  for _, t := range tasks {
+    if t.ParentGlobalTaskID == "" {
+      add(t, 0, categories[t.CategoryID])
+    }
+  }
+  return items, nil
+}
+
+// Imports items read from the export of another app, the tasks of each
+// project into the list of its name, created if need be, or with asTags
+// set into the current list, tagged with the project. Unless force is
+// set, the projects and their tasks are counted first and the import
+// only happens once confirmed
+func importAppItems(items []importItem, opts importOptions, asTags bool, force bool) error {
+  var projects []string
+  byProject := map[string][]importItem{}
+  for _, item := range items {
+    project := item.project
+    if asTags {
+      if project != "" {
+        item.task.Tags = appendTag(item.task.Tags, projectTag(project))
+      }
+      project = ""
+    }
+    if _, ok := byProject[project]; !ok {
+      projects = append(projects, project)
+    }
+    byProject[project] = append(byProject[project], item)
+  }
+  if len(items) == 0 {
+    infof("Nothing to import")
+    return nil
+  }
+
+  if !force {
+    for _, project := range projects {
+      open, done := 0, 0
+      for _, item := range byProject[project] {
+        if item.done {
+          done++
+        } else {
+          open++
+        }
+      }
+      list := project
+      if list == "" {
+        list = currentList()
+      }
+      line := fmt.Sprintf("%s into your %s list", plural(open, "task"), list)
+      if done > 0 && opts.completed {
+        line += fmt.Sprintf(", %d completed", done)
+      }
+      fmt.Printf("  %s\n", line)
+    }
+    if !confirmf("Import %s?", plural(len(items), "task")) {
+      return nil
+    }
+  }
+
+  current := listFlag
+  defer func() { listFlag = current }()
+  for _, project := range projects {
+    listFlag = current
+    if project != "" {
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if _, err := getTodoId(s.ctx, s.client, project, true); err != nil {
+        return fmt.Errorf("Unable to create the %s list: %w", project, err)
+      }
+      listFlag = project
+    }
+    s, err := newSession()
+    if err != nil {
+      return err
+    }
+    if err := importTodoItems(s, byProject[project], opts); err != nil {
+      return err
+    }
+  }
+  return nil
+}
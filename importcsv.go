@@ -0,0 +1,224 @@
+package main
+
+import (
+  "bufio"
+  "encoding/csv"
+  "fmt"
+  "io"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// csvFields are the task fields a CSV column can be mapped to, with the
+// header names each is found under when there is no --map
+var csvFields = map[string][]string{
+  "title":    {"title", "name", "task", "content", "subject", "summary"},
+  "notes":    {"notes", "note", "description", "details"},
+  "due":      {"due", "due date", "due_date", "deadline", "date"},
+  "priority": {"priority"},
+  "tags":     {"tags", "tag", "labels", "label", "categories"},
+  "done":     {"done", "completed", "status", "checked"},
+}
+
+// csvDateLayouts are the date formats of spreadsheets and exports accepted
+// besides the dates add understands
+var csvDateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006/01/02",
+  "1/2/2006", "1/2/06", "Jan 2, 2006", "January 2, 2006", "2 Jan 2006"}
+
+// parseCSVMap parses the field mapping of --map, such as
+// "title=2,due=5,notes=Description": columns are numbered from 1 or named
+// by their header
+func parseCSVMap(s string) (map[string]string, error) {
+  mapping := map[string]string{}
+  for _, pair := range strings.Split(s, ",") {
+    kv := strings.SplitN(pair, "=", 2)
+    field := strings.ToLower(strings.TrimSpace(kv[0]))
+    if _, ok := csvFields[field]; !ok || len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+      return nil, invalidf("Invalid --map '%s', expected field=column with field one of title, notes, due, priority, tags or done", pair)
+    }
+    mapping[field] = strings.TrimSpace(kv[1])
+  }
+  if mapping["title"] == "" {
+    return nil, invalidf("--map must give the column of the title, e.g. title=1")
+  }
+  return mapping, nil
+}
+
+// csvColumns resolves mapping to column indexes against header, which is
+// nil for files without one. Without a mapping, columns are found by
+// their header names
+func csvColumns(mapping map[string]string, header []string) (map[string]int, error) {
+  columns := map[string]int{}
+  if mapping == nil {
+    if header == nil {
+      return nil, invalidf("A CSV file without a header needs --map, e.g. --map title=1,due=2")
+    }
+    for field, names := range csvFields {
+      for i, h := range header {
+        if _, ok := columns[field]; !ok && containsFold(names, strings.TrimSpace(h)) {
+          columns[field] = i
+        }
+      }
+    }
+    if _, ok := columns["title"]; !ok {
+      return nil, invalidf("No title column found in the CSV header, give one with --map title=<column>")
+    }
+    return columns, nil
+  }
+  for field, col := range mapping {
+    if n, err := strconv.Atoi(col); err == nil {
+      if n < 1 {
+        return nil, invalidf("Invalid --map column %d, columns are numbered from 1", n)
+      }
+      columns[field] = n - 1
+      continue
+    }
+    found := false
+    for i, h := range header {
+      if strings.EqualFold(strings.TrimSpace(h), col) {
+        columns[field], found = i, true
+        break
+      }
+    }
+    if !found {
+      return nil, invalidf("No column named '%s' in the CSV header", col)
+    }
+  }
+  return columns, nil
+}
+
+// containsFold reports whether names holds s, ignoring case
+func containsFold(names []string, s string) bool {
+  for _, name := range names {
+    if strings.EqualFold(name, s) {
+      return true
+    }
+  }
+  return false
+}
+
+// parseCSVImport reads tasks from the rows of a CSV file, mapping columns
+// to fields as parseCSVMap and csvColumns say. The first row is a header
+// unless noHeader is set. Semicolons separate columns if the first line
+// holds more of them than commas. Rows that can not be read are returned
+// with their error
+func parseCSVImport(r io.Reader, mapping map[string]string, noHeader bool) ([]importItem, error) {
+  br := bufio.NewReader(r)
+  first, _ := br.Peek(4096)
+  line := string(first)
+  if i := strings.IndexByte(line, '\n'); i >= 0 {
+    line = line[:i]
+  }
+  cr := csv.NewReader(br)
+  cr.FieldsPerRecord, cr.LazyQuotes, cr.TrimLeadingSpace = -1, true, true
+  if strings.Count(line, ";") > strings.Count(line, ",") {
+    cr.Comma = ';'
+  }
+  rows, err := cr.ReadAll()
+  if err != nil {
+    return nil, err
+  }
+  var header []string
+  start := 0
+  if !noHeader && len(rows) > 0 {
+    header, start = rows[0], 1
+  }
+  columns, err := csvColumns(mapping, header)
+  if err != nil {
+    return nil, err
+  }
+
+  now := time.Now()
+  var items []importItem
+  for n, row := range rows[start:] {
+    value := func(field string) string {
+      if i, ok := columns[field]; ok && i < len(row) {
+        return strings.TrimSpace(row[i])
+      }
+      return ""
+    }
+    item := importItem{row: n + start + 1, title: value("title"), done: csvTrue(value("done"))}
+    if strings.Join(row, "") == "" {
+      continue
+    }
+    task, err := csvTask(value, now)
+    if err != nil {
+      item.err = err
+    }
+    item.task = task
+    items = append(items, item)
+  }
+  return items, nil
+}
+
+// csvTask builds a task of the fields of a CSV row, value returning the
+// cell of a field
+func csvTask(value func(field string) string, now time.Time) (*todo.Task, error) {
+  task := &todo.Task{Title: value("title"), Notes: value("notes")}
+  if task.Title == "" {
+    return nil, fmt.Errorf("the title is empty")
+  }
+  if due := value("due"); due != "" {
+    date, err := parseCSVDate(due, now)
+    if err != nil {
+      return nil, err
+    }
+    task.Due = todo.Date(date)
+  }
+  if p := value("priority"); p != "" {
+    priority, err := parseCSVPriority(p)
+    if err != nil {
+      return nil, err
+    }
+    task.Priority = priority
+  }
+  for _, tag := range strings.FieldsFunc(value("tags"), func(r rune) bool {
+    return r == ',' || r == ';' || r == ' '
+  }) {
+    task.Tags = appendTag(task.Tags, strings.ToLower(strings.TrimLeft(tag, "+#@")))
+  }
+  return task, nil
+}
+
+// parseCSVDate parses the dates add understands and those of csvDateLayouts
+func parseCSVDate(value string, now time.Time) (time.Time, error) {
+  if date, err := parseDate(value, now); err == nil {
+    return date, nil
+  }
+  for _, layout := range csvDateLayouts {
+    if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+      return t, nil
+    }
+  }
+  return time.Time{}, fmt.Errorf("unrecognized date '%s'", value)
+}
+
+// parseCSVPriority parses priority names as well as the numbers apps
+// export priorities as, 1 being the highest
+func parseCSVPriority(value string) (todo.Priority, error) {
+  switch value {
+  case "0":
+    return todo.PriorityNone, nil
+  case "1":
+    return todo.PriorityHigh, nil
+  case "2":
+    return todo.PriorityMedium, nil
+  case "3", "4":
+    return todo.PriorityLow, nil
+  }
+  return todo.ParsePriority(value)
+}
+
+// csvTrue reports whether a cell of a done column marks the task
+// completed: any value but an empty or negative one, such as the time of
+// completion export writes
+func csvTrue(value string) bool {
+  switch strings.ToLower(value) {
+  case "", "0", "n", "no", "false", "open", "todo", "pending", "needsaction", "needs action", "incomplete":
+    return false
+  }
+  return true
+}
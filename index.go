@@ -0,0 +1,168 @@
+package main
+
+import (
+  "crypto/sha1"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/term"
+)
+
+// idAlphabet spells short task ids. It has no digits, so ids never read as
+// indexes, nor l and o, which look like them
+const idAlphabet = "abcdefghijkmnpqrstuvwxyz"
+
+// shortIDLength is the length of short ids, and minIDPrefix that of the
+// shortest prefix of one commands accept
+const (
+  shortIDLength = 6
+  minIDPrefix   = 3
+)
+
+// shortID returns the short id of the task with the given backend id,
+// which stays the same as long as the backend id does
+func shortID(id string) string {
+  sum := sha1.Sum([]byte(id))
+  b := make([]byte, shortIDLength)
+  for i := range b {
+    b[i] = idAlphabet[int(sum[i])%len(idAlphabet)]
+  }
+  return string(b)
+}
+
+// byID returns the tasks of items whose short id starts with prefix, or
+// whose backend id is prefix
+func byID(items []*todo.Task, prefix string) []*todo.Task {
+  isPrefix := len(prefix) >= minIDPrefix && len(prefix) <= shortIDLength &&
+    strings.Trim(prefix, idAlphabet) == ""
+  var matches []*todo.Task
+  for _, task := range items {
+    if task.ID == prefix || isPrefix && strings.HasPrefix(shortID(task.ID), prefix) {
+      matches = append(matches, task)
+    }
+  }
+  return matches
+}
+
+// resolve returns the tasks of items arg, which is not an index, refers
+// to: those with an id starting with it, then those with a title matching
+// it as with findTodoItems
+func resolve(items []*todo.Task, arg string) []*todo.Task {
+  matches := byID(items, arg)
+  for _, task := range findTodoItems(items, arg) {
+    if len(matches) == 0 || !containsTask(matches, task) {
+      matches = append(matches, task)
+    }
+  }
+  return matches
+}
+
+// containsTask reports whether tasks holds task
+func containsTask(tasks []*todo.Task, task *todo.Task) bool {
+  for _, t := range tasks {
+    if t.ID == task.ID {
+      return true
+    }
+  }
+  return false
+}
+
+// chooseTask asks the user to pick one of the tasks arg matches with the
+// finder of 'todo pick', or fails listing them if stdin is no terminal
+func chooseTask(arg string, matches []*todo.Task) (*todo.Task, error) {
+  var lines []string
+  for _, task := range matches {
+    lines = append(lines, shortID(task.ID)+"  "+task.Title)
+  }
+  if !term.IsTerminal(int(os.Stdin.Fd())) {
+    return nil, invalidf("'%s' matches %d tasks, give the id of one: %s", arg, len(matches),
+      strings.Join(lines, ", "))
+  }
+  fmt.Fprintf(os.Stderr, "'%s' matches %d tasks, pick one:\n", arg, len(matches))
+  i, err := pickEmbedded(lines)
+  if err != nil {
+    return nil, err
+  }
+  return matches[i], nil
+}
+
+// remember records the ids of items in the order 'todo list', or the view
+// with the given name, numbered them, so that indexes keep referring to
+// the same tasks until the next listing even if the list changes in
+// between
+func (c *cachedList) remember(items []*todo.Task, view string) {
+  c.ListedView = view
+  c.Listed = make([]string, len(items))
+  for i, task := range items {
+    c.Listed[i] = task.ID
+  }
+}
+
+// relabel replaces the id old in the remembered listing by id, once a
+// task created offline has been given its id by the backend
+func (c *cachedList) relabel(old string, id string) {
+  for i, listed := range c.Listed {
+    if listed == old {
+      c.Listed[i] = id
+    }
+  }
+}
+
+// taskAt returns the task of items shown at the 1-based index arg by the
+// last listing. If the list changed since a listing of the whole list,
+// the task keeps its index and a note says so; if it no longer exists, a not found error is
+// returned. Without a listing to go by, arg indexes items directly. An arg
+// that is not a number is resolved as an id prefix or title, asking which
+// task is meant if it matches several
+func (s *session) taskAt(items []*todo.Task, arg string) (*todo.Task, error) {
+  i, err := strconv.Atoi(arg)
+  if err != nil && arg != "" {
+    switch matches := resolve(items, arg); len(matches) {
+    case 0:
+      return nil, notFoundf("No task in your %s list has the id or title '%s'", s.listName, arg)
+    case 1:
+      return matches[0], nil
+    default:
+      return chooseTask(arg, matches)
+    }
+  }
+  listed := s.cache.Listed
+  if len(listed) == 0 {
+    if err != nil || i < 1 || i > len(items) {
+      return nil, invalidf("Invalid task index '%s'", arg)
+    }
+    return items[i-1], nil
+  }
+  if err != nil || i < 1 || i > len(listed) {
+    return nil, invalidf("Invalid task index '%s', run 'todo list' to see the current ones", arg)
+  }
+  for j, task := range items {
+    if task.ID != listed[i-1] {
+      continue
+    }
+    if j != i-1 && s.cache.ListedView == "" {
+      warnf("Your %s list changed since it was last listed, %d still refers to '%s'",
+        s.listName, i, task.Title)
+    }
+    return task, nil
+  }
+  return nil, notFoundf("Task %d of your last listing is no longer in your %s list, run 'todo list' to see the current one",
+    i, s.listName)
+}
+
+// find resolves query to the tasks of items it refers to: the task at an
+// index given by taskAt, or the tasks with an id starting with query or a
+// title matching it
+func (s *session) find(items []*todo.Task, query string) ([]*todo.Task, error) {
+  if _, err := strconv.Atoi(query); err != nil {
+    return resolve(items, query), nil
+  }
+  task, err := s.taskAt(items, query)
+  if err != nil {
+    return nil, err
+  }
+  return []*todo.Task{task}, nil
+}
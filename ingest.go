@@ -0,0 +1,229 @@
+package main
+
+import (
+  "bytes"
+  "encoding/base64"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "mime"
+  "mime/multipart"
+  "mime/quotedprintable"
+  "net/mail"
+  "os"
+  "strings"
+  "unicode/utf8"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// excerptLength is how many characters of the body of a message go into
+// the notes of its task
+const excerptLength = 500
+
+// mailTask returns the task for the email message raw: its subject is the
+// title, and its sender, date, Message-ID and the start of its text the
+// notes
+func mailTask(raw []byte) (*todo.Task, error) {
+  msg, err := mail.ReadMessage(bytes.NewReader(raw))
+  if err != nil {
+    return nil, invalidf("Invalid email message: %v", err)
+  }
+  dec := new(mime.WordDecoder)
+  subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+  if err != nil {
+    subject = msg.Header.Get("Subject")
+  }
+  subject = strings.Join(strings.Fields(subject), " ")
+  if subject == "" {
+    subject = "(no subject)"
+  }
+
+  var notes []string
+  if from, err := dec.DecodeHeader(msg.Header.Get("From")); err == nil && from != "" {
+    notes = append(notes, "From: "+from)
+  }
+  if date, err := msg.Header.Date(); err == nil {
+    notes = append(notes, "Date: "+formatDate(date)+" "+date.Format("15:04"))
+  }
+  if id := msg.Header.Get("Message-ID"); id != "" {
+    // RFC 2392 mid: links open the message in mail clients supporting them
+    notes = append(notes, "Link: mid:"+strings.Trim(id, "<>"))
+  }
+  text, err := plainText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+  if err != nil {
+    warnf("Unable to read the text of '%s': %v", subject, err)
+  }
+  if excerpt := excerpt(text, excerptLength); excerpt != "" {
+    if len(notes) > 0 {
+      notes = append(notes, "")
+    }
+    notes = append(notes, excerpt)
+  }
+  return &todo.Task{Title: subject, Notes: strings.Join(notes, "\n")}, nil
+}
+
+// plainText returns the text/plain part of a message body with the given
+// content type and transfer encoding, or "" if it has none
+func plainText(contentType string, encoding string, body io.Reader) (string, error) {
+  if contentType == "" {
+    contentType = "text/plain"
+  }
+  mediaType, params, err := mime.ParseMediaType(contentType)
+  if err != nil {
+    return "", err
+  }
+  switch strings.ToLower(encoding) {
+  case "quoted-printable":
+    body = quotedprintable.NewReader(body)
+  case "base64":
+    body = base64.NewDecoder(base64.StdEncoding, body)
+  }
+  if strings.HasPrefix(mediaType, "multipart/") {
+    parts := multipart.NewReader(body, params["boundary"])
+    for {
+      part, err := parts.NextPart()
+      if err == io.EOF {
+        return "", nil
+      }
+      if err != nil {
+        return "", err
+      }
+      // multipart decodes quoted-printable parts itself
+      text, err := plainText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+      if err != nil || text != "" {
+        return text, err
+      }
+    }
+  }
+  if mediaType != "text/plain" {
+    return "", nil
+  }
+  b, err := ioutil.ReadAll(body)
+  if err != nil {
+    return "", err
+  }
+  switch charset := strings.ToLower(params["charset"]); charset {
+  case "", "utf-8", "us-ascii":
+    return string(b), nil
+  case "iso-8859-1", "latin1":
+    // its bytes are the first 256 code points
+    runes := make([]rune, len(b))
+    for i, c := range b {
+      runes[i] = rune(c)
+    }
+    return string(runes), nil
+  default:
+    return "", fmt.Errorf("unsupported charset %s", charset)
+  }
+}
+
+// excerpt returns the first n characters of text, with whitespace
+// collapsed and quoted replies left out
+func excerpt(text string, n int) string {
+  var lines []string
+  for _, line := range strings.Split(text, "\n") {
+    line = strings.TrimSpace(line)
+    if strings.HasPrefix(line, ">") {
+      continue
+    }
+    lines = append(lines, line)
+  }
+  s := strings.TrimSpace(strings.Join(strings.Fields(strings.Join(lines, " ")), " "))
+  if utf8.RuneCountInString(s) <= n {
+    return s
+  }
+  return string([]rune(s)[:n]) + "…"
+}
+
+// ingestMessage adds the task of the email message raw
+func ingestMessage(s *session, raw []byte) error {
+  task, err := mailTask(raw)
+  if err != nil {
+    return err
+  }
+  task, err = s.insert(task)
+  if err != nil {
+    return fmt.Errorf("Could not create task %w", err)
+  }
+  infof("Task '%s' added to your %s list", task.Title, s.listName)
+  return nil
+}
+
+// Adds a task for each flagged message of the mailbox of the config, or
+// with to set each unread message sent to that address. Flagged messages
+// are unflagged and unread messages marked read once their task is added
+func ingestMailbox(s *session, to string) error {
+  c := loadConfig()
+  if c.IMAPServer == "" {
+    return invalidf("Set imap_server to the host:port of your IMAP server, e.g. imap.example.com:993")
+  }
+  mailbox := c.IMAPMailbox
+  if mailbox == "" {
+    mailbox = "INBOX"
+  }
+  conn, err := dialIMAP(s.ctx, c.IMAPServer)
+  if err != nil {
+    return err
+  }
+  defer conn.logout()
+  if err := conn.login(c.IMAPUsername, c.IMAPPassword, mailbox); err != nil {
+    return err
+  }
+  criteria, done := "FLAGGED", `-FLAGS.SILENT (\Flagged)`
+  if to != "" {
+    criteria, done = "UNSEEN TO "+imapQuote(to), `+FLAGS.SILENT (\Seen)`
+  }
+  uids, err := conn.search(criteria)
+  if err != nil {
+    return err
+  }
+  for _, uid := range uids {
+    raw, err := conn.fetch(uid)
+    if err != nil {
+      return err
+    }
+    if err := ingestMessage(s, raw); err != nil {
+      return err
+    }
+    if err := conn.store(uid, done); err != nil {
+      return err
+    }
+  }
+  if len(uids) == 0 {
+    infof("No new messages to add tasks for in %s", mailbox)
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:  "ingest",
+    usage: "ingest email [--to address] | ingest email - < message.eml",
+    summary: "Add tasks for flagged email messages, or those sent to an address, " +
+      "or for a message read from stdin",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      to := fs.String("to", "", "add tasks for the unread messages sent to this address instead of flagged ones")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 || args[0] != "email" || len(args) > 2 || len(args) == 2 && args[1] != "-" {
+        return invalidf("Unknown ingest command, see 'todo help ingest'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if len(args) == 2 {
+        raw, err := ioutil.ReadAll(os.Stdin)
+        if err != nil {
+          return err
+        }
+        return ingestMessage(s, raw)
+      }
+      return ingestMailbox(s, *to)
+    },
+  })
+}
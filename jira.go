@@ -0,0 +1,434 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/url"
+  "regexp"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// metaJira is the metadata key holding the key of the Jira issue a task
+// mirrors, such as PROJ-12
+const metaJira = "jira"
+
+// defaultSprintField is the custom field holding the sprints of issues on
+// Jira Cloud, unless jira_sprint_field names another
+const defaultSprintField = "customfield_10020"
+
+// jiraJQL selects the issues sync looks at: those assigned to the user
+// that are not done, or became done recently
+const jiraJQL = "assignee = currentUser() AND (statusCategory != Done OR updated >= -30d) ORDER BY created"
+
+// jiraSprintName finds the name and state in the string form of a sprint
+// sent by Jira Server
+var jiraSprintName = regexp.MustCompile(`(?:^|[\[,])name=([^,\]]*)`)
+var jiraSprintState = regexp.MustCompile(`(?:^|[\[,])state=([^,\]]*)`)
+
+// jiraIssue is the part of a Jira issue sync uses
+type jiraIssue struct {
+  Key    string
+  Fields struct {
+    Summary string `json:"summary"`
+    DueDate string `json:"duedate"`
+    Updated string `json:"updated"`
+    Status  struct {
+      StatusCategory struct {
+        Key string `json:"key"`
+      } `json:"statusCategory"`
+    } `json:"status"`
+  }
+  // the sprints the issue was in, read from the sprint field
+  sprints []jiraSprint
+}
+
+// jiraSprint is a sprint an issue is or was in
+type jiraSprint struct {
+  Name  string `json:"name"`
+  State string `json:"state"`
+}
+
+// done reports whether the issue is in a status of the done category
+func (i *jiraIssue) done() bool {
+  return i.Fields.Status.StatusCategory.Key == "done"
+}
+
+// due returns the due date of the issue, or zero
+func (i *jiraIssue) due() time.Time {
+  t, err := time.Parse("2006-01-02", i.Fields.DueDate)
+  if err != nil {
+    return time.Time{}
+  }
+  return t
+}
+
+// updated returns when the issue was last changed
+func (i *jiraIssue) updated() time.Time {
+  t, _ := time.Parse("2006-01-02T15:04:05.000-0700", i.Fields.Updated)
+  return t
+}
+
+// sprintTag returns the tag of the sprint the issue is in, the active or
+// a future one if any, or else the last one, or "" if it was never in one
+func (i *jiraIssue) sprintTag() string {
+  var last string
+  for _, sprint := range i.sprints {
+    state := strings.ToLower(sprint.State)
+    if state == "active" || state == "future" {
+      return sprintTag(sprint.Name)
+    }
+    last = sprintTag(sprint.Name)
+  }
+  return last
+}
+
+// sprintTag turns the name of a sprint into a tag
+func sprintTag(name string) string {
+  return strings.Join(strings.Fields(name), "-")
+}
+
+// parseSprints reads the value of the sprint field of an issue: objects on
+// Jira Cloud, strings on Jira Server
+func parseSprints(raw json.RawMessage) []jiraSprint {
+  var sprints []jiraSprint
+  if json.Unmarshal(raw, &sprints) == nil {
+    return sprints
+  }
+  var values []string
+  if json.Unmarshal(raw, &values) != nil {
+    return nil
+  }
+  for _, v := range values {
+    var s jiraSprint
+    if m := jiraSprintName.FindStringSubmatch(v); m != nil {
+      s.Name = m[1]
+    }
+    if m := jiraSprintState.FindStringSubmatch(v); m != nil {
+      s.State = m[1]
+    }
+    if s.Name != "" {
+      sprints = append(sprints, s)
+    }
+  }
+  return sprints
+}
+
+// jiraClient calls the REST API of a Jira instance, signing in with an
+// email address and API token on Jira Cloud, or with a personal access
+// token on Jira Server when email is empty
+type jiraClient struct {
+  base        *url.URL
+  email       string
+  token       string
+  sprintField string
+  client      *http.Client
+}
+
+// do sends a request with the JSON encoding of in as its body, if it is
+// not nil, and decodes the JSON response into out, if it is not nil
+func (j *jiraClient) do(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}) error {
+  u := *j.base
+  u.Path = strings.TrimSuffix(u.Path, "/") + path
+  u.RawQuery = query.Encode()
+  var body bytes.Buffer
+  if in != nil {
+    if err := json.NewEncoder(&body).Encode(in); err != nil {
+      return err
+    }
+  }
+  req, err := http.NewRequest(method, u.String(), &body)
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Accept", "application/json")
+  if in != nil {
+    req.Header.Set("Content-Type", "application/json")
+  }
+  if j.email != "" {
+    req.SetBasicAuth(j.email, j.token)
+  } else {
+    req.Header.Set("Authorization", "Bearer "+j.token)
+  }
+  res, err := j.client.Do(req.WithContext(ctx))
+  if err != nil {
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Unable to reach Jira: %w", err)}
+  }
+  defer res.Body.Close()
+  if res.StatusCode >= 300 {
+    var e struct {
+      ErrorMessages []string          `json:"errorMessages"`
+      Errors        map[string]string `json:"errors"`
+    }
+    json.NewDecoder(res.Body).Decode(&e)
+    msgs := e.ErrorMessages
+    for field, msg := range e.Errors {
+      msgs = append(msgs, field+": "+msg)
+    }
+    if len(msgs) == 0 {
+      msgs = []string{http.StatusText(res.StatusCode)}
+    }
+    err := fmt.Errorf("Jira: %s (%d)", strings.Join(msgs, ", "), res.StatusCode)
+    switch res.StatusCode {
+    case http.StatusUnauthorized:
+      return fmt.Errorf("%v, check jira_email and jira_token", err)
+    case http.StatusNotFound:
+      return notFoundf("%v", err)
+    }
+    return err
+  }
+  if out == nil {
+    return nil
+  }
+  if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+    return fmt.Errorf("Invalid response of Jira: %v", err)
+  }
+  return nil
+}
+
+// assignedIssues returns the issues of jiraJQL. Jira Cloud pages through
+// them with tokens, Jira Server by offset
+func (j *jiraClient) assignedIssues(ctx context.Context) ([]*jiraIssue, error) {
+  fields := "summary,status,duedate,updated," + j.sprintField
+  var issues []*jiraIssue
+  for token, start := "", 0; ; {
+    var page struct {
+      Issues []struct {
+        Key    string                     `json:"key"`
+        Fields map[string]json.RawMessage `json:"fields"`
+      } `json:"issues"`
+      Total         int    `json:"total"`
+      NextPageToken string `json:"nextPageToken"`
+    }
+    q := url.Values{"jql": {jiraJQL}, "fields": {fields}, "maxResults": {"100"}}
+    path := "/rest/api/2/search"
+    if j.email != "" {
+      path += "/jql"
+      if token != "" {
+        q.Set("nextPageToken", token)
+      }
+    } else {
+      q.Set("startAt", fmt.Sprint(start))
+    }
+    if err := j.do(ctx, http.MethodGet, path, q, nil, &page); err != nil {
+      return nil, err
+    }
+    for _, raw := range page.Issues {
+      issue := &jiraIssue{Key: raw.Key}
+      b, _ := json.Marshal(raw.Fields)
+      if err := json.Unmarshal(b, &issue.Fields); err != nil {
+        return nil, fmt.Errorf("Invalid issue %s of Jira: %v", raw.Key, err)
+      }
+      issue.sprints = parseSprints(raw.Fields[j.sprintField])
+      issues = append(issues, issue)
+    }
+    start += len(page.Issues)
+    token = page.NextPageToken
+    if j.email != "" && token == "" || j.email == "" && (start >= page.Total || len(page.Issues) == 0) {
+      return issues, nil
+    }
+  }
+}
+
+// setDue changes the due date of the issue with the given key, clearing it
+// if due is zero
+func (j *jiraClient) setDue(ctx context.Context, key string, due time.Time) error {
+  var value interface{}
+  if !due.IsZero() {
+    value = due.Format("2006-01-02")
+  }
+  body := map[string]interface{}{"fields": map[string]interface{}{"duedate": value}}
+  return j.do(ctx, http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(key), nil, body, nil)
+}
+
+// resolve moves the issue with the given key to a status of the done
+// category, through the first transition available to one
+func (j *jiraClient) resolve(ctx context.Context, key string) error {
+  var res struct {
+    Transitions []struct {
+      ID string `json:"id"`
+      To struct {
+        StatusCategory struct {
+          Key string `json:"key"`
+        } `json:"statusCategory"`
+      } `json:"to"`
+    } `json:"transitions"`
+  }
+  path := "/rest/api/2/issue/" + url.PathEscape(key) + "/transitions"
+  if err := j.do(ctx, http.MethodGet, path, nil, nil, &res); err != nil {
+    return err
+  }
+  for _, t := range res.Transitions {
+    if t.To.StatusCategory.Key == "done" {
+      body := map[string]interface{}{"transition": map[string]string{"id": t.ID}}
+      return j.do(ctx, http.MethodPost, path, nil, body, nil)
+    }
+  }
+  return fmt.Errorf("Jira offers no transition of %s to a done status", key)
+}
+
+// jiraTags returns tags with the tags of sprints other than the current
+// one of issue replaced by it
+func jiraTags(tags []string, issue *jiraIssue, sprintTags map[string]bool) []string {
+  current := issue.sprintTag()
+  kept := []string{}
+  for _, tag := range tags {
+    if !sprintTags[tag] || tag == current {
+      kept = append(kept, tag)
+    }
+  }
+  if current != "" {
+    kept = appendTag(kept, current)
+  }
+  return kept
+}
+
+// Pulls the Jira issues assigned to the user into the todo list: a task is
+// added for each issue that is not done, titled like it, with its address
+// in the notes, tagged with its sprint and due when it is, and the tasks of
+// issues that are done are completed. With twoWay set, due dates changed
+// last in the todo list go to Jira, and issues whose task was completed
+// are moved to a done status
+func syncJira(s *session, j *jiraClient, twoWay bool) error {
+  issues, err := j.assignedIssues(s.ctx)
+  if err != nil {
+    return err
+  }
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  tasks := map[string]*todo.Task{}
+  for _, task := range items {
+    if key := task.Meta[metaJira]; key != "" {
+      tasks[key] = task
+    }
+  }
+  completed := map[string]bool{}
+  if twoWay {
+    done, err := s.client.Completed(s.ctx, s.todoId, time.Now().AddDate(0, 0, -30), time.Time{})
+    if err != nil {
+      return fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+    }
+    for _, task := range done {
+      if key := task.Meta[metaJira]; key != "" && tasks[key] == nil {
+        completed[key] = true
+      }
+    }
+  }
+  sprintTags := map[string]bool{}
+  for _, issue := range issues {
+    for _, sprint := range issue.sprints {
+      sprintTags[sprintTag(sprint.Name)] = true
+    }
+  }
+
+  added, updated, resolved := 0, 0, 0
+  var finished []*todo.Task
+  for _, issue := range issues {
+    task, ok := tasks[issue.Key]
+    due := issue.due()
+    switch {
+    case issue.done():
+      if ok {
+        finished = append(finished, task)
+      }
+    case completed[issue.Key]:
+      if err := j.resolve(s.ctx, issue.Key); err != nil {
+        return err
+      }
+      infof("Issue %s resolved, its task was completed", issue.Key)
+      resolved++
+    case !ok:
+      task = &todo.Task{Title: issue.Fields.Summary, Due: due,
+        Notes: strings.TrimSuffix(j.base.String(), "/") + "/browse/" + issue.Key,
+        Tags:  jiraTags(nil, issue, sprintTags), Meta: map[string]string{metaJira: issue.Key}}
+      if _, err := s.insert(task); err != nil {
+        return fmt.Errorf("Could not create task %w", err)
+      }
+      infof("Task '%s' added for %s", task.Title, issue.Key)
+      added++
+    default:
+      if twoWay && !task.Due.Equal(due) && task.Updated.After(issue.updated()) {
+        if err := j.setDue(s.ctx, issue.Key, task.Due); err != nil {
+          return err
+        }
+        infof("Due date of %s set to that of '%s'", issue.Key, task.Title)
+        due = task.Due
+      }
+      patch := &todo.Patch{}
+      if task.Title != issue.Fields.Summary {
+        patch.Title = &issue.Fields.Summary
+      }
+      if !task.Due.Equal(due) {
+        patch.Due = &due
+      }
+      if tags := jiraTags(task.Tags, issue, sprintTags); strings.Join(tags, ",") != strings.Join(task.Tags, ",") {
+        patch.Tags = &tags
+      }
+      if patch.Empty() {
+        continue
+      }
+      if _, err := s.update(task, patch); err != nil {
+        return err
+      }
+      infof("Task '%s' updated for %s", issue.Fields.Summary, issue.Key)
+      updated++
+    }
+  }
+  err = s.mutateAll(opComplete, finished, func(task *todo.Task) {
+    infof("Task '%s' completed, %s is done", task.Title, task.Meta[metaJira])
+  })
+  if err != nil {
+    return err
+  }
+  if twoWay {
+    infof("%d added, %d updated and %d completed, %s resolved", added, updated, len(finished), plural(resolved, "issue"))
+  } else {
+    infof("%d added, %d updated and %d completed", added, updated, len(finished))
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "jira",
+    usage:   "jira sync [--two-way]",
+    summary: "Pull the Jira issues assigned to you into your todo list",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      twoWay := fs.Bool("two-way", false, "also send due dates and completions back to Jira")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 || args[0] != "sync" {
+        return invalidf("Unknown jira command, see 'todo help jira'")
+      }
+      c := loadConfig()
+      if c.JiraURL == "" || c.JiraToken == "" {
+        return invalidf("Set jira_url and jira_token, and jira_email on Jira Cloud, see 'todo config'")
+      }
+      base, err := url.Parse(c.JiraURL)
+      if err != nil || base.Scheme != "http" && base.Scheme != "https" {
+        return invalidf("Invalid jira_url '%s', expected e.g. https://example.atlassian.net", c.JiraURL)
+      }
+      field := c.JiraSprintField
+      if field == "" {
+        field = defaultSprintField
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      j := &jiraClient{base: base, email: c.JiraEmail, token: c.JiraToken, sprintField: field,
+        client: &http.Client{Transport: retryTransport(http.DefaultTransport)}}
+      return syncJira(s, j, *twoWay)
+    },
+  })
+}
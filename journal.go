@@ -0,0 +1,259 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// maxJournal is how many operations the journal remembers
+const maxJournal = 50
+
+// journalEntry records a change made to a task, with the task as it was
+// before and after it, so that the change can be undone. Before is nil
+// for additions and After for completions and deletions
+type journalEntry struct {
+  Op     string     `json:"op"`
+  List   string     `json:"list"`
+  ListId string     `json:"listId"`
+  Before *todo.Task `json:"before,omitempty"`
+  After  *todo.Task `json:"after,omitempty"`
+  Time   time.Time  `json:"time"`
+}
+
+// journalFile returns the path of the journal of the current account
+func journalFile() (string, error) {
+  dir, err := dataDir("journal")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, stateName()+".json"), nil
+}
+
+// loadJournal reads the journal, oldest entry first. A missing or
+// unreadable journal is empty
+func loadJournal() []journalEntry {
+  file, err := journalFile()
+  if err != nil {
+    return nil
+  }
+  b, err := readPrivate(file)
+  if err != nil {
+    return nil
+  }
+  var entries []journalEntry
+  if err := json.Unmarshal(b, &entries); err != nil {
+    return nil
+  }
+  return entries
+}
+
+// saveJournal replaces the journal with entries, keeping only the most
+// recent maxJournal of them
+func saveJournal(entries []journalEntry) error {
+  if len(entries) > maxJournal {
+    entries = entries[len(entries)-maxJournal:]
+  }
+  file, err := journalFile()
+  if err != nil {
+    return err
+  }
+  b, err := json.MarshalIndent(entries, "", "  ")
+  if err != nil {
+    return err
+  }
+  return writePrivate(file, b)
+}
+
+// record adds an operation made in the session to the journal, warning on
+// failure since the operation itself succeeded
+func (s *session) record(op string, before *todo.Task, after *todo.Task) {
+  recordHookChange(op, s.listName, before, after)
+  entry := journalEntry{Op: op, List: s.listName, ListId: s.todoId, Before: before, After: after, Time: time.Now()}
+  if err := saveJournal(append(loadJournal(), entry)); err != nil {
+    warnf("Unable to record operation for undo: %v", err)
+  }
+}
+
+// id returns the id of the task the entry is about
+func (e *journalEntry) id() string {
+  if e.After != nil {
+    return e.After.ID
+  }
+  return e.Before.ID
+}
+
+// undoCached reverses e in the cache c alone, which is possible as long as
+// the operation has not reached Google Tasks yet. It reports whether it
+// did so
+func undoCached(c *cachedList, e *journalEntry) bool {
+  id := e.id()
+  if strings.HasPrefix(id, localIdPrefix) {
+    switch e.Op {
+    case opAdd:
+      if !c.hasPendingAdd(id) {
+        return false
+      }
+      c.removePendingAdd(id)
+      c.removeItem(id)
+    case opEdit:
+      if !c.hasPendingAdd(id) {
+        return false
+      }
+      for _, op := range c.Pending {
+        if op.Op == opAdd && op.Task.ID == id {
+          *op.Task = *e.Before
+        }
+      }
+      c.replaceItem(e.Before)
+    default:
+      // the queued creation was dropped along with the task
+      c.Pending = append(c.Pending, pendingOp{Op: opAdd, Task: e.Before})
+      c.Items = append(c.Items, e.Before)
+    }
+    return true
+  }
+
+  for i := len(c.Pending) - 1; i >= 0; i-- {
+    op := c.Pending[i]
+    if op.Op != e.Op || op.Task.ID != id {
+      continue
+    }
+    c.Pending = append(c.Pending[:i], c.Pending[i+1:]...)
+    if e.Op == opEdit {
+      c.replaceItem(e.Before)
+    } else {
+      c.Items = append(c.Items, e.Before)
+    }
+    return true
+  }
+  return false
+}
+
+// hasPendingAdd reports whether the creation of the local task with the
+// given id is still queued
+func (c *cachedList) hasPendingAdd(id string) bool {
+  for _, op := range c.Pending {
+    if op.Op == opAdd && op.Task.ID == id {
+      return true
+    }
+  }
+  return false
+}
+
+// undoRemote reverses e against the Tasks API. Edits of tasks changed
+// since are only reverted with force set
+func undoRemote(s *session, e *journalEntry, force bool) error {
+  switch e.Op {
+  case opAdd:
+    err := s.client.Delete(s.ctx, s.todoId, e.After.ID)
+    if err != nil && err != todo.ErrNotFound {
+      return err
+    }
+  case opComplete:
+    if _, err := s.client.Uncomplete(s.ctx, s.todoId, e.Before.ID); err != nil {
+      return err
+    }
+  case opDelete:
+    if _, err := s.client.Add(s.ctx, s.todoId, e.Before); err != nil {
+      return err
+    }
+  case opEdit:
+    current, err := s.client.Get(s.ctx, s.todoId, e.Before.ID)
+    if err != nil {
+      return err
+    }
+    if current.Etag != e.After.Etag && !force {
+      return invalidf("'%s' changed since it was edited, use --force to revert it anyway", current.Title)
+    }
+    b := e.Before
+    due := b.Due
+    tags := b.Tags
+    blockedBy := b.BlockedBy
+    every := &todo.Recurrence{}
+    if b.Every != nil {
+      every = b.Every
+    }
+    patch := &todo.Patch{Title: &b.Title, Notes: &b.Notes, Due: &due, Priority: &b.Priority, Tags: &tags,
+      Every: every, Remind: &b.Remind, Snooze: &b.Snooze, BlockedBy: &blockedBy, Starred: &b.Starred}
+    if _, err := s.client.Update(s.ctx, s.todoId, b.ID, patch); err != nil {
+      return err
+    }
+  }
+  _, err := s.items()
+  return err
+}
+
+// describe returns a short description of the operation e undoes
+func (e *journalEntry) describe() string {
+  verbs := map[string]string{opAdd: "adding", opComplete: "completing", opDelete: "deleting", opEdit: "editing"}
+  title := e.Before
+  if title == nil {
+    title = e.After
+  }
+  return fmt.Sprintf("%s '%s' in your %s list", verbs[e.Op], title.Title, e.List)
+}
+
+// Reverses the most recent operation in the journal and drops it from
+// there
+func undoLast(force bool) error {
+  entries := loadJournal()
+  if len(entries) == 0 {
+    return notFoundf("Nothing to undo")
+  }
+  e := entries[len(entries)-1]
+
+  c := loadCache(e.List)
+  if c.ListId == e.ListId && undoCached(c, &e) {
+    if err := c.save(e.List); err != nil {
+      return fmt.Errorf("Unable to update local cache: %w", err)
+    }
+  } else {
+    listFlag = e.List
+    s, err := newSession()
+    if err != nil {
+      return err
+    }
+    if s.todoId != e.ListId {
+      return notFoundf("Your %s list was recreated, can not undo %s", e.List, e.describe())
+    }
+    if s.offline {
+      return &exitError{code: exitNetwork, err: fmt.Errorf("Unable to reach Google Tasks to undo %s", e.describe())}
+    }
+    if strings.HasPrefix(e.id(), localIdPrefix) {
+      return invalidf("Can not undo %s, the task has been synced since", e.describe())
+    }
+    if err := undoRemote(s, &e, force); err != nil {
+      return fmt.Errorf("Could not undo %s: %w", e.describe(), err)
+    }
+  }
+
+  if err := saveJournal(entries[:len(entries)-1]); err != nil {
+    return fmt.Errorf("Unable to update journal: %w", err)
+  }
+  if e.Op == opDelete {
+    untrash(e.Before.ID)
+  }
+  infof("Undid %s", e.describe())
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "undo",
+    usage:   "undo [--force]",
+    summary: "Reverse the most recent add, done, rm or edit",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      force := fs.Bool("force", false, "revert an edit even if the task changed since")
+      if _, err := parseFlags(fs, args); err != nil {
+        return err
+      }
+      return undoLast(*force)
+    },
+  })
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "net/url"
+  "os"
+  "path/filepath"
+
+  "github.com/zalando/go-keyring"
+  "golang.org/x/oauth2"
+)
+
+// Token stores selectable with token_store
+const (
+  tokenStoreFile    = "file"
+  tokenStoreKeyring = "keyring"
+)
+
+// keyringService is the service name tokens are stored under in the
+// system keyring, keyed by account name
+const keyringService = "todo"
+
+// keyringMarker is the suffix of the files recording which accounts keep
+// their token in the system keyring, since keyrings can not be listed
+const keyringMarker = ".keyring"
+
+// useKeyring reports whether tokens should be kept in the system keyring
+func useKeyring() bool {
+  return loadConfig().TokenStore == tokenStoreKeyring
+}
+
+// loadToken retrieves the cached token of the current account, from the
+// system keyring if configured and otherwise, or if the keyring is
+// unavailable, from the token file
+func loadToken() (*oauth2.Token, error) {
+  if useKeyring() {
+    secret, err := keyring.Get(keyringService, currentAccount())
+    if err == nil {
+      tok := &oauth2.Token{}
+      return tok, json.Unmarshal([]byte(secret), tok)
+    }
+    if err != keyring.ErrNotFound {
+      warnf("System keyring unavailable, using credential file: %v", err)
+    }
+  }
+  file, err := tokenCacheFile()
+  if err != nil {
+    return nil, fmt.Errorf("Unable to get path to cached credential file. %w", err)
+  }
+  return tokenFromFile(file)
+}
+
+// storeToken caches the token of the current account in the system
+// keyring if configured, falling back to the token file
+func storeToken(tok *oauth2.Token) error {
+  if useKeyring() {
+    err := saveTokenToKeyring(tok)
+    if err == nil {
+      infof("Saved credentials of account '%s' to the system keyring", currentAccount())
+      return nil
+    }
+    warnf("System keyring unavailable, using credential file: %v", err)
+  }
+  file, err := tokenCacheFile()
+  if err != nil {
+    return fmt.Errorf("Unable to get path to cached credential file. %w", err)
+  }
+  return saveToken(file, tok)
+}
+
+// saveTokenToKeyring stores tok in the system keyring and records that
+// the current account keeps its token there
+func saveTokenToKeyring(tok *oauth2.Token) error {
+  b, err := json.Marshal(tok)
+  if err != nil {
+    return err
+  }
+  account := currentAccount()
+  if err := keyring.Set(keyringService, account, string(b)); err != nil {
+    return err
+  }
+  dir, err := accountsDir()
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(filepath.Join(dir, url.QueryEscape(account)+keyringMarker), nil, 0600)
+}
+
+// deleteToken forgets the cached token of the current account, in the
+// system keyring and the token file
+func deleteToken() error {
+  account := currentAccount()
+  dir, err := accountsDir()
+  if err != nil {
+    return err
+  }
+  marker := filepath.Join(dir, url.QueryEscape(account)+keyringMarker)
+  if _, err := os.Stat(marker); err == nil {
+    if err := keyring.Delete(keyringService, account); err != nil && err != keyring.ErrNotFound {
+      return fmt.Errorf("Unable to delete credentials from the system keyring: %w", err)
+    }
+    os.Remove(marker)
+  }
+  file, err := tokenCacheFile()
+  if err != nil {
+    return fmt.Errorf("Unable to get path to cached credential file. %w", err)
+  }
+  if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+    return fmt.Errorf("Unable to delete cached credential file: %w", err)
+  }
+  return nil
+}
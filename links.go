@@ -0,0 +1,81 @@
+package main
+
+import (
+  "fmt"
+  "net/url"
+  "regexp"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// linkPattern finds the URLs in notes, punctuation ending a sentence aside
+var linkPattern = regexp.MustCompile(`\bhttps?://[^\s<>()\[\]"'` + "`" + `]+[^\s<>()\[\]"'` + "`" + `.,;:!?]`)
+
+// taskLinks returns the URLs of the notes of task, in order
+func taskLinks(task *todo.Task) []string {
+  return linkPattern.FindAllString(task.Notes, -1)
+}
+
+// checkLink reports whether link is an absolute http or https URL, as
+// given to add --link
+func checkLink(link string) error {
+  u, err := url.Parse(link)
+  if err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+    return invalidf("Invalid link '%s', expected an http or https URL", link)
+  }
+  return nil
+}
+
+// Opens the first link in the notes of the todo item at the given index in
+// the browser or, with web set or without links, the task in Google Tasks
+func openTodoItem(s *session, arg string, web bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  link := ""
+  if links := taskLinks(task); len(links) > 0 && !web {
+    link = links[0]
+  } else if task.WebLink != "" {
+    link = task.WebLink
+  }
+  if link == "" {
+    if web {
+      return notFoundf("Task '%s' has no web view, only Google Tasks offers one", task.Title)
+    }
+    return notFoundf("Task '%s' has no link in its notes", task.Title)
+  }
+  infof("Opening %s", link)
+  if err := openBrowser(link); err != nil {
+    return fmt.Errorf("Unable to open a browser: %w", err)
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "open",
+    usage:   "open [--web] <index>",
+    summary: "Open the first link in a task's notes, or the task in Google Tasks, in your browser",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      web := fs.Bool("web", false, "open the task in Google Tasks even if its notes have links")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 {
+        return invalidf("Expected exactly one task index, see 'todo help open'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return openTodoItem(s, args[0], *web)
+    },
+  })
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+  "fmt"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// Lists the user's task lists to stdout, marking the current one
+func listTaskLists(ctx context.Context, client todo.Backend) error {
+  lists, err := client.Lists(ctx)
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve task lists. %w", err)
+  }
+  current := currentList()
+  for _, list := range lists {
+    marker := " "
+    if list.Title == current {
+      marker = "*"
+    }
+    fmt.Printf("%s %s\n", marker, list.Title)
+  }
+  return nil
+}
+
+// lookupList returns the id of the task list with the given name, failing
+// if there is none
+func lookupList(ctx context.Context, client todo.Backend, name string) (string, error) {
+  id, err := getTodoId(ctx, client, name, false)
+  if err == todo.ErrNotFound {
+    return "", notFoundf("No task list named '%s'", name)
+  }
+  if err != nil {
+    return "", fmt.Errorf("Unable to retrieve task lists. %w", err)
+  }
+  return id, nil
+}
+
+func init() {
+  register(&command{
+    name:  "lists",
+    usage: "lists [create <name> | delete [--force] <name> | rename <old> <new> | default <name>]",
+    summary: "Show your task lists, or create, delete, rename them " +
+      "or pick the default one",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      force := fs.Bool("force", false, "delete without asking for confirmation")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+
+      if len(args) > 0 {
+        want := map[string]int{"create": 2, "delete": 2, "rename": 3, "default": 2}
+        n, ok := want[args[0]]
+        if !ok {
+          return invalidf("Unknown lists command '%s', see 'todo help lists'", args[0])
+        }
+        if len(args) != n {
+          return invalidf("Wrong number of arguments for 'lists %s', see 'todo help lists'", args[0])
+        }
+      }
+
+      if len(args) > 0 && args[0] == "default" {
+        c, err := loadConfigFile()
+        if err != nil {
+          return err
+        }
+        c.DefaultList = args[1]
+        if err := c.save(); err != nil {
+          return fmt.Errorf("Unable to save config file: %w", err)
+        }
+        infof("Default list set to %s", args[1])
+        return nil
+      }
+
+      ctx := cmdCtx
+      client, err := newClient()
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return listTaskLists(ctx, client)
+      }
+
+      switch args[0] {
+      case "create":
+        if _, err := getTodoId(ctx, client, args[1], false); err == nil {
+          return invalidf("A task list named '%s' already exists", args[1])
+        }
+        if _, err := client.CreateList(ctx, args[1]); err != nil {
+          return fmt.Errorf("Could not create task list %w", err)
+        }
+        infof("Task list '%s' created", args[1])
+      case "delete":
+        id, err := lookupList(ctx, client, args[1])
+        if err != nil {
+          return err
+        }
+        if !*force && !confirmf("Delete task list '%s' and all of its tasks?", args[1]) {
+          return nil
+        }
+        if err := client.DeleteList(ctx, id); err != nil {
+          return fmt.Errorf("Could not delete task list %w", err)
+        }
+        infof("Task list '%s' deleted", args[1])
+      case "rename":
+        id, err := lookupList(ctx, client, args[1])
+        if err != nil {
+          return err
+        }
+        if _, err := client.RenameList(ctx, id, args[2]); err != nil {
+          return fmt.Errorf("Could not rename task list %w", err)
+        }
+        infof("Task list '%s' renamed to '%s'", args[1], args[2])
+      }
+      return nil
+    },
+  })
+}
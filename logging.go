@@ -0,0 +1,110 @@
+package main
+
+import (
+  "fmt"
+  "net/http"
+  "os"
+  "sort"
+  "strings"
+  "time"
+)
+
+// Levels of how much todo tells about what it does. Output asked for,
+// such as listings, warnings and errors are always printed
+const (
+  // levelQuiet, with --quiet, leaves out reports of what was changed
+  levelQuiet = iota
+  // levelNormal reports what commands changed, such as added tasks
+  levelNormal
+  // levelVerbose, with --verbose, also logs HTTP requests, retries and
+  // use of the cache
+  levelVerbose
+  // levelDebug, with --debug, also logs the headers of HTTP requests
+  // and responses
+  levelDebug
+)
+
+// Flags selecting the log level
+var (
+  quietFlag   bool
+  verboseFlag bool
+  debugFlag   bool
+)
+
+// logLevel returns the level selected with --quiet, --verbose or --debug
+func logLevel() int {
+  switch {
+  case debugFlag:
+    return levelDebug
+  case verboseFlag:
+    return levelVerbose
+  case quietFlag:
+    return levelQuiet
+  }
+  return levelNormal
+}
+
+// infof reports on stdout what a command did, unless --quiet is given
+func infof(format string, a ...interface{}) {
+  if logLevel() >= levelNormal {
+    fmt.Printf(tr(format)+"\n", a...)
+  }
+}
+
+// warnf tells on stderr about a problem todo worked around
+func warnf(format string, a ...interface{}) {
+  fmt.Fprintf(os.Stderr, tr(format)+"\n", a...)
+}
+
+// verbosef logs on stderr with --verbose or --debug
+func verbosef(format string, a ...interface{}) {
+  if logLevel() >= levelVerbose {
+    fmt.Fprintln(os.Stderr, colorize("2", fmt.Sprintf(format, a...)))
+  }
+}
+
+// debugf logs on stderr with --debug
+func debugf(format string, a ...interface{}) {
+  if logLevel() >= levelDebug {
+    fmt.Fprintln(os.Stderr, colorize("2", fmt.Sprintf(format, a...)))
+  }
+}
+
+// logTransport logs the requests sent through base and their responses
+type logTransport struct {
+  base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  logHeaders("> ", req.Header)
+  start := time.Now()
+  res, err := t.base.RoundTrip(req)
+  took := time.Since(start).Round(time.Millisecond)
+  if err != nil {
+    verbosef("%s %s failed after %s: %v", req.Method, req.URL.Redacted(), took, err)
+    return nil, err
+  }
+  verbosef("%s %s: %s in %s", req.Method, req.URL.Redacted(), res.Status, took)
+  logHeaders("< ", res.Header)
+  return res, nil
+}
+
+// logHeaders logs header with --debug, hiding credentials
+func logHeaders(prefix string, header http.Header) {
+  if logLevel() < levelDebug {
+    return
+  }
+  var names []string
+  for name := range header {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  for _, name := range names {
+    value := strings.Join(header[name], ", ")
+    if name == "Authorization" || name == "Cookie" || name == "Set-Cookie" {
+      value = "(hidden)"
+    }
+    debugf("%s%s: %s", prefix, name, value)
+  }
+}
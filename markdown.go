@@ -0,0 +1,103 @@
+package main
+
+import (
+  "regexp"
+  "strings"
+)
+
+// Inline Markdown rendered by renderInline, applied in this order so code
+// spans are not searched for emphasis
+var (
+  mdCode   = regexp.MustCompile("`([^`]+)`")
+  mdLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+  mdAuto   = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+  mdStrong = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+  mdEm     = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\s][^*_]*)[*_]`)
+)
+
+// Block level Markdown rendered by renderMarkdown
+var (
+  mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+  mdCheck   = regexp.MustCompile(`^(\s*)[-*+]\s+\[([ xX])\]\s+(.*)$`)
+  mdBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+  mdQuote   = regexp.MustCompile(`^>\s?(.*)$`)
+  mdRule    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+)
+
+// renderMarkdown renders the Markdown of notes for the terminal: headings
+// in bold, checklists with boxes, bullets, quotes, rules, indented code
+// blocks and inline code, emphasis and links. Without color the markup is
+// still replaced by the layout it stands for
+func renderMarkdown(notes string) string {
+  var out []string
+  fenced := false
+  for _, line := range strings.Split(notes, "\n") {
+    if strings.HasPrefix(strings.TrimSpace(line), "```") {
+      fenced = !fenced
+      continue
+    }
+    if fenced {
+      out = append(out, "    "+colorize("36", line))
+      continue
+    }
+    if m := mdHeading.FindStringSubmatch(line); m != nil {
+      out = append(out, colorize("1", renderInline(m[2])))
+      continue
+    }
+    if mdRule.MatchString(line) {
+      out = append(out, colorize("2", strings.Repeat("─", 40)))
+      continue
+    }
+    if m := mdCheck.FindStringSubmatch(line); m != nil {
+      if m[2] == " " {
+        out = append(out, m[1]+"☐ "+renderInline(m[3]))
+      } else {
+        out = append(out, m[1]+colorize("2", "☑ "+m[3]))
+      }
+      continue
+    }
+    if m := mdBullet.FindStringSubmatch(line); m != nil {
+      out = append(out, m[1]+"• "+renderInline(m[2]))
+      continue
+    }
+    if m := mdQuote.FindStringSubmatch(line); m != nil {
+      out = append(out, colorize("2", "│ ")+colorize("3", renderInline(m[1])))
+      continue
+    }
+    out = append(out, renderInline(line))
+  }
+  return strings.Join(out, "\n")
+}
+
+// renderInline renders the code spans, links and emphasis of a line.
+// Links show their text, underlined, followed by their URL
+func renderInline(line string) string {
+  // code spans are set aside so their content is left alone
+  var spans []string
+  line = mdCode.ReplaceAllStringFunc(line, func(s string) string {
+    spans = append(spans, colorize("36", mdCode.FindStringSubmatch(s)[1]))
+    return "\x00"
+  })
+  line = mdLink.ReplaceAllStringFunc(line, func(s string) string {
+    m := mdLink.FindStringSubmatch(s)
+    if m[1] == m[2] {
+      return colorize("4", m[2])
+    }
+    return colorize("4", m[1]) + " " + colorize("2", "("+m[2]+")")
+  })
+  line = mdAuto.ReplaceAllStringFunc(line, func(s string) string {
+    return colorize("4", mdAuto.FindStringSubmatch(s)[1])
+  })
+  line = mdStrong.ReplaceAllStringFunc(line, func(s string) string {
+    m := mdStrong.FindStringSubmatch(s)
+    return colorize("1", m[1]+m[2])
+  })
+  line = mdEm.ReplaceAllStringFunc(line, func(s string) string {
+    m := mdEm.FindStringSubmatch(s)
+    return m[1] + colorize("3", m[2])
+  })
+  for _, span := range spans {
+    line = strings.Replace(line, "\x00", span, 1)
+  }
+  return line
+}
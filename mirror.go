@@ -0,0 +1,271 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// metaSync is the metadata key holding the stable id of a task copied
+// between backends: the id the task has in the backend it was created in
+const metaSync = "sync"
+
+// syncKey returns the stable id of task, shared by all its copies
+func syncKey(task *todo.Task) string {
+  if key := task.Meta[metaSync]; key != "" {
+    return key
+  }
+  return task.ID
+}
+
+// mirrorSide is a backend taking part in a sync, with the tasks of the
+// synced list in it by stable id
+type mirrorSide struct {
+  name   string
+  client todo.Backend
+  listId string
+  tasks  map[string]*todo.Task
+  // order holds the stable ids in list order, parents first
+  order []string
+}
+
+// loadMirrorSide loads the list named listName from the backend with the
+// given name, creating the list if it does not exist yet
+func loadMirrorSide(ctx context.Context, name string, listName string) (*mirrorSide, error) {
+  client, err := newBackend(name)
+  if err != nil {
+    return nil, err
+  }
+  listId, err := getTodoId(ctx, client, listName, true)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve the %s list from %s: %w", listName, name, err)
+  }
+  open, err := client.List(ctx, listId)
+  if err != nil {
+    return nil, err
+  }
+  done, err := client.Completed(ctx, listId, time.Time{}, time.Time{})
+  if err != nil {
+    return nil, err
+  }
+  side := &mirrorSide{name: name, client: client, listId: listId, tasks: map[string]*todo.Task{}}
+  for _, task := range append(open, done...) {
+    key := syncKey(task)
+    if _, ok := side.tasks[key]; !ok {
+      side.tasks[key] = task
+      side.order = append(side.order, key)
+    }
+  }
+  return side, nil
+}
+
+// byID returns the task of side with the given backend id, or nil
+func (side *mirrorSide) byID(id string) *todo.Task {
+  for _, task := range side.tasks {
+    if task.ID == id {
+      return task
+    }
+  }
+  return nil
+}
+
+// mirrorStats counts the changes made by a sync
+type mirrorStats struct {
+  created, updated, deleted int
+}
+
+// mirror copies the tasks of one backend to another. Changes are
+// printed as they are made
+type mirror struct {
+  ctx   context.Context
+  stats mirrorStats
+}
+
+// create copies task of src to dst, as a subtask if its parent has a copy
+// in dst already
+func (m *mirror) create(src *mirrorSide, dst *mirrorSide, key string, task *todo.Task) error {
+  c := *task
+  c.ID, c.Position, c.Etag, c.Parent = "", "", "", ""
+  // the ids of blocking tasks mean nothing in dst
+  c.BlockedBy = nil
+  if parent := src.byID(task.Parent); parent != nil {
+    if p, ok := dst.tasks[syncKey(parent)]; ok {
+      c.Parent = p.ID
+    }
+  }
+  c.Meta = map[string]string{}
+  for k, v := range task.Meta {
+    c.Meta[k] = v
+  }
+  c.Meta[metaSync] = key
+  created, err := dst.client.Add(m.ctx, dst.listId, &c)
+  if err != nil {
+    return fmt.Errorf("Unable to create '%s' in %s: %w", task.Title, dst.name, err)
+  }
+  dst.tasks[key] = created
+  m.stats.created++
+  infof("Created '%s' in %s", task.Title, dst.name)
+  return nil
+}
+
+// update makes the copy of task in dst match it
+func (m *mirror) update(dst *mirrorSide, key string, task *todo.Task) error {
+  current := dst.tasks[key]
+  var err error
+  if patch := mirrorPatch(current, task); !patch.Empty() {
+    if current, err = dst.client.Update(m.ctx, dst.listId, current.ID, patch); err != nil {
+      return fmt.Errorf("Unable to update '%s' in %s: %w", task.Title, dst.name, err)
+    }
+  }
+  if task.Done() != current.Done() {
+    if task.Done() {
+      current, err = dst.client.Complete(m.ctx, dst.listId, current.ID)
+    } else {
+      current, err = dst.client.Uncomplete(m.ctx, dst.listId, current.ID)
+    }
+    if err != nil {
+      return fmt.Errorf("Unable to update '%s' in %s: %w", task.Title, dst.name, err)
+    }
+  }
+  dst.tasks[key] = current
+  m.stats.updated++
+  infof("Updated '%s' in %s", task.Title, dst.name)
+  return nil
+}
+
+// remove deletes the copy of a task deleted from the other backend
+func (m *mirror) remove(dst *mirrorSide, key string) error {
+  task := dst.tasks[key]
+  if err := dst.client.Delete(m.ctx, dst.listId, task.ID); err != nil && err != todo.ErrNotFound {
+    return fmt.Errorf("Unable to delete '%s' from %s: %w", task.Title, dst.name, err)
+  }
+  delete(dst.tasks, key)
+  m.stats.deleted++
+  infof("Deleted '%s' from %s", task.Title, dst.name)
+  return nil
+}
+
+// mirrorPatch returns the changes that make dst match src
+func mirrorPatch(dst *todo.Task, src *todo.Task) *todo.Patch {
+  p := &todo.Patch{}
+  if dst.Title != src.Title {
+    p.Title = &src.Title
+  }
+  if dst.Notes != src.Notes {
+    p.Notes = &src.Notes
+  }
+  if !dst.Due.Equal(src.Due) {
+    p.Due = &src.Due
+  }
+  if dst.Priority != src.Priority {
+    p.Priority = &src.Priority
+  }
+  if strings.Join(dst.Tags, ",") != strings.Join(src.Tags, ",") {
+    tags := src.Tags
+    p.Tags = &tags
+  }
+  if recurrenceString(dst.Every) != recurrenceString(src.Every) {
+    p.Every = &todo.Recurrence{}
+    if src.Every != nil {
+      p.Every = src.Every
+    }
+  }
+  if dst.Remind != src.Remind {
+    p.Remind = &src.Remind
+  }
+  if !dst.Snooze.Equal(src.Snooze) {
+    p.Snooze = &src.Snooze
+  }
+  if dst.Starred != src.Starred {
+    p.Starred = &src.Starred
+  }
+  // BlockedBy is left alone, as for create
+  return p
+}
+
+// recurrenceString returns the rule of r, or "" if it is nil
+func recurrenceString(r *todo.Recurrence) string {
+  if r == nil {
+    return ""
+  }
+  return r.String()
+}
+
+// differs reports whether the copies a and b of a task disagree
+func differs(a *todo.Task, b *todo.Task) bool {
+  return !mirrorPatch(a, b).Empty() || a.Done() != b.Done()
+}
+
+// syncBackends reconciles the list named listName in the backends from and
+// to. Tasks are matched by their stable id. Tasks of from missing in to
+// are created there, copies differing from their original are updated and
+// copies whose original was deleted are deleted. With twoWay set, changes
+// flow in both directions and the most recently modified copy of a task
+// wins when the copies disagree
+func syncBackends(ctx context.Context, from string, to string, listName string, twoWay bool) (mirrorStats, error) {
+  m := &mirror{ctx: ctx}
+  src, err := loadMirrorSide(ctx, from, listName)
+  if err != nil {
+    return m.stats, err
+  }
+  dst, err := loadMirrorSide(ctx, to, listName)
+  if err != nil {
+    return m.stats, err
+  }
+
+  // remember which tasks were there before any were created, so new
+  // copies are not mistaken for tasks to create in the other direction
+  srcKeys, dstKeys := src.order, dst.order
+  for _, key := range srcKeys {
+    task := src.tasks[key]
+    copied, ok := dst.tasks[key]
+    switch {
+    case !ok && task.Meta[metaSync] != "" && twoWay:
+      // a copy whose original was deleted from to
+      if err := m.remove(src, key); err != nil {
+        return m.stats, err
+      }
+    case !ok:
+      if err := m.create(src, dst, key, task); err != nil {
+        return m.stats, err
+      }
+    case !differs(copied, task):
+    case twoWay && copied.Updated.After(task.Updated):
+      if err := m.update(src, key, copied); err != nil {
+        return m.stats, err
+      }
+    default:
+      if err := m.update(dst, key, task); err != nil {
+        return m.stats, err
+      }
+    }
+  }
+  for _, key := range dstKeys {
+    task, ok := dst.tasks[key]
+    if !ok {
+      continue
+    }
+    if _, ok := src.tasks[key]; ok {
+      continue
+    }
+    switch {
+    case task.Meta[metaSync] != "":
+      // a copy whose original was deleted from from
+      if err := m.remove(dst, key); err != nil {
+        return m.stats, err
+      }
+    case twoWay:
+      if err := m.create(dst, src, key, task); err != nil {
+        return m.stats, err
+      }
+    }
+  }
+  return m.stats, nil
+}
+
+func (st mirrorStats) String() string {
+  return fmt.Sprintf("%d created, %d updated, %d deleted", st.created, st.updated, st.deleted)
+}
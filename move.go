@@ -0,0 +1,114 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// findOne resolves query to a single task of items, failing if it matches
+// none or several
+func findOne(s *session, items []*todo.Task, query string) (*todo.Task, error) {
+  matches, err := s.find(items, query)
+  if err != nil {
+    return nil, err
+  }
+  if len(matches) == 0 {
+    return nil, notFoundf("No task in your %s list matches '%s'", s.listName, query)
+  }
+  if len(matches) > 1 {
+    return nil, invalidf("'%s' matches %d tasks, use its index instead", query, len(matches))
+  }
+  return matches[0], nil
+}
+
+// Moves the todo item matching query, along with its subtasks, after the
+// task matching after, which it becomes a sibling of, to the top of the
+// task list named toList, or else to the top of its list
+func moveTodoItem(s *session, query string, after string, toList string) error {
+  if s.offline {
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Moving tasks is not queued while offline, try again once %s can be reached", currentBackend())}
+  }
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := findOne(s, items, query)
+  if err != nil {
+    return err
+  }
+
+  var dest todo.Destination
+  where := "to the top of your " + s.listName + " list"
+  switch {
+  case toList != "":
+    if dest.ListID, err = getTodoId(s.ctx, s.client, toList, false); err == todo.ErrNotFound {
+      return notFoundf("No task list named '%s', see 'todo lists'", toList)
+    } else if err != nil {
+      return err
+    }
+    if dest.ListID == s.todoId {
+      return invalidf("'%s' already is in your %s list", task.Title, toList)
+    }
+    where = "to your " + toList + " list"
+  case after != "":
+    prev, err := findOne(s, items, after)
+    if err != nil {
+      return err
+    }
+    for _, sub := range append(subtasks(items, task), task) {
+      if sub == prev {
+        return invalidf("Can not move '%s' after itself or one of its subtasks", task.Title)
+      }
+    }
+    dest = todo.Destination{Parent: prev.Parent, Previous: prev.ID}
+    where = fmt.Sprintf("after '%s'", prev.Title)
+  }
+
+  if _, err := s.client.Move(s.ctx, s.todoId, task.ID, dest); err != nil {
+    return fmt.Errorf("Unable to move task '%s': %w", task.Title, err)
+  }
+  // positions of other tasks may have changed too
+  if _, err := s.items(); err != nil {
+    return err
+  }
+  infof("Task '%s' moved %s", task.Title, where)
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "move",
+    aliases: []string{"mv"},
+    usage:   "move <index|title> (--after index | --top | --to-list name)",
+    summary: "Reorder a task within its list or move it to another list",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      after := fs.String("after", "", "index or title of the task to place it after")
+      top := fs.Bool("top", false, "place it first in the list")
+      toList := fs.String("to-list", "", "task list to move it to, at the top")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return invalidf("Missing task index or title, see 'todo help move'")
+      }
+      given := 0
+      for _, set := range []bool{*after != "", *top, *toList != ""} {
+        if set {
+          given++
+        }
+      }
+      if given != 1 {
+        return invalidf("Give exactly one of --after, --top and --to-list")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return moveTodoItem(s, strings.Join(args, " "), *after, *toList)
+    },
+  })
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// Prints all details of the todo item at the given index, including its
+// notes with their Markdown rendered unless raw is set, or the task as
+// JSON with output set to json
+func showTodoItem(s *session, arg string, raw bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  if loadConfig().Output == outputJSON {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(task)
+  }
+
+  field := func(name string, value string) {
+    fmt.Printf("%s %s\n", colorize("2", fmt.Sprintf("%-10s", tr(name)+":")), value)
+  }
+  fmt.Println(colorize("1", task.Title))
+  field("List", s.listName)
+  field("ID", shortID(task.ID))
+  for _, parent := range items {
+    if parent.ID == task.Parent {
+      field("Subtask of", parent.Title)
+    }
+  }
+  if n := len(subtasks(items, task)); n > 0 {
+    field("Subtasks", fmt.Sprint(n))
+  }
+  if task.Starred {
+    field("Starred", "yes")
+  }
+  if task.Priority != todo.PriorityNone {
+    field("Priority", task.Priority.String())
+  }
+  if !task.Due.IsZero() {
+    field("Due", formatDate(task.Due))
+  }
+  if task.Every != nil {
+    field("Every", task.Every.String())
+  }
+  if task.Remind > 0 {
+    field("Remind", todo.FormatDuration(task.Remind)+" before")
+  }
+  if snoozed(task, time.Now()) {
+    field("Snoozed", "until "+formatDate(task.Snooze))
+  }
+  for _, b := range blockers(items, task) {
+    field("Blocked by", b.Title)
+  }
+  if entries, err := loadTimeLog(); err != nil {
+    warnf("%v", err)
+  } else if spent := timeSpent(entries, task.ID, time.Now()); spent > 0 {
+    field("Time", formatSpent(spent))
+  }
+  if len(task.Tags) > 0 {
+    field("Tags", formatTags(task.Tags))
+  }
+  if !task.Updated.IsZero() {
+    updated := task.Updated.Local()
+    field("Updated", formatDate(updated)+" "+updated.Format("15:04"))
+  }
+  if task.Notes != "" {
+    notes := task.Notes
+    if !raw {
+      notes = renderMarkdown(notes)
+    }
+    fmt.Printf("\n%s\n", notes)
+  }
+  return nil
+}
+
+// Appends text to the notes of the todo item at the given index, on a
+// line of its own
+func appendNote(s *session, arg string, text string) error {
+  text = strings.TrimSpace(text)
+  if text == "" {
+    return invalidf("Nothing to add to the notes")
+  }
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  notes := text
+  if task.Notes != "" {
+    notes = task.Notes + "\n" + text
+  }
+  if task, err = s.update(task, &todo.Patch{Notes: &notes}); err != nil {
+    return err
+  }
+  infof("Notes of task '%s' updated", task.Title)
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "show",
+    usage:   "show [--raw] <index>",
+    summary: "Show all details of a task, including its notes",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      raw := fs.Bool("raw", false, "print the notes as written instead of rendering their Markdown")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 {
+        return invalidf("Expected exactly one task index, see 'todo help show'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return showTodoItem(s, args[0], *raw)
+    },
+  })
+
+  register(&command{
+    name:    "note",
+    usage:   "note <index> [text]",
+    summary: "Append text, or what is read from stdin, to the notes of a task",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return invalidf("Missing task index, see 'todo help note'")
+      }
+      text := strings.Join(args[1:], " ")
+      if len(args) == 1 {
+        if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+          fmt.Fprintln(os.Stderr, "Type the note, then press Ctrl-D")
+        }
+        b, err := ioutil.ReadAll(os.Stdin)
+        if err != nil {
+          return fmt.Errorf("Unable to read the note: %w", err)
+        }
+        text = string(b)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return appendNote(s, args[0], text)
+    },
+  })
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+  "bytes"
+  "crypto/hmac"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/xml"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "os"
+  "path"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// gcsHost serves the XML API of Google Cloud Storage, which speaks the S3
+// protocol when signed with HMAC keys
+const gcsHost = "storage.googleapis.com"
+
+// bucketURLs describes the URLs of buckets in messages
+const bucketURLs = "s3://bucket/path, gs://bucket/path or https://host/bucket/path"
+
+// s3Store keeps objects under a prefix of a bucket of S3, Google Cloud
+// Storage or another service compatible with S3, addressed by path and
+// signed with AWS Signature Version 4. It holds scheduled backups by name
+type s3Store struct {
+  endpoint *url.URL
+  bucket   string
+  prefix   string
+  region   string
+  // gcs is set for Google Cloud Storage, which has its own headers for
+  // conditional writes
+  gcs bool
+}
+
+// parseS3URL parses the URL of a bucket and the path of an object or
+// prefix in it: s3://bucket/path for AWS, gs://bucket/path for Google
+// Cloud Storage or https://host/bucket/path for another S3-compatible
+// service, such as MinIO. Region is that of the bucket, if set
+func parseS3URL(value string, region string) (*s3Store, error) {
+  u, err := url.Parse(value)
+  if err != nil {
+    return nil, fmt.Errorf("expected a bucket URL, %s", bucketURLs)
+  }
+  // the region is settled first, as AWS endpoints are named after it
+  s := &s3Store{region: region}
+  s.gcs = u.Scheme == "gs" || (u.Scheme == "http" || u.Scheme == "https") && u.Host == gcsHost
+  switch {
+  case s.region != "":
+  case s.gcs:
+    s.region = "auto"
+  default:
+    s.region = "us-east-1"
+  }
+  var key string
+  switch u.Scheme {
+  case "s3":
+    s.endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%s.amazonaws.com", s.region)}
+    s.bucket, key = u.Host, u.Path
+  case "gs":
+    s.endpoint = &url.URL{Scheme: "https", Host: gcsHost}
+    s.bucket, key = u.Host, u.Path
+  case "http", "https":
+    s.endpoint = &url.URL{Scheme: u.Scheme, Host: u.Host}
+    parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+    s.bucket = parts[0]
+    if len(parts) == 2 {
+      key = parts[1]
+    }
+  }
+  if s.endpoint == nil || s.endpoint.Host == "" || s.bucket == "" {
+    return nil, fmt.Errorf("expected a bucket URL, %s", bucketURLs)
+  }
+  if s.prefix = strings.Trim(key, "/"); s.prefix != "" {
+    s.prefix += "/"
+  }
+  return s, nil
+}
+
+// isBucketURL reports whether value is the URL of an object in a bucket
+// rather than the path of a file
+func isBucketURL(value string) bool {
+  for _, scheme := range []string{"s3://", "gs://", "http://", "https://"} {
+    if strings.HasPrefix(value, scheme) {
+      return true
+    }
+  }
+  return false
+}
+
+// String returns the URL of the prefix, in the form it was given in
+func (s *s3Store) String() string {
+  switch {
+  case s.gcs:
+    return fmt.Sprintf("gs://%s/%s", s.bucket, s.prefix)
+  case strings.HasSuffix(s.endpoint.Host, ".amazonaws.com"):
+    return fmt.Sprintf("s3://%s/%s", s.bucket, s.prefix)
+  }
+  return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, s.prefix)
+}
+
+// s3Keys returns the access key id and secret to sign requests with
+func s3Keys() (string, string, error) {
+  c := loadConfig()
+  id, secret := c.S3AccessKey, c.S3SecretKey
+  if id == "" {
+    id = os.Getenv("AWS_ACCESS_KEY_ID")
+  }
+  if secret == "" {
+    secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+  }
+  if id == "" || secret == "" {
+    return "", "", invalidf("No credentials for the bucket, set s3_access_key and s3_secret_key or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+  }
+  return id, secret, nil
+}
+
+// s3Escape escapes s the way Signature Version 4 canonical requests do,
+// leaving slashes as they are unless path is unset
+func s3Escape(s string, path bool) string {
+  var b strings.Builder
+  for _, c := range []byte(s) {
+    switch {
+    case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+      b.WriteByte(c)
+    case c == '/' && path:
+      b.WriteByte(c)
+    default:
+      fmt.Fprintf(&b, "%%%02X", c)
+    }
+  }
+  return b.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+  h := hmac.New(sha256.New, key)
+  h.Write([]byte(data))
+  return h.Sum(nil)
+}
+
+// do sends a request for the object key of the bucket, the bucket itself
+// if key is empty, signing headers along with it. It returns the body and
+// the headers of a successful response. A missing object fails with
+// todo.ErrNotFound and a failed condition with todo.ErrConflict
+func (s *s3Store) do(method string, key string, query url.Values, headers map[string]string, body []byte) ([]byte, http.Header, error) {
+  id, secret, err := s3Keys()
+  if err != nil {
+    return nil, nil, err
+  }
+  path := "/" + s.bucket + "/" + key
+  var params []string
+  for k, vs := range query {
+    for _, v := range vs {
+      params = append(params, s3Escape(k, false)+"="+s3Escape(v, false))
+    }
+  }
+  sort.Strings(params)
+  rawQuery := strings.Join(params, "&")
+
+  now := time.Now().UTC()
+  stamp, day := now.Format("20060102T150405Z"), now.Format("20060102")
+  sum := sha256.Sum256(body)
+  payload := hex.EncodeToString(sum[:])
+  signed := map[string]string{"host": s.endpoint.Host, "x-amz-content-sha256": payload, "x-amz-date": stamp}
+  for k, v := range headers {
+    signed[strings.ToLower(k)] = v
+  }
+  var names []string
+  for k := range signed {
+    names = append(names, k)
+  }
+  sort.Strings(names)
+  lines := []string{method, s3Escape(path, true), rawQuery}
+  for _, k := range names {
+    lines = append(lines, k+":"+signed[k])
+  }
+  lines = append(lines, "", strings.Join(names, ";"), payload)
+  scope := day + "/" + s.region + "/s3/aws4_request"
+  hashed := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+  toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+  signing := []byte("AWS4" + secret)
+  for _, part := range []string{day, s.region, "s3", "aws4_request"} {
+    signing = hmacSHA256(signing, part)
+  }
+  signature := hex.EncodeToString(hmacSHA256(signing, toSign))
+
+  u := *s.endpoint
+  u.Path, u.RawPath, u.RawQuery = path, s3Escape(path, true), rawQuery
+  req, err := http.NewRequestWithContext(cmdCtx, method, u.String(), bytes.NewReader(body))
+  if err != nil {
+    return nil, nil, err
+  }
+  for k, v := range signed {
+    if k != "host" {
+      req.Header.Set(k, v)
+    }
+  }
+  req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+    id, scope, strings.Join(names, ";"), signature))
+  resp, err := http.DefaultClient.Do(req)
+  if err != nil {
+    return nil, nil, err
+  }
+  defer resp.Body.Close()
+  data, err := ioutil.ReadAll(resp.Body)
+  if err != nil {
+    return nil, nil, err
+  }
+  switch {
+  case resp.StatusCode == http.StatusNotFound && key != "":
+    return nil, nil, todo.ErrNotFound
+  case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+    return nil, nil, todo.ErrConflict
+  case resp.StatusCode/100 != 2:
+    var e struct {
+      Code    string
+      Message string
+    }
+    if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+      return nil, nil, fmt.Errorf("%s: %s", e.Code, e.Message)
+    }
+    return nil, nil, fmt.Errorf("%s %s: %s", method, u.Path, resp.Status)
+  }
+  return data, resp.Header, nil
+}
+
+func (s *s3Store) list(prefix string) ([]string, error) {
+  var names []string
+  token := ""
+  for {
+    query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+    if token != "" {
+      query.Set("continuation-token", token)
+    }
+    data, _, err := s.do("GET", "", query, nil, nil)
+    if err != nil {
+      return nil, err
+    }
+    var result struct {
+      Contents []struct {
+        Key string
+      }
+      IsTruncated           bool
+      NextContinuationToken string
+    }
+    if err := xml.Unmarshal(data, &result); err != nil {
+      return nil, err
+    }
+    for _, c := range result.Contents {
+      if name := strings.TrimPrefix(c.Key, s.prefix); !strings.Contains(name, "/") && strings.HasSuffix(name, ".json") {
+        names = append(names, name)
+      }
+    }
+    if !result.IsTruncated || result.NextContinuationToken == "" {
+      return names, nil
+    }
+    token = result.NextContinuationToken
+  }
+}
+
+func (s *s3Store) get(name string) ([]byte, error) {
+  data, _, err := s.do("GET", s.prefix+name, nil, nil, nil)
+  return data, err
+}
+
+func (s *s3Store) put(name string, data []byte) error {
+  _, _, err := s.do("PUT", s.prefix+name, nil, nil, data)
+  return err
+}
+
+func (s *s3Store) remove(name string) error {
+  _, _, err := s.do("DELETE", s.prefix+name, nil, nil, nil)
+  return err
+}
+
+// s3Object is an object of a bucket holding the file of the local
+// backend. Its version is its ETag, or its generation with Google Cloud
+// Storage, and writes only succeed if it is unchanged
+type s3Object struct {
+  store *s3Store
+  name  string
+}
+
+var _ todo.Storage = (*s3Object)(nil)
+
+// newS3Object returns the object at the bucket URL value
+func newS3Object(value string) (*s3Object, error) {
+  store, err := parseS3URL(value, loadConfig().S3Region)
+  if err != nil {
+    return nil, err
+  }
+  name := path.Base(strings.TrimSuffix(store.prefix, "/"))
+  if store.prefix == "" {
+    return nil, fmt.Errorf("%s names a bucket, not a file in it", value)
+  }
+  store.prefix = strings.TrimSuffix(strings.TrimSuffix(store.prefix, "/"), name)
+  return &s3Object{store: store, name: name}, nil
+}
+
+func (o *s3Object) String() string {
+  return o.store.String() + o.name
+}
+
+func (o *s3Object) Read() ([]byte, string, error) {
+  data, header, err := o.store.do("GET", o.store.prefix+o.name, nil, nil, nil)
+  if err == todo.ErrNotFound {
+    return nil, "", nil
+  }
+  if err != nil {
+    return nil, "", fmt.Errorf("Unable to read %s: %w", o, err)
+  }
+  version := header.Get("ETag")
+  if o.store.gcs {
+    version = header.Get("X-Goog-Generation")
+  }
+  return data, version, nil
+}
+
+func (o *s3Object) Write(b []byte, version string) error {
+  var headers map[string]string
+  switch {
+  case o.store.gcs && version == "":
+    headers = map[string]string{"x-goog-if-generation-match": "0"}
+  case o.store.gcs:
+    headers = map[string]string{"x-goog-if-generation-match": version}
+  case version == "":
+    headers = map[string]string{"If-None-Match": "*"}
+  default:
+    headers = map[string]string{"If-Match": version}
+  }
+  _, _, err := o.store.do("PUT", o.store.prefix+o.name, nil, headers, b)
+  if err != nil && err != todo.ErrConflict {
+    return fmt.Errorf("Unable to write %s: %w", o, err)
+  }
+  return err
+}
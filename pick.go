@@ -0,0 +1,338 @@
+package main
+
+import (
+  "bytes"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "os/exec"
+  "sort"
+  "strconv"
+  "strings"
+  "unicode"
+  "unicode/utf8"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/term"
+)
+
+// pickHeight is the most candidates the embedded finder shows at once
+const pickHeight = 10
+
+// errNotPicked is returned when the finder is left without a selection
+var errNotPicked = &exitError{code: exitInterrupted, err: errors.New("No task picked")}
+
+// pickLine describes task, at the 1-based index i, as a line to pick from
+func pickLine(i int, task *todo.Task) string {
+  parts := []string{strconv.Itoa(i), task.Title}
+  if !task.Due.IsZero() {
+    parts = append(parts, formatDate(task.Due))
+  }
+  for _, tag := range task.Tags {
+    parts = append(parts, "+"+tag)
+  }
+  return strings.Join(parts, "  ")
+}
+
+// fuzzyMatch is a line matching the query of a finder
+type fuzzyMatch struct {
+  line  int
+  score int
+  // positions are the indexes of the runes of the line matching the
+  // query
+  positions []int
+}
+
+// matchFuzzy reports whether the runes of query appear in line in order,
+// ignoring case, with a score favoring runes matched at the start of words
+// and one after another
+func matchFuzzy(query []rune, line string) (int, []int, bool) {
+  var positions []int
+  score, q, prev := 0, 0, -2
+  last := ' '
+  for i, r := range []rune(line) {
+    if q < len(query) && unicode.ToLower(r) == unicode.ToLower(query[q]) {
+      score++
+      if i == prev+1 {
+        score += 4
+      }
+      if !unicode.IsLetter(last) && !unicode.IsDigit(last) {
+        score += 2
+      }
+      positions = append(positions, i)
+      prev = i
+      q++
+    }
+    last = r
+  }
+  return score, positions, q == len(query)
+}
+
+// finder is a fuzzy finder over lines, read from the keys of a terminal in
+// raw mode and drawn below the cursor
+type finder struct {
+  lines   []string
+  query   []rune
+  matches []fuzzyMatch
+  cursor  int
+  width   int
+}
+
+// filter matches the lines against the query, best matches first
+func (f *finder) filter() {
+  f.matches = f.matches[:0]
+  for i, line := range f.lines {
+    if score, positions, ok := matchFuzzy(f.query, line); ok {
+      f.matches = append(f.matches, fuzzyMatch{line: i, score: score, positions: positions})
+    }
+  }
+  sort.SliceStable(f.matches, func(i, j int) bool { return f.matches[i].score > f.matches[j].score })
+  f.cursor = 0
+}
+
+// move moves the cursor by delta, within the matches
+func (f *finder) move(delta int) {
+  f.cursor += delta
+  if f.cursor >= len(f.matches) {
+    f.cursor = len(f.matches) - 1
+  }
+  if f.cursor < 0 {
+    f.cursor = 0
+  }
+}
+
+// draw prints the prompt and the matches around the cursor, then puts the
+// terminal's cursor back at the end of the prompt
+func (f *finder) draw(w io.Writer) {
+  var b strings.Builder
+  b.WriteString("\r\x1b[J" + colorize("36", "> ") + string(f.query))
+  top := 0
+  if f.cursor >= pickHeight {
+    top = f.cursor - pickHeight + 1
+  }
+  shown := 0
+  for i := top; i < len(f.matches) && i < top+pickHeight; i++ {
+    m := f.matches[i]
+    prefix := "  "
+    if i == f.cursor {
+      prefix = colorize("36", "▌ ")
+    }
+    b.WriteString("\r\n" + prefix + f.highlight(m, i == f.cursor))
+    shown++
+  }
+  b.WriteString("\r\n" + colorize("2", fmt.Sprintf("  %d/%d", len(f.matches), len(f.lines))))
+  fmt.Fprintf(&b, "\x1b[%dA\r\x1b[%dC", shown+1, 2+len(f.query))
+  io.WriteString(w, b.String())
+}
+
+// highlight returns the line of m cut to the width of the terminal, with
+// the runes matching the query emphasized
+func (f *finder) highlight(m fuzzyMatch, selected bool) string {
+  matched := map[int]bool{}
+  for _, p := range m.positions {
+    matched[p] = true
+  }
+  var b strings.Builder
+  for i, r := range []rune(f.lines[m.line]) {
+    if i >= f.width-2 {
+      break
+    }
+    switch {
+    case matched[i]:
+      b.WriteString(colorize("1;32", string(r)))
+    case selected:
+      b.WriteString(colorize("1", string(r)))
+    default:
+      b.WriteRune(r)
+    }
+  }
+  return b.String()
+}
+
+// run reads keys from in until a line is picked, returning its index in
+// lines, or errNotPicked if the finder is left with Esc or Ctrl-C
+func (f *finder) run(in io.Reader, out io.Writer) (int, error) {
+  f.filter()
+  f.draw(out)
+  defer io.WriteString(out, "\r\x1b[J")
+  buf := make([]byte, 256)
+  for {
+    n, err := in.Read(buf)
+    if err != nil {
+      return 0, err
+    }
+    keys := buf[:n]
+    for len(keys) > 0 {
+      changed := false
+      switch {
+      case bytes.HasPrefix(keys, []byte("\x1b[A")), bytes.HasPrefix(keys, []byte("\x1bOA")):
+        f.move(-1)
+        keys = keys[3:]
+        continue
+      case bytes.HasPrefix(keys, []byte("\x1b[B")), bytes.HasPrefix(keys, []byte("\x1bOB")):
+        f.move(1)
+        keys = keys[3:]
+        continue
+      case keys[0] == 0x1b && len(keys) > 1:
+        // other escape sequences have no meaning here
+        keys = nil
+        continue
+      case keys[0] == 0x1b, keys[0] == 3, keys[0] == 7, keys[0] == 4 && len(f.query) == 0:
+        return 0, errNotPicked
+      case keys[0] == '\r' || keys[0] == '\n':
+        if len(f.matches) == 0 {
+          break
+        }
+        return f.matches[f.cursor].line, nil
+      case keys[0] == 16 || keys[0] == 11:
+        f.move(-1)
+      case keys[0] == 14:
+        f.move(1)
+      case keys[0] == 127 || keys[0] == 8:
+        if len(f.query) > 0 {
+          f.query = f.query[:len(f.query)-1]
+          changed = true
+        }
+      case keys[0] == 21:
+        f.query, changed = nil, true
+      case keys[0] == 23:
+        q := strings.TrimRightFunc(string(f.query), unicode.IsSpace)
+        f.query, changed = []rune(q[:strings.LastIndexFunc(q, unicode.IsSpace)+1]), true
+      default:
+        r, size := utf8.DecodeRune(keys)
+        if r >= ' ' && r != utf8.RuneError {
+          f.query, changed = append(f.query, r), true
+        }
+        keys = keys[size:]
+        if changed {
+          f.filter()
+        }
+        continue
+      }
+      keys = keys[1:]
+      if changed {
+        f.filter()
+      }
+    }
+    f.draw(out)
+  }
+}
+
+// pickEmbedded lets the user pick one of lines with the built-in finder,
+// drawn on stderr so stdout can be captured
+func pickEmbedded(lines []string) (int, error) {
+  fd := int(os.Stdin.Fd())
+  if !term.IsTerminal(fd) {
+    return 0, invalidf("Picking a task needs a terminal, or the picker setting naming a command such as fzf")
+  }
+  state, err := term.MakeRaw(fd)
+  if err != nil {
+    return 0, fmt.Errorf("Unable to set up the terminal: %w", err)
+  }
+  defer term.Restore(fd, state)
+  f := &finder{lines: lines, width: 80}
+  if w, _, err := term.GetSize(fd); err == nil && w > 0 {
+    f.width = w
+  }
+  return f.run(os.Stdin, os.Stderr)
+}
+
+// pickExternal lets the user pick one of lines with command, a finder
+// such as fzf reading the lines on stdin and printing the picked one
+func pickExternal(command string, lines []string) (int, error) {
+  args := strings.Fields(command)
+  cmd := exec.Command(args[0], args[1:]...)
+  cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+  cmd.Stderr = os.Stderr
+  out, err := cmd.Output()
+  var exit *exec.ExitError
+  if errors.As(err, &exit) {
+    // fzf exits with 1 without a match and 130 when interrupted
+    return 0, errNotPicked
+  }
+  if err != nil {
+    return 0, fmt.Errorf("Unable to run picker '%s': %w", command, err)
+  }
+  picked := strings.TrimRight(string(out), "\r\n")
+  for i, line := range lines {
+    if line == picked {
+      return i, nil
+    }
+  }
+  if picked == "" {
+    return 0, errNotPicked
+  }
+  return 0, fmt.Errorf("Picker '%s' printed '%s', not one of the tasks", command, picked)
+}
+
+// Lets the user pick a task of the todo list with a fuzzy finder, then
+// completes, deletes, edits or shows it as action says, or prints its
+// index without an action
+func pickTodoItem(s *session, action string) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  if len(items) == 0 {
+    return notFoundf("No task in your %s list to pick", s.listName)
+  }
+  lines := make([]string, len(items))
+  for i, task := range items {
+    lines[i] = pickLine(i+1, task)
+  }
+  var picked int
+  if picker := loadConfig().Picker; picker != "" {
+    picked, err = pickExternal(picker, lines)
+  } else {
+    picked, err = pickEmbedded(lines)
+  }
+  if err != nil {
+    return err
+  }
+  // the index refers to the tasks in the order they were picked from
+  s.cache.remember(items, "")
+  s.saveCache()
+  index := strconv.Itoa(picked + 1)
+  switch action {
+  case "done":
+    return completeTodoItem(s, index, false)
+  case "rm":
+    return deleteTodoItems(s, []string{index}, false)
+  case "edit":
+    return editTodoItem(s, index, &todo.Patch{})
+  case "show":
+    return showTodoItem(s, index, false)
+  }
+  fmt.Println(index)
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "pick",
+    usage:   "pick [done|rm|edit|show]",
+    summary: "Pick a task with a fuzzy finder, then complete, delete, edit or show it, or print its index",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      action := ""
+      if len(args) > 0 {
+        action = args[0]
+      }
+      switch {
+      case len(args) > 1:
+        return invalidf("Unexpected argument '%s', see 'todo help pick'", args[1])
+      case action != "" && action != "done" && action != "rm" && action != "edit" && action != "show":
+        return invalidf("Unknown action '%s', expected done, rm, edit or show", action)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return pickTodoItem(s, action)
+    },
+  })
+}
@@ -0,0 +1,100 @@
+package todo
+
+import (
+  "context"
+  "time"
+)
+
+// Backend stores task lists and their tasks. Client implements it on top
+// of Google Tasks and Local on top of a file. Methods return ErrNotFound
+// for task lists and tasks that do not exist
+type Backend interface {
+  // Lists returns all task lists
+  Lists(ctx context.Context) ([]*TaskList, error)
+  // FindList returns the task list with the given title
+  FindList(ctx context.Context, title string) (*TaskList, error)
+  // CreateList creates a task list with the given title
+  CreateList(ctx context.Context, title string) (*TaskList, error)
+  // RenameList changes the title of a task list
+  RenameList(ctx context.Context, listID string, title string) (*TaskList, error)
+  // DeleteList deletes a task list and all of its tasks
+  DeleteList(ctx context.Context, listID string) error
+
+  // List returns the uncompleted tasks of a task list, in list order
+  // with subtasks following their parent
+  List(ctx context.Context, listID string) ([]*Task, error)
+  // Completed returns the tasks of a task list completed between min and
+  // max, most recent first. A zero min or max leaves that end open
+  Completed(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error)
+  // Due returns the uncompleted tasks of a task list due on the days from
+  // min to max, in list order. A zero min or max leaves that end open
+  Due(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error)
+  // Get returns a single task
+  Get(ctx context.Context, listID string, id string) (*Task, error)
+  // Add creates task in a task list, as a subtask if its Parent is set
+  Add(ctx context.Context, listID string, task *Task) (*Task, error)
+  // Complete marks a task as completed
+  Complete(ctx context.Context, listID string, id string) (*Task, error)
+  // Uncomplete marks a completed task as not completed
+  Uncomplete(ctx context.Context, listID string, id string) (*Task, error)
+  // Delete removes a task
+  Delete(ctx context.Context, listID string, id string) error
+  // Update applies patch to a task
+  Update(ctx context.Context, listID string, id string, patch *Patch) (*Task, error)
+  // Move places a task and its subtasks at dest
+  Move(ctx context.Context, listID string, id string, dest Destination) (*Task, error)
+}
+
+// Clearer is implemented by backends that can hide the completed tasks of
+// a task list without deleting them, such as Client
+type Clearer interface {
+  Clear(ctx context.Context, listID string) error
+}
+
+// Destination is where Move places a task
+type Destination struct {
+  // ListID is the task list to move the task to, empty for its own
+  ListID string
+  // Parent is the task to make it a subtask of, empty for the top level
+  Parent string
+  // Previous is the sibling to place it after, empty to place it first
+  Previous string
+}
+
+// dueBetween returns the tasks of items due on the days from min to max,
+// for backends that can not filter by due date themselves
+func dueBetween(items []*Task, min time.Time, max time.Time) []*Task {
+  var due []*Task
+  for _, t := range items {
+    if t.Due.IsZero() || !min.IsZero() && t.Due.Before(Date(min)) || !max.IsZero() && t.Due.After(Date(max)) {
+      continue
+    }
+    due = append(due, t)
+  }
+  return due
+}
+
+// reorder returns siblings in their new order once moved is placed after
+// the sibling with the id previous: first if previous is empty, last if it
+// is not among them
+func reorder(siblings []*Task, moved *Task, previous string) []*Task {
+  order := []*Task{}
+  placed := previous == ""
+  if placed {
+    order = append(order, moved)
+  }
+  for _, t := range siblings {
+    if t.ID == moved.ID {
+      continue
+    }
+    order = append(order, t)
+    if t.ID == previous {
+      order = append(order, moved)
+      placed = true
+    }
+  }
+  if !placed {
+    order = append(order, moved)
+  }
+  return order
+}
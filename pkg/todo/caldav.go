@@ -0,0 +1,519 @@
+package todo
+
+import (
+  "bytes"
+  "context"
+  "encoding/xml"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "sort"
+  "strings"
+  "time"
+)
+
+// CalDAV is a Backend on top of a CalDAV server such as Nextcloud,
+// Radicale or Fastmail. Calendars supporting VTODO are task lists and
+// their VTODO items are tasks, identified by their UID; task list IDs are
+// the paths of the calendars
+type CalDAV struct {
+  home       *url.URL
+  username   string
+  password   string
+  httpClient *http.Client
+}
+
+var _ Backend = (*CalDAV)(nil)
+
+// NewCalDAV returns a CalDAV backend for the calendars in the collection
+// at home, usually the calendar home of the user such as
+// https://cloud.example.com/remote.php/dav/calendars/alice/. Requests
+// authenticate with username and password, if set, and are sent through
+// httpClient, or http.DefaultClient if it is nil
+func NewCalDAV(home string, username string, password string, httpClient *http.Client) (*CalDAV, error) {
+  u, err := url.Parse(home)
+  if err != nil {
+    return nil, fmt.Errorf("invalid CalDAV URL %s: %w", home, err)
+  }
+  if u.Scheme != "http" && u.Scheme != "https" {
+    return nil, fmt.Errorf("invalid CalDAV URL %s: expected an http or https URL", home)
+  }
+  if !strings.HasSuffix(u.Path, "/") {
+    u.Path += "/"
+  }
+  if httpClient == nil {
+    httpClient = http.DefaultClient
+  }
+  return &CalDAV{home: u, username: username, password: password, httpClient: httpClient}, nil
+}
+
+// CalDAVError is an error response of a CalDAV server
+type CalDAVError struct {
+  Code    int
+  Message string
+}
+
+func (e *CalDAVError) Error() string {
+  return fmt.Sprintf("caldav: %d %s", e.Code, e.Message)
+}
+
+// do sends a request for the resource at path on the server, with the
+// given headers, and returns the response of the server if it succeeded
+func (c *CalDAV) do(ctx context.Context, method string, path string, header map[string]string, body string) (*http.Response, error) {
+  u := c.home.ResolveReference(&url.URL{Path: path})
+  var r io.Reader
+  if body != "" {
+    r = strings.NewReader(body)
+  }
+  req, err := http.NewRequest(method, u.String(), r)
+  if err != nil {
+    return nil, err
+  }
+  req = req.WithContext(ctx)
+  if c.username != "" || c.password != "" {
+    req.SetBasicAuth(c.username, c.password)
+  }
+  for k, v := range header {
+    req.Header.Set(k, v)
+  }
+
+  res, err := c.httpClient.Do(req)
+  if err != nil {
+    return nil, err
+  }
+  if res.StatusCode == http.StatusNotFound {
+    res.Body.Close()
+    return nil, ErrNotFound
+  }
+  if res.StatusCode >= 300 {
+    msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+    res.Body.Close()
+    return nil, &CalDAVError{Code: res.StatusCode, Message: strings.TrimSpace(string(msg))}
+  }
+  return res, nil
+}
+
+// exec sends a request whose response body is of no interest
+func (c *CalDAV) exec(ctx context.Context, method string, path string, header map[string]string, body string) error {
+  res, err := c.do(ctx, method, path, header, body)
+  if err != nil {
+    return err
+  }
+  return res.Body.Close()
+}
+
+// davMultistatus is the multistatus response to PROPFIND and REPORT
+type davMultistatus struct {
+  Responses []struct {
+    Href     string `xml:"DAV: href"`
+    Propstat []struct {
+      Status string `xml:"DAV: status"`
+      Prop   struct {
+        DisplayName  string `xml:"DAV: displayname"`
+        ResourceType *struct {
+          Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+        } `xml:"DAV: resourcetype"`
+        Components []struct {
+          Name string `xml:"name,attr"`
+        } `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set>comp"`
+        Etag         string `xml:"DAV: getetag"`
+        CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+      } `xml:"DAV: prop"`
+    } `xml:"DAV: propstat"`
+  } `xml:"DAV: response"`
+}
+
+// multistatus sends a PROPFIND or REPORT request and decodes the response
+func (c *CalDAV) multistatus(ctx context.Context, method string, path string, body string) (*davMultistatus, error) {
+  res, err := c.do(ctx, method, path, map[string]string{
+    "Depth":        "1",
+    "Content-Type": "application/xml; charset=utf-8",
+  }, body)
+  if err != nil {
+    return nil, err
+  }
+  defer res.Body.Close()
+  ms := &davMultistatus{}
+  if err := xml.NewDecoder(res.Body).Decode(ms); err != nil {
+    return nil, fmt.Errorf("invalid CalDAV response: %w", err)
+  }
+  return ms, nil
+}
+
+// escapeXML escapes s for use as XML character data
+func escapeXML(s string) string {
+  var b bytes.Buffer
+  xml.EscapeText(&b, []byte(s))
+  return b.String()
+}
+
+// hrefPath returns the path of an href, which servers may send as a full
+// URL
+func hrefPath(href string) string {
+  if u, err := url.Parse(href); err == nil {
+    return u.Path
+  }
+  return href
+}
+
+const propfindCalendars = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:resourcetype/><d:displayname/><c:supported-calendar-component-set/></d:prop>
+</d:propfind>`
+
+// Lists returns the calendars supporting VTODO
+func (c *CalDAV) Lists(ctx context.Context) ([]*TaskList, error) {
+  ms, err := c.multistatus(ctx, "PROPFIND", c.home.Path, propfindCalendars)
+  if err != nil {
+    return nil, err
+  }
+  var lists []*TaskList
+  for _, r := range ms.Responses {
+    for _, ps := range r.Propstat {
+      p := ps.Prop
+      if !strings.Contains(ps.Status, " 200 ") || p.ResourceType == nil || p.ResourceType.Calendar == nil {
+        continue
+      }
+      // calendars that do not list their components take any
+      todos := len(p.Components) == 0
+      for _, comp := range p.Components {
+        todos = todos || strings.EqualFold(comp.Name, "VTODO")
+      }
+      if !todos {
+        continue
+      }
+      path := hrefPath(r.Href)
+      title := p.DisplayName
+      if title == "" {
+        title, _ = url.PathUnescape(strings.Trim(path[strings.LastIndex(strings.TrimSuffix(path, "/"), "/")+1:], "/"))
+      }
+      lists = append(lists, &TaskList{ID: path, Title: title})
+    }
+  }
+  return lists, nil
+}
+
+// FindList returns the calendar with the given name, or ErrNotFound
+func (c *CalDAV) FindList(ctx context.Context, title string) (*TaskList, error) {
+  lists, err := c.Lists(ctx)
+  if err != nil {
+    return nil, err
+  }
+  for _, l := range lists {
+    if l.Title == title {
+      return l, nil
+    }
+  }
+  return nil, ErrNotFound
+}
+
+// CreateList creates a calendar for tasks with the given name
+func (c *CalDAV) CreateList(ctx context.Context, title string) (*TaskList, error) {
+  path := c.home.Path + newID() + "/"
+  body := `<?xml version="1.0" encoding="utf-8"?>
+<c:mkcalendar xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:set><d:prop>
+    <d:displayname>` + escapeXML(title) + `</d:displayname>
+    <c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set>
+  </d:prop></d:set>
+</c:mkcalendar>`
+  if err := c.exec(ctx, "MKCALENDAR", path, map[string]string{"Content-Type": "application/xml; charset=utf-8"}, body); err != nil {
+    return nil, err
+  }
+  return &TaskList{ID: path, Title: title}, nil
+}
+
+// RenameList changes the name of a calendar
+func (c *CalDAV) RenameList(ctx context.Context, listID string, title string) (*TaskList, error) {
+  body := `<?xml version="1.0" encoding="utf-8"?>
+<d:propertyupdate xmlns:d="DAV:">
+  <d:set><d:prop><d:displayname>` + escapeXML(title) + `</d:displayname></d:prop></d:set>
+</d:propertyupdate>`
+  if err := c.exec(ctx, "PROPPATCH", listID, map[string]string{"Content-Type": "application/xml; charset=utf-8"}, body); err != nil {
+    return nil, err
+  }
+  return &TaskList{ID: listID, Title: title}, nil
+}
+
+// DeleteList deletes a calendar and all of its tasks
+func (c *CalDAV) DeleteList(ctx context.Context, listID string) error {
+  return c.exec(ctx, http.MethodDelete, listID, nil, "")
+}
+
+// calDAVTask is a VTODO item stored on the server
+type calDAVTask struct {
+  path string
+  etag string
+  cal  *icalComponent
+  task *Task
+}
+
+// query returns the VTODO items of a calendar, only the one with the
+// given UID if uid is set
+func (c *CalDAV) query(ctx context.Context, listID string, uid string) ([]*calDAVTask, error) {
+  filter := ""
+  if uid != "" {
+    filter = `<c:prop-filter name="UID"><c:text-match collation="i;octet">` + escapeXML(uid) + `</c:text-match></c:prop-filter>`
+  }
+  body := `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO">` + filter + `</c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+  ms, err := c.multistatus(ctx, "REPORT", listID, body)
+  if err != nil {
+    return nil, err
+  }
+  var items []*calDAVTask
+  for _, r := range ms.Responses {
+    for _, ps := range r.Propstat {
+      if ps.Prop.CalendarData == "" {
+        continue
+      }
+      cal, err := parseICal(ps.Prop.CalendarData)
+      if err != nil {
+        return nil, fmt.Errorf("%s: %w", r.Href, err)
+      }
+      vtodo := cal.child("VTODO")
+      if vtodo == nil {
+        continue
+      }
+      task := fromVTODO(vtodo)
+      if uid != "" && task.ID != uid {
+        continue
+      }
+      task.Etag = ps.Prop.Etag
+      items = append(items, &calDAVTask{path: hrefPath(r.Href), etag: ps.Prop.Etag, cal: cal, task: task})
+    }
+  }
+  return items, nil
+}
+
+// find returns the VTODO item with the given UID, or ErrNotFound
+func (c *CalDAV) find(ctx context.Context, listID string, id string) (*calDAVTask, error) {
+  items, err := c.query(ctx, listID, id)
+  if err != nil {
+    return nil, err
+  }
+  if len(items) == 0 {
+    return nil, ErrNotFound
+  }
+  return items[0], nil
+}
+
+// put writes task into the VTODO item t and uploads it, failing if the
+// item changed on the server since it was read
+func (c *CalDAV) put(ctx context.Context, listID string, t *calDAVTask, task *Task) (*Task, error) {
+  setVTODO(t.cal.child("VTODO"), task)
+  header := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+  if t.etag != "" {
+    header["If-Match"] = t.etag
+  } else {
+    header["If-None-Match"] = "*"
+  }
+  if err := c.exec(ctx, http.MethodPut, t.path, header, t.cal.String()); err != nil {
+    return nil, err
+  }
+  return c.Get(ctx, listID, task.ID)
+}
+
+// List returns the uncompleted tasks of a calendar, oldest first with
+// subtasks following their parent
+func (c *CalDAV) List(ctx context.Context, listID string) ([]*Task, error) {
+  all, err := c.query(ctx, listID, "")
+  if err != nil {
+    return nil, err
+  }
+  var items []*Task
+  for _, t := range all {
+    if !t.task.Done() {
+      items = append(items, t.task)
+    }
+  }
+  sortByPosition(items)
+  return items, nil
+}
+
+// Completed returns the tasks of a calendar completed between min and
+// max, most recent first. A zero min or max leaves that end open
+func (c *CalDAV) Completed(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  all, err := c.query(ctx, listID, "")
+  if err != nil {
+    return nil, err
+  }
+  var items []*Task
+  for _, t := range all {
+    done := t.task.Completed
+    if t.task.Done() && (min.IsZero() || !done.Before(min)) && (max.IsZero() || !done.After(max)) {
+      items = append(items, t.task)
+    }
+  }
+  sort.SliceStable(items, func(i, j int) bool {
+    return items[i].Completed.After(items[j].Completed)
+  })
+  return items, nil
+}
+
+// Get returns a single task, or ErrNotFound
+func (c *CalDAV) Get(ctx context.Context, listID string, id string) (*Task, error) {
+  t, err := c.find(ctx, listID, id)
+  if err != nil {
+    return nil, err
+  }
+  return t.task, nil
+}
+
+// Add creates task in a calendar, as a subtask if its Parent is set. The
+// ID and Position of task are ignored.
+// It returns the created task
+func (c *CalDAV) Add(ctx context.Context, listID string, task *Task) (*Task, error) {
+  created := *task
+  created.ID = newID()
+  t := &calDAVTask{path: listID + created.ID + ".ics", cal: newVCALENDAR()}
+  return c.put(ctx, listID, t, &created)
+}
+
+// Complete marks a task as completed
+func (c *CalDAV) Complete(ctx context.Context, listID string, id string) (*Task, error) {
+  t, err := c.find(ctx, listID, id)
+  if err != nil {
+    return nil, err
+  }
+  task := *t.task
+  task.Completed = time.Now().UTC()
+  return c.put(ctx, listID, t, &task)
+}
+
+// Uncomplete marks a completed task as not completed
+func (c *CalDAV) Uncomplete(ctx context.Context, listID string, id string) (*Task, error) {
+  t, err := c.find(ctx, listID, id)
+  if err != nil {
+    return nil, err
+  }
+  task := *t.task
+  task.Completed = time.Time{}
+  return c.put(ctx, listID, t, &task)
+}
+
+// Delete removes a task
+func (c *CalDAV) Delete(ctx context.Context, listID string, id string) error {
+  t, err := c.find(ctx, listID, id)
+  if err != nil {
+    return err
+  }
+  header := map[string]string{}
+  if t.etag != "" {
+    header["If-Match"] = t.etag
+  }
+  return c.exec(ctx, http.MethodDelete, t.path, header, "")
+}
+
+// Update applies patch to a task.
+// It returns the updated task
+func (c *CalDAV) Update(ctx context.Context, listID string, id string, patch *Patch) (*Task, error) {
+  t, err := c.find(ctx, listID, id)
+  if err != nil {
+    return nil, err
+  }
+  return c.put(ctx, listID, t, patch.Apply(t.task))
+}
+
+// Move places a task and its subtasks at dest. Moving to another calendar
+// copies the items there and deletes the originals; the order within a
+// calendar is kept in X-APPLE-SORT-ORDER, which the moved task and its new
+// siblings are renumbered in.
+// It returns the moved task
+func (c *CalDAV) Move(ctx context.Context, listID string, id string, dest Destination) (*Task, error) {
+  all, err := c.query(ctx, listID, "")
+  if err != nil {
+    return nil, err
+  }
+  var moved *calDAVTask
+  for _, t := range all {
+    if t.task.ID == id {
+      moved = t
+    }
+  }
+  if moved == nil {
+    return nil, ErrNotFound
+  }
+  var tasks []*Task
+  for _, t := range all {
+    tasks = append(tasks, t.task)
+  }
+  ids := subtree(tasks, id)
+  if ids[dest.Parent] {
+    return nil, fmt.Errorf("can not move a task below itself")
+  }
+
+  to := listID
+  if dest.ListID != "" && dest.ListID != listID {
+    to = dest.ListID
+    for _, t := range all {
+      if !ids[t.task.ID] {
+        continue
+      }
+      path := to + t.path[strings.LastIndex(t.path, "/")+1:]
+      header := map[string]string{"Content-Type": "text/calendar; charset=utf-8", "If-None-Match": "*"}
+      if err := c.exec(ctx, http.MethodPut, path, header, t.cal.String()); err != nil {
+        return nil, err
+      }
+      if err := c.exec(ctx, http.MethodDelete, t.path, map[string]string{"If-Match": t.etag}, ""); err != nil {
+        return nil, err
+      }
+    }
+    if all, err = c.query(ctx, to, ""); err != nil {
+      return nil, err
+    }
+    moved = nil
+    for _, t := range all {
+      if t.task.ID == id {
+        moved = t
+      }
+    }
+    if moved == nil {
+      return nil, ErrNotFound
+    }
+  }
+
+  vtodo := moved.cal.child("VTODO")
+  vtodo.set("RELATED-TO", "", escapeICal(dest.Parent))
+  var siblings []*Task
+  byID := map[string]*calDAVTask{}
+  for _, t := range all {
+    byID[t.task.ID] = t
+    if t.task.Parent == dest.Parent && !t.task.Done() {
+      siblings = append(siblings, t.task)
+    }
+  }
+  sort.SliceStable(siblings, func(i, j int) bool {
+    return siblings[i].Position < siblings[j].Position
+  })
+  for i, task := range reorder(siblings, moved.task, dest.Previous) {
+    t := byID[task.ID]
+    order := fmt.Sprint(i + 1)
+    v := t.cal.child("VTODO")
+    if t != moved && v.value("X-APPLE-SORT-ORDER") == order {
+      continue
+    }
+    v.set("X-APPLE-SORT-ORDER", "", order)
+    v.set("LAST-MODIFIED", "", time.Now().UTC().Format(icalStamp))
+    header := map[string]string{"Content-Type": "text/calendar; charset=utf-8", "If-Match": t.etag}
+    if err := c.exec(ctx, http.MethodPut, t.path, header, t.cal.String()); err != nil {
+      return nil, err
+    }
+  }
+  return c.Get(ctx, to, id)
+}
+
+// Due returns the uncompleted tasks of a calendar due on the days from min
+// to max, in calendar order
+func (c *CalDAV) Due(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  items, err := c.List(ctx, listID)
+  if err != nil {
+    return nil, err
+  }
+  return dueBetween(items, min, max), nil
+}
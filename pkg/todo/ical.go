@@ -0,0 +1,353 @@
+package todo
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// icalStamp is the layout of UTC DATE-TIME values in iCalendar
+const icalStamp = "20060102T150405Z"
+
+// icalProp is a content line of an iCalendar object. Params holds the
+// parameters as written, including the leading semicolon
+type icalProp struct {
+  Name   string
+  Params string
+  Value  string
+}
+
+// icalComponent is an iCalendar component such as VCALENDAR or VTODO,
+// keeping the properties and components todo does not know about so that
+// writing it back loses nothing other clients stored in it
+type icalComponent struct {
+  Name     string
+  Props    []*icalProp
+  Children []*icalComponent
+}
+
+// parseICal parses an iCalendar object
+func parseICal(data string) (*icalComponent, error) {
+  data = strings.Replace(data, "\r\n", "\n", -1)
+  // unfold continuation lines
+  data = strings.Replace(strings.Replace(data, "\n ", "", -1), "\n\t", "", -1)
+
+  var stack []*icalComponent
+  var root *icalComponent
+  for _, line := range strings.Split(data, "\n") {
+    if line == "" {
+      continue
+    }
+    prop := parseICalLine(line)
+    switch prop.Name {
+    case "BEGIN":
+      c := &icalComponent{Name: strings.ToUpper(prop.Value)}
+      if len(stack) > 0 {
+        parent := stack[len(stack)-1]
+        parent.Children = append(parent.Children, c)
+      } else if root == nil {
+        root = c
+      }
+      stack = append(stack, c)
+    case "END":
+      if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+        return nil, fmt.Errorf("invalid iCalendar data: unexpected END:%s", prop.Value)
+      }
+      stack = stack[:len(stack)-1]
+    default:
+      if len(stack) == 0 {
+        return nil, fmt.Errorf("invalid iCalendar data: property %s outside of a component", prop.Name)
+      }
+      c := stack[len(stack)-1]
+      c.Props = append(c.Props, prop)
+    }
+  }
+  if root == nil || len(stack) > 0 {
+    return nil, fmt.Errorf("invalid iCalendar data: incomplete component")
+  }
+  return root, nil
+}
+
+// parseICalLine splits an unfolded content line into its name,
+// parameters and value. Colons in quoted parameter values do not end the
+// parameters
+func parseICalLine(line string) *icalProp {
+  quoted := false
+  for i, r := range line {
+    switch {
+    case r == '"':
+      quoted = !quoted
+    case r == ':' && !quoted:
+      name, params := line[:i], ""
+      if j := strings.Index(name, ";"); j >= 0 {
+        name, params = name[:j], name[j:]
+      }
+      return &icalProp{Name: strings.ToUpper(name), Params: params, Value: line[i+1:]}
+    }
+  }
+  return &icalProp{Name: strings.ToUpper(line)}
+}
+
+// String encodes c with folded CRLF terminated lines
+func (c *icalComponent) String() string {
+  var b strings.Builder
+  c.write(&b)
+  return b.String()
+}
+
+func (c *icalComponent) write(b *strings.Builder) {
+  b.WriteString("BEGIN:" + c.Name + "\r\n")
+  for _, p := range c.Props {
+    b.WriteString(foldICal(p.Name+p.Params+":"+p.Value) + "\r\n")
+  }
+  for _, child := range c.Children {
+    child.write(b)
+  }
+  b.WriteString("END:" + c.Name + "\r\n")
+}
+
+// child returns the first component of c with the given name, or nil
+func (c *icalComponent) child(name string) *icalComponent {
+  for _, child := range c.Children {
+    if child.Name == name {
+      return child
+    }
+  }
+  return nil
+}
+
+// prop returns the first property of c with the given name, or nil
+func (c *icalComponent) prop(name string) *icalProp {
+  for _, p := range c.Props {
+    if p.Name == name {
+      return p
+    }
+  }
+  return nil
+}
+
+// value returns the raw value of the property of c with the given name
+func (c *icalComponent) value(name string) string {
+  if p := c.prop(name); p != nil {
+    return p.Value
+  }
+  return ""
+}
+
+// set replaces the properties of c with the given name by one with value,
+// or removes them if value is empty
+func (c *icalComponent) set(name string, params string, value string) {
+  props := c.Props[:0:0]
+  added := false
+  for _, p := range c.Props {
+    if p.Name != name {
+      props = append(props, p)
+    } else if value != "" && !added {
+      props = append(props, &icalProp{Name: name, Params: params, Value: value})
+      added = true
+    }
+  }
+  if value != "" && !added {
+    props = append(props, &icalProp{Name: name, Params: params, Value: value})
+  }
+  c.Props = props
+}
+
+// escapeICal escapes s for use as an iCalendar TEXT value
+func escapeICal(s string) string {
+  return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// unescapeICal decodes an iCalendar TEXT value
+func unescapeICal(s string) string {
+  return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// splitICalList splits a list of TEXT values such as CATEGORIES at the
+// commas that are not escaped
+func splitICalList(s string) []string {
+  var values []string
+  start := 0
+  for i := 0; i < len(s); i++ {
+    switch s[i] {
+    case '\\':
+      i++
+    case ',':
+      values = append(values, unescapeICal(s[start:i]))
+      start = i + 1
+    }
+  }
+  return append(values, unescapeICal(s[start:]))
+}
+
+// foldICal splits a content line longer than 75 octets into continuation
+// lines, without breaking up UTF-8 sequences
+func foldICal(s string) string {
+  var b strings.Builder
+  n := 0
+  for _, r := range s {
+    size := len(string(r))
+    if n+size > 75 {
+      b.WriteString("\r\n ")
+      n = 1
+    }
+    b.WriteRune(r)
+    n += size
+  }
+  return b.String()
+}
+
+// parseICalTime parses a DATE or DATE-TIME value. Floating and TZID times
+// are read as UTC, which is precise enough for due dates
+func parseICalTime(s string) time.Time {
+  for _, layout := range []string{icalStamp, "20060102T150405", "20060102"} {
+    if t, err := time.Parse(layout, s); err == nil {
+      return t
+    }
+  }
+  return time.Time{}
+}
+
+// icalPriorities maps priorities to the PRIORITY values of iCalendar, where
+// 1 is the highest and 9 the lowest
+var icalPriorities = map[Priority]int{
+  PriorityHigh:   1,
+  PriorityMedium: 5,
+  PriorityLow:    9,
+}
+
+// icalPriority maps a PRIORITY value to a priority
+func icalPriority(s string) Priority {
+  n, err := strconv.Atoi(s)
+  switch {
+  case err != nil || n <= 0:
+    return PriorityNone
+  case n <= 4:
+    return PriorityHigh
+  case n == 5:
+    return PriorityMedium
+  }
+  return PriorityLow
+}
+
+// fromVTODO converts a VTODO component. Fields iCalendar has no property
+// for are read from the metadata line of its DESCRIPTION
+func fromVTODO(c *icalComponent) *Task {
+  task := &Task{
+    ID:      unescapeICal(c.value("UID")),
+    Title:   unescapeICal(c.value("SUMMARY")),
+    Due:     Date(parseICalTime(c.value("DUE"))),
+    Updated: parseICalTime(c.value("LAST-MODIFIED")),
+  }
+  decodeMeta(task, unescapeICal(c.value("DESCRIPTION")))
+  task.Priority = icalPriority(c.value("PRIORITY"))
+  task.Tags = nil
+  for _, p := range c.Props {
+    switch p.Name {
+    case "CATEGORIES":
+      task.Tags = append(task.Tags, splitICalList(p.Value)...)
+    case "RELATED-TO":
+      if params := strings.ToUpper(p.Params); params == "" || strings.Contains(params, "RELTYPE=PARENT") {
+        task.Parent = unescapeICal(p.Value)
+      }
+    }
+  }
+  created := parseICalTime(c.value("CREATED"))
+  if created.IsZero() {
+    created = parseICalTime(c.value("DTSTAMP"))
+  }
+  task.Created = created
+  task.Position = fmt.Sprintf("%020d", sortOrder(c, created))
+  if task.Updated.IsZero() {
+    task.Updated = created
+  }
+  if strings.EqualFold(c.value("STATUS"), "COMPLETED") || c.prop("COMPLETED") != nil {
+    task.Completed = parseICalTime(c.value("COMPLETED"))
+    if task.Completed.IsZero() {
+      task.Completed = task.Updated
+    }
+  }
+  return task
+}
+
+// icalSortEpoch is the time X-APPLE-SORT-ORDER counts seconds from for
+// items that were never reordered
+var icalSortEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// sortOrder returns the X-APPLE-SORT-ORDER of the VTODO component c, the
+// property clients such as Apple Reminders, Thunderbird and Nextcloud
+// order tasks by. Components without it are ordered by when they were
+// created, the way those clients order new items
+func sortOrder(c *icalComponent, created time.Time) int64 {
+  n, err := strconv.ParseInt(c.value("X-APPLE-SORT-ORDER"), 10, 64)
+  if err != nil {
+    n = int64(created.Sub(icalSortEpoch) / time.Second)
+  }
+  if n < 0 {
+    return 0
+  }
+  return n
+}
+
+// setVTODO writes the fields of task into the VTODO component c, leaving
+// its other properties alone
+func setVTODO(c *icalComponent, task *Task) {
+  now := time.Now().UTC().Format(icalStamp)
+  if c.prop("UID") == nil {
+    c.set("UID", "", escapeICal(task.ID))
+  }
+  if c.prop("CREATED") == nil {
+    if task.Created.IsZero() {
+      c.set("CREATED", "", now)
+    } else {
+      c.set("CREATED", "", task.Created.UTC().Format(icalStamp))
+    }
+  }
+  c.set("DTSTAMP", "", now)
+  c.set("LAST-MODIFIED", "", now)
+  c.set("SUMMARY", "", escapeICal(task.Title))
+
+  meta := *task
+  meta.Priority, meta.Tags, meta.Created = PriorityNone, nil, time.Time{}
+  c.set("DESCRIPTION", "", escapeICal(encodeMeta(&meta)))
+
+  due := ""
+  if !task.Due.IsZero() {
+    due = task.Due.Format("20060102")
+  }
+  c.set("DUE", ";VALUE=DATE", due)
+  priority := ""
+  if p, ok := icalPriorities[task.Priority]; ok {
+    priority = strconv.Itoa(p)
+  }
+  c.set("PRIORITY", "", priority)
+  var tags []string
+  for _, tag := range task.Tags {
+    tags = append(tags, escapeICal(tag))
+  }
+  c.set("CATEGORIES", "", strings.Join(tags, ","))
+  c.set("RELATED-TO", "", escapeICal(task.Parent))
+
+  if task.Done() {
+    c.set("STATUS", "", "COMPLETED")
+    c.set("COMPLETED", "", task.Completed.UTC().Format(icalStamp))
+    c.set("PERCENT-COMPLETE", "", "100")
+  } else {
+    c.set("STATUS", "", "NEEDS-ACTION")
+    c.set("COMPLETED", "", "")
+    c.set("PERCENT-COMPLETE", "", "")
+  }
+}
+
+// newVCALENDAR returns a calendar object holding an empty VTODO
+func newVCALENDAR() *icalComponent {
+  return &icalComponent{
+    Name: "VCALENDAR",
+    Props: []*icalProp{
+      {Name: "VERSION", Value: "2.0"},
+      {Name: "PRODID", Value: "-//PedramPejman//todo//EN"},
+    },
+    Children: []*icalComponent{{Name: "VTODO"}},
+  }
+}
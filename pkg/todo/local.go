@@ -0,0 +1,526 @@
+package todo
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "sync"
+  "time"
+)
+
+// Local is a Backend keeping task lists in a JSON file, for use without a
+// Google account. Every call reads the file and every change rewrites it
+type Local struct {
+  path    string
+  storage Storage
+  sealer  Sealer
+  mu      sync.Mutex
+}
+
+// Storage keeps the file of a Local backend elsewhere than on disk, such
+// as in an object storage bucket, where other machines may change it
+type Storage interface {
+  // Read returns the content of the file and its version, nil and an
+  // empty version if there is no file yet
+  Read() ([]byte, string, error)
+  // Write replaces the content of the file if it still is at version,
+  // or creates it if version is empty and there is no file yet, failing
+  // with ErrConflict otherwise
+  Write(b []byte, version string) error
+  // String names the file in messages
+  String() string
+}
+
+// ErrConflict is returned by a Storage when the file was changed since
+// it was read
+var ErrConflict = errors.New("changed concurrently")
+
+// localAttempts is how often a change is applied to a freshly read file
+// when Storage reports that another one was made in the meantime
+const localAttempts = 5
+
+// Sealer encrypts the file of a Local backend at rest
+type Sealer interface {
+  // Seal encrypts the content of the file
+  Seal(b []byte) ([]byte, error)
+  // Open decrypts what Seal returned
+  Open(b []byte) ([]byte, error)
+}
+
+var _ Backend = (*Local)(nil)
+
+// localList is a task list as stored in the file of a Local backend
+type localList struct {
+  TaskList
+  Tasks []*Task `json:"tasks"`
+}
+
+// localData is the content of the file of a Local backend
+type localData struct {
+  Lists []*localList `json:"lists"`
+  // Next is the position given to the next task added
+  Next int `json:"next"`
+}
+
+// NewLocal returns a Local backend storing its tasks in the file at path,
+// which is created when the first change is made
+func NewLocal(path string) *Local {
+  return &Local{path: path}
+}
+
+// NewSealedLocal returns a Local backend like NewLocal whose file is
+// encrypted with sealer
+func NewSealedLocal(path string, sealer Sealer) *Local {
+  return &Local{path: path, sealer: sealer}
+}
+
+// NewStoredLocal returns a Local backend keeping its file in storage,
+// encrypted with sealer unless it is nil
+func NewStoredLocal(storage Storage, sealer Sealer) *Local {
+  return &Local{path: storage.String(), storage: storage, sealer: sealer}
+}
+
+// load reads the file, which is empty if it does not exist yet. It also
+// returns the version of the file in storage, if any
+func (l *Local) load() (*localData, string, error) {
+  data := &localData{}
+  var b []byte
+  var version string
+  var err error
+  if l.storage != nil {
+    if b, version, err = l.storage.Read(); err == nil && b == nil {
+      return data, "", nil
+    }
+  } else {
+    b, err = ioutil.ReadFile(l.path)
+    if os.IsNotExist(err) {
+      return data, "", nil
+    }
+  }
+  if err != nil {
+    return nil, "", err
+  }
+  if l.sealer != nil {
+    if b, err = l.sealer.Open(b); err != nil {
+      return nil, "", err
+    }
+  }
+  if err := json.Unmarshal(b, data); err != nil {
+    return nil, "", fmt.Errorf("invalid task file %s: %w", l.path, err)
+  }
+  return data, version, nil
+}
+
+// update loads the file, lets change modify its content and writes it
+// back unless change fails. If the file in storage changed in the
+// meantime, change is applied again to its new content
+func (l *Local) update(change func(data *localData) error) error {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  for attempt := 1; ; attempt++ {
+    data, version, err := l.load()
+    if err != nil {
+      return err
+    }
+    if err := change(data); err != nil {
+      return err
+    }
+    err = l.save(data, version)
+    if err != ErrConflict || attempt == localAttempts {
+      return err
+    }
+  }
+}
+
+// save writes data to the file, which was read at version if it is in
+// storage
+func (l *Local) save(data *localData, version string) error {
+  b, err := json.MarshalIndent(data, "", "  ")
+  if err != nil {
+    return err
+  }
+  if l.sealer != nil {
+    if b, err = l.sealer.Seal(b); err != nil {
+      return err
+    }
+  }
+  if l.storage != nil {
+    return l.storage.Write(b, version)
+  }
+  if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+    return err
+  }
+  tmp := l.path + ".tmp"
+  if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+    return err
+  }
+  return os.Rename(tmp, l.path)
+}
+
+// read loads the file for a call that does not change it
+func (l *Local) read() (*localData, error) {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  data, _, err := l.load()
+  return data, err
+}
+
+// list returns the task list with the given id
+func (d *localData) list(id string) (*localList, error) {
+  for _, l := range d.Lists {
+    if l.ID == id {
+      return l, nil
+    }
+  }
+  return nil, ErrNotFound
+}
+
+// task returns the task with the given id in the task list with the given
+// id
+func (d *localData) task(listID string, id string) (*Task, error) {
+  l, err := d.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  for _, t := range l.Tasks {
+    if t.ID == id {
+      return t, nil
+    }
+  }
+  return nil, ErrNotFound
+}
+
+// newID returns a random id for a task or task list
+func newID() string {
+  b := make([]byte, 12)
+  rand.Read(b)
+  return hex.EncodeToString(b)
+}
+
+// touch records that t changed now
+func touch(t *Task) {
+  t.Updated = time.Now().UTC()
+  t.Etag = strconv.FormatInt(t.Updated.UnixNano(), 36)
+}
+
+// copyTask returns a copy of t, so callers can not change stored tasks
+func copyTask(t *Task) *Task {
+  c := *t
+  return &c
+}
+
+// Lists returns all task lists
+func (l *Local) Lists(ctx context.Context) ([]*TaskList, error) {
+  data, err := l.read()
+  if err != nil {
+    return nil, err
+  }
+  var lists []*TaskList
+  for _, list := range data.Lists {
+    tl := list.TaskList
+    lists = append(lists, &tl)
+  }
+  return lists, nil
+}
+
+// FindList returns the task list with the given title, or ErrNotFound
+func (l *Local) FindList(ctx context.Context, title string) (*TaskList, error) {
+  lists, err := l.Lists(ctx)
+  if err != nil {
+    return nil, err
+  }
+  for _, list := range lists {
+    if list.Title == title {
+      return list, nil
+    }
+  }
+  return nil, ErrNotFound
+}
+
+// CreateList creates a task list with the given title
+func (l *Local) CreateList(ctx context.Context, title string) (*TaskList, error) {
+  list := &localList{TaskList: TaskList{ID: newID(), Title: title}}
+  err := l.update(func(data *localData) error {
+    data.Lists = append(data.Lists, list)
+    return nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  return &list.TaskList, nil
+}
+
+// RenameList changes the title of a task list
+func (l *Local) RenameList(ctx context.Context, listID string, title string) (*TaskList, error) {
+  var renamed TaskList
+  err := l.update(func(data *localData) error {
+    list, err := data.list(listID)
+    if err != nil {
+      return err
+    }
+    list.Title = title
+    renamed = list.TaskList
+    return nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  return &renamed, nil
+}
+
+// DeleteList deletes a task list and all of its tasks
+func (l *Local) DeleteList(ctx context.Context, listID string) error {
+  return l.update(func(data *localData) error {
+    for i, list := range data.Lists {
+      if list.ID == listID {
+        data.Lists = append(data.Lists[:i], data.Lists[i+1:]...)
+        return nil
+      }
+    }
+    return ErrNotFound
+  })
+}
+
+// List returns the uncompleted tasks of a task list, in list order with
+// subtasks following their parent
+func (l *Local) List(ctx context.Context, listID string) ([]*Task, error) {
+  data, err := l.read()
+  if err != nil {
+    return nil, err
+  }
+  list, err := data.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  var items []*Task
+  for _, t := range list.Tasks {
+    if !t.Done() {
+      items = append(items, copyTask(t))
+    }
+  }
+  sortByPosition(items)
+  return items, nil
+}
+
+// Completed returns the completed tasks of a task list that were completed
+// between min and max, most recent first
+func (l *Local) Completed(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  data, err := l.read()
+  if err != nil {
+    return nil, err
+  }
+  list, err := data.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  var items []*Task
+  for _, t := range list.Tasks {
+    if !t.Done() || !min.IsZero() && t.Completed.Before(min) || !max.IsZero() && t.Completed.After(max) {
+      continue
+    }
+    items = append(items, copyTask(t))
+  }
+  sort.SliceStable(items, func(i, j int) bool {
+    return items[i].Completed.After(items[j].Completed)
+  })
+  return items, nil
+}
+
+// Get returns a single task, or ErrNotFound
+func (l *Local) Get(ctx context.Context, listID string, id string) (*Task, error) {
+  data, err := l.read()
+  if err != nil {
+    return nil, err
+  }
+  t, err := data.task(listID, id)
+  if err != nil {
+    return nil, err
+  }
+  return copyTask(t), nil
+}
+
+// Add creates task in a task list, as a subtask if its Parent is set. The
+// ID and Position of task are ignored.
+// It returns the created task
+func (l *Local) Add(ctx context.Context, listID string, task *Task) (*Task, error) {
+  created := copyTask(task)
+  err := l.update(func(data *localData) error {
+    list, err := data.list(listID)
+    if err != nil {
+      return err
+    }
+    if created.Parent != "" {
+      if _, err := data.task(listID, created.Parent); err != nil {
+        return fmt.Errorf("parent task %s: %w", created.Parent, err)
+      }
+    }
+    data.Next++
+    created.ID = newID()
+    created.Position = fmt.Sprintf("%020d", data.Next)
+    created.Due = Date(created.Due)
+    touch(created)
+    if created.Created.IsZero() {
+      created.Created = created.Updated
+    }
+    list.Tasks = append(list.Tasks, created)
+    return nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  return copyTask(created), nil
+}
+
+// change applies fn to a stored task and returns a copy of the result
+func (l *Local) change(listID string, id string, fn func(t *Task)) (*Task, error) {
+  var changed *Task
+  err := l.update(func(data *localData) error {
+    t, err := data.task(listID, id)
+    if err != nil {
+      return err
+    }
+    fn(t)
+    touch(t)
+    changed = copyTask(t)
+    return nil
+  })
+  return changed, err
+}
+
+// Complete marks a task as completed
+func (l *Local) Complete(ctx context.Context, listID string, id string) (*Task, error) {
+  return l.change(listID, id, func(t *Task) {
+    if !t.Done() {
+      t.Completed = time.Now().UTC()
+    }
+  })
+}
+
+// Uncomplete marks a completed task as not completed
+func (l *Local) Uncomplete(ctx context.Context, listID string, id string) (*Task, error) {
+  return l.change(listID, id, func(t *Task) {
+    t.Completed = time.Time{}
+  })
+}
+
+// Delete removes a task along with its subtasks
+func (l *Local) Delete(ctx context.Context, listID string, id string) error {
+  return l.update(func(data *localData) error {
+    list, err := data.list(listID)
+    if err != nil {
+      return err
+    }
+    if _, err := data.task(listID, id); err != nil {
+      return err
+    }
+    var kept []*Task
+    for _, t := range list.Tasks {
+      if t.ID != id && t.Parent != id {
+        kept = append(kept, t)
+      }
+    }
+    list.Tasks = kept
+    return nil
+  })
+}
+
+// Update applies patch to a task.
+// It returns the updated task
+func (l *Local) Update(ctx context.Context, listID string, id string, patch *Patch) (*Task, error) {
+  return l.change(listID, id, func(t *Task) {
+    *t = *patch.Apply(t)
+  })
+}
+
+// subtree returns the ids of the task with the given id and of all tasks
+// nested below it in tasks
+func subtree(tasks []*Task, id string) map[string]bool {
+  ids := map[string]bool{id: true}
+  for grown := true; grown; {
+    grown = false
+    for _, t := range tasks {
+      if ids[t.Parent] && !ids[t.ID] {
+        ids[t.ID] = true
+        grown = true
+      }
+    }
+  }
+  return ids
+}
+
+// Move places a task and its subtasks at dest.
+// It returns the moved task
+func (l *Local) Move(ctx context.Context, listID string, id string, dest Destination) (*Task, error) {
+  var moved *Task
+  err := l.update(func(data *localData) error {
+    from, err := data.list(listID)
+    if err != nil {
+      return err
+    }
+    t, err := data.task(listID, id)
+    if err != nil {
+      return err
+    }
+    to := from
+    if dest.ListID != "" && dest.ListID != listID {
+      if to, err = data.list(dest.ListID); err != nil {
+        return err
+      }
+      ids := subtree(from.Tasks, id)
+      var kept []*Task
+      for _, task := range from.Tasks {
+        if ids[task.ID] {
+          to.Tasks = append(to.Tasks, task)
+        } else {
+          kept = append(kept, task)
+        }
+      }
+      from.Tasks = kept
+    }
+    if dest.Parent != "" {
+      if subtree(to.Tasks, id)[dest.Parent] {
+        return fmt.Errorf("can not move a task below itself")
+      }
+      if _, err := data.task(to.ID, dest.Parent); err != nil {
+        return fmt.Errorf("parent task %s: %w", dest.Parent, err)
+      }
+    }
+    t.Parent = dest.Parent
+
+    var siblings []*Task
+    for _, task := range to.Tasks {
+      if task.Parent == dest.Parent && !task.Done() {
+        siblings = append(siblings, task)
+      }
+    }
+    sort.SliceStable(siblings, func(i, j int) bool {
+      return siblings[i].Position < siblings[j].Position
+    })
+    for _, task := range reorder(siblings, t, dest.Previous) {
+      data.Next++
+      task.Position = fmt.Sprintf("%020d", data.Next)
+    }
+    touch(t)
+    moved = copyTask(t)
+    return nil
+  })
+  return moved, err
+}
+
+// Due returns the uncompleted tasks of a task list due on the days from min
+// to max, in list order
+func (l *Local) Due(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  items, err := l.List(ctx, listID)
+  if err != nil {
+    return nil, err
+  }
+  return dueBetween(items, min, max), nil
+}
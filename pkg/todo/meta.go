@@ -0,0 +1,228 @@
+package todo
+
+import (
+  "fmt"
+  "net/url"
+  "sort"
+  "strings"
+  "time"
+)
+
+// metaPrefix starts the last line of a task's notes when the task carries
+// fields Google Tasks has no room for, such as its priority. The line
+// holds space separated key=value pairs with URL-escaped values
+const metaPrefix = "#todo "
+
+// Metadata keys of the fields of Task stored in the notes
+const (
+  metaPriority = "priority"
+  metaTags     = "tags"
+  metaEvery    = "every"
+  metaRemind   = "remind"
+  metaCreated  = "created"
+  metaSnooze   = "snooze"
+  metaBlocked  = "blocked"
+  metaStarred  = "starred"
+)
+
+// Priority is the importance of a task
+type Priority int
+
+// Priorities in increasing order of importance
+const (
+  PriorityNone Priority = iota
+  PriorityLow
+  PriorityMedium
+  PriorityHigh
+)
+
+var priorityNames = map[Priority]string{
+  PriorityNone:   "none",
+  PriorityLow:    "low",
+  PriorityMedium: "med",
+  PriorityHigh:   "high",
+}
+
+// ParsePriority parses a priority name: high, med, low or none, or their
+// first letters. The empty string is PriorityNone
+func ParsePriority(s string) (Priority, error) {
+  switch strings.ToLower(s) {
+  case "", "none", "n":
+    return PriorityNone, nil
+  case "low", "l":
+    return PriorityLow, nil
+  case "med", "medium", "m":
+    return PriorityMedium, nil
+  case "high", "h":
+    return PriorityHigh, nil
+  }
+  return PriorityNone, fmt.Errorf("unknown priority '%s', expected high, med, low or none", s)
+}
+
+func (p Priority) String() string {
+  if name, ok := priorityNames[p]; ok {
+    return name
+  }
+  return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// MarshalText encodes p by name
+func (p Priority) MarshalText() ([]byte, error) {
+  return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a priority name
+func (p *Priority) UnmarshalText(b []byte) error {
+  parsed, err := ParsePriority(string(b))
+  *p = parsed
+  return err
+}
+
+// splitNotes separates the metadata line from the rest of notes
+func splitNotes(notes string) (string, map[string]string) {
+  i := strings.LastIndex(notes, "\n") + 1
+  if !strings.HasPrefix(notes[i:], metaPrefix) {
+    return notes, nil
+  }
+  meta := map[string]string{}
+  for _, field := range strings.Fields(strings.TrimPrefix(notes[i:], metaPrefix)) {
+    kv := strings.SplitN(field, "=", 2)
+    if len(kv) != 2 {
+      continue
+    }
+    if v, err := url.QueryUnescape(kv[1]); err == nil {
+      meta[kv[0]] = v
+    }
+  }
+  return strings.TrimSuffix(notes[:i], "\n"), meta
+}
+
+// joinNotes appends the metadata line to notes, if there is any metadata
+func joinNotes(notes string, meta map[string]string) string {
+  var keys []string
+  for k, v := range meta {
+    if v != "" {
+      keys = append(keys, k)
+    }
+  }
+  if len(keys) == 0 {
+    return notes
+  }
+  sort.Strings(keys)
+
+  var fields []string
+  for _, k := range keys {
+    // commas separate list values such as tags and need no escaping
+    v := strings.Replace(url.QueryEscape(meta[k]), "%2C", ",", -1)
+    fields = append(fields, k+"="+v)
+  }
+  line := metaPrefix + strings.Join(fields, " ")
+  if notes == "" {
+    return line
+  }
+  return notes + "\n" + line
+}
+
+// decodeMeta moves the metadata held in the notes of t into its fields
+func decodeMeta(t *Task, notes string) {
+  t.Notes, t.Meta = splitNotes(notes)
+  if p, ok := t.Meta[metaPriority]; ok {
+    t.Priority, _ = ParsePriority(p)
+    delete(t.Meta, metaPriority)
+  }
+  if tags, ok := t.Meta[metaTags]; ok {
+    t.Tags = strings.Split(tags, ",")
+    delete(t.Meta, metaTags)
+  }
+  if remind, ok := t.Meta[metaRemind]; ok {
+    if d, err := time.ParseDuration(remind); err == nil {
+      t.Remind = d
+      delete(t.Meta, metaRemind)
+    }
+  }
+  if created, ok := t.Meta[metaCreated]; ok {
+    if c, err := time.Parse(icalStamp, created); err == nil {
+      t.Created = c
+      delete(t.Meta, metaCreated)
+    }
+  }
+  if blocked, ok := t.Meta[metaBlocked]; ok {
+    t.BlockedBy = strings.Split(blocked, ",")
+    delete(t.Meta, metaBlocked)
+  }
+  if starred, ok := t.Meta[metaStarred]; ok {
+    t.Starred = starred == "1"
+    delete(t.Meta, metaStarred)
+  }
+  if snooze, ok := t.Meta[metaSnooze]; ok {
+    if d, err := time.Parse("2006-01-02", snooze); err == nil {
+      t.Snooze = d
+      delete(t.Meta, metaSnooze)
+    }
+  }
+  if every, ok := t.Meta[metaEvery]; ok {
+    if r, err := ParseRecurrence(every); err == nil {
+      t.Every = r
+      delete(t.Meta, metaEvery)
+    }
+  }
+  if len(t.Meta) == 0 {
+    t.Meta = nil
+  }
+}
+
+// encodeMeta returns the notes of t with its metadata appended
+func encodeMeta(t *Task) string {
+  meta := map[string]string{}
+  for k, v := range t.Meta {
+    meta[k] = v
+  }
+  if t.Priority != PriorityNone {
+    meta[metaPriority] = t.Priority.String()
+  }
+  if len(t.Tags) > 0 {
+    meta[metaTags] = strings.Join(t.Tags, ",")
+  }
+  if t.Every != nil {
+    meta[metaEvery] = t.Every.String()
+  }
+  if t.Remind > 0 {
+    meta[metaRemind] = FormatDuration(t.Remind)
+  }
+  if !t.Created.IsZero() {
+    meta[metaCreated] = t.Created.UTC().Format(icalStamp)
+  }
+  if len(t.BlockedBy) > 0 {
+    meta[metaBlocked] = strings.Join(t.BlockedBy, ",")
+  }
+  if t.Starred {
+    meta[metaStarred] = "1"
+  }
+  if !t.Snooze.IsZero() {
+    meta[metaSnooze] = t.Snooze.Format("2006-01-02")
+  }
+  return joinNotes(t.Notes, meta)
+}
+
+// FormatDuration prints d without the zero minutes and seconds
+// time.Duration.String adds, as in "1h" instead of "1h0m0s"
+func FormatDuration(d time.Duration) string {
+  s := d.String()
+  if strings.HasSuffix(s, "m0s") {
+    s = strings.TrimSuffix(s, "0s")
+  }
+  if strings.HasSuffix(s, "h0m") {
+    s = strings.TrimSuffix(s, "0m")
+  }
+  return s
+}
+
+// HasTag reports whether t is tagged with tag, ignoring case
+func (t *Task) HasTag(tag string) bool {
+  for _, tt := range t.Tags {
+    if strings.EqualFold(tt, tag) {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,84 @@
+package todo
+
+import (
+  "net/http"
+  "sync"
+  "time"
+)
+
+// DefaultQPS is the rate at which a RateLimitTransport with no QPS set
+// sends requests, well below the per-user quota of Google Tasks
+const DefaultQPS = 10
+
+// RateLimitTransport spaces out requests with a token bucket, so that bulk
+// operations stay within the API's per-user quota instead of failing
+// with 429 or 403 rateLimitExceeded. Bursts of up to Burst requests are
+// sent at once, after which requests wait for the bucket to refill at
+// QPS tokens per second
+type RateLimitTransport struct {
+  // Base sends the requests, http.DefaultTransport if nil
+  Base http.RoundTripper
+  // QPS is how many requests per second are sent at most. Zero means
+  // DefaultQPS
+  QPS float64
+  // Burst is how many requests may be sent at once. Zero means QPS,
+  // rounded up
+  Burst int
+
+  mu     sync.Mutex
+  tokens float64
+  last   time.Time
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  base := t.Base
+  if base == nil {
+    base = http.DefaultTransport
+  }
+  if wait := t.reserve(); wait > 0 {
+    timer := time.NewTimer(wait)
+    select {
+    case <-req.Context().Done():
+      timer.Stop()
+      t.mu.Lock()
+      t.tokens++
+      t.mu.Unlock()
+      return nil, req.Context().Err()
+    case <-timer.C:
+    }
+  }
+  return base.RoundTrip(req)
+}
+
+// reserve takes a token from the bucket and returns how long to wait
+// until it is available
+func (t *RateLimitTransport) reserve() time.Duration {
+  qps := t.QPS
+  if qps <= 0 {
+    qps = DefaultQPS
+  }
+  burst := float64(t.Burst)
+  if burst <= 0 {
+    burst = float64(int(qps + 0.999))
+  }
+
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  now := time.Now()
+  if t.last.IsZero() {
+    t.tokens = burst
+  } else {
+    t.tokens += now.Sub(t.last).Seconds() * qps
+    if t.tokens > burst {
+      t.tokens = burst
+    }
+  }
+  t.last = now
+  // tokens may go below zero: each waiting request holds a reservation
+  t.tokens--
+  if t.tokens >= 0 {
+    return 0
+  }
+  return time.Duration(-t.tokens / qps * float64(time.Second))
+}
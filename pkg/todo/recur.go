@@ -0,0 +1,239 @@
+package todo
+
+import (
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Frequency is the unit a Recurrence repeats in
+type Frequency int
+
+// Frequencies of recurrences
+const (
+  Daily Frequency = iota
+  Weekly
+  Monthly
+  Yearly
+)
+
+// frequencyUnits are the units of frequencies in the short form of
+// recurrences, such as "3d"
+var frequencyUnits = map[Frequency]string{Daily: "d", Weekly: "w", Monthly: "m", Yearly: "y"}
+
+// rruleFrequencies are the FREQ values of iCalendar RRULEs
+var rruleFrequencies = map[string]Frequency{
+  "DAILY": Daily, "WEEKLY": Weekly, "MONTHLY": Monthly, "YEARLY": Yearly,
+}
+
+// weekdayCodes are the two letter weekday names used by RRULE BYDAY
+var weekdayCodes = []string{"su", "mo", "tu", "we", "th", "fr", "sa"}
+
+// Recurrence is a rule for repeating a task every Interval days, weeks,
+// months or years. Weekly rules may name the Weekdays they repeat on
+type Recurrence struct {
+  Freq     Frequency
+  Interval int
+  Weekdays []time.Weekday
+}
+
+// ParseRecurrence parses a recurrence rule. It accepts short forms such as
+// "3d", "2w", "1m" or "1y", optionally followed by weekdays for weekly
+// rules as in "1w-mo,th", the words daily, weekly, monthly, yearly and
+// weekdays, and iCalendar RRULEs such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO"
+func ParseRecurrence(s string) (*Recurrence, error) {
+  s = strings.TrimSpace(s)
+  lower := strings.ToLower(s)
+  switch lower {
+  case "daily":
+    return &Recurrence{Freq: Daily, Interval: 1}, nil
+  case "weekly":
+    return &Recurrence{Freq: Weekly, Interval: 1}, nil
+  case "monthly":
+    return &Recurrence{Freq: Monthly, Interval: 1}, nil
+  case "yearly":
+    return &Recurrence{Freq: Yearly, Interval: 1}, nil
+  case "weekdays":
+    return &Recurrence{Freq: Weekly, Interval: 1, Weekdays: []time.Weekday{
+      time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday,
+    }}, nil
+  }
+  if strings.Contains(s, "=") {
+    return parseRRule(strings.TrimPrefix(s, "RRULE:"))
+  }
+
+  rule, days := lower, ""
+  if i := strings.Index(lower, "-"); i >= 0 {
+    rule, days = lower[:i], lower[i+1:]
+  }
+  r := &Recurrence{Interval: 1}
+  unit := rule
+  if n := strings.IndexFunc(rule, func(c rune) bool { return c < '0' || c > '9' }); n > 0 {
+    interval, err := strconv.Atoi(rule[:n])
+    if err != nil {
+      return nil, fmt.Errorf("invalid recurrence '%s'", s)
+    }
+    r.Interval, unit = interval, rule[n:]
+  }
+  found := false
+  for f, u := range frequencyUnits {
+    if u == unit {
+      r.Freq, found = f, true
+    }
+  }
+  if !found || r.Interval < 1 {
+    return nil, fmt.Errorf("invalid recurrence '%s', expected e.g. 3d, 2w, 1m or daily", s)
+  }
+  if days != "" {
+    if err := r.parseWeekdays(days); err != nil {
+      return nil, err
+    }
+  }
+  return r, nil
+}
+
+// parseRRule parses the FREQ, INTERVAL and BYDAY parts of an RRULE
+func parseRRule(s string) (*Recurrence, error) {
+  r := &Recurrence{Interval: 1}
+  freq := false
+  for _, part := range strings.Split(s, ";") {
+    kv := strings.SplitN(part, "=", 2)
+    if len(kv) != 2 {
+      return nil, fmt.Errorf("invalid RRULE part '%s'", part)
+    }
+    switch strings.ToUpper(kv[0]) {
+    case "FREQ":
+      f, ok := rruleFrequencies[strings.ToUpper(kv[1])]
+      if !ok {
+        return nil, fmt.Errorf("unsupported RRULE frequency '%s'", kv[1])
+      }
+      r.Freq, freq = f, true
+    case "INTERVAL":
+      n, err := strconv.Atoi(kv[1])
+      if err != nil || n < 1 {
+        return nil, fmt.Errorf("invalid RRULE interval '%s'", kv[1])
+      }
+      r.Interval = n
+    case "BYDAY":
+      if err := r.parseWeekdays(strings.ToLower(kv[1])); err != nil {
+        return nil, err
+      }
+    default:
+      return nil, fmt.Errorf("unsupported RRULE part '%s'", kv[0])
+    }
+  }
+  if !freq {
+    return nil, fmt.Errorf("RRULE '%s' has no FREQ", s)
+  }
+  return r, nil
+}
+
+// parseWeekdays sets the weekdays of a weekly rule from a comma separated
+// list of two letter weekday names
+func (r *Recurrence) parseWeekdays(days string) error {
+  if r.Freq != Weekly {
+    return fmt.Errorf("only weekly recurrences can name weekdays")
+  }
+  for _, day := range strings.Split(days, ",") {
+    found := false
+    for wd, code := range weekdayCodes {
+      if code == day {
+        r.Weekdays = append(r.Weekdays, time.Weekday(wd))
+        found = true
+      }
+    }
+    if !found {
+      return fmt.Errorf("unknown weekday '%s', expected mo, tu, we, th, fr, sa or su", day)
+    }
+  }
+  sort.Slice(r.Weekdays, func(i, j int) bool { return r.Weekdays[i] < r.Weekdays[j] })
+  return nil
+}
+
+// String returns the short form of r, such as "3d" or "1w-mo,th", or an
+// empty string for the zero Recurrence
+func (r *Recurrence) String() string {
+  if r.Interval == 0 {
+    return ""
+  }
+  s := strconv.Itoa(r.Interval) + frequencyUnits[r.Freq]
+  if len(r.Weekdays) > 0 {
+    var days []string
+    for _, wd := range r.Weekdays {
+      days = append(days, weekdayCodes[wd])
+    }
+    s += "-" + strings.Join(days, ",")
+  }
+  return s
+}
+
+// MarshalText encodes r in its short form
+func (r *Recurrence) MarshalText() ([]byte, error) {
+  return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes a recurrence in any form ParseRecurrence accepts,
+// or the zero Recurrence from an empty string
+func (r *Recurrence) UnmarshalText(b []byte) error {
+  if len(b) == 0 {
+    *r = Recurrence{}
+    return nil
+  }
+  parsed, err := ParseRecurrence(string(b))
+  if err != nil {
+    return err
+  }
+  *r = *parsed
+  return nil
+}
+
+// Next returns the first date the task recurs on after the date of t
+func (r *Recurrence) Next(t time.Time) time.Time {
+  interval := r.Interval
+  if interval < 1 {
+    interval = 1
+  }
+  switch r.Freq {
+  case Daily:
+    return t.AddDate(0, 0, interval)
+  case Weekly:
+    if len(r.Weekdays) == 0 {
+      return t.AddDate(0, 0, 7*interval)
+    }
+    // weeks start on Monday, as they do for RRULEs by default
+    week := func(d time.Time) int64 {
+      days := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+      // 1970-01-05 was a Monday
+      return (days - 4) / 7
+    }
+    for d := 1; d <= 7*interval+7; d++ {
+      next := t.AddDate(0, 0, d)
+      if (week(next)-week(t))%int64(interval) != 0 {
+        continue
+      }
+      for _, wd := range r.Weekdays {
+        if next.Weekday() == wd {
+          return next
+        }
+      }
+    }
+    return t.AddDate(0, 0, 7*interval)
+  case Monthly:
+    return addMonths(t, interval)
+  }
+  return addMonths(t, 12*interval)
+}
+
+// addMonths adds n months to t, moving to the last day of the month when
+// the day does not exist there, so that Jan 31 is followed by Feb 28
+func addMonths(t time.Time, n int) time.Time {
+  first := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+  last := first.AddDate(0, 1, -1).Day()
+  day := t.Day()
+  if day > last {
+    day = last
+  }
+  return first.AddDate(0, 0, day-1)
+}
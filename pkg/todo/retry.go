@@ -0,0 +1,124 @@
+package todo
+
+import (
+  "bytes"
+  "io"
+  "io/ioutil"
+  "math/rand"
+  "net/http"
+  "strconv"
+  "time"
+)
+
+// DefaultMaxAttempts is how often a RetryTransport with no MaxAttempts
+// set tries a request
+const DefaultMaxAttempts = 5
+
+// Bounds of the delay between attempts
+const (
+  retryBaseDelay = 500 * time.Millisecond
+  retryMaxDelay  = 30 * time.Second
+)
+
+// RetryTransport retries requests that fail with 429 Too Many Requests,
+// 403 rateLimitExceeded as Google APIs answer when requests come in too
+// fast, or a 5xx server error, waiting with exponential backoff and jitter between
+// attempts, or as long as a Retry-After header asks for. Requests whose
+// body can not be replayed are sent only once
+type RetryTransport struct {
+  // Base sends the requests, http.DefaultTransport if nil
+  Base http.RoundTripper
+  // MaxAttempts is the most times a request is sent, including the first
+  // one. Zero means DefaultMaxAttempts
+  MaxAttempts int
+  // OnRetry, if set, is called before waiting to send req again after a
+  // response with the given status
+  OnRetry func(req *http.Request, status int, wait time.Duration)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  base := t.Base
+  if base == nil {
+    base = http.DefaultTransport
+  }
+  attempts := t.MaxAttempts
+  if attempts <= 0 {
+    attempts = DefaultMaxAttempts
+  }
+  if req.Body != nil && req.GetBody == nil {
+    attempts = 1
+  }
+
+  for attempt := 1; ; attempt++ {
+    res, err := base.RoundTrip(req)
+    if err != nil || attempt >= attempts || !retryable(res) {
+      return res, err
+    }
+    wait := retryDelay(attempt, res.Header.Get("Retry-After"))
+    res.Body.Close()
+    if t.OnRetry != nil {
+      t.OnRetry(req, res.StatusCode, wait)
+    }
+
+    timer := time.NewTimer(wait)
+    select {
+    case <-req.Context().Done():
+      timer.Stop()
+      return nil, req.Context().Err()
+    case <-timer.C:
+    }
+    if req.GetBody != nil {
+      body, err := req.GetBody()
+      if err != nil {
+        return nil, err
+      }
+      req = req.Clone(req.Context())
+      req.Body = body
+    }
+  }
+}
+
+// retryable reports whether res is worth retrying. The body of 403
+// responses is read to tell rate limits from denied access, and replaced
+func retryable(res *http.Response) bool {
+  if res.StatusCode == http.StatusForbidden {
+    body, err := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+    res.Body.Close()
+    res.Body = ioutil.NopCloser(bytes.NewReader(body))
+    return err == nil && rateLimited(res.StatusCode, body)
+  }
+  return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// rateLimited reports whether a response with the given status and body
+// means requests were sent too fast, rather than that the daily quota is
+// used up or access was denied
+func rateLimited(status int, body []byte) bool {
+  if status == http.StatusTooManyRequests {
+    return true
+  }
+  return status == http.StatusForbidden &&
+    (bytes.Contains(body, []byte(`"rateLimitExceeded"`)) || bytes.Contains(body, []byte(`"userRateLimitExceeded"`)))
+}
+
+// retryDelay returns how long to wait before the attempt after the given
+// one. retryAfter is the Retry-After header of the failed response, in
+// seconds or as an HTTP date
+func retryDelay(attempt int, retryAfter string) time.Duration {
+  if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+    return time.Duration(secs) * time.Second
+  }
+  if t, err := http.ParseTime(retryAfter); err == nil {
+    if d := time.Until(t); d > 0 {
+      return d
+    }
+    return 0
+  }
+  max := retryBaseDelay << uint(attempt-1)
+  if max > retryMaxDelay || max <= 0 {
+    max = retryMaxDelay
+  }
+  // full jitter spreads out clients that failed at the same time
+  return time.Duration(rand.Int63n(int64(max)))
+}
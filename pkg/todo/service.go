@@ -0,0 +1,131 @@
+package todo
+
+import (
+  "context"
+
+  "google.golang.org/api/tasks/v1"
+)
+
+// TaskQuery selects the tasks Service.ListTasks returns, like the
+// parameters of the tasks.list method of the Tasks API. Empty bounds,
+// formatted as RFC 3339 timestamps, leave that end of the range open
+type TaskQuery struct {
+  ShowCompleted bool
+  ShowHidden    bool
+  DueMin        string
+  DueMax        string
+  CompletedMin  string
+  CompletedMax  string
+  MaxResults    int64
+  PageToken     string
+}
+
+// Service is the part of the Google Tasks API a Client uses. NewClient
+// calls the API; tests can pass a fake such as the one of package
+// todotest to NewServiceClient instead. Failures are reported as
+// *googleapi.Error, with code 404 for tasks and task lists that do not
+// exist
+type Service interface {
+  ListTaskLists(ctx context.Context, pageToken string) (*tasks.TaskLists, error)
+  InsertTaskList(ctx context.Context, list *tasks.TaskList) (*tasks.TaskList, error)
+  PatchTaskList(ctx context.Context, listID string, list *tasks.TaskList) (*tasks.TaskList, error)
+  DeleteTaskList(ctx context.Context, listID string) error
+  ListTasks(ctx context.Context, listID string, q TaskQuery) (*tasks.Tasks, error)
+  GetTask(ctx context.Context, listID string, id string) (*tasks.Task, error)
+  // InsertTask creates task, as the first subtask of parent if it is
+  // not empty and else first in the list
+  InsertTask(ctx context.Context, listID string, parent string, task *tasks.Task) (*tasks.Task, error)
+  // PatchTask changes the fields of the task that are set in task, or
+  // listed in its ForceSendFields, and clears those in its NullFields
+  PatchTask(ctx context.Context, listID string, id string, task *tasks.Task) (*tasks.Task, error)
+  DeleteTask(ctx context.Context, listID string, id string) error
+  MoveTask(ctx context.Context, listID string, id string, dest Destination) (*tasks.Task, error)
+  // ClearTasks hides the completed tasks of a task list
+  ClearTasks(ctx context.Context, listID string) error
+}
+
+// apiService is the Service of the Tasks API
+type apiService struct {
+  srv *tasks.Service
+}
+
+func (s *apiService) ListTaskLists(ctx context.Context, pageToken string) (*tasks.TaskLists, error) {
+  call := s.srv.Tasklists.List().MaxResults(pageSize)
+  if pageToken != "" {
+    call = call.PageToken(pageToken)
+  }
+  return call.Context(ctx).Do()
+}
+
+func (s *apiService) InsertTaskList(ctx context.Context, list *tasks.TaskList) (*tasks.TaskList, error) {
+  return s.srv.Tasklists.Insert(list).Context(ctx).Do()
+}
+
+func (s *apiService) PatchTaskList(ctx context.Context, listID string, list *tasks.TaskList) (*tasks.TaskList, error) {
+  return s.srv.Tasklists.Patch(listID, list).Context(ctx).Do()
+}
+
+func (s *apiService) DeleteTaskList(ctx context.Context, listID string) error {
+  return s.srv.Tasklists.Delete(listID).Context(ctx).Do()
+}
+
+func (s *apiService) ListTasks(ctx context.Context, listID string, q TaskQuery) (*tasks.Tasks, error) {
+  call := s.srv.Tasks.List(listID).ShowCompleted(q.ShowCompleted).ShowHidden(q.ShowHidden)
+  if q.PageToken != "" {
+    call = call.PageToken(q.PageToken)
+  }
+  if q.MaxResults > 0 {
+    call = call.MaxResults(q.MaxResults)
+  }
+  if q.DueMin != "" {
+    call = call.DueMin(q.DueMin)
+  }
+  if q.DueMax != "" {
+    call = call.DueMax(q.DueMax)
+  }
+  if q.CompletedMin != "" {
+    call = call.CompletedMin(q.CompletedMin)
+  }
+  if q.CompletedMax != "" {
+    call = call.CompletedMax(q.CompletedMax)
+  }
+  return call.Context(ctx).Do()
+}
+
+func (s *apiService) GetTask(ctx context.Context, listID string, id string) (*tasks.Task, error) {
+  return s.srv.Tasks.Get(listID, id).Context(ctx).Do()
+}
+
+func (s *apiService) InsertTask(ctx context.Context, listID string, parent string, task *tasks.Task) (*tasks.Task, error) {
+  call := s.srv.Tasks.Insert(listID, task)
+  if parent != "" {
+    call = call.Parent(parent)
+  }
+  return call.Context(ctx).Do()
+}
+
+func (s *apiService) PatchTask(ctx context.Context, listID string, id string, task *tasks.Task) (*tasks.Task, error) {
+  return s.srv.Tasks.Patch(listID, id, task).Context(ctx).Do()
+}
+
+func (s *apiService) DeleteTask(ctx context.Context, listID string, id string) error {
+  return s.srv.Tasks.Delete(listID, id).Context(ctx).Do()
+}
+
+func (s *apiService) ClearTasks(ctx context.Context, listID string) error {
+  return s.srv.Tasks.Clear(listID).Context(ctx).Do()
+}
+
+func (s *apiService) MoveTask(ctx context.Context, listID string, id string, dest Destination) (*tasks.Task, error) {
+  call := s.srv.Tasks.Move(listID, id)
+  if dest.Parent != "" {
+    call = call.Parent(dest.Parent)
+  }
+  if dest.Previous != "" {
+    call = call.Previous(dest.Previous)
+  }
+  if dest.ListID != "" && dest.ListID != listID {
+    call = call.DestinationTasklist(dest.ListID)
+  }
+  return call.Context(ctx).Do()
+}
@@ -0,0 +1,492 @@
+// Package todo is a small client for Google Tasks. It works with plain
+// Task and TaskList values instead of the generated API types and reports
+// failures as errors.
+package todo
+
+import (
+  "context"
+  "errors"
+  "net/http"
+  "sort"
+  "time"
+
+  "google.golang.org/api/googleapi"
+  "google.golang.org/api/option"
+  "google.golang.org/api/tasks/v1"
+)
+
+// Scope is the OAuth scope a Client needs
+const Scope = tasks.TasksScope
+
+// ErrNotFound is returned when a task or task list does not exist
+var ErrNotFound = errors.New("not found")
+
+// dueLayout is the format of the due field of a task. Google Tasks only
+// stores the date, the time portion is always midnight UTC
+const dueLayout = "2006-01-02T15:04:05.000Z"
+
+// Statuses of a task
+const (
+  statusCompleted   = "completed"
+  statusNeedsAction = "needsAction"
+)
+
+// TaskList is a named list of tasks
+type TaskList struct {
+  ID    string `json:"id"`
+  Title string `json:"title"`
+}
+
+// Task is a single task. Due holds only a date, at midnight UTC, and is
+// zero if the task has no due date. Created is when the task was added,
+// zero if the backend does not know. Completed is zero for tasks that are
+// not done, and Hidden set once a completed task was cleared from the
+// list, see Clearer. Parent is the ID of the task this is a subtask of, and
+// Position orders the task among its siblings. Every is nil unless the
+// task recurs, and Remind is how long before it is due to remind of it,
+// zero for no reminder. Snooze is the date until which the task is
+// hidden from listings, zero if it is not snoozed. BlockedBy holds the IDs
+// of the tasks that must be completed first, and Starred pins the task to
+// the top of listings. Priority, Tags, Every, Remind, Snooze, BlockedBy,
+// Starred and Meta are stored
+// in a line at the end of the notes in Google Tasks, as is Created for
+// tasks added by todo. Meta holds any
+// key=value pairs there beyond the ones with fields of their own
+type Task struct {
+  ID        string            `json:"id"`
+  Title     string            `json:"title"`
+  Parent    string            `json:"parent,omitempty"`
+  Position  string            `json:"position,omitempty"`
+  Notes     string            `json:"notes,omitempty"`
+  Due       time.Time         `json:"due,omitempty"`
+  Priority  Priority          `json:"priority,omitempty"`
+  Tags      []string          `json:"tags,omitempty"`
+  Every     *Recurrence       `json:"every,omitempty"`
+  Remind    time.Duration     `json:"remind,omitempty"`
+  Snooze    time.Time         `json:"snooze,omitempty"`
+  BlockedBy []string          `json:"blockedBy,omitempty"`
+  Starred   bool              `json:"starred,omitempty"`
+  Meta      map[string]string `json:"meta,omitempty"`
+  Created   time.Time         `json:"created,omitempty"`
+  Completed time.Time         `json:"completed,omitempty"`
+  Hidden    bool              `json:"hidden,omitempty"`
+  Updated   time.Time         `json:"updated,omitempty"`
+  Etag      string            `json:"etag,omitempty"`
+  WebLink   string            `json:"webLink,omitempty"`
+}
+
+// Done reports whether the task is completed
+func (t *Task) Done() bool {
+  return !t.Completed.IsZero()
+}
+
+// Patch describes changes to a task. Nil fields are left unchanged, a zero
+// Due clears the due date, a zero Every stops the task from recurring and
+// a zero Remind removes its reminder, a zero Snooze unsnoozes it, an
+// empty BlockedBy unblocks it and a false Starred unstars it
+type Patch struct {
+  Title     *string        `json:"title,omitempty"`
+  Notes     *string        `json:"notes,omitempty"`
+  Due       *time.Time     `json:"due,omitempty"`
+  Priority  *Priority      `json:"priority,omitempty"`
+  Tags      *[]string      `json:"tags,omitempty"`
+  Every     *Recurrence    `json:"every,omitempty"`
+  Remind    *time.Duration `json:"remind,omitempty"`
+  Snooze    *time.Time     `json:"snooze,omitempty"`
+  BlockedBy *[]string      `json:"blockedBy,omitempty"`
+  Starred   *bool          `json:"starred,omitempty"`
+}
+
+// Empty reports whether p changes nothing
+func (p *Patch) Empty() bool {
+  return p.Title == nil && p.Notes == nil && p.Due == nil && p.Priority == nil &&
+    p.Tags == nil && p.Every == nil && p.Remind == nil && p.Snooze == nil &&
+    p.BlockedBy == nil && p.Starred == nil
+}
+
+// touchesNotes reports whether p changes anything stored in the notes of
+// the task in Google Tasks
+func (p *Patch) touchesNotes() bool {
+  return p.Notes != nil || p.Priority != nil || p.Tags != nil || p.Every != nil ||
+    p.Remind != nil || p.Snooze != nil || p.BlockedBy != nil || p.Starred != nil
+}
+
+// Apply returns a copy of t with the changes of p applied, the way the
+// server would apply them
+func (p *Patch) Apply(t *Task) *Task {
+  c := *t
+  if p.Title != nil {
+    c.Title = *p.Title
+  }
+  if p.Notes != nil {
+    c.Notes = *p.Notes
+  }
+  if p.Due != nil {
+    c.Due = Date(*p.Due)
+  }
+  if p.Priority != nil {
+    c.Priority = *p.Priority
+  }
+  if p.Tags != nil {
+    c.Tags = *p.Tags
+  }
+  if p.Every != nil {
+    c.Every = nil
+    if p.Every.Interval > 0 {
+      every := *p.Every
+      c.Every = &every
+    }
+  }
+  if p.Remind != nil {
+    c.Remind = *p.Remind
+  }
+  if p.Snooze != nil {
+    c.Snooze = Date(*p.Snooze)
+  }
+  if p.BlockedBy != nil {
+    c.BlockedBy = *p.BlockedBy
+  }
+  if p.Starred != nil {
+    c.Starred = *p.Starred
+  }
+  return &c
+}
+
+// Date truncates t to its date at midnight UTC, the way Google Tasks
+// stores due dates
+func Date(t time.Time) time.Time {
+  if t.IsZero() {
+    return t
+  }
+  return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Client talks to Google Tasks on behalf of an authenticated user
+type Client struct {
+  srv Service
+}
+
+// NewClient returns a Client sending its requests through httpClient,
+// which must carry the user's OAuth credentials
+func NewClient(ctx context.Context, httpClient *http.Client) (*Client, error) {
+  srv, err := tasks.NewService(ctx, option.WithHTTPClient(httpClient))
+  if err != nil {
+    return nil, err
+  }
+  return &Client{srv: &apiService{srv: srv}}, nil
+}
+
+// NewServiceClient returns a Client calling srv instead of the Tasks API
+func NewServiceClient(srv Service) *Client {
+  return &Client{srv: srv}
+}
+
+// pageSize is the most results the Tasks API returns per page
+const pageSize = 100
+
+// Lists returns all task lists of the user
+func (c *Client) Lists(ctx context.Context) ([]*TaskList, error) {
+  var lists []*TaskList
+  token := ""
+  for {
+    res, err := c.srv.ListTaskLists(ctx, token)
+    if err != nil {
+      return nil, wrap(err)
+    }
+    for _, l := range res.Items {
+      lists = append(lists, &TaskList{ID: l.Id, Title: l.Title})
+    }
+    if token = res.NextPageToken; token == "" {
+      return lists, nil
+    }
+  }
+}
+
+// FindList returns the task list with the given title, or ErrNotFound
+func (c *Client) FindList(ctx context.Context, title string) (*TaskList, error) {
+  lists, err := c.Lists(ctx)
+  if err != nil {
+    return nil, err
+  }
+  for _, l := range lists {
+    if l.Title == title {
+      return l, nil
+    }
+  }
+  return nil, ErrNotFound
+}
+
+// CreateList creates a task list with the given title
+func (c *Client) CreateList(ctx context.Context, title string) (*TaskList, error) {
+  l, err := c.srv.InsertTaskList(ctx, &tasks.TaskList{Title: title})
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return &TaskList{ID: l.Id, Title: l.Title}, nil
+}
+
+// RenameList changes the title of a task list
+func (c *Client) RenameList(ctx context.Context, listID string, title string) (*TaskList, error) {
+  l, err := c.srv.PatchTaskList(ctx, listID, &tasks.TaskList{Title: title})
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return &TaskList{ID: l.Id, Title: l.Title}, nil
+}
+
+// DeleteList deletes a task list and all of its tasks
+func (c *Client) DeleteList(ctx context.Context, listID string) error {
+  return wrap(c.srv.DeleteTaskList(ctx, listID))
+}
+
+// List returns the uncompleted tasks of a task list, in list order with
+// subtasks following their parent
+func (c *Client) List(ctx context.Context, listID string) ([]*Task, error) {
+  items, err := c.listTasks(ctx, listID, TaskQuery{})
+  if err != nil {
+    return nil, err
+  }
+  sortByPosition(items)
+  return items, nil
+}
+
+// listTasks returns the tasks of a task list selected by q, going through
+// all pages of results
+func (c *Client) listTasks(ctx context.Context, listID string, q TaskQuery) ([]*Task, error) {
+  var items []*Task
+  q.MaxResults = pageSize
+  for {
+    res, err := c.srv.ListTasks(ctx, listID, q)
+    if err != nil {
+      return nil, wrap(err)
+    }
+    for _, t := range res.Items {
+      items = append(items, fromAPI(t))
+    }
+    if q.PageToken = res.NextPageToken; q.PageToken == "" {
+      return items, nil
+    }
+  }
+}
+
+// Due returns the uncompleted tasks of a task list due on the days from
+// min to max, in list order, letting the Tasks API do the filtering. A
+// zero min or max leaves that end of the range open
+func (c *Client) Due(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  var q TaskQuery
+  if !min.IsZero() {
+    q.DueMin = Date(min).Format(time.RFC3339)
+  }
+  if !max.IsZero() {
+    q.DueMax = Date(max).Add(24*time.Hour - time.Second).Format(time.RFC3339)
+  }
+  items, err := c.listTasks(ctx, listID, q)
+  if err != nil {
+    return nil, err
+  }
+  sortByPosition(items)
+  return items, nil
+}
+
+// Completed returns the completed tasks of a task list, including hidden
+// ones, that were completed between min and max, most recent first. A
+// zero min or max leaves that end of the range open
+func (c *Client) Completed(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  q := TaskQuery{ShowCompleted: true, ShowHidden: true}
+  if !min.IsZero() {
+    q.CompletedMin = min.UTC().Format(time.RFC3339)
+  }
+  if !max.IsZero() {
+    q.CompletedMax = max.UTC().Format(time.RFC3339)
+  }
+  all, err := c.listTasks(ctx, listID, q)
+  if err != nil {
+    return nil, err
+  }
+  var items []*Task
+  for _, task := range all {
+    if task.Done() {
+      items = append(items, task)
+    }
+  }
+  sort.SliceStable(items, func(i, j int) bool {
+    return items[i].Completed.After(items[j].Completed)
+  })
+  return items, nil
+}
+
+// sortByPosition orders items by position, placing subtasks right after
+// their parent. Subtasks whose parent is not among items are ordered as
+// if they had none
+func sortByPosition(items []*Task) {
+  byID := map[string]*Task{}
+  for _, t := range items {
+    byID[t.ID] = t
+  }
+  key := func(t *Task) [2]string {
+    if p, ok := byID[t.Parent]; ok {
+      return [2]string{p.Position, t.Position}
+    }
+    return [2]string{t.Position, ""}
+  }
+  sort.SliceStable(items, func(i, j int) bool {
+    a, b := key(items[i]), key(items[j])
+    if a[0] != b[0] {
+      return a[0] < b[0]
+    }
+    return a[1] < b[1]
+  })
+}
+
+// Get returns a single task, or ErrNotFound
+func (c *Client) Get(ctx context.Context, listID string, id string) (*Task, error) {
+  t, err := c.srv.GetTask(ctx, listID, id)
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return fromAPI(t), nil
+}
+
+// Add creates task in a task list, as a subtask if its Parent is set. The
+// ID and Position of task are ignored.
+// It returns the created task
+func (c *Client) Add(ctx context.Context, listID string, task *Task) (*Task, error) {
+  if task.Created.IsZero() {
+    // Google Tasks does not record when tasks are created
+    stamped := *task
+    stamped.Created = time.Now().UTC()
+    task = &stamped
+  }
+  t := toAPI(task)
+  t.Id = ""
+  created, err := c.srv.InsertTask(ctx, listID, task.Parent, t)
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return fromAPI(created), nil
+}
+
+// Complete marks a task as completed
+func (c *Client) Complete(ctx context.Context, listID string, id string) (*Task, error) {
+  t, err := c.srv.PatchTask(ctx, listID, id, &tasks.Task{
+    Status: statusCompleted,
+  })
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return fromAPI(t), nil
+}
+
+// Uncomplete marks a completed task as not completed
+func (c *Client) Uncomplete(ctx context.Context, listID string, id string) (*Task, error) {
+  t, err := c.srv.PatchTask(ctx, listID, id, &tasks.Task{
+    Status:     statusNeedsAction,
+    NullFields: []string{"Completed"},
+  })
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return fromAPI(t), nil
+}
+
+// Delete removes a task
+func (c *Client) Delete(ctx context.Context, listID string, id string) error {
+  return wrap(c.srv.DeleteTask(ctx, listID, id))
+}
+
+// Update applies patch to a task. Patches changing fields stored in the
+// notes fetch the task first, so the rest of the notes are preserved.
+// It returns the updated task
+func (c *Client) Update(ctx context.Context, listID string, id string, patch *Patch) (*Task, error) {
+  t := &tasks.Task{}
+  if patch.Title != nil {
+    t.Title = *patch.Title
+    t.ForceSendFields = append(t.ForceSendFields, "Title")
+  }
+  if patch.touchesNotes() {
+    current, err := c.Get(ctx, listID, id)
+    if err != nil {
+      return nil, err
+    }
+    t.Notes = encodeMeta(patch.Apply(current))
+    t.ForceSendFields = append(t.ForceSendFields, "Notes")
+  }
+  if patch.Due != nil {
+    if patch.Due.IsZero() {
+      t.NullFields = append(t.NullFields, "Due")
+    } else {
+      t.Due = Date(*patch.Due).Format(dueLayout)
+    }
+  }
+  updated, err := c.srv.PatchTask(ctx, listID, id, t)
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return fromAPI(updated), nil
+}
+
+// fromAPI converts a task returned by the Tasks API
+func fromAPI(t *tasks.Task) *Task {
+  task := &Task{
+    ID:       t.Id,
+    Title:    t.Title,
+    Parent:   t.Parent,
+    Position: t.Position,
+    Hidden:   t.Hidden,
+    Etag:     t.Etag,
+    WebLink:  t.WebViewLink,
+  }
+  decodeMeta(task, t.Notes)
+  task.Due, _ = time.Parse(time.RFC3339, t.Due)
+  task.Updated, _ = time.Parse(time.RFC3339, t.Updated)
+  if t.Completed != nil {
+    task.Completed, _ = time.Parse(time.RFC3339, *t.Completed)
+  }
+  if t.Status == statusCompleted && task.Completed.IsZero() {
+    task.Completed = task.Updated
+  }
+  return task
+}
+
+// toAPI converts task for sending it to the Tasks API
+func toAPI(task *Task) *tasks.Task {
+  t := &tasks.Task{
+    Id:    task.ID,
+    Title: task.Title,
+    Notes: encodeMeta(task),
+  }
+  if !task.Due.IsZero() {
+    t.Due = Date(task.Due).Format(dueLayout)
+  }
+  if task.Done() {
+    t.Status = statusCompleted
+  }
+  return t
+}
+
+// wrap translates API errors meaning a resource does not exist into
+// ErrNotFound
+func wrap(err error) error {
+  var e *googleapi.Error
+  if errors.As(err, &e) && (e.Code == http.StatusNotFound || e.Code == http.StatusGone) {
+    return ErrNotFound
+  }
+  return err
+}
+
+// Clear hides all completed tasks of a task list from Google Tasks apps.
+// They are not deleted, and still returned by Completed
+func (c *Client) Clear(ctx context.Context, listID string) error {
+  return wrap(c.srv.ClearTasks(ctx, listID))
+}
+
+// Move places a task and its subtasks at dest, first among the subtasks
+// of the destination if its Previous is empty.
+// It returns the moved task
+func (c *Client) Move(ctx context.Context, listID string, id string, dest Destination) (*Task, error) {
+  t, err := c.srv.MoveTask(ctx, listID, id, dest)
+  if err != nil {
+    return nil, wrap(err)
+  }
+  return fromAPI(t), nil
+}
@@ -0,0 +1,461 @@
+package todo
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "sort"
+  "strings"
+  "time"
+)
+
+// TodoistURL is the base URL of the Todoist API
+const TodoistURL = "https://api.todoist.com/api/v1"
+
+// todoistCompletedRange is the longest period Todoist returns completed
+// tasks for in one request
+const todoistCompletedRange = 89 * 24 * time.Hour
+
+// Todoist is a Backend on top of the Todoist API. Projects are task
+// lists. Priorities and tags map to Todoist priorities and labels; fields
+// Todoist has no room for are kept in the task description the way Client
+// keeps them in the notes
+type Todoist struct {
+  // BaseURL is the URL of the API, TodoistURL by default
+  BaseURL    string
+  token      string
+  httpClient *http.Client
+}
+
+var _ Backend = (*Todoist)(nil)
+
+// NewTodoist returns a Todoist backend authenticating with the API token
+// of a Todoist account and sending its requests through httpClient, or
+// http.DefaultClient if it is nil
+func NewTodoist(token string, httpClient *http.Client) *Todoist {
+  if httpClient == nil {
+    httpClient = http.DefaultClient
+  }
+  return &Todoist{BaseURL: TodoistURL, token: token, httpClient: httpClient}
+}
+
+// TodoistError is an error response of the Todoist API
+type TodoistError struct {
+  Code    int
+  Message string
+}
+
+func (e *TodoistError) Error() string {
+  return fmt.Sprintf("todoist: %d %s", e.Code, e.Message)
+}
+
+// do sends a request with body encoded as JSON, or as a form if it is
+// url.Values, if not nil, and decodes the response into result, if not nil
+func (c *Todoist) do(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+  u := c.BaseURL + path
+  if len(query) > 0 {
+    u += "?" + query.Encode()
+  }
+  var r io.Reader
+  contentType := "application/json"
+  if form, ok := body.(url.Values); ok {
+    r = strings.NewReader(form.Encode())
+    contentType = "application/x-www-form-urlencoded"
+  } else if body != nil {
+    b, err := json.Marshal(body)
+    if err != nil {
+      return err
+    }
+    r = bytes.NewReader(b)
+  }
+  req, err := http.NewRequest(method, u, r)
+  if err != nil {
+    return err
+  }
+  req = req.WithContext(ctx)
+  req.Header.Set("Authorization", "Bearer "+c.token)
+  if body != nil {
+    req.Header.Set("Content-Type", contentType)
+  }
+
+  res, err := c.httpClient.Do(req)
+  if err != nil {
+    return err
+  }
+  defer res.Body.Close()
+  if res.StatusCode == http.StatusNotFound {
+    return ErrNotFound
+  }
+  if res.StatusCode >= 300 {
+    msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+    return &TodoistError{Code: res.StatusCode, Message: strings.TrimSpace(string(msg))}
+  }
+  if result == nil {
+    return nil
+  }
+  return json.NewDecoder(res.Body).Decode(result)
+}
+
+// todoistProject is a project as returned by the Todoist API
+type todoistProject struct {
+  ID   string `json:"id"`
+  Name string `json:"name"`
+}
+
+// todoistDue is the due date of a Todoist task
+type todoistDue struct {
+  Date string `json:"date"`
+}
+
+// todoistTask is a task as returned by the Todoist API
+type todoistTask struct {
+  ID          string      `json:"id"`
+  Content     string      `json:"content"`
+  Description string      `json:"description"`
+  ParentID    string      `json:"parent_id"`
+  ChildOrder  int         `json:"child_order"`
+  Priority    int         `json:"priority"`
+  Labels      []string    `json:"labels"`
+  Due         *todoistDue `json:"due"`
+  Checked     bool        `json:"checked"`
+  AddedAt     string      `json:"added_at"`
+  CompletedAt string      `json:"completed_at"`
+  UpdatedAt   string      `json:"updated_at"`
+}
+
+// todoistPriority maps priorities to Todoist's, where 1 is normal and 4
+// urgent
+func todoistPriority(p Priority) int {
+  return int(p) + 1
+}
+
+// fromTodoist converts a task returned by the Todoist API
+func fromTodoist(t *todoistTask) *Task {
+  task := &Task{
+    ID:       t.ID,
+    Title:    t.Content,
+    Parent:   t.ParentID,
+    Position: fmt.Sprintf("%010d", t.ChildOrder),
+    Priority: Priority(t.Priority - 1),
+    Tags:     t.Labels,
+    Etag:     t.UpdatedAt,
+  }
+  if task.Priority < PriorityNone || task.Priority > PriorityHigh {
+    task.Priority = PriorityNone
+  }
+  tags := task.Tags
+  decodeMeta(task, t.Description)
+  task.Tags = tags
+  if t.Due != nil && len(t.Due.Date) >= 10 {
+    task.Due, _ = time.Parse("2006-01-02", t.Due.Date[:10])
+  }
+  task.Updated, _ = time.Parse(time.RFC3339, t.UpdatedAt)
+  task.Created, _ = time.Parse(time.RFC3339, t.AddedAt)
+  if t.CompletedAt != "" {
+    task.Completed, _ = time.Parse(time.RFC3339, t.CompletedAt)
+  }
+  if t.Checked && task.Completed.IsZero() {
+    task.Completed = task.Updated
+  }
+  return task
+}
+
+// todoistDescription returns the description of task in Todoist: its
+// notes and the metadata Todoist has no fields for
+func todoistDescription(task *Task) string {
+  c := *task
+  c.Priority, c.Tags, c.Created = PriorityNone, nil, time.Time{}
+  return encodeMeta(&c)
+}
+
+// Lists returns all projects
+func (c *Todoist) Lists(ctx context.Context) ([]*TaskList, error) {
+  var lists []*TaskList
+  query := url.Values{}
+  for {
+    var page struct {
+      Results    []todoistProject `json:"results"`
+      NextCursor string           `json:"next_cursor"`
+    }
+    if err := c.do(ctx, http.MethodGet, "/projects", query, nil, &page); err != nil {
+      return nil, err
+    }
+    for _, p := range page.Results {
+      lists = append(lists, &TaskList{ID: p.ID, Title: p.Name})
+    }
+    if page.NextCursor == "" {
+      return lists, nil
+    }
+    query.Set("cursor", page.NextCursor)
+  }
+}
+
+// FindList returns the project with the given name, or ErrNotFound
+func (c *Todoist) FindList(ctx context.Context, title string) (*TaskList, error) {
+  lists, err := c.Lists(ctx)
+  if err != nil {
+    return nil, err
+  }
+  for _, l := range lists {
+    if l.Title == title {
+      return l, nil
+    }
+  }
+  return nil, ErrNotFound
+}
+
+// CreateList creates a project with the given name
+func (c *Todoist) CreateList(ctx context.Context, title string) (*TaskList, error) {
+  var p todoistProject
+  if err := c.do(ctx, http.MethodPost, "/projects", nil, map[string]string{"name": title}, &p); err != nil {
+    return nil, err
+  }
+  return &TaskList{ID: p.ID, Title: p.Name}, nil
+}
+
+// RenameList changes the name of a project
+func (c *Todoist) RenameList(ctx context.Context, listID string, title string) (*TaskList, error) {
+  var p todoistProject
+  if err := c.do(ctx, http.MethodPost, "/projects/"+url.PathEscape(listID), nil, map[string]string{"name": title}, &p); err != nil {
+    return nil, err
+  }
+  return &TaskList{ID: p.ID, Title: p.Name}, nil
+}
+
+// DeleteList deletes a project and all of its tasks
+func (c *Todoist) DeleteList(ctx context.Context, listID string) error {
+  return c.do(ctx, http.MethodDelete, "/projects/"+url.PathEscape(listID), nil, nil, nil)
+}
+
+// List returns the uncompleted tasks of a project, in project order with
+// subtasks following their parent
+func (c *Todoist) List(ctx context.Context, listID string) ([]*Task, error) {
+  var items []*Task
+  query := url.Values{"project_id": {listID}, "limit": {"200"}}
+  for {
+    var page struct {
+      Results    []*todoistTask `json:"results"`
+      NextCursor string         `json:"next_cursor"`
+    }
+    if err := c.do(ctx, http.MethodGet, "/tasks", query, nil, &page); err != nil {
+      return nil, err
+    }
+    for _, t := range page.Results {
+      items = append(items, fromTodoist(t))
+    }
+    if page.NextCursor == "" {
+      break
+    }
+    query.Set("cursor", page.NextCursor)
+  }
+  sortByPosition(items)
+  return items, nil
+}
+
+// Completed returns the tasks of a project completed between min and max,
+// most recent first. Todoist only looks back within a limited range, so a
+// zero min means the last three months
+func (c *Todoist) Completed(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  if max.IsZero() {
+    max = time.Now()
+  }
+  if min.IsZero() || max.Sub(min) > todoistCompletedRange {
+    min = max.Add(-todoistCompletedRange)
+  }
+  query := url.Values{
+    "project_id": {listID},
+    "since":      {min.UTC().Format(time.RFC3339)},
+    "until":      {max.UTC().Format(time.RFC3339)},
+    "limit":      {"200"},
+  }
+  var items []*Task
+  for {
+    var page struct {
+      Items      []*todoistTask `json:"items"`
+      NextCursor string         `json:"next_cursor"`
+    }
+    if err := c.do(ctx, http.MethodGet, "/tasks/completed/by_completion_date", query, nil, &page); err != nil {
+      return nil, err
+    }
+    for _, t := range page.Items {
+      if task := fromTodoist(t); task.Done() {
+        items = append(items, task)
+      }
+    }
+    if page.NextCursor == "" {
+      break
+    }
+    query.Set("cursor", page.NextCursor)
+  }
+  sort.SliceStable(items, func(i, j int) bool {
+    return items[i].Completed.After(items[j].Completed)
+  })
+  return items, nil
+}
+
+// Get returns a single task, or ErrNotFound
+func (c *Todoist) Get(ctx context.Context, listID string, id string) (*Task, error) {
+  var t todoistTask
+  if err := c.do(ctx, http.MethodGet, "/tasks/"+url.PathEscape(id), nil, nil, &t); err != nil {
+    return nil, err
+  }
+  return fromTodoist(&t), nil
+}
+
+// Add creates task in a project, as a subtask if its Parent is set. The ID
+// and Position of task are ignored.
+// It returns the created task
+func (c *Todoist) Add(ctx context.Context, listID string, task *Task) (*Task, error) {
+  body := map[string]interface{}{
+    "content":     task.Title,
+    "description": todoistDescription(task),
+    "project_id":  listID,
+    "priority":    todoistPriority(task.Priority),
+  }
+  if task.Parent != "" {
+    body["parent_id"] = task.Parent
+  }
+  if len(task.Tags) > 0 {
+    body["labels"] = task.Tags
+  }
+  if !task.Due.IsZero() {
+    body["due_date"] = task.Due.Format("2006-01-02")
+  }
+  var t todoistTask
+  if err := c.do(ctx, http.MethodPost, "/tasks", nil, body, &t); err != nil {
+    return nil, err
+  }
+  created := fromTodoist(&t)
+  if task.Done() {
+    return c.Complete(ctx, listID, created.ID)
+  }
+  return created, nil
+}
+
+// Complete marks a task as completed
+func (c *Todoist) Complete(ctx context.Context, listID string, id string) (*Task, error) {
+  if err := c.do(ctx, http.MethodPost, "/tasks/"+url.PathEscape(id)+"/close", nil, nil, nil); err != nil {
+    return nil, err
+  }
+  return c.Get(ctx, listID, id)
+}
+
+// Uncomplete marks a completed task as not completed
+func (c *Todoist) Uncomplete(ctx context.Context, listID string, id string) (*Task, error) {
+  if err := c.do(ctx, http.MethodPost, "/tasks/"+url.PathEscape(id)+"/reopen", nil, nil, nil); err != nil {
+    return nil, err
+  }
+  return c.Get(ctx, listID, id)
+}
+
+// Delete removes a task
+func (c *Todoist) Delete(ctx context.Context, listID string, id string) error {
+  return c.do(ctx, http.MethodDelete, "/tasks/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Update applies patch to a task. Patches changing fields kept in the
+// description fetch the task first, so the rest of it is preserved.
+// It returns the updated task
+func (c *Todoist) Update(ctx context.Context, listID string, id string, patch *Patch) (*Task, error) {
+  body := map[string]interface{}{}
+  if patch.Title != nil {
+    body["content"] = *patch.Title
+  }
+  if patch.Priority != nil {
+    body["priority"] = todoistPriority(*patch.Priority)
+  }
+  if patch.Tags != nil {
+    tags := *patch.Tags
+    if tags == nil {
+      tags = []string{}
+    }
+    body["labels"] = tags
+  }
+  if patch.Due != nil {
+    if patch.Due.IsZero() {
+      body["due_string"] = "no date"
+    } else {
+      body["due_date"] = patch.Due.Format("2006-01-02")
+    }
+  }
+  if patch.Notes != nil || patch.Every != nil || patch.Remind != nil || patch.Snooze != nil || patch.BlockedBy != nil ||
+    patch.Starred != nil {
+    current, err := c.Get(ctx, listID, id)
+    if err != nil {
+      return nil, err
+    }
+    body["description"] = todoistDescription(patch.Apply(current))
+  }
+  var t todoistTask
+  if err := c.do(ctx, http.MethodPost, "/tasks/"+url.PathEscape(id), nil, body, &t); err != nil {
+    return nil, err
+  }
+  return fromTodoist(&t), nil
+}
+
+// Move places a task and its subtasks at dest. Todoist moves tasks between
+// projects and parents with one request, and reorders them with a command
+// of its Sync API.
+// It returns the moved task
+func (c *Todoist) Move(ctx context.Context, listID string, id string, dest Destination) (*Task, error) {
+  to := listID
+  if dest.ListID != "" {
+    to = dest.ListID
+  }
+  body := map[string]string{"project_id": to}
+  if dest.Parent != "" {
+    body = map[string]string{"parent_id": dest.Parent}
+  }
+  if err := c.do(ctx, http.MethodPost, "/tasks/"+url.PathEscape(id)+"/move", nil, body, nil); err != nil {
+    return nil, err
+  }
+
+  tasks, err := c.List(ctx, to)
+  if err != nil {
+    return nil, err
+  }
+  var moved *Task
+  var siblings []*Task
+  for _, t := range tasks {
+    if t.ID == id {
+      moved = t
+    }
+    if t.Parent == dest.Parent {
+      siblings = append(siblings, t)
+    }
+  }
+  if moved == nil {
+    return nil, ErrNotFound
+  }
+  var items []map[string]interface{}
+  for i, t := range reorder(siblings, moved, dest.Previous) {
+    items = append(items, map[string]interface{}{"id": t.ID, "child_order": i + 1})
+  }
+  commands, err := json.Marshal([]map[string]interface{}{{
+    "type": "item_reorder",
+    "uuid": newID(),
+    "args": map[string]interface{}{"items": items},
+  }})
+  if err != nil {
+    return nil, err
+  }
+  if err := c.do(ctx, http.MethodPost, "/sync", nil, url.Values{"commands": {string(commands)}}, nil); err != nil {
+    return nil, err
+  }
+  return c.Get(ctx, to, id)
+}
+
+// Due returns the uncompleted tasks of a project due on the days from min
+// to max, in project order
+func (c *Todoist) Due(ctx context.Context, listID string, min time.Time, max time.Time) ([]*Task, error) {
+  items, err := c.List(ctx, listID)
+  if err != nil {
+    return nil, err
+  }
+  return dueBetween(items, min, max), nil
+}
@@ -0,0 +1,5 @@
+// Package todopb holds the gRPC service definition of todo, generated
+// from proto/todo.proto.
+package todopb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative todo.proto
@@ -0,0 +1,447 @@
+// Package todotest provides an in-memory fake of Google Tasks, for
+// testing programs using package todo without network access or a Google
+// account.
+package todotest
+
+import (
+  "context"
+  "fmt"
+  "net/http"
+  "strconv"
+  "sync"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "google.golang.org/api/googleapi"
+  "google.golang.org/api/tasks/v1"
+)
+
+// Service is an in-memory todo.Service behaving like the Tasks API: new
+// tasks go first among their siblings, completing a task records when,
+// and deleting or moving a task does the same to its subtasks. It is safe
+// for concurrent use. The zero value has no task lists
+type Service struct {
+  // Fail, if set, is called with the name of each Service method
+  // before it runs, and a non-nil result is returned instead, to test
+  // how failures are handled
+  Fail func(method string) error
+
+  mu    sync.Mutex
+  lists []*list
+  next  int
+}
+
+// list is a task list with its tasks in sibling order
+type list struct {
+  meta  tasks.TaskList
+  tasks []*tasks.Task
+}
+
+// NewService returns a Service with a single empty task list, the way new
+// Google accounts start
+func NewService() *Service {
+  s := &Service{}
+  s.InsertTaskList(context.Background(), &tasks.TaskList{Title: "My Tasks"})
+  return s
+}
+
+// NewClient returns a todo.Client backed by a new Service, and the Service
+func NewClient() (*todo.Client, *Service) {
+  s := NewService()
+  return todo.NewServiceClient(s), s
+}
+
+// notFound is the error of the Tasks API for what does not exist
+func notFound(what string, id string) error {
+  return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("%s %s not found", what, id)}
+}
+
+// fail returns the error Fail gives for method, if any
+func (s *Service) fail(method string) error {
+  if s.Fail != nil {
+    return s.Fail(method)
+  }
+  return nil
+}
+
+// newID returns an id that was not used before, with an etag to go with
+// it
+func (s *Service) newID() string {
+  s.next++
+  return "t" + strconv.Itoa(s.next)
+}
+
+// touch records that t changed now
+func (s *Service) touch(t *tasks.Task) {
+  s.next++
+  t.Etag = `"` + strconv.Itoa(s.next) + `"`
+  t.Updated = time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func (s *Service) list(id string) (*list, error) {
+  for _, l := range s.lists {
+    if l.meta.Id == id {
+      return l, nil
+    }
+  }
+  return nil, notFound("task list", id)
+}
+
+// index returns where the task with the given id is in l, or -1
+func (l *list) index(id string) int {
+  for i, t := range l.tasks {
+    if t.Id == id {
+      return i
+    }
+  }
+  return -1
+}
+
+// subtree returns the ids of the task with the given id and of the tasks
+// nested below it
+func (l *list) subtree(id string) map[string]bool {
+  ids := map[string]bool{id: true}
+  for changed := true; changed; {
+    changed = false
+    for _, t := range l.tasks {
+      if ids[t.Parent] && !ids[t.Id] {
+        ids[t.Id] = true
+        changed = true
+      }
+    }
+  }
+  return ids
+}
+
+// renumber sets the positions of the tasks of l to their order among
+// their siblings
+func (l *list) renumber() {
+  n := map[string]int{}
+  for _, t := range l.tasks {
+    t.Position = fmt.Sprintf("%020d", n[t.Parent])
+    n[t.Parent]++
+  }
+}
+
+// place inserts t into l after the task with the id previous, or before
+// all tasks if it is empty
+func (l *list) place(t *tasks.Task, previous string) {
+  at := 0
+  if i := l.index(previous); i >= 0 {
+    at = i + 1
+  }
+  l.tasks = append(l.tasks[:at], append([]*tasks.Task{t}, l.tasks[at:]...)...)
+}
+
+func copyTask(t *tasks.Task) *tasks.Task {
+  c := *t
+  return &c
+}
+
+// setCompleted keeps the completion time of t in line with its status
+func setCompleted(t *tasks.Task) {
+  switch {
+  case t.Status == "completed" && t.Completed == nil:
+    now := time.Now().UTC().Format(time.RFC3339Nano)
+    t.Completed = &now
+  case t.Status != "completed":
+    t.Status = "needsAction"
+    t.Completed = nil
+    t.Hidden = false
+  }
+}
+
+// ListTaskLists returns all task lists, on a single page
+func (s *Service) ListTaskLists(ctx context.Context, pageToken string) (*tasks.TaskLists, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("ListTaskLists"); err != nil {
+    return nil, err
+  }
+  res := &tasks.TaskLists{}
+  for _, l := range s.lists {
+    meta := l.meta
+    res.Items = append(res.Items, &meta)
+  }
+  return res, nil
+}
+
+// InsertTaskList creates a task list
+func (s *Service) InsertTaskList(ctx context.Context, l *tasks.TaskList) (*tasks.TaskList, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("InsertTaskList"); err != nil {
+    return nil, err
+  }
+  created := &list{meta: tasks.TaskList{Id: "l" + s.newID(), Title: l.Title}}
+  s.lists = append(s.lists, created)
+  meta := created.meta
+  return &meta, nil
+}
+
+// PatchTaskList renames a task list
+func (s *Service) PatchTaskList(ctx context.Context, listID string, l *tasks.TaskList) (*tasks.TaskList, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("PatchTaskList"); err != nil {
+    return nil, err
+  }
+  found, err := s.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  if l.Title != "" {
+    found.meta.Title = l.Title
+  }
+  meta := found.meta
+  return &meta, nil
+}
+
+// DeleteTaskList deletes a task list with its tasks
+func (s *Service) DeleteTaskList(ctx context.Context, listID string) error {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("DeleteTaskList"); err != nil {
+    return err
+  }
+  for i, l := range s.lists {
+    if l.meta.Id == listID {
+      s.lists = append(s.lists[:i], s.lists[i+1:]...)
+      return nil
+    }
+  }
+  return notFound("task list", listID)
+}
+
+// ListTasks returns the tasks of a task list selected by q, on a single
+// page. Hidden tasks are not modeled, so ShowHidden has no effect
+func (s *Service) ListTasks(ctx context.Context, listID string, q todo.TaskQuery) (*tasks.Tasks, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("ListTasks"); err != nil {
+    return nil, err
+  }
+  l, err := s.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  within := func(value string, min string, max string) bool {
+    if min == "" && max == "" {
+      return true
+    }
+    t, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+      return false
+    }
+    if lo, err := time.Parse(time.RFC3339, min); err == nil && t.Before(lo) {
+      return false
+    }
+    if hi, err := time.Parse(time.RFC3339, max); err == nil && t.After(hi) {
+      return false
+    }
+    return true
+  }
+  res := &tasks.Tasks{}
+  for _, t := range l.tasks {
+    completed := ""
+    if t.Completed != nil {
+      completed = *t.Completed
+    }
+    if t.Status == "completed" && !q.ShowCompleted || t.Hidden && !q.ShowHidden ||
+      !within(t.Due, q.DueMin, q.DueMax) || !within(completed, q.CompletedMin, q.CompletedMax) {
+      continue
+    }
+    res.Items = append(res.Items, copyTask(t))
+  }
+  return res, nil
+}
+
+// GetTask returns a task
+func (s *Service) GetTask(ctx context.Context, listID string, id string) (*tasks.Task, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("GetTask"); err != nil {
+    return nil, err
+  }
+  l, err := s.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  i := l.index(id)
+  if i < 0 {
+    return nil, notFound("task", id)
+  }
+  return copyTask(l.tasks[i]), nil
+}
+
+// InsertTask creates a task, first among its siblings
+func (s *Service) InsertTask(ctx context.Context, listID string, parent string, task *tasks.Task) (*tasks.Task, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("InsertTask"); err != nil {
+    return nil, err
+  }
+  l, err := s.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  if parent != "" && l.index(parent) < 0 {
+    return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "Invalid parent " + parent}
+  }
+  t := copyTask(task)
+  t.Id, t.Parent = s.newID(), parent
+  setCompleted(t)
+  s.touch(t)
+  l.place(t, "")
+  l.renumber()
+  return copyTask(t), nil
+}
+
+// PatchTask changes the title, notes, due date and status of a task
+func (s *Service) PatchTask(ctx context.Context, listID string, id string, patch *tasks.Task) (*tasks.Task, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("PatchTask"); err != nil {
+    return nil, err
+  }
+  l, err := s.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  i := l.index(id)
+  if i < 0 {
+    return nil, notFound("task", id)
+  }
+  has := func(fields []string, name string) bool {
+    for _, f := range fields {
+      if f == name {
+        return true
+      }
+    }
+    return false
+  }
+  t := l.tasks[i]
+  if patch.Title != "" || has(patch.ForceSendFields, "Title") {
+    t.Title = patch.Title
+  }
+  if patch.Notes != "" || has(patch.ForceSendFields, "Notes") {
+    t.Notes = patch.Notes
+  }
+  if patch.Due != "" || has(patch.NullFields, "Due") {
+    t.Due = patch.Due
+  }
+  if patch.Completed != nil || has(patch.NullFields, "Completed") {
+    t.Completed = patch.Completed
+  }
+  if patch.Status != "" {
+    t.Status = patch.Status
+  }
+  setCompleted(t)
+  s.touch(t)
+  return copyTask(t), nil
+}
+
+// ClearTasks hides the completed tasks of a task list
+func (s *Service) ClearTasks(ctx context.Context, listID string) error {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("ClearTasks"); err != nil {
+    return err
+  }
+  l, err := s.list(listID)
+  if err != nil {
+    return err
+  }
+  for _, t := range l.tasks {
+    if t.Status == "completed" {
+      t.Hidden = true
+    }
+  }
+  return nil
+}
+
+// DeleteTask deletes a task and its subtasks
+func (s *Service) DeleteTask(ctx context.Context, listID string, id string) error {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("DeleteTask"); err != nil {
+    return err
+  }
+  l, err := s.list(listID)
+  if err != nil {
+    return err
+  }
+  if l.index(id) < 0 {
+    return notFound("task", id)
+  }
+  ids := l.subtree(id)
+  var kept []*tasks.Task
+  for _, t := range l.tasks {
+    if !ids[t.Id] {
+      kept = append(kept, t)
+    }
+  }
+  l.tasks = kept
+  l.renumber()
+  return nil
+}
+
+// MoveTask moves a task and its subtasks to dest
+func (s *Service) MoveTask(ctx context.Context, listID string, id string, dest todo.Destination) (*tasks.Task, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.fail("MoveTask"); err != nil {
+    return nil, err
+  }
+  from, err := s.list(listID)
+  if err != nil {
+    return nil, err
+  }
+  to := from
+  if dest.ListID != "" {
+    if to, err = s.list(dest.ListID); err != nil {
+      return nil, err
+    }
+  }
+  if from.index(id) < 0 {
+    return nil, notFound("task", id)
+  }
+  ids := from.subtree(id)
+  if ids[dest.Parent] || ids[dest.Previous] {
+    return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "Can not move a task below or after itself"}
+  }
+  if dest.Parent != "" && to.index(dest.Parent) < 0 || dest.Previous != "" && to.index(dest.Previous) < 0 {
+    return nil, notFound("task", dest.Parent+dest.Previous)
+  }
+
+  var moved, kept []*tasks.Task
+  for _, t := range from.tasks {
+    if ids[t.Id] {
+      moved = append(moved, t)
+    } else {
+      kept = append(kept, t)
+    }
+  }
+  from.tasks = kept
+  var task *tasks.Task
+  previous := dest.Previous
+  for _, t := range moved {
+    if t.Id == id {
+      task = t
+    }
+  }
+  task.Parent = dest.Parent
+  s.touch(task)
+  to.place(task, previous)
+  // subtasks keep their order, right after the task
+  previous = task.Id
+  for _, t := range moved {
+    if t != task {
+      to.place(t, previous)
+      previous = t.Id
+    }
+  }
+  from.renumber()
+  to.renumber()
+  return copyTask(task), nil
+}
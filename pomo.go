@@ -0,0 +1,127 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "time"
+
+  "golang.org/x/net/context"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// defaultPomodoro is how long a pomodoro lasts without --length
+const defaultPomodoro = 25 * time.Minute
+
+// countdown waits for length to pass, showing the time left on a line of
+// its own on terminals. It returns early with the error of ctx if ctx is
+// done first
+func countdown(ctx context.Context, title string, length time.Duration) error {
+  end := time.Now().Add(length)
+  fi, err := os.Stdout.Stat()
+  live := err == nil && fi.Mode()&os.ModeCharDevice != 0
+  tick := time.NewTicker(time.Second)
+  defer tick.Stop()
+  for {
+    left := time.Until(end)
+    if live {
+      m := int(left.Round(time.Second) / time.Second)
+      fmt.Printf("\r%s %02d:%02d ", colorize("1", title), m/60, m%60)
+    }
+    if left <= 0 {
+      break
+    }
+    select {
+    case <-ctx.Done():
+      if live {
+        fmt.Println()
+      }
+      return ctx.Err()
+    case <-tick.C:
+    }
+  }
+  if live {
+    fmt.Println()
+  }
+  return nil
+}
+
+// Runs a pomodoro of the given length on the todo item at arg: its time
+// is logged as with 'todo start', a notification is shown when it is
+// over and a line recording it is appended to the task's notes. An
+// interrupted pomodoro is logged for the time it lasted, but not noted
+func runPomodoro(s *session, arg string, length time.Duration) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  if err := beginTimer(s, task); err != nil {
+    return err
+  }
+  infof("Pomodoro of %s on '%s' started, Ctrl-C to stop it", todo.FormatDuration(length), task.Title)
+
+  start := time.Now()
+  waited := countdown(s.ctx, task.Title, length)
+  entries, err := loadTimeLog()
+  if err != nil {
+    return err
+  }
+  // the timer is left alone if another task was started in the meantime
+  if i := len(entries) - 1; i >= 0 && entries[i].Task == task.ID && entries[i].End.IsZero() {
+    entries[i].End = time.Now()
+    if err := saveTimeLog(entries); err != nil {
+      return err
+    }
+  }
+  if waited != nil {
+    infof("Pomodoro on '%s' stopped after %s", task.Title, formatSpent(time.Since(start)))
+    return waited
+  }
+
+  if err := notify("Pomodoro over", task.Title); err != nil {
+    warnf("Unable to show notification: %v", err)
+  }
+  line := fmt.Sprintf("Pomodoro of %s, %s %s", todo.FormatDuration(length), formatDate(start), start.Format("15:04"))
+  notes := line
+  if task.Notes != "" {
+    notes = task.Notes + "\n" + line
+  }
+  if _, err := s.update(task, &todo.Patch{Notes: &notes}); err != nil {
+    return err
+  }
+  infof("Pomodoro on '%s' over, %s spent on it in total", task.Title,
+    formatSpent(timeSpent(entries, task.ID, time.Now())))
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "pomo",
+    aliases: []string{"pomodoro"},
+    usage:   "pomo [--length 25m] <index>",
+    summary: "Work on a task for a pomodoro, logging the time spent",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      length := fs.Duration("length", defaultPomodoro, "how long the pomodoro lasts")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 {
+        return invalidf("Expected a task index, see 'todo help pomo'")
+      }
+      if *length <= 0 {
+        return invalidf("--length must be positive")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return runPomodoro(s, args[0], *length)
+    },
+  })
+}
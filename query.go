@@ -0,0 +1,391 @@
+package main
+
+import (
+  "regexp"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// queryKind is the type of a field of the --where language, which decides
+// the operators and values it may be compared with
+type queryKind int
+
+const (
+  queryText queryKind = iota
+  queryTags
+  queryDate
+  queryPriority
+  queryFlag
+)
+
+// queryFields maps the fields queries may refer to to their kind
+var queryFields = map[string]queryKind{
+  "title":     queryText,
+  "notes":     queryText,
+  "status":    queryText,
+  "tag":       queryTags,
+  "tags":      queryTags,
+  "due":       queryDate,
+  "created":   queryDate,
+  "updated":   queryDate,
+  "priority":  queryPriority,
+  "blocked":   queryFlag,
+  "snoozed":   queryFlag,
+  "overdue":   queryFlag,
+  "recurring": queryFlag,
+  "starred":   queryFlag,
+}
+
+// queryOps are the comparison operators each kind of field accepts
+var queryOps = map[queryKind][]string{
+  queryText:     {"==", "!=", "~", "!~"},
+  queryTags:     {"==", "!=", "~", "!~"},
+  queryDate:     {"==", "!=", "<", "<=", ">", ">="},
+  queryPriority: {"==", "!=", "<", "<=", ">", ">="},
+}
+
+// queryEnv holds what matching a task depends on besides the task itself
+type queryEnv struct {
+  now     time.Time
+  today   time.Time
+  blocked map[string]bool
+}
+
+// query is a parsed --where expression
+type query interface {
+  match(task *todo.Task, env *queryEnv) bool
+}
+
+type queryAnd struct{ left, right query }
+type queryOr struct{ left, right query }
+type queryNot struct{ q query }
+type queryIs struct{ field string }
+
+// queryCompare compares a field of a task with a value parsed according
+// to the kind of the field
+type queryCompare struct {
+  field    string
+  op       string
+  text     string
+  date     time.Time
+  priority todo.Priority
+}
+
+func (q queryAnd) match(task *todo.Task, env *queryEnv) bool {
+  return q.left.match(task, env) && q.right.match(task, env)
+}
+
+func (q queryOr) match(task *todo.Task, env *queryEnv) bool {
+  return q.left.match(task, env) || q.right.match(task, env)
+}
+
+func (q queryNot) match(task *todo.Task, env *queryEnv) bool {
+  return !q.q.match(task, env)
+}
+
+func (q queryIs) match(task *todo.Task, env *queryEnv) bool {
+  switch q.field {
+  case "blocked":
+    return env.blocked[task.ID]
+  case "snoozed":
+    return snoozed(task, env.now)
+  case "starred":
+    return task.Starred
+  case "overdue":
+    return !task.Done() && !task.Due.IsZero() && daysUntil(task.Due, env.today) < 0
+  }
+  return task.Every != nil
+}
+
+func (q queryCompare) match(task *todo.Task, env *queryEnv) bool {
+  switch queryFields[q.field] {
+  case queryText:
+    value := task.Title
+    switch q.field {
+    case "notes":
+      value = task.Notes
+    case "status":
+      value = "open"
+      if task.Done() {
+        value = "completed"
+      }
+    }
+    return compareText(q.op, value, q.text)
+  case queryTags:
+    if q.op == "==" || q.op == "!=" {
+      return task.HasTag(q.text) == (q.op == "==")
+    }
+    any := false
+    for _, tag := range task.Tags {
+      any = any || compareText("~", tag, q.text)
+    }
+    return any == (q.op == "~")
+  case queryDate:
+    var date time.Time
+    switch q.field {
+    case "due":
+      date = task.Due
+    case "created":
+      date = task.Created
+    case "updated":
+      date = task.Updated
+    }
+    if q.date.IsZero() || date.IsZero() {
+      // an undated task only equals none, and differs from any date
+      same := q.date.IsZero() == date.IsZero()
+      return q.op == "==" && same || q.op == "!=" && !same
+    }
+    if q.field != "due" {
+      date = todo.Date(date.In(time.Local))
+    }
+    return compareInts(q.op, daysUntil(date, q.date), 0)
+  }
+  return compareInts(q.op, int(task.Priority), int(q.priority))
+}
+
+// compareText compares value and text ignoring case, with ~ true when value
+// contains text
+func compareText(op string, value string, text string) bool {
+  switch op {
+  case "==":
+    return strings.EqualFold(value, text)
+  case "!=":
+    return !strings.EqualFold(value, text)
+  }
+  contains := strings.Contains(strings.ToLower(value), strings.ToLower(text))
+  return contains == (op == "~")
+}
+
+func compareInts(op string, a int, b int) bool {
+  switch op {
+  case "==":
+    return a == b
+  case "!=":
+    return a != b
+  case "<":
+    return a < b
+  case "<=":
+    return a <= b
+  case ">":
+    return a > b
+  }
+  return a >= b
+}
+
+// queryToken is an operator, a parenthesis, a quoted string or a bare word
+// such as a field name or an unquoted value
+type queryToken struct {
+  text   string
+  quoted bool
+}
+
+var queryOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!", "(", ")"}
+
+// queryUnits maps the units of relative dates to those addUnit takes
+var queryUnits = map[string]string{"d": "day", "w": "week", "m": "month", "y": "year"}
+
+// relativeDate matches dates relative to today, such as 3d or -2w
+var relativeDate = regexp.MustCompile(`^([+-]?\d+)([dwmy])$`)
+
+// lexQuery splits a --where expression into tokens
+func lexQuery(s string) ([]queryToken, error) {
+  var tokens []queryToken
+  for {
+    s = strings.TrimLeft(s, " \t\n")
+    if s == "" {
+      return tokens, nil
+    }
+    if s[0] == '"' || s[0] == '\'' {
+      end := strings.IndexByte(s[1:], s[0])
+      if end < 0 {
+        return nil, invalidf("Invalid --where: unterminated string %s", s)
+      }
+      tokens = append(tokens, queryToken{text: s[1 : end+1], quoted: true})
+      s = s[end+2:]
+      continue
+    }
+    op := ""
+    for _, o := range queryOperators {
+      if strings.HasPrefix(s, o) {
+        op = o
+        break
+      }
+    }
+    if op != "" {
+      tokens = append(tokens, queryToken{text: op})
+      s = s[len(op):]
+      continue
+    }
+    end := strings.IndexFunc(s, func(r rune) bool {
+      return strings.ContainsRune(" \t\n\"'&|=!<>~()", r)
+    })
+    if end < 0 {
+      end = len(s)
+    }
+    tokens = append(tokens, queryToken{text: s[:end]})
+    s = s[end:]
+  }
+}
+
+// queryParser parses tokens by recursive descent, with ! binding tighter
+// than && binding tighter than ||
+type queryParser struct {
+  tokens []queryToken
+  now    time.Time
+}
+
+// parseQuery parses a --where expression such as
+// 'due < 3d && tag == work && !blocked', checking its fields and values
+func parseQuery(s string, now time.Time) (query, error) {
+  tokens, err := lexQuery(s)
+  if err != nil {
+    return nil, err
+  }
+  p := &queryParser{tokens: tokens, now: now}
+  q, err := p.or()
+  if err != nil {
+    return nil, err
+  }
+  if len(p.tokens) > 0 {
+    return nil, invalidf("Invalid --where: unexpected '%s'", p.tokens[0].text)
+  }
+  return q, nil
+}
+
+// peek reports whether the next token is the operator op
+func (p *queryParser) peek(op string) bool {
+  return len(p.tokens) > 0 && !p.tokens[0].quoted && p.tokens[0].text == op
+}
+
+func (p *queryParser) next() (queryToken, error) {
+  if len(p.tokens) == 0 {
+    return queryToken{}, invalidf("Invalid --where: unexpected end of expression")
+  }
+  t := p.tokens[0]
+  p.tokens = p.tokens[1:]
+  return t, nil
+}
+
+func (p *queryParser) or() (query, error) {
+  q, err := p.and()
+  for err == nil && p.peek("||") {
+    p.tokens = p.tokens[1:]
+    var right query
+    if right, err = p.and(); err == nil {
+      q = queryOr{q, right}
+    }
+  }
+  return q, err
+}
+
+func (p *queryParser) and() (query, error) {
+  q, err := p.unary()
+  for err == nil && p.peek("&&") {
+    p.tokens = p.tokens[1:]
+    var right query
+    if right, err = p.unary(); err == nil {
+      q = queryAnd{q, right}
+    }
+  }
+  return q, err
+}
+
+func (p *queryParser) unary() (query, error) {
+  if p.peek("!") {
+    p.tokens = p.tokens[1:]
+    q, err := p.unary()
+    return queryNot{q}, err
+  }
+  if p.peek("(") {
+    p.tokens = p.tokens[1:]
+    q, err := p.or()
+    if err != nil {
+      return nil, err
+    }
+    if !p.peek(")") {
+      return nil, invalidf("Invalid --where: missing ')'")
+    }
+    p.tokens = p.tokens[1:]
+    return q, nil
+  }
+  return p.comparison()
+}
+
+func (p *queryParser) comparison() (query, error) {
+  t, err := p.next()
+  if err != nil {
+    return nil, err
+  }
+  field := strings.ToLower(t.text)
+  kind, ok := queryFields[field]
+  if t.quoted || !ok {
+    return nil, invalidf("Invalid --where: unknown field '%s', expected one of %s",
+      t.text, strings.Join(queryFieldNames(), ", "))
+  }
+  if kind == queryFlag {
+    return queryIs{field}, nil
+  }
+
+  op, err := p.next()
+  if err != nil {
+    return nil, err
+  }
+  valid := false
+  for _, o := range queryOps[kind] {
+    valid = valid || !op.quoted && op.text == o
+  }
+  if !valid {
+    return nil, invalidf("Invalid --where: %s compares with %s, not '%s'",
+      field, strings.Join(queryOps[kind], " "), op.text)
+  }
+  value, err := p.next()
+  if err != nil {
+    return nil, err
+  }
+  q := queryCompare{field: field, op: op.text, text: value.text}
+  switch kind {
+  case queryTags:
+    q.text = strings.TrimPrefix(q.text, "+")
+  case queryPriority:
+    if q.priority, err = todo.ParsePriority(value.text); err != nil {
+      return nil, invalidf("Invalid --where: %v", err)
+    }
+  case queryDate:
+    if q.date, err = p.date(value.text); err != nil {
+      return nil, err
+    }
+    if q.date.IsZero() && q.op != "==" && q.op != "!=" {
+      return nil, invalidf("Invalid --where: none only compares with == and !=")
+    }
+  }
+  return q, nil
+}
+
+// date parses the value of a date comparison: none, a number of days,
+// weeks, months or years from today such as 3d or -1w, or a date phrase
+// such as 'friday' or 2024-03-05
+func (p *queryParser) date(value string) (time.Time, error) {
+  if strings.EqualFold(value, "none") {
+    return time.Time{}, nil
+  }
+  today := todo.Date(p.now)
+  if m := relativeDate.FindStringSubmatch(value); m != nil {
+    n, _ := strconv.Atoi(m[1])
+    date, _ := addUnit(today, queryUnits[m[2]], n)
+    return date, nil
+  }
+  date, err := parseDate(value, p.now)
+  if err != nil {
+    return time.Time{}, invalidf("Invalid --where: %v", err)
+  }
+  return date, nil
+}
+
+// queryFieldNames returns the fields queries may refer to in a fixed order
+func queryFieldNames() []string {
+  return []string{"title", "notes", "status", "tags", "due", "created", "updated", "priority",
+    "blocked", "snoozed", "overdue", "recurring", "starred"}
+}
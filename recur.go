@@ -0,0 +1,131 @@
+package main
+
+import (
+  "fmt"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// parseEvery parses the value of an --every flag. An empty value or none
+// results in the zero Recurrence, which stops a task from recurring
+func parseEvery(value string) (*todo.Recurrence, error) {
+  if value == "" || value == "none" {
+    return &todo.Recurrence{}, nil
+  }
+  r, err := todo.ParseRecurrence(value)
+  if err != nil {
+    return nil, invalidf("%v", err)
+  }
+  return r, nil
+}
+
+// nextOccurrence returns the due date of the task following task, which
+// was completed on the given date. It is the first date of the rule after
+// the due date of task that falls after the completion date, or after the
+// completion date if task had no due date
+func nextOccurrence(task *todo.Task, completed time.Time) time.Time {
+  done := todo.Date(completed.Local())
+  if task.Due.IsZero() {
+    return task.Every.Next(done)
+  }
+  next := task.Every.Next(task.Due)
+  for !next.After(done) {
+    next = task.Every.Next(next)
+  }
+  return next
+}
+
+// recur creates the next occurrence of the recurring task, completed on
+// the given date. It returns the new task
+func recur(s *session, task *todo.Task, completed time.Time) (*todo.Task, error) {
+  next := *task
+  next.ID, next.Position, next.Etag = "", "", ""
+  next.Completed, next.Updated, next.Snooze = time.Time{}, time.Time{}, time.Time{}
+  next.Due = nextOccurrence(task, completed)
+  created, err := s.insert(&next)
+  if err != nil {
+    return nil, fmt.Errorf("Could not create next occurrence of '%s': %w", task.Title, err)
+  }
+  return created, nil
+}
+
+// tickRecurring recreates the recurring tasks of the todo list completed
+// elsewhere, such as in the Google Tasks app, since the given time, or
+// ever if it is zero. It returns the number of tasks created
+func tickRecurring(s *session, since time.Time) (int, error) {
+  if s.offline {
+    return 0, nil
+  }
+  completed, err := s.client.Completed(s.ctx, s.todoId, since, time.Time{})
+  if err != nil {
+    return 0, fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+  }
+  n := 0
+  for _, task := range completed {
+    if task.Every == nil {
+      continue
+    }
+    // stop the completed task from recurring first, so that a failure
+    // can not result in it being recreated twice
+    if _, err := s.client.Update(s.ctx, s.todoId, task.ID, &todo.Patch{Every: &todo.Recurrence{}}); err != nil {
+      return n, fmt.Errorf("Could not stop completed task '%s' from recurring: %w", task.Title, err)
+    }
+    next, err := recur(s, task, task.Completed)
+    if err != nil {
+      return n, err
+    }
+    infof("Recurring task '%s' is due again %s", next.Title, formatDate(next.Due))
+    n++
+  }
+  return n, nil
+}
+
+// Lists the recurring tasks of the todo list along with their rules
+func listRecurring(items []*todo.Task) {
+  for i, task := range items {
+    if task.Every != nil {
+      fmt.Printf("%d. %s (every %s)\n", i+1, task.Title, task.Every)
+    }
+  }
+}
+
+func init() {
+  register(&command{
+    name:    "recur",
+    usage:   "recur [tick]",
+    summary: "Show recurring tasks, or recreate completed ones with their next due date",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 1 || len(args) == 1 && args[0] != "tick" {
+        return invalidf("Unknown recur command, see 'todo help recur'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        items, err := s.items()
+        if err != nil {
+          return err
+        }
+        listRecurring(items)
+        return nil
+      }
+      if s.offline {
+        return &exitError{code: exitNetwork, err: fmt.Errorf("Unable to reach Google Tasks to look for completed recurring tasks")}
+      }
+      n, err := tickRecurring(s, time.Time{})
+      if err != nil {
+        return err
+      }
+      if n == 0 {
+        fmt.Println("No completed recurring tasks to recreate")
+      }
+      return nil
+    },
+  })
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "runtime"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// defaultDueTime is the time of day tasks are considered due at unless
+// due_time is set, since Google Tasks only stores due dates
+const defaultDueTime = "09:00"
+
+// dueAt returns the moment task is due: its due date at the configured
+// due_time in the local time zone
+func dueAt(task *todo.Task) time.Time {
+  at, err := time.Parse("15:04", loadConfig().DueTime)
+  if err != nil {
+    at, _ = time.Parse("15:04", defaultDueTime)
+  }
+  d := task.Due
+  return time.Date(d.Year(), d.Month(), d.Day(), at.Hour(), at.Minute(), 0, 0, time.Local)
+}
+
+// remindersFile returns the path of the file recording which reminders of
+// the current account have been shown
+func remindersFile() (string, error) {
+  dir, err := dataDir("reminders")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, stateName()+".json"), nil
+}
+
+// loadReminders reads the reminders shown so far, keyed by reminderKey
+func loadReminders() map[string]time.Time {
+  shown := map[string]time.Time{}
+  file, err := remindersFile()
+  if err != nil {
+    return shown
+  }
+  if b, err := ioutil.ReadFile(file); err == nil {
+    json.Unmarshal(b, &shown)
+  }
+  return shown
+}
+
+// saveReminders writes the reminders shown so far, forgetting those of
+// tasks due more than a week ago
+func saveReminders(shown map[string]time.Time) error {
+  for key, due := range shown {
+    if time.Since(due) > 7*24*time.Hour {
+      delete(shown, key)
+    }
+  }
+  file, err := remindersFile()
+  if err != nil {
+    return err
+  }
+  b, err := json.MarshalIndent(shown, "", "  ")
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(file, b, 0600)
+}
+
+// reminderKey identifies the reminder of task for its current due date,
+// so that moving the due date brings the reminder back
+func reminderKey(task *todo.Task) string {
+  return task.ID + "@" + task.Due.Format("2006-01-02")
+}
+
+// notify shows a desktop notification, using notify-send on Linux and
+// BSDs, osascript on macOS and a PowerShell toast on Windows
+func notify(title string, body string) error {
+  var cmd *exec.Cmd
+  switch runtime.GOOS {
+  case "darwin":
+    script := fmt.Sprintf("display notification %s with title %s", appleScriptString(body), appleScriptString(title))
+    cmd = exec.Command("osascript", "-e", script)
+  case "windows":
+    script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:TODO_TITLE)) | Out-Null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:TODO_BODY)) | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('todo').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+    cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+    // passed through the environment to avoid quoting them for PowerShell
+    cmd.Env = append(os.Environ(), "TODO_TITLE="+title, "TODO_BODY="+body)
+  default:
+    cmd = exec.Command("notify-send", "--app-name=todo", title, body)
+  }
+  if out, err := cmd.CombinedOutput(); err != nil {
+    return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+  }
+  return nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+  return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Shows a notification for each task in items whose reminder is due and
+// has not been shown yet. Tasks without a reminder of their own are
+// reminded of before their due time by the given default, if positive
+func remindDue(items []*todo.Task, before time.Duration, shown map[string]time.Time, now time.Time) {
+  for _, task := range items {
+    remind := task.Remind
+    if remind == 0 {
+      remind = before
+    }
+    if task.Due.IsZero() || remind <= 0 || !shown[reminderKey(task)].IsZero() {
+      continue
+    }
+    due := dueAt(task)
+    if now.Before(due.Add(-remind)) {
+      continue
+    }
+    body := "Due " + formatDate(task.Due) + " " + due.Format("15:04")
+    if now.After(due) {
+      body = "Overdue since " + formatDate(task.Due) + " " + due.Format("15:04")
+    }
+    if err := notify(task.Title, body); err != nil {
+      warnf("Unable to show notification, %s: %s (%v)", task.Title, body, err)
+    } else {
+      infof("Reminded of '%s'", task.Title)
+    }
+    shown[reminderKey(task)] = due
+  }
+}
+
+// Checks the todo list for due reminders, once or, with daemon set, every
+// interval until interrupted
+func runReminders(s *session, before time.Duration, daemon bool, interval time.Duration) error {
+  shown := loadReminders()
+  for {
+    items, err := s.items()
+    if err != nil && !daemon {
+      return err
+    }
+    if s.ctx.Err() != nil {
+      return nil
+    }
+    if err != nil {
+      warnf("Unable to check reminders: %v", err)
+    } else {
+      remindDue(items, before, shown, time.Now())
+      if err := saveReminders(shown); err != nil {
+        warnf("Unable to record shown reminders: %v", err)
+      }
+    }
+    if !daemon {
+      return nil
+    }
+    select {
+    case <-s.ctx.Done():
+      return nil
+    case <-time.After(interval):
+    }
+  }
+}
+
+func init() {
+  register(&command{
+    name:    "remind",
+    usage:   "remind [--daemon] [--interval 1m] [--before 15m]",
+    summary: "Show desktop notifications for tasks that are about to be due",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      daemon := fs.Bool("daemon", false, "keep running and check for reminders every interval")
+      interval := fs.Duration("interval", time.Minute, "how often the daemon checks for reminders")
+      before := fs.Duration("before", 0, "remind of tasks without a reminder of their own this long before they are due")
+      if _, err := parseFlags(fs, args); err != nil {
+        return err
+      }
+      if *interval <= 0 {
+        return invalidf("--interval must be positive")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return runReminders(s, *before, *daemon, *interval)
+    },
+  })
+}
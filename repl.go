@@ -0,0 +1,333 @@
+package main
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+  "golang.org/x/term"
+)
+
+// replHistorySize is the number of lines of REPL history kept
+const replHistorySize = 500
+
+// replClients and replSessions keep the backends and sessions of a REPL
+// alive between commands, keyed by backend, account and list. They are
+// nil outside of the REPL
+var (
+  replClients  map[string]todo.Backend
+  replSessions map[string]*session
+)
+
+// replHistory is the history of lines entered in the REPL, kept in
+// the data directory across runs
+type replHistory struct {
+  file  string
+  lines []string
+}
+
+// loadReplHistory reads the history saved by earlier REPL runs
+func loadReplHistory() *replHistory {
+  h := &replHistory{}
+  dir, err := dataDir()
+  if err != nil {
+    return h
+  }
+  h.file = filepath.Join(dir, "repl_history")
+  if b, err := ioutil.ReadFile(h.file); err == nil {
+    h.lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+  }
+  return h
+}
+
+// Add records line as the most recent entry and saves the history
+func (h *replHistory) Add(line string) {
+  if line == "" || len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+    return
+  }
+  h.lines = append(h.lines, line)
+  if len(h.lines) > replHistorySize {
+    h.lines = h.lines[len(h.lines)-replHistorySize:]
+  }
+  if h.file != "" {
+    ioutil.WriteFile(h.file, []byte(strings.Join(h.lines, "\n")+"\n"), 0600)
+  }
+}
+
+// Len returns the number of entries in the history
+func (h *replHistory) Len() int {
+  return len(h.lines)
+}
+
+// At returns the entry idx lines back, 0 being the most recent one
+func (h *replHistory) At(idx int) string {
+  return h.lines[len(h.lines)-1-idx]
+}
+
+// splitLine splits a line typed in the REPL into arguments the way a
+// shell would, honouring single and double quotes and backslashes
+func splitLine(line string) ([]string, error) {
+  var args []string
+  var arg strings.Builder
+  inArg := false
+  var quote rune
+  escaped := false
+  for _, r := range line {
+    switch {
+    case escaped:
+      arg.WriteRune(r)
+      escaped = false
+    case r == '\\' && quote != '\'':
+      escaped, inArg = true, true
+    case quote != 0:
+      if r == quote {
+        quote = 0
+      } else {
+        arg.WriteRune(r)
+      }
+    case r == '"' || r == '\'':
+      quote, inArg = r, true
+    case r == ' ' || r == '\t':
+      if inArg {
+        args = append(args, arg.String())
+        arg.Reset()
+        inArg = false
+      }
+    default:
+      arg.WriteRune(r)
+      inArg = true
+    }
+  }
+  if quote != 0 {
+    return nil, fmt.Errorf("missing closing %c", quote)
+  }
+  if inArg {
+    args = append(args, arg.String())
+  }
+  return args, nil
+}
+
+// replState is what a command run in the REPL may change globally, and
+// is restored after each one
+type replState struct {
+  list, account, backend, token, clientSecret, output, dateFormat string
+  noRetry, noColor, quiet, verbose, debug, noContext              bool
+  timeout                                                         time.Duration
+  stdout, stderr                                                  *os.File
+}
+
+func saveReplState() replState {
+  return replState{listFlag, accountFlag, backendFlag, tokenFlag, clientSecretFlag, outputFlag, dateFormatFlag, noRetryFlag, noColorFlag, quietFlag, verboseFlag, debugFlag, noContextFlag, timeoutFlag, os.Stdout, os.Stderr}
+}
+
+func (st replState) restore() {
+  listFlag, accountFlag, backendFlag, tokenFlag, clientSecretFlag = st.list, st.account, st.backend, st.token, st.clientSecret
+  outputFlag, dateFormatFlag = st.output, st.dateFormat
+  noRetryFlag, noColorFlag, quietFlag, verboseFlag, debugFlag = st.noRetry, st.noColor, st.quiet, st.verbose, st.debug
+  noContextFlag = st.noContext
+  timeoutFlag = st.timeout
+  os.Stdout, os.Stderr = st.stdout, st.stderr
+}
+
+// runReplLine runs the command typed on a line of the REPL, reporting its
+// errors. It returns false once the REPL should end
+func runReplLine(line string) bool {
+  args, err := splitLine(line)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "todo: %v\n", err)
+    return true
+  }
+  if len(args) == 0 {
+    return true
+  }
+  switch args[0] {
+  case "exit", "quit":
+    return false
+  case "repl":
+    fmt.Fprintln(os.Stderr, "todo: already in the REPL")
+    return true
+  }
+  state := saveReplState()
+  defer state.restore()
+  if strings.HasPrefix(args[0], "-") {
+    // global flags before the command, as in 'todo --list Work list'
+    if err := flag.CommandLine.Parse(args); err != nil {
+      return true
+    }
+    args = flag.Args()
+  }
+  if err := run(args); err != nil && err != flag.ErrHelp {
+    reportError(err)
+  }
+  return true
+}
+
+// replCompleter completes the word before the cursor when tab is pressed:
+// command names first, tags after '+' and task list names after --list
+// and --to-list
+type replCompleter struct {
+  t     *term.Terminal
+  lists []string
+  // last is the line of the previous tab press, repeated presses show
+  // all candidates
+  last string
+}
+
+// candidates returns the completions for word, the wordIndex'th word of
+// the line, following prev
+func (c *replCompleter) candidates(word string, wordIndex int, prev string) []string {
+  var all []string
+  switch {
+  case wordIndex == 0:
+    for name := range commands {
+      all = append(all, name)
+    }
+    all = append(all, "exit")
+  case strings.HasPrefix(word, "+"):
+    seen := map[string]bool{}
+    for _, task := range loadCache(currentList()).Items {
+      for _, tag := range task.Tags {
+        if !seen[tag] {
+          seen[tag] = true
+          all = append(all, "+"+tag)
+        }
+      }
+    }
+  case prev == "--list" || prev == "--to-list":
+    if c.lists == nil {
+      c.lists = []string{}
+      if client, err := newClient(); err == nil {
+        if lists, err := client.Lists(context.Background()); err == nil {
+          for _, l := range lists {
+            c.lists = append(c.lists, l.Title)
+          }
+        }
+      }
+    }
+    all = c.lists
+  }
+  var matches []string
+  for _, s := range all {
+    if strings.HasPrefix(s, word) {
+      matches = append(matches, s)
+    }
+  }
+  sort.Strings(matches)
+  return matches
+}
+
+// complete is the AutoCompleteCallback of the REPL terminal
+func (c *replCompleter) complete(line string, pos int, key rune) (string, int, bool) {
+  if key != '\t' {
+    return "", 0, false
+  }
+  head := line[:pos]
+  fields := strings.Fields(head)
+  word, prev := "", ""
+  if len(fields) > 0 && !strings.HasSuffix(head, " ") {
+    word, fields = fields[len(fields)-1], fields[:len(fields)-1]
+  }
+  if len(fields) > 0 {
+    prev = fields[len(fields)-1]
+  }
+  matches := c.candidates(word, len(fields), prev)
+  if len(matches) == 0 {
+    return "", 0, false
+  }
+  completion := matches[0]
+  for _, m := range matches[1:] {
+    for !strings.HasPrefix(m, completion) {
+      completion = completion[:len(completion)-1]
+    }
+  }
+  if len(matches) == 1 {
+    completion += " "
+  } else if completion == word {
+    if c.last == line {
+      fmt.Fprintln(c.t, strings.Join(matches, "  "))
+    }
+    c.last = line
+    return "", 0, false
+  }
+  newHead := head[:len(head)-len(word)] + completion
+  return newHead + line[pos:], len(newHead), true
+}
+
+// Reads commands from stdin and runs them until exit, quit or end of
+// input, keeping backends and task lists resolved between commands. On a
+// terminal, lines can be edited, recalled with the arrow keys and
+// completed with tab
+func runRepl() error {
+  replClients = map[string]todo.Backend{}
+  replSessions = map[string]*session{}
+  defer func() { replClients, replSessions = nil, nil }()
+
+  fd := int(os.Stdin.Fd())
+  if !term.IsTerminal(fd) {
+    scanner := bufio.NewScanner(os.Stdin)
+    for scanner.Scan() {
+      if !runReplLine(scanner.Text()) {
+        return nil
+      }
+    }
+    return scanner.Err()
+  }
+
+  t := term.NewTerminal(struct {
+    io.Reader
+    io.Writer
+  }{os.Stdin, os.Stdout}, "todo> ")
+  t.History = loadReplHistory()
+  c := &replCompleter{t: t}
+  t.AutoCompleteCallback = c.complete
+  fmt.Println("Type a command such as 'add buy milk' or 'list', 'help' to see them all and 'exit' to leave")
+  for {
+    state, err := term.MakeRaw(fd)
+    if err != nil {
+      return fmt.Errorf("Unable to set up the terminal: %w", err)
+    }
+    if w, h, err := term.GetSize(fd); err == nil && w > 0 {
+      t.SetSize(w, h)
+    }
+    line, err := t.ReadLine()
+    // commands print and run editors on a terminal in its usual mode
+    term.Restore(fd, state)
+    if err == io.EOF {
+      fmt.Println()
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+    if !runReplLine(line) {
+      return nil
+    }
+  }
+}
+
+func init() {
+  register(&command{
+    name:    "repl",
+    usage:   "repl",
+    summary: "Run commands interactively without signing in and resolving the list each time",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help repl'", args[0])
+      }
+      return runRepl()
+    },
+  })
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "crypto/sha1"
+  "encoding/hex"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "regexp"
+  "strings"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// metaScan is the metadata key identifying the TODO comment a task was
+// added for by 'todo scan'
+const metaScan = "scan"
+
+// maxScanFile is the size of the largest file scan reads
+const maxScanFile = 1 << 20
+
+// todoComment matches comments starting with TODO, optionally followed by
+// a name in parentheses and a colon, after //, #, --, ; or /*
+var todoComment = regexp.MustCompile(`(?://|#|--|;|/\*)\s*TODO(?:\(([^)]*)\))?:?\s+(.*?)\s*(?:\*/)?$`)
+
+// codeTodo is a TODO comment found in a file
+type codeTodo struct {
+  file string
+  line int
+  name string
+  text string
+}
+
+// key identifies c across scans by the repository, file and text, so that
+// it keeps its task while lines move around it
+func (c *codeTodo) key(repo string) string {
+  sum := sha1.Sum([]byte(c.text))
+  return repo + "/" + filepath.ToSlash(c.file) + "#" + hex.EncodeToString(sum[:6])
+}
+
+// scanFiles returns the files below root worth scanning, relative to the
+// directory it returns: those git tracks relative to the top of the work
+// tree if root is in a git repository, so that they are named the same
+// whatever part of it is scanned, or else all outside of hidden
+// directories relative to root
+func scanFiles(root string) (string, []string, error) {
+  cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+  cmd.Dir = root
+  if top, err := cmd.Output(); err == nil {
+    cmd := exec.Command("git", "ls-files", "-z", "--full-name")
+    cmd.Dir = root
+    out, err := cmd.Output()
+    if err != nil {
+      return "", nil, fmt.Errorf("Unable to list the files of %s: %v", root, err)
+    }
+    var files []string
+    for _, f := range strings.Split(string(out), "\x00") {
+      if f != "" {
+        files = append(files, filepath.FromSlash(f))
+      }
+    }
+    return strings.TrimSpace(string(top)), files, nil
+  }
+  var files []string
+  err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    if info.IsDir() && path != root && strings.HasPrefix(info.Name(), ".") {
+      return filepath.SkipDir
+    }
+    if info.Mode().IsRegular() {
+      rel, err := filepath.Rel(root, path)
+      if err != nil {
+        return err
+      }
+      files = append(files, rel)
+    }
+    return nil
+  })
+  return root, files, err
+}
+
+// repoName names the repository root is in, after the top level directory
+// of its git work tree or else root itself
+func repoName(root string) string {
+  cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+  cmd.Dir = root
+  if out, err := cmd.Output(); err == nil {
+    return filepath.Base(strings.TrimSpace(string(out)))
+  }
+  abs, err := filepath.Abs(root)
+  if err != nil {
+    return filepath.Base(root)
+  }
+  return filepath.Base(abs)
+}
+
+// findTodos returns the TODO comments of the files below root, and the
+// files it looked at, named as by scanFiles. Binary and very large files are skipped
+func findTodos(root string) ([]*codeTodo, []string, error) {
+  base, files, err := scanFiles(root)
+  if err != nil {
+    return nil, nil, err
+  }
+  var todos []*codeTodo
+  for _, file := range files {
+    path := filepath.Join(base, file)
+    if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || info.Size() > maxScanFile {
+      continue
+    }
+    b, err := ioutil.ReadFile(path)
+    if err != nil {
+      return nil, nil, err
+    }
+    if bytes.IndexByte(b, 0) >= 0 {
+      continue
+    }
+    lines := bufio.NewScanner(bytes.NewReader(b))
+    lines.Buffer(make([]byte, 0, 64*1024), maxScanFile)
+    for n := 1; lines.Scan(); n++ {
+      if m := todoComment.FindStringSubmatch(lines.Text()); m != nil && m[2] != "" {
+        todos = append(todos, &codeTodo{file: file, line: n, name: m[1], text: m[2]})
+      }
+    }
+  }
+  return todos, files, nil
+}
+
+// Adds a task for each TODO comment below root without one yet, only for
+// those of name if it is not empty, and updates the location in the notes
+// of the others. Tasks of TODO comments that are gone from the files
+// scanned are completed
+func scanTodos(s *session, root string, name string) error {
+  todos, files, err := findTodos(root)
+  if err != nil {
+    return err
+  }
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  repo := repoName(root)
+  tasks := map[string]*todo.Task{}
+  for _, task := range items {
+    if key := task.Meta[metaScan]; strings.HasPrefix(key, repo+"/") {
+      tasks[key] = task
+    }
+  }
+
+  added, updated := 0, 0
+  seen := map[string]bool{}
+  for _, c := range todos {
+    key := c.key(repo)
+    if seen[key] {
+      continue
+    }
+    seen[key] = true
+    notes := fmt.Sprintf("%s:%d", filepath.ToSlash(c.file), c.line)
+    task, ok := tasks[key]
+    switch {
+    case !ok && (name == "" || strings.EqualFold(c.name, name)):
+      task = &todo.Task{Title: c.text, Notes: notes, Meta: map[string]string{metaScan: key}}
+      if _, err := s.insert(task); err != nil {
+        return fmt.Errorf("Could not create task %w", err)
+      }
+      infof("Task '%s' added for %s", c.text, notes)
+      added++
+    case ok && task.Notes != notes:
+      if _, err := s.update(task, &todo.Patch{Notes: &notes}); err != nil {
+        return err
+      }
+      updated++
+    }
+  }
+
+  // only TODOs of the files scanned can be told to be gone
+  scanned := map[string]bool{}
+  for _, file := range files {
+    scanned[repo+"/"+filepath.ToSlash(file)] = true
+  }
+  var gone []*todo.Task
+  for key, task := range tasks {
+    if !seen[key] && scanned[key[:strings.LastIndex(key, "#")]] {
+      gone = append(gone, task)
+    }
+  }
+  err = s.mutateAll(opComplete, gone, func(task *todo.Task) {
+    infof("Task '%s' completed, its TODO is gone", task.Title)
+  })
+  if err != nil {
+    return err
+  }
+  infof("%d added, %d updated and %d completed", added, updated, len(gone))
+  return nil
+}
+
+// prePushHook is the git hook installed by 'todo scan --install-hook'
+const prePushHook = `#!/bin/sh
+# Installed by 'todo scan --install-hook': adds the TODO comments of the
+# code being pushed to your todo list. A failure does not stop the push.
+todo -q scan "$(git rev-parse --show-toplevel)" || echo "todo scan failed" >&2
+exit 0
+`
+
+// installHook writes prePushHook to the pre-push hook of the git
+// repository root is in, unless it has a pre-push hook already
+func installHook(root string) error {
+  cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+  cmd.Dir = root
+  out, err := cmd.Output()
+  if err != nil {
+    return invalidf("%s is not in a git repository", root)
+  }
+  dir := strings.TrimSpace(string(out))
+  if !filepath.IsAbs(dir) {
+    dir = filepath.Join(root, dir)
+  }
+  file := filepath.Join(dir, "pre-push")
+  if b, err := ioutil.ReadFile(file); err == nil {
+    if string(b) == prePushHook {
+      infof("The pre-push hook of %s is installed already", file)
+      return nil
+    }
+    return invalidf("%s exists already, add 'todo -q scan' to it yourself", file)
+  }
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return err
+  }
+  if err := ioutil.WriteFile(file, []byte(prePushHook), 0755); err != nil {
+    return err
+  }
+  infof("Installed %s, TODOs are added to your %s list on every push", file, currentList())
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "scan",
+    usage:   "scan [--name name] [path] | scan --install-hook [path]",
+    summary: "Add tasks for the TODO comments of a repository, or install a git hook doing so on push",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      name := fs.String("name", "", "only add tasks for TODO(name) comments")
+      hook := fs.Bool("install-hook", false, "install a pre-push git hook running 'todo scan'")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 1 {
+        return invalidf("Unexpected argument '%s', see 'todo help scan'", args[1])
+      }
+      root := "."
+      if len(args) == 1 {
+        root = args[0]
+      }
+      if info, err := os.Stat(root); err != nil || !info.IsDir() {
+        return invalidf("%s is not a directory", root)
+      }
+      if *hook {
+        return installHook(root)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return scanTodos(s, root, *name)
+    },
+  })
+}
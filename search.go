@@ -0,0 +1,110 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "regexp"
+  "strings"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// searchHit is a task matching a search, along with the task list it is in
+// and its index there
+type searchHit struct {
+  List  string     `json:"list"`
+  Index int        `json:"index"`
+  Task  *todo.Task `json:"task"`
+}
+
+// newMatcher returns a function reporting whether text matches query,
+// either as a case-insensitive substring or, with regex set, as a regular
+// expression
+func newMatcher(query string, regex bool) (func(text string) bool, error) {
+  if regex {
+    re, err := regexp.Compile(query)
+    if err != nil {
+      return nil, invalidf("Invalid regular expression: %v", err)
+    }
+    return re.MatchString, nil
+  }
+  q := strings.ToLower(query)
+  return func(text string) bool {
+    return strings.Contains(strings.ToLower(text), q)
+  }, nil
+}
+
+// Searches the titles and notes of the uncompleted tasks in all task lists
+// and prints the ones that match, grouped by list
+func searchTodoItems(ctx context.Context, client todo.Backend, match func(string) bool) error {
+  lists, err := client.Lists(ctx)
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve task lists. %w", err)
+  }
+
+  results, err := fetchLists(ctx, lists, func(ctx context.Context, list *todo.TaskList) ([]*todo.Task, error) {
+    items, err := client.List(ctx, list.ID)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to retrieve tasks of %s: %w", list.Title, err)
+    }
+    return items, nil
+  })
+  if err != nil {
+    return err
+  }
+
+  var hits []searchHit
+  for l, list := range lists {
+    for i, task := range results[l] {
+      if match(task.Title) || match(task.Notes) {
+        hits = append(hits, searchHit{List: list.Title, Index: i + 1, Task: task})
+      }
+    }
+  }
+
+  if loadConfig().Output == outputJSON {
+    if hits == nil {
+      hits = []searchHit{}
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(hits)
+  }
+  if len(hits) == 0 {
+    return notFoundf("No tasks match")
+  }
+  for _, hit := range hits {
+    fmt.Printf("%s %d. %s\n", colorize("1", hit.List+":"), hit.Index, hit.Task.Title)
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "search",
+    usage:   "search [--regex] <query>",
+    summary: "Find tasks by title or notes across all task lists",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      regex := fs.Bool("regex", false, "treat the query as a regular expression")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return invalidf("Missing search query, see 'todo help search'")
+      }
+      match, err := newMatcher(strings.Join(args, " "), *regex)
+      if err != nil {
+        return err
+      }
+      client, err := newClient()
+      if err != nil {
+        return err
+      }
+      return searchTodoItems(cmdCtx, client, match)
+    },
+  })
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+  "bufio"
+  "bytes"
+  "crypto/ed25519"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "runtime"
+  "strconv"
+  "strings"
+
+  "golang.org/x/net/context"
+)
+
+// releaseKey is the Ed25519 public key, base64 encoded, release checksums
+// are signed with, set when building releases with
+// -ldflags "-X main.releaseKey=<key>"
+var releaseKey string
+
+// releaseRepo is the GitHub repository todo is released from
+const releaseRepo = "PedramPejman/todo"
+
+// Release files besides the binaries: checksums.txt lists the SHA-256 of
+// each binary like sha256sum does, and checksums.txt.sig holds the
+// Ed25519 signature of checksums.txt, base64 encoded
+const (
+  checksumsAsset    = "checksums.txt"
+  checksumsSigAsset = "checksums.txt.sig"
+)
+
+// release is the part of a GitHub release self-update uses
+type release struct {
+  TagName string `json:"tag_name"`
+  HTMLURL string `json:"html_url"`
+  Assets  []struct {
+    Name string `json:"name"`
+    URL  string `json:"browser_download_url"`
+  } `json:"assets"`
+}
+
+// assetURL returns the address of the release file named name
+func (r *release) assetURL(name string) (string, bool) {
+  for _, a := range r.Assets {
+    if a.Name == name {
+      return a.URL, true
+    }
+  }
+  return "", false
+}
+
+// binaryAsset names the binary of this platform in releases, such as
+// todo_linux_amd64
+func binaryAsset() string {
+  name := fmt.Sprintf("todo_%s_%s", runtime.GOOS, runtime.GOARCH)
+  if runtime.GOOS == "windows" {
+    name += ".exe"
+  }
+  return name
+}
+
+// latestRelease returns the latest release on GitHub, using github_token
+// if set to avoid the rate limit of anonymous requests
+func latestRelease(ctx context.Context) (*release, error) {
+  g := &githubClient{api: githubAPI, token: loadConfig().GitHubToken, client: http.DefaultClient}
+  var r release
+  if _, err := g.get(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", g.api, releaseRepo), &r); err != nil {
+    return nil, fmt.Errorf("Unable to find the latest release: %w", err)
+  }
+  return &r, nil
+}
+
+// compareVersions compares versions such as v1.10.2 by their numbers,
+// returning -1, 0 or 1. A pre-release such as v1.2.0-rc1 comes before its
+// release
+func compareVersions(a, b string) int {
+  parse := func(v string) ([]int, string) {
+    v = strings.TrimPrefix(v, "v")
+    pre := ""
+    if i := strings.IndexAny(v, "-+"); i >= 0 {
+      v, pre = v[:i], v[i:]
+    }
+    var nums []int
+    for _, part := range strings.Split(v, ".") {
+      n, _ := strconv.Atoi(part)
+      nums = append(nums, n)
+    }
+    return nums, pre
+  }
+  an, apre := parse(a)
+  bn, bpre := parse(b)
+  for i := 0; i < len(an) || i < len(bn); i++ {
+    var x, y int
+    if i < len(an) {
+      x = an[i]
+    }
+    if i < len(bn) {
+      y = bn[i]
+    }
+    if x != y {
+      if x < y {
+        return -1
+      }
+      return 1
+    }
+  }
+  switch {
+  case apre == bpre:
+    return 0
+  case apre == "" || (bpre != "" && apre > bpre):
+    return 1
+  }
+  return -1
+}
+
+// download returns the content of the file at u
+func download(ctx context.Context, u string) ([]byte, error) {
+  req, err := http.NewRequest(http.MethodGet, u, nil)
+  if err != nil {
+    return nil, err
+  }
+  res, err := http.DefaultClient.Do(req.WithContext(ctx))
+  if err != nil {
+    return nil, &exitError{code: exitNetwork, err: fmt.Errorf("Unable to download %s: %w", u, err)}
+  }
+  defer res.Body.Close()
+  if res.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("Unable to download %s: %s", u, res.Status)
+  }
+  return ioutil.ReadAll(res.Body)
+}
+
+// releaseChecksum returns the SHA-256 checksum listed for name in
+// checksums, after verifying sig, the base64 encoded signature of
+// checksums, with releaseKey
+func releaseChecksum(checksums, sig []byte, name string) (string, error) {
+  key, err := base64.StdEncoding.DecodeString(releaseKey)
+  if err != nil || len(key) != ed25519.PublicKeySize {
+    return "", fmt.Errorf("Invalid release key built into todo")
+  }
+  signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+  if err != nil || !ed25519.Verify(ed25519.PublicKey(key), checksums, signature) {
+    return "", fmt.Errorf("The signature of %s does not match, not updating", checksumsAsset)
+  }
+  scanner := bufio.NewScanner(bytes.NewReader(checksums))
+  for scanner.Scan() {
+    fields := strings.Fields(scanner.Text())
+    if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+      return fields[0], nil
+    }
+  }
+  return "", fmt.Errorf("No checksum of %s in %s", name, checksumsAsset)
+}
+
+// selfUpdate replaces the running binary with that of the latest release,
+// unless it is not newer than this one and force is unset. The new binary
+// is only installed if its checksum and the signature of the checksums
+// match
+func selfUpdate(ctx context.Context, force bool) error {
+  if releaseKey == "" {
+    return fmt.Errorf("This todo was not built by a release and can not verify updates, install one from https://github.com/%s/releases", releaseRepo)
+  }
+  r, err := latestRelease(ctx)
+  if err != nil {
+    return err
+  }
+  current := currentBuild().Version
+  if !force && compareVersions(r.TagName, current) <= 0 {
+    infof("todo %s is the latest version", current)
+    return nil
+  }
+  name := binaryAsset()
+  binURL, ok := r.assetURL(name)
+  if !ok {
+    return notFoundf("Release %s has no binary for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+  }
+  sumsURL, ok1 := r.assetURL(checksumsAsset)
+  sigURL, ok2 := r.assetURL(checksumsSigAsset)
+  if !ok1 || !ok2 {
+    return fmt.Errorf("Release %s is not signed, not updating", r.TagName)
+  }
+  checksums, err := download(ctx, sumsURL)
+  if err != nil {
+    return err
+  }
+  sig, err := download(ctx, sigURL)
+  if err != nil {
+    return err
+  }
+  want, err := releaseChecksum(checksums, sig, name)
+  if err != nil {
+    return err
+  }
+  verbosef("Downloading %s", binURL)
+  bin, err := download(ctx, binURL)
+  if err != nil {
+    return err
+  }
+  if sum := sha256.Sum256(bin); !strings.EqualFold(hex.EncodeToString(sum[:]), want) {
+    return fmt.Errorf("The checksum of %s does not match, not updating", name)
+  }
+  if err := replaceExecutable(bin); err != nil {
+    return err
+  }
+  infof("Updated todo from %s to %s, see %s", current, r.TagName, r.HTMLURL)
+  return nil
+}
+
+// replaceExecutable atomically replaces the running binary with bin,
+// writing it next to the binary and renaming it over the binary. Windows
+// does not allow that for running binaries, which are moved aside first
+// and moved back if the new one can not take their place
+func replaceExecutable(bin []byte) error {
+  exe, err := os.Executable()
+  if err == nil {
+    exe, err = filepath.EvalSymlinks(exe)
+  }
+  if err != nil {
+    return fmt.Errorf("Unable to find the todo binary: %w", err)
+  }
+  mode := os.FileMode(0755)
+  if info, err := os.Stat(exe); err == nil {
+    mode = info.Mode().Perm()
+  }
+  tmp, err := ioutil.TempFile(filepath.Dir(exe), ".todo-update-")
+  if err != nil {
+    return fmt.Errorf("Unable to write next to %s: %w", exe, err)
+  }
+  defer os.Remove(tmp.Name())
+  if _, err := io.Copy(tmp, bytes.NewReader(bin)); err != nil {
+    tmp.Close()
+    return err
+  }
+  if err := tmp.Close(); err != nil {
+    return err
+  }
+  if err := os.Chmod(tmp.Name(), mode); err != nil {
+    return err
+  }
+  old := ""
+  if runtime.GOOS == "windows" {
+    old = exe + ".old"
+    os.Remove(old)
+    if err := os.Rename(exe, old); err != nil {
+      return fmt.Errorf("Unable to replace %s: %w", exe, err)
+    }
+  }
+  if err := os.Rename(tmp.Name(), exe); err != nil {
+    if old != "" {
+      if rerr := os.Rename(old, exe); rerr != nil {
+        return fmt.Errorf("Unable to replace %s: %v, and to restore it from %s: %w", exe, err, old, rerr)
+      }
+    }
+    return fmt.Errorf("Unable to replace %s: %w", exe, err)
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "self-update",
+    usage:   "self-update [--force]",
+    summary: "Replace todo with the latest release, after verifying its signature",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      force := fs.Bool("force", false, "reinstall the latest release even if it is not newer")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help self-update'", args[0])
+      }
+      return selfUpdate(cmdCtx, *force)
+    },
+  })
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+  "crypto/subtle"
+  "encoding/json"
+  "errors"
+  "net"
+  "net/http"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// maxRequestBody is the largest request body the server reads
+const maxRequestBody = 1 << 20
+
+// server exposes the tasks of the authenticated user over a small REST
+// API. Requests name the task list with the list query parameter, the
+// current list if it is missing
+type server struct {
+  client todo.Backend
+  // token, if set, must be sent as a bearer token with every request
+  token string
+
+  mu sync.Mutex
+  // listIds caches the ids of task lists by name
+  listIds map[string]string
+  // hooks receives an event for every task created, completed or deleted
+  hooks *webhooks
+}
+
+// httpStatus maps the exit code err would result in to an HTTP status
+func httpStatus(err error) int {
+  switch exitCode(err) {
+  case exitNotFound:
+    return http.StatusNotFound
+  case exitInvalid:
+    return http.StatusBadRequest
+  case exitAuth:
+    return http.StatusUnauthorized
+  case exitNetwork:
+    return http.StatusBadGateway
+  case exitQuota:
+    return http.StatusTooManyRequests
+  }
+  return http.StatusInternalServerError
+}
+
+// writeJSON sends v as the JSON body of a response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(status)
+  json.NewEncoder(w).Encode(v)
+}
+
+// writeError sends err as a JSON error response
+func writeError(w http.ResponseWriter, err error) {
+  writeJSON(w, httpStatus(err), map[string]string{"error": err.Error()})
+}
+
+// listId returns the id of the named task list, or of the current list if
+// name is empty
+func (srv *server) listId(ctx context.Context, name string) (string, error) {
+  if name == "" {
+    name = currentList()
+  }
+  srv.mu.Lock()
+  id, ok := srv.listIds[name]
+  srv.mu.Unlock()
+  if ok {
+    return id, nil
+  }
+  id, err := lookupList(ctx, srv.client, name)
+  if err != nil {
+    return "", err
+  }
+  srv.mu.Lock()
+  srv.listIds[name] = id
+  srv.mu.Unlock()
+  return id, nil
+}
+
+// listName returns the name of the task list with the given id, as
+// looked up by listId
+func (srv *server) listName(id string) string {
+  srv.mu.Lock()
+  defer srv.mu.Unlock()
+  for name, listId := range srv.listIds {
+    if listId == id {
+      return name
+    }
+  }
+  return id
+}
+
+// create adds task to a task list
+func (srv *server) create(ctx context.Context, listId string, task *todo.Task) (*todo.Task, error) {
+  created, err := srv.client.Add(ctx, listId, task)
+  if err == nil {
+    srv.hooks.send(eventCreated, srv.listName(listId), created)
+  }
+  return created, err
+}
+
+// complete marks a task as completed
+func (srv *server) complete(ctx context.Context, listId string, id string) (*todo.Task, error) {
+  task, err := srv.client.Complete(ctx, listId, id)
+  if err == nil {
+    srv.hooks.send(eventCompleted, srv.listName(listId), task)
+  }
+  return task, err
+}
+
+// remove deletes a task. With webhooks, the task is fetched first for
+// the event to describe it
+func (srv *server) remove(ctx context.Context, listId string, id string) error {
+  task := &todo.Task{ID: id}
+  if srv.hooks != nil {
+    if t, err := srv.client.Get(ctx, listId, id); err == nil {
+      task = t
+    }
+  }
+  if err := srv.client.Delete(ctx, listId, id); err != nil {
+    return err
+  }
+  srv.hooks.send(eventDeleted, srv.listName(listId), task)
+  return nil
+}
+
+// ServeHTTP routes requests:
+//
+//	GET    /tasks                list uncompleted tasks
+//	POST   /tasks                create the task in the body
+//	PATCH  /tasks/{id}           apply the todo.Patch in the body
+//	POST   /tasks/{id}/complete  mark a task as completed
+//	DELETE /tasks/{id}           delete a task
+func (srv *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  if srv.token != "" {
+    auth := []byte(r.Header.Get("Authorization"))
+    if subtle.ConstantTimeCompare(auth, []byte("Bearer "+srv.token)) != 1 {
+      writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or wrong bearer token"})
+      return
+    }
+  } else {
+    // without a token, web pages the user visits must not reach the
+    // server, whether through a DNS name rebound to 127.0.0.1 or a form
+    host, _, err := net.SplitHostPort(r.Host)
+    if err != nil {
+      host = strings.Trim(r.Host, "[]")
+    }
+    if !localHost(host) {
+      writeJSON(w, http.StatusForbidden, map[string]string{"error": "host must be localhost without --auth-token"})
+      return
+    }
+    if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+      if ct := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]); !strings.EqualFold(ct, "application/json") {
+        writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "content type must be application/json"})
+        return
+      }
+    }
+  }
+
+  r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+  path := strings.Trim(r.URL.Path, "/")
+  parts := strings.Split(path, "/")
+  if parts[0] != "tasks" || len(parts) > 3 || len(parts) == 3 && parts[2] != "complete" {
+    writeError(w, notFoundf("No such resource /%s", path))
+    return
+  }
+  listId, err := srv.listId(r.Context(), r.URL.Query().Get("list"))
+  if err != nil {
+    writeError(w, err)
+    return
+  }
+
+  var status int
+  var result interface{}
+  switch {
+  case len(parts) == 1 && r.Method == http.MethodGet:
+    status = http.StatusOK
+    result, err = srv.list(r, listId)
+  case len(parts) == 1 && r.Method == http.MethodPost:
+    status = http.StatusCreated
+    result, err = srv.add(r, listId)
+  case len(parts) == 2 && r.Method == http.MethodPatch:
+    status = http.StatusOK
+    result, err = srv.update(r, listId, parts[1])
+  case len(parts) == 2 && r.Method == http.MethodDelete:
+    status = http.StatusNoContent
+    err = srv.remove(r.Context(), listId, parts[1])
+  case len(parts) == 3 && r.Method == http.MethodPost:
+    status = http.StatusOK
+    result, err = srv.complete(r.Context(), listId, parts[1])
+  default:
+    w.Header().Set("Allow", allowedMethods(len(parts)))
+    writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+    return
+  }
+  if err != nil {
+    writeError(w, err)
+    return
+  }
+  if result == nil {
+    w.WriteHeader(status)
+    return
+  }
+  writeJSON(w, status, result)
+}
+
+// localHost reports whether host names the loopback interface
+func localHost(host string) bool {
+  return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// allowedMethods returns the methods a path with the given number of
+// segments supports
+func allowedMethods(segments int) string {
+  switch segments {
+  case 1:
+    return "GET, POST"
+  case 2:
+    return "PATCH, DELETE"
+  }
+  return "POST"
+}
+
+// list returns the uncompleted tasks of a task list, never as null
+func (srv *server) list(r *http.Request, listId string) ([]*todo.Task, error) {
+  items, err := srv.client.List(r.Context(), listId)
+  if items == nil {
+    items = []*todo.Task{}
+  }
+  return items, err
+}
+
+// add creates the task in the request body
+func (srv *server) add(r *http.Request, listId string) (*todo.Task, error) {
+  task := &todo.Task{}
+  if err := json.NewDecoder(r.Body).Decode(task); err != nil {
+    return nil, invalidf("Invalid task: %v", err)
+  }
+  if strings.TrimSpace(task.Title) == "" {
+    return nil, invalidf("Task title can not be empty")
+  }
+  return srv.create(r.Context(), listId, task)
+}
+
+// update applies the patch in the request body to a task
+func (srv *server) update(r *http.Request, listId string, id string) (*todo.Task, error) {
+  patch := &todo.Patch{}
+  if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+    return nil, invalidf("Invalid patch: %v", err)
+  }
+  if patch.Empty() {
+    return nil, invalidf("Patch changes nothing")
+  }
+  return srv.client.Update(r.Context(), listId, id, patch)
+}
+
+func init() {
+  register(&command{
+    name:    "serve",
+    usage:   "serve [--addr 127.0.0.1] [--port 8080] [--grpc-port 9090] [--auth-token secret]",
+    summary: "Serve your tasks over a REST API and optionally gRPC, see 'todo help serve'",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      addr := fs.String("addr", "127.0.0.1", "address to listen on")
+      port := fs.Int("port", 8080, "port of the REST API, 0 to disable it")
+      grpcPort := fs.Int("grpc-port", 0, "port of the gRPC service defined in proto/todo.proto, 0 to disable it")
+      token := fs.String("auth-token", "", "bearer token clients must send, required unless listening on localhost")
+      if _, err := parseFlags(fs, args); err != nil {
+        return err
+      }
+      if *port == 0 && *grpcPort == 0 {
+        return invalidf("Nothing to serve with both --port and --grpc-port 0")
+      }
+      if *token == "" && !localHost(*addr) {
+        return invalidf("Refusing to serve on %s without --auth-token", *addr)
+      }
+      client, err := newClient()
+      if err != nil {
+        return err
+      }
+      hooks, err := newWebhooks()
+      if err != nil {
+        return err
+      }
+      // events of requests served until interrupted are still delivered
+      defer hooks.close(30 * time.Second)
+      srv := &server{client: client, token: *token, listIds: map[string]string{}, hooks: hooks}
+
+      // both servers stop once the command is interrupted
+      ctx := cmdCtx
+      errs := make(chan error, 2)
+      if *port != 0 {
+        listen := net.JoinHostPort(*addr, strconv.Itoa(*port))
+        httpServer := &http.Server{Addr: listen, Handler: srv}
+        infof("Serving tasks on http://%s/tasks", listen)
+        go func() { errs <- httpServer.ListenAndServe() }()
+        go func() {
+          <-ctx.Done()
+          httpServer.Close()
+        }()
+      }
+      if *grpcPort != 0 {
+        go func() { errs <- serveGRPC(ctx, srv, net.JoinHostPort(*addr, strconv.Itoa(*grpcPort))) }()
+      }
+      err = <-errs
+      if errors.Is(err, http.ErrServerClosed) || err == nil && ctx.Err() != nil {
+        return nil
+      }
+      return err
+    },
+  })
+}
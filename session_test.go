@@ -0,0 +1,284 @@
+package main
+
+import (
+  "context"
+  "net/http"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "github.com/PedramPejman/todo/pkg/todotest"
+  "google.golang.org/api/googleapi"
+)
+
+// newTestSession returns a session on the default list of a fake Google
+// Tasks account, with the files of todo kept in a temporary directory.
+// Commands opening a session of their own, such as undo, get this one
+func newTestSession(t *testing.T) *session {
+  dir := t.TempDir()
+  for _, env := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME"} {
+    t.Setenv(env, filepath.Join(dir, strings.ToLower(env)))
+  }
+  // leave the files of earlier versions in the real ~/.todo alone
+  migrateOnce.Do(func() {})
+
+  client, _ := todotest.NewClient()
+  ctx := context.Background()
+  name := currentList()
+  id, err := getTodoId(ctx, client, name, true)
+  if err != nil {
+    t.Fatal(err)
+  }
+  s := &session{ctx: ctx, client: client, listName: name, todoId: id, cache: &cachedList{ListId: id}}
+  key := currentBackend() + "/" + currentAccount()
+  replClients = map[string]todo.Backend{key: client}
+  replSessions = map[string]*session{key + "/" + name: s}
+  bypassDaemon, quietFlag = true, true
+  t.Cleanup(func() {
+    replClients, replSessions, bypassDaemon, quietFlag, listFlag = nil, nil, false, false, ""
+  })
+  return s
+}
+
+// remoteTitles returns the titles of the uncompleted tasks of the list of
+// s on the server, in list order
+func remoteTitles(t *testing.T, s *session) string {
+  items, err := s.client.List(s.ctx, s.todoId)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var titles []string
+  for _, task := range items {
+    titles = append(titles, task.Title)
+  }
+  return strings.Join(titles, ", ")
+}
+
+func TestSessionAddDoneRm(t *testing.T) {
+  s := newTestSession(t)
+  if err := addTodoItem(s, &todo.Task{Title: "buy milk tomorrow"}, false, false); err != nil {
+    t.Fatal(err)
+  }
+  if err := addTodoItem(s, &todo.Task{Title: "call mom"}, false, false); err != nil {
+    t.Fatal(err)
+  }
+  // new tasks go first, like with Google Tasks
+  if got := remoteTitles(t, s); got != "call mom, buy milk" {
+    t.Fatalf("after add, tasks are %q", got)
+  }
+  items, err := s.items()
+  if err != nil {
+    t.Fatal(err)
+  }
+  milk := items[1]
+  if want := todo.Date(time.Now().AddDate(0, 0, 1)); !milk.Due.Equal(want) {
+    t.Errorf("'buy milk tomorrow' is due %s, want %s", milk.Due, want)
+  }
+
+  if err := completeTodoItem(s, "milk", false); err != nil {
+    t.Fatal(err)
+  }
+  if got := remoteTitles(t, s); got != "call mom" {
+    t.Fatalf("after done, tasks are %q", got)
+  }
+  if done, err := s.client.Get(s.ctx, s.todoId, milk.ID); err != nil || !done.Done() {
+    t.Errorf("'buy milk' is not completed: %v", err)
+  }
+  if len(s.cache.Items) != 1 {
+    t.Errorf("cache holds %d tasks after done, want 1", len(s.cache.Items))
+  }
+
+  if err := deleteTodoItems(s, []string{"1"}, false); err != nil {
+    t.Fatal(err)
+  }
+  if got := remoteTitles(t, s); got != "" {
+    t.Fatalf("after rm, tasks are %q", got)
+  }
+  trash, err := loadTrash()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(trash) != 1 || trash[0].Task.Title != "call mom" {
+    t.Errorf("trash holds %v, want 'call mom'", trash)
+  }
+}
+
+func TestSessionUndo(t *testing.T) {
+  s := newTestSession(t)
+  if err := addTodoItem(s, &todo.Task{Title: "water plants"}, false, false); err != nil {
+    t.Fatal(err)
+  }
+  if err := addTodoItem(s, &todo.Task{Title: "pay rent"}, false, false); err != nil {
+    t.Fatal(err)
+  }
+
+  if err := undoLast(false); err != nil {
+    t.Fatal(err)
+  }
+  if got := remoteTitles(t, s); got != "water plants" {
+    t.Fatalf("after undoing add, tasks are %q", got)
+  }
+
+  if err := completeTodoItem(s, "water", false); err != nil {
+    t.Fatal(err)
+  }
+  if err := undoLast(false); err != nil {
+    t.Fatal(err)
+  }
+  if got := remoteTitles(t, s); got != "water plants" {
+    t.Fatalf("after undoing done, tasks are %q", got)
+  }
+
+  if err := deleteTodoItems(s, []string{"water"}, false); err != nil {
+    t.Fatal(err)
+  }
+  if err := undoLast(false); err != nil {
+    t.Fatal(err)
+  }
+  if got := remoteTitles(t, s); got != "water plants" {
+    t.Fatalf("after undoing rm, tasks are %q", got)
+  }
+  if trash, _ := loadTrash(); len(trash) != 0 {
+    t.Errorf("trash holds %d tasks after undoing rm, want none", len(trash))
+  }
+
+  if len(loadJournal()) != 1 {
+    t.Errorf("journal holds %d entries, want the first add only", len(loadJournal()))
+  }
+  if err := undoLast(false); err != nil {
+    t.Fatal(err)
+  }
+  if err := undoLast(false); err == nil {
+    t.Error("undo with an empty journal succeeded")
+  }
+}
+
+func TestSessionOffline(t *testing.T) {
+  s := newTestSession(t)
+  if err := addTodoItem(s, &todo.Task{Title: "synced"}, false, false); err != nil {
+    t.Fatal(err)
+  }
+  s.offline = true
+
+  for _, title := range []string{"queued", "scrapped"} {
+    if err := addTodoItem(s, &todo.Task{Title: title}, false, false); err != nil {
+      t.Fatal(err)
+    }
+  }
+  items, err := s.items()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(items) != 3 {
+    t.Fatalf("offline, cache holds %d tasks, want 3", len(items))
+  }
+  for _, task := range items[1:] {
+    if !strings.HasPrefix(task.ID, localIdPrefix) {
+      t.Errorf("'%s' added offline has id %s, want one starting with %s", task.Title, task.ID, localIdPrefix)
+    }
+  }
+  if got := remoteTitles(t, s); got != "synced" {
+    t.Fatalf("offline adds reached the server: %q", got)
+  }
+
+  // a task created offline is dropped along with its queued creation
+  if err := completeTodoItem(s, "scrapped", false); err != nil {
+    t.Fatal(err)
+  }
+  if err := deleteTodoItems(s, []string{"synced"}, false); err != nil {
+    t.Fatal(err)
+  }
+  if n := len(s.cache.Pending); n != 2 {
+    t.Fatalf("%d operations queued, want the add of 'queued' and the rm of 'synced'", n)
+  }
+
+  s.offline = false
+  s.replay()
+  if len(s.cache.Pending) != 0 {
+    t.Errorf("%d operations still queued after replay", len(s.cache.Pending))
+  }
+  if got := remoteTitles(t, s); got != "queued" {
+    t.Fatalf("after replay, tasks are %q", got)
+  }
+  if len(s.cache.Items) != 1 || strings.HasPrefix(s.cache.Items[0].ID, localIdPrefix) {
+    t.Errorf("after replay, cache holds %v, want 'queued' with the id of the server", s.cache.Items)
+  }
+}
+
+func TestUndoOfflineAdd(t *testing.T) {
+  s := newTestSession(t)
+  s.offline = true
+  if err := addTodoItem(s, &todo.Task{Title: "draft"}, false, false); err != nil {
+    t.Fatal(err)
+  }
+  if err := undoLast(false); err != nil {
+    t.Fatal(err)
+  }
+  c := loadCache(s.listName)
+  if len(c.Items) != 0 || len(c.Pending) != 0 {
+    t.Errorf("after undoing an offline add, cache holds %d tasks and %d operations, want none", len(c.Items), len(c.Pending))
+  }
+}
+
+func TestMutateAllQueuedTask(t *testing.T) {
+  s := newTestSession(t)
+  s.offline = true
+  if err := addTodoItem(s, &todo.Task{Title: "draft"}, false, false); err != nil {
+    t.Fatal(err)
+  }
+  // back online, such as with a daemon providing the cached items, before
+  // the creation of the task was replayed
+  s.offline = false
+  var done []string
+  err := s.mutateAll(opDelete, s.cache.Items, func(task *todo.Task) {
+    done = append(done, task.Title)
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(done) != 1 || done[0] != "draft" {
+    t.Errorf("done called for %v, want 'draft'", done)
+  }
+  if len(s.cache.Items) != 0 || len(s.cache.Pending) != 0 {
+    t.Errorf("cache holds %d tasks and %d operations, want none", len(s.cache.Items), len(s.cache.Pending))
+  }
+}
+
+// rejectingBackend fails to create tasks titled reject, like a server
+// refusing them
+type rejectingBackend struct {
+  todo.Backend
+  reject string
+}
+
+func (b rejectingBackend) Add(ctx context.Context, listId string, task *todo.Task) (*todo.Task, error) {
+  if task.Title == b.reject {
+    return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "Invalid task"}
+  }
+  return b.Backend.Add(ctx, listId, task)
+}
+
+func TestReplayRejectedAdd(t *testing.T) {
+  s := newTestSession(t)
+  s.offline = true
+  for _, title := range []string{"rejected", "accepted"} {
+    if err := addTodoItem(s, &todo.Task{Title: title}, false, false); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  s.offline = false
+  s.client = rejectingBackend{Backend: s.client, reject: "rejected"}
+  s.replay()
+  if len(s.cache.Pending) != 0 {
+    t.Errorf("%d operations still queued after replay, want the rejected add dropped", len(s.cache.Pending))
+  }
+  if got := remoteTitles(t, s); got != "accepted" {
+    t.Fatalf("after replay, tasks are %q", got)
+  }
+  if len(s.cache.Items) != 1 || s.cache.Items[0].Title != "accepted" {
+    t.Errorf("after replay, cache holds %v, want 'accepted' only", s.cache.Items)
+  }
+}
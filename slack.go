@@ -0,0 +1,268 @@
+package main
+
+import (
+  "bytes"
+  "crypto/hmac"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "net/url"
+  "strconv"
+  "time"
+
+  "golang.org/x/net/context"
+)
+
+// slackMaxAge is how old the timestamp of a Slack request may be, to
+// keep captured requests from being replayed
+const slackMaxAge = 5 * time.Minute
+
+// slackInteractionTimeout bounds the work done for a button press, which
+// is answered right away and finished after the request, through its
+// response URL
+const slackInteractionTimeout = time.Minute
+
+// slackServer answers the slash command and the buttons of a Slack app.
+// Each Slack user acts as the account users maps them to, or as the
+// current account if users is empty
+type slackServer struct {
+  secret string
+  users  map[string]string
+  chats  map[string]*chat
+}
+
+// slackMessage is a message sent to Slack, see
+// https://api.slack.com/reference/block-kit
+type slackMessage struct {
+  ResponseType    string        `json:"response_type,omitempty"`
+  ReplaceOriginal bool          `json:"replace_original,omitempty"`
+  Text            string        `json:"text"`
+  Blocks          []interface{} `json:"blocks,omitempty"`
+}
+
+// slackInteraction is the part of the payload of a button press the
+// server uses
+type slackInteraction struct {
+  Type string `json:"type"`
+  User struct {
+    ID string `json:"id"`
+  } `json:"user"`
+  Actions []struct {
+    ActionID string `json:"action_id"`
+    Value    string `json:"value"`
+  } `json:"actions"`
+  ResponseURL string `json:"response_url"`
+}
+
+// verify checks the signature Slack computes of a request with the
+// signing secret of the app
+func (srv *slackServer) verify(r *http.Request, body []byte, now time.Time) bool {
+  ts, err := strconv.ParseInt(r.Header.Get("X-Slack-Request-Timestamp"), 10, 64)
+  if err != nil {
+    return false
+  }
+  if age := now.Sub(time.Unix(ts, 0)); age > slackMaxAge || age < -slackMaxAge {
+    return false
+  }
+  mac := hmac.New(sha256.New, []byte(srv.secret))
+  fmt.Fprintf(mac, "v0:%d:%s", ts, body)
+  want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+  return hmac.Equal([]byte(want), []byte(r.Header.Get("X-Slack-Signature")))
+}
+
+// chat returns the chat of a Slack user, or nil if the user is not
+// mapped to an account
+func (srv *slackServer) chat(user string) *chat {
+  if len(srv.users) == 0 {
+    for _, c := range srv.chats {
+      return c
+    }
+  }
+  return srv.chats[srv.users[user]]
+}
+
+// ServeHTTP answers slash commands, and button presses sent with a
+// payload form field
+func (srv *slackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost {
+    w.Header().Set("Allow", "POST")
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  if !srv.verify(r, body, time.Now()) {
+    http.Error(w, "invalid signature", http.StatusUnauthorized)
+    return
+  }
+  form, err := url.ParseQuery(string(body))
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+
+  if payload := form.Get("payload"); payload != "" {
+    // Slack wants button presses acknowledged within 3 seconds, and the
+    // context of r ends with the request
+    w.WriteHeader(http.StatusOK)
+    go func() {
+      ctx, cancel := context.WithTimeout(context.Background(), slackInteractionTimeout)
+      defer cancel()
+      srv.interact(ctx, payload)
+    }()
+    return
+  }
+  c := srv.chat(form.Get("user_id"))
+  if c == nil {
+    writeJSON(w, http.StatusOK, slackMessage{Text: "Your Slack user is not mapped to a todo account, see slack_users"})
+    return
+  }
+  writeJSON(w, http.StatusOK, srv.answer(r.Context(), c, form.Get("text")))
+}
+
+// answer runs the command in text as c, listing tasks with a button to
+// complete each
+func (srv *slackServer) answer(ctx context.Context, c *chat, text string) slackMessage {
+  reply, items, err := c.answer(ctx, text)
+  if err != nil {
+    return slackMessage{Text: err.Error()}
+  }
+  msg := slackMessage{Text: reply}
+  if items == nil {
+    return msg
+  }
+  msg.Blocks = append(msg.Blocks, slackSection(fmt.Sprintf("Your %s list:", c.listName)))
+  for i, task := range items {
+    section := slackSection(fmt.Sprintf("%d. %s", i+1, chatTask(task)))
+    section["accessory"] = map[string]interface{}{
+      "type":      "button",
+      "text":      map[string]string{"type": "plain_text", "text": "Done"},
+      "action_id": "complete",
+      "value":     task.ID,
+    }
+    msg.Blocks = append(msg.Blocks, section)
+  }
+  return msg
+}
+
+// slackSection returns a block showing text
+func slackSection(text string) map[string]interface{} {
+  return map[string]interface{}{
+    "type": "section",
+    "text": map[string]string{"type": "plain_text", "text": text},
+  }
+}
+
+// interact handles a press of the Done button of a listing: the task is
+// completed and the listing replaced by the remaining tasks
+func (srv *slackServer) interact(ctx context.Context, payload string) {
+  var in slackInteraction
+  if err := json.Unmarshal([]byte(payload), &in); err != nil || in.Type != "block_actions" {
+    return
+  }
+  c := srv.chat(in.User.ID)
+  if c == nil {
+    return
+  }
+  for _, action := range in.Actions {
+    if action.ActionID != "complete" {
+      continue
+    }
+    status := ""
+    if task, err := c.client.Complete(ctx, c.listId, action.Value); err != nil {
+      status = err.Error()
+    } else {
+      status = fmt.Sprintf("Task '%s' marked as completed", task.Title)
+    }
+    msg := srv.answer(ctx, c, "list")
+    msg.Text = status
+    msg.Blocks = append([]interface{}{slackSection(status)}, msg.Blocks...)
+    msg.ReplaceOriginal = true
+    if err := slackRespond(ctx, in.ResponseURL, msg); err != nil {
+      warnf("Unable to update Slack message: %v", err)
+    }
+  }
+}
+
+// slackRespond posts msg to the response URL of an interaction
+func slackRespond(ctx context.Context, responseURL string, msg slackMessage) error {
+  b, err := json.Marshal(msg)
+  if err != nil {
+    return err
+  }
+  req, err := http.NewRequest(http.MethodPost, responseURL, bytes.NewReader(b))
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Content-Type", "application/json")
+  res, err := http.DefaultClient.Do(req.WithContext(ctx))
+  if err != nil {
+    return err
+  }
+  defer res.Body.Close()
+  if res.StatusCode != http.StatusOK {
+    return fmt.Errorf("%s", res.Status)
+  }
+  return nil
+}
+
+// serveSlack serves the Slack app on addr until ctx is done
+func serveSlack(ctx context.Context, addr string) error {
+  c := loadConfig()
+  if c.SlackSigningSecret == "" {
+    return invalidf("Set slack_signing_secret to the signing secret of your Slack app with 'todo config set'")
+  }
+  users, err := parseChatUsers(c.SlackUsers)
+  if err != nil {
+    return invalidf("Invalid slack_users: %v", err)
+  }
+  var accounts []string
+  for _, account := range users {
+    accounts = append(accounts, account)
+  }
+  chats, err := chatAccounts(ctx, accounts)
+  if err != nil {
+    return err
+  }
+  srv := &slackServer{secret: c.SlackSigningSecret, users: users, chats: chats}
+
+  httpServer := &http.Server{Addr: addr, Handler: srv}
+  go func() {
+    <-ctx.Done()
+    httpServer.Close()
+  }()
+  infof("Serving Slack commands on http://%s/", addr)
+  if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+    return err
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "slack",
+    usage:   "slack serve [--addr 127.0.0.1] [--port 3000]",
+    summary: "Serve a Slack slash command adding and listing tasks, with buttons completing them",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      addr := fs.String("addr", "127.0.0.1", "address to listen on, behind a proxy Slack can reach")
+      port := fs.Int("port", 3000, "port to listen on")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 || args[0] != "serve" {
+        return invalidf("Unknown slack command, see 'todo help slack'")
+      }
+      return serveSlack(cmdCtx, net.JoinHostPort(*addr, strconv.Itoa(*port)))
+    },
+  })
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+  "fmt"
+  "strconv"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// defaultSnooze is how long snooze pushes a task back without a duration
+const defaultSnooze = "1d"
+
+// snoozed reports whether task is snoozed past today, and so left out of
+// list
+func snoozed(task *todo.Task, now time.Time) bool {
+  return task.Snooze.After(todo.Date(now))
+}
+
+// parseAhead parses value as a number of days, weeks, months or years,
+// such as "3d", "2w", "1m" or "1y", and returns from moved ahead by it
+func parseAhead(value string, from time.Time) (time.Time, error) {
+  units := map[string]string{"d": "day", "w": "week", "m": "month", "y": "year"}
+  if n := len(value) - 1; n > 0 {
+    if unit, ok := units[value[n:]]; ok {
+      if count, err := strconv.Atoi(value[:n]); err == nil && count > 0 {
+        t, _ := addUnit(from, unit, count)
+        return t, nil
+      }
+    }
+  }
+  return time.Time{}, fmt.Errorf("unrecognized duration '%s', expected e.g. 3d, 2w, 1m or 1y", value)
+}
+
+// Pushes the due date of the todo item at arg to until, or else forward
+// by the duration by from its due date, or from today if it is overdue or
+// has none. With hide set, the task is also left out of list until then
+func snoozeTodoItem(s *session, arg string, by string, until time.Time, hide bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+
+  due := until
+  if due.IsZero() {
+    today := todo.Date(time.Now())
+    from := today
+    if task.Due.After(today) {
+      from = task.Due
+    }
+    if due, err = parseAhead(by, from); err != nil {
+      return invalidf("%v", err)
+    }
+  }
+  due = todo.Date(due)
+  patch := &todo.Patch{Due: &due}
+  if hide {
+    patch.Snooze = &due
+  }
+  if _, err := s.update(task, patch); err != nil {
+    return err
+  }
+  if hide {
+    infof("Task '%s' snoozed until %s", task.Title, formatDate(due))
+  } else {
+    infof("Task '%s' now due %s", task.Title, formatDate(due))
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "snooze",
+    aliases: []string{"defer"},
+    usage:   "snooze [--hide] <index> [3d|2w|1m] | snooze [--hide] --until date <index>",
+    summary: "Push a task's due date back, optionally hiding it from list until then",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      untilFlag := fs.String("until", "", "date to push the task to, such as monday or 2024-03-05")
+      hide := fs.Bool("hide", false, "leave the task out of list until it is due")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return invalidf("Missing task index, see 'todo help snooze'")
+      }
+      by := defaultSnooze
+      var until time.Time
+      if *untilFlag != "" {
+        if until, err = parseDate(*untilFlag, time.Now()); err != nil {
+          return invalidf("Invalid --until: %v", err)
+        }
+        if len(args) > 1 {
+          return invalidf("Unexpected argument '%s' with --until, see 'todo help snooze'", args[1])
+        }
+      } else if len(args) == 2 {
+        by = args[1]
+      }
+      if len(args) > 2 {
+        return invalidf("Unexpected argument '%s', see 'todo help snooze'", args[2])
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return snoozeTodoItem(s, args[0], by, until, *hide)
+    },
+  })
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// taskOrders compare two tasks by one sort key, returning a negative number
+// when a comes first, a positive one when b does and 0 when they tie
+var taskOrders = map[string]func(a, b *todo.Task) int{
+  // most important first
+  "priority": func(a, b *todo.Task) int { return int(b.Priority) - int(a.Priority) },
+  // soonest due first, undated tasks last
+  "due": func(a, b *todo.Task) int { return compareTimes(a.Due, b.Due) },
+  // most recently created or updated first
+  "created": func(a, b *todo.Task) int { return newestFirst(a.Created, b.Created) },
+  "updated": func(a, b *todo.Task) int { return newestFirst(a.Updated, b.Updated) },
+  "title": func(a, b *todo.Task) int {
+    return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+  },
+}
+
+// sortKeyNames lists the keys of taskOrders for messages
+const sortKeyNames = "due, created, updated, title or priority"
+
+// compareTimes orders a before b when a is earlier, with zero times last
+func compareTimes(a, b time.Time) int {
+  switch {
+  case a.Equal(b):
+    return 0
+  case a.IsZero():
+    return 1
+  case b.IsZero():
+    return -1
+  case a.Before(b):
+    return -1
+  }
+  return 1
+}
+
+// newestFirst orders a before b when a is later, with zero times last
+func newestFirst(a, b time.Time) int {
+  if a.IsZero() || b.IsZero() {
+    return compareTimes(a, b)
+  }
+  return compareTimes(b, a)
+}
+
+// parseSortKeys splits a comma separated list of sort keys such as
+// "due,priority", checking each one
+func parseSortKeys(s string) ([]string, error) {
+  if s == "" {
+    return nil, nil
+  }
+  var keys []string
+  for _, key := range strings.Split(s, ",") {
+    key = strings.ToLower(strings.TrimSpace(key))
+    if taskOrders[key] == nil {
+      return nil, invalidf("Unknown sort order '%s', expected %s", key, sortKeyNames)
+    }
+    keys = append(keys, key)
+  }
+  return keys, nil
+}
+
+// sortTasks orders the indexes of items in selected by keys, the first key
+// deciding unless tasks tie on it. Tasks tying on all keys keep their order
+func sortTasks(items []*todo.Task, selected []int, keys []string) {
+  sort.SliceStable(selected, func(i, j int) bool {
+    a, b := items[selected[i]], items[selected[j]]
+    for _, key := range keys {
+      if c := taskOrders[key](a, b); c != 0 {
+        return c < 0
+      }
+    }
+    return false
+  })
+}
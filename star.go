@@ -0,0 +1,94 @@
+package main
+
+import (
+  "sort"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// starredFirst moves the indexes of the starred tasks of items in order to
+// its front, keeping the order of both the starred and the other tasks
+func starredFirst(items []*todo.Task, order []int) {
+  sort.SliceStable(order, func(a, b int) bool {
+    return items[order[a]].Starred && !items[order[b]].Starred
+  })
+}
+
+// Stars, or with star unset unstars, the todo items at the given indexes
+func starTodoItems(s *session, args []string, star bool) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  var tasks []*todo.Task
+  for _, arg := range args {
+    task, err := s.taskAt(items, arg)
+    if err != nil {
+      return err
+    }
+    tasks = append(tasks, task)
+  }
+  for _, task := range tasks {
+    if task.Starred == star {
+      if star {
+        infof("Task '%s' is already starred", task.Title)
+      } else {
+        infof("Task '%s' is not starred", task.Title)
+      }
+      continue
+    }
+    if _, err := s.update(task, &todo.Patch{Starred: &star}); err != nil {
+      return err
+    }
+    if star {
+      infof("Task '%s' starred", task.Title)
+    } else {
+      infof("Task '%s' unstarred", task.Title)
+    }
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "star",
+    aliases: []string{"pin"},
+    usage:   "star <index>...",
+    summary: "Pin tasks to the top of list, whatever its sort order",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return invalidf("Missing task index, see 'todo help star'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return starTodoItems(s, args, true)
+    },
+  })
+
+  register(&command{
+    name:    "unstar",
+    aliases: []string{"unpin"},
+    usage:   "unstar <index>...",
+    summary: "Stop pinning tasks to the top of list",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        return invalidf("Missing task index, see 'todo help unstar'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return starTodoItems(s, args, false)
+    },
+  })
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// statsBarWidth is the width of the longest bar of the stats chart
+const statsBarWidth = 30
+
+// statsPeriod is a day or week of the stats chart
+type statsPeriod struct {
+  Start     string `json:"start"`
+  Created   int    `json:"created"`
+  Completed int    `json:"completed"`
+}
+
+// tagCount is how many tasks with a tag were completed
+type tagCount struct {
+  Tag       string `json:"tag"`
+  Completed int    `json:"completed"`
+}
+
+// stats summarizes the activity of a task list since a point in time.
+// Only tasks whose backend records when they were created count as
+// created, and toward the average time to complete
+type stats struct {
+  Since     time.Time     `json:"since"`
+  By        string        `json:"by"`
+  Periods   []statsPeriod `json:"periods"`
+  Created   int           `json:"created"`
+  Completed int           `json:"completed"`
+  Open      int           `json:"open"`
+  // AverageHours is the average time from creation to completion
+  AverageHours  float64    `json:"average_hours,omitempty"`
+  CurrentStreak int        `json:"current_streak"`
+  LongestStreak int        `json:"longest_streak"`
+  Tags          []tagCount `json:"tags,omitempty"`
+}
+
+// localDay returns the local midnight starting the day of t
+func localDay(t time.Time) time.Time {
+  t = t.Local()
+  return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// periodStart returns the start of the day, or week starting on the
+// first day of the week, holding t
+func periodStart(t time.Time, by string) time.Time {
+  day := localDay(t)
+  if by == "week" {
+    return day.AddDate(0, 0, -weekOffset(day))
+  }
+  return day
+}
+
+// computeStats gathers the statistics of the open and completed tasks of
+// a list since the given time, per day or week
+func computeStats(open []*todo.Task, completed []*todo.Task, since time.Time, by string, now time.Time) *stats {
+  st := &stats{Since: since, By: by, Open: len(open)}
+  step := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+  if by == "week" {
+    step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+  }
+  index := map[time.Time]int{}
+  for t := periodStart(since, by); !t.After(now); t = step(t) {
+    index[t] = len(st.Periods)
+    st.Periods = append(st.Periods, statsPeriod{Start: t.Format("2006-01-02")})
+  }
+  count := func(t time.Time, f func(p *statsPeriod)) bool {
+    if t.Before(since) || t.After(now) {
+      return false
+    }
+    if i, ok := index[periodStart(t, by)]; ok {
+      f(&st.Periods[i])
+    }
+    return true
+  }
+
+  var total time.Duration
+  timed := 0
+  doneDays := map[time.Time]bool{}
+  tags := map[string]int{}
+  for _, task := range append(append([]*todo.Task{}, open...), completed...) {
+    if !task.Created.IsZero() && count(task.Created, func(p *statsPeriod) { p.Created++ }) {
+      st.Created++
+    }
+    if !task.Done() || !count(task.Completed, func(p *statsPeriod) { p.Completed++ }) {
+      continue
+    }
+    st.Completed++
+    doneDays[localDay(task.Completed)] = true
+    for _, tag := range task.Tags {
+      tags[strings.ToLower(tag)]++
+    }
+    if !task.Created.IsZero() && task.Completed.After(task.Created) {
+      total += task.Completed.Sub(task.Created)
+      timed++
+    }
+  }
+  if timed > 0 {
+    st.AverageHours = total.Hours() / float64(timed)
+  }
+
+  streak := 0
+  today := localDay(now)
+  for day := localDay(since); !day.After(today); day = day.AddDate(0, 0, 1) {
+    if doneDays[day] {
+      streak++
+    } else if day != today {
+      // the current streak goes on until a day with nothing done
+      // has passed
+      streak = 0
+    }
+    if streak > st.LongestStreak {
+      st.LongestStreak = streak
+    }
+  }
+  st.CurrentStreak = streak
+
+  for tag, n := range tags {
+    st.Tags = append(st.Tags, tagCount{Tag: tag, Completed: n})
+  }
+  sort.Slice(st.Tags, func(i, j int) bool {
+    if st.Tags[i].Completed != st.Tags[j].Completed {
+      return st.Tags[i].Completed > st.Tags[j].Completed
+    }
+    return st.Tags[i].Tag < st.Tags[j].Tag
+  })
+  if len(st.Tags) > 5 {
+    st.Tags = st.Tags[:5]
+  }
+  return st
+}
+
+// formatHours prints a number of hours in days, hours or minutes,
+// whichever reads best
+func formatHours(h float64) string {
+  switch {
+  case h >= 48:
+    return fmt.Sprintf("%.1f days", h/24)
+  case h >= 2:
+    return fmt.Sprintf("%.0f hours", h)
+  }
+  return fmt.Sprintf("%.0f minutes", h*60)
+}
+
+// plural returns n followed by word, with an s unless n is 1
+func plural(n int, word string) string {
+  format := "%d " + word
+  if n != 1 {
+    format += "s"
+  }
+  return fmt.Sprintf(tr(format), n)
+}
+
+// printStats prints st as a chart of the tasks created and completed per
+// period followed by a summary, or as JSON with output set to json
+func printStats(st *stats, of string) error {
+  if loadConfig().Output == outputJSON {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(st)
+  }
+  max := 1
+  for _, p := range st.Periods {
+    if p.Created > max {
+      max = p.Created
+    }
+    if p.Completed > max {
+      max = p.Completed
+    }
+  }
+  bar := func(code string, n int) tableCell {
+    if n == 0 {
+      return cell("2", "0")
+    }
+    width := (n*statsBarWidth + max - 1) / max
+    return join(cell(code, strings.Repeat("#", width)), cell("", fmt.Sprintf(" %d", n)))
+  }
+
+  fmt.Printf("Tasks of %s since %s\n\n", of, formatDate(st.Since))
+  rows := [][]tableCell{{cell("2", strings.Title(st.By)), cell("2", "Created"), cell("2", "Completed")}}
+  for _, p := range st.Periods {
+    start, _ := time.ParseInLocation("2006-01-02", p.Start, time.Local)
+    rows = append(rows, []tableCell{cell("", formatDate(start)), bar("36", p.Created), bar("32", p.Completed)})
+  }
+  printTable(rows)
+
+  fmt.Printf("\n%d created, %d completed, %d open\n", st.Created, st.Completed, st.Open)
+  if st.AverageHours > 0 {
+    fmt.Printf("Average time to complete: %s\n", formatHours(st.AverageHours))
+  }
+  fmt.Printf("Current streak: %s, longest: %s\n", plural(st.CurrentStreak, "day"), plural(st.LongestStreak, "day"))
+  if len(st.Tags) > 0 {
+    var busiest []string
+    for _, t := range st.Tags {
+      busiest = append(busiest, fmt.Sprintf("%s %d", colorize("36", "+"+t.Tag), t.Completed))
+    }
+    fmt.Printf("Busiest tags: %s\n", strings.Join(busiest, ", "))
+  }
+  return nil
+}
+
+// Prints statistics of the todo list, or with allLists set of all task
+// lists, since the given time, per day or week. Completed tasks are not
+// cached, so this needs the backend
+func showStats(s *session, since time.Time, by string, allLists bool) error {
+  if s.offline {
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Completed tasks are not cached, stats needs Google Tasks")}
+  }
+  if allLists {
+    open, completed, err := allListsStats(s, since)
+    if err != nil {
+      return err
+    }
+    return printStats(computeStats(open, completed, since, by, time.Now()), "all your lists")
+  }
+  open, err := s.items()
+  if err != nil {
+    return err
+  }
+  completed, err := s.client.Completed(s.ctx, s.todoId, since, time.Time{})
+  if err != nil {
+    return fmt.Errorf("Unable to retrieve completed tasks: %w", err)
+  }
+  return printStats(computeStats(open, completed, since, by, time.Now()), "your "+s.listName+" list")
+}
+
+// allListsStats returns the uncompleted tasks of all task lists and those
+// completed since the given time, fetching the lists concurrently
+func allListsStats(s *session, since time.Time) ([]*todo.Task, []*todo.Task, error) {
+  lists, err := s.client.Lists(s.ctx)
+  if err != nil {
+    return nil, nil, fmt.Errorf("Unable to retrieve task lists. %w", err)
+  }
+  results, err := fetchLists(s.ctx, lists, func(ctx context.Context, list *todo.TaskList) ([]*todo.Task, error) {
+    open, err := s.client.List(ctx, list.ID)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to retrieve tasks of %s: %w", list.Title, err)
+    }
+    completed, err := s.client.Completed(ctx, list.ID, since, time.Time{})
+    if err != nil {
+      return nil, fmt.Errorf("Unable to retrieve completed tasks of %s: %w", list.Title, err)
+    }
+    return append(open, completed...), nil
+  })
+  if err != nil {
+    return nil, nil, err
+  }
+  var open, completed []*todo.Task
+  for _, items := range results {
+    for _, task := range items {
+      if task.Done() {
+        completed = append(completed, task)
+      } else {
+        open = append(open, task)
+      }
+    }
+  }
+  return open, completed, nil
+}
+
+func init() {
+  register(&command{
+    name:    "stats",
+    usage:   "stats [--since 30d|date] [--by day|week] [--all-lists]",
+    summary: "Chart the tasks created and completed per day or week, with streaks and busiest tags",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      sinceFlag := fs.String("since", "30d", "how far back to look, e.g. 30d, 12w, 1y or a date")
+      by := fs.String("by", "", "chart per day or week, by default per week beyond 31 days")
+      allLists := fs.Bool("all-lists", false, "count the tasks of all task lists")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help stats'", args[0])
+      }
+      now := time.Now()
+      since, err := parseSince(*sinceFlag, now)
+      if err != nil {
+        return invalidf("Invalid --since: %v", err)
+      }
+      switch *by {
+      case "":
+        *by = "day"
+        if now.Sub(since) > 31*24*time.Hour {
+          *by = "week"
+        }
+      case "day", "week":
+      default:
+        return invalidf("Invalid --by '%s', expected day or week", *by)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return showStats(s, since, *by, *allLists)
+    },
+  })
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "os"
+  "strings"
+  texttemplate "text/template"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// defaultStatusFormat is the status line printed unless --format or
+// status_format say otherwise
+const defaultStatusFormat = "{{.Overdue}} overdue, {{.DueToday}} today"
+
+// statusLine holds the counts a status line format can refer to
+type statusLine struct {
+  // List is the name of the task list
+  List string
+  // Open counts the uncompleted tasks, but those snoozed out of sight
+  Open int
+  // Overdue and DueToday count the open tasks due before and on today,
+  // DueWeek those due from today to the end of the week, like 'todo week'
+  Overdue  int
+  DueToday int
+  DueWeek  int
+  // NoDue counts the open tasks without a due date
+  NoDue int
+  // High counts the open tasks of high priority, Blocked those blocked
+  // by other tasks
+  High    int
+  Blocked int
+  // Pending counts the changes queued while offline
+  Pending int
+  // Timer is the title of the task being timed, if any, and Elapsed the
+  // time spent on it since, such as 25m
+  Timer   string
+  Elapsed string
+}
+
+// summarize counts the tasks of items for a status line at now
+func summarize(list string, items []*todo.Task, now time.Time) *statusLine {
+  st := &statusLine{List: list}
+  today := todo.Date(now)
+  blocked := blockedIDs(items)
+  for _, task := range items {
+    if snoozed(task, now) {
+      continue
+    }
+    st.Open++
+    if task.Due.IsZero() {
+      st.NoDue++
+    } else {
+      days := daysUntil(task.Due, today)
+      switch {
+      case days < 0:
+        st.Overdue++
+      case days == 0:
+        st.DueToday++
+      }
+      if days >= 0 && days < 7-weekOffset(today) {
+        st.DueWeek++
+      }
+    }
+    if task.Priority == todo.PriorityHigh {
+      st.High++
+    }
+    if blocked[task.ID] {
+      st.Blocked++
+    }
+  }
+  if entries, err := loadTimeLog(); err == nil {
+    for _, e := range entries {
+      if e.End.IsZero() {
+        st.Timer, st.Elapsed = e.Title, formatSpent(e.spent(now))
+      }
+    }
+  }
+  return st
+}
+
+// quickItems returns the tasks of the named list from its cache when there
+// is one, refreshing it in the background, and fetches them otherwise
+func quickItems(name string) ([]*todo.Task, *cachedList, error) {
+  c := loadCache(name)
+  if c.ListId != "" {
+    startBackgroundSync(c)
+    return c.Items, c, nil
+  }
+  s, err := newSession()
+  if err != nil {
+    return nil, nil, err
+  }
+  items, err := s.items()
+  if err != nil {
+    return nil, nil, err
+  }
+  return items, s.cache, nil
+}
+
+// filterOptions parses the filter arguments of count and summary: +tags,
+// merged with those of the project context, and --where
+func filterOptions(cmd *command, args []string) (listOptions, error) {
+  fs := cmd.flags()
+  where := fs.String("where", "", "only count tasks matching an expression, see 'todo help list'")
+  args, err := parseFlags(fs, args)
+  if err != nil {
+    return listOptions{}, err
+  }
+  words, tags := splitTags(args)
+  if len(words) > 0 {
+    return listOptions{}, invalidf("Unexpected argument '%s', tags to filter by start with '+'", words[0])
+  }
+  opts := listOptions{tags: contextTags(tags)}
+  if *where != "" {
+    if opts.where, err = parseQuery(*where, time.Now()); err != nil {
+      return listOptions{}, err
+    }
+  }
+  return opts, nil
+}
+
+// filteredItems returns the tasks of the current list opts selects, in
+// list order
+func filteredItems(opts listOptions) ([]*todo.Task, error) {
+  items, _, err := quickItems(currentList())
+  if err != nil {
+    return nil, err
+  }
+  order, _, _, err := listOrder(items, opts)
+  if err != nil {
+    return nil, err
+  }
+  var selected []*todo.Task
+  for _, i := range order {
+    selected = append(selected, items[i])
+  }
+  return selected, nil
+}
+
+// Prints a one line summary of the todo list in format, a Go template
+// over the fields of statusLine. The cached list is used when there is
+// one, refreshed in the background, so it is quick enough for a prompt
+func printStatus(format string) error {
+  tmpl, err := texttemplate.New("status").Option("missingkey=error").Parse(format)
+  if err != nil {
+    return invalidf("Invalid status format: %v", err)
+  }
+  name := currentList()
+  items, c, err := quickItems(name)
+  if err != nil {
+    return err
+  }
+  st := summarize(name, items, time.Now())
+  st.Pending = len(c.Pending)
+  var out bytes.Buffer
+  if err := tmpl.Execute(&out, st); err != nil {
+    return invalidf("Invalid status format: %v", err)
+  }
+  fmt.Println(strings.TrimRight(out.String(), "\n"))
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "status",
+    usage:   "status [--format template]",
+    summary: "Print a one line summary of your tasks for status bars and prompts, see 'todo help status'",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      format := fs.String("format", "", "Go template over .List, .Open, .Overdue, .DueToday, .DueWeek, .NoDue, .High, .Blocked, .Pending, .Timer and .Elapsed")
+      if _, err := parseFlags(fs, args); err != nil {
+        return err
+      }
+      if *format == "" {
+        *format = loadConfig().StatusFormat
+      }
+      if *format == "" {
+        *format = defaultStatusFormat
+      }
+      return printStatus(*format)
+    },
+  })
+
+  register(&command{
+    name:    "count",
+    usage:   "count [--where expr] [+tag...]",
+    summary: "Print the number of uncompleted tasks, optionally only those matching a filter",
+    run: func(cmd *command, args []string) error {
+      opts, err := filterOptions(cmd, args)
+      if err != nil {
+        return err
+      }
+      items, err := filteredItems(opts)
+      if err != nil {
+        return err
+      }
+      fmt.Println(len(items))
+      return nil
+    },
+  })
+
+  register(&command{
+    name:    "summary",
+    usage:   "summary [--where expr] [+tag...]",
+    summary: "Print how many tasks are open, overdue, due today and without a due date",
+    run: func(cmd *command, args []string) error {
+      opts, err := filterOptions(cmd, args)
+      if err != nil {
+        return err
+      }
+      items, err := filteredItems(opts)
+      if err != nil {
+        return err
+      }
+      st := summarize(currentList(), items, time.Now())
+      if loadConfig().Output == outputJSON {
+        return json.NewEncoder(os.Stdout).Encode(map[string]int{
+          "total": st.Open, "overdue": st.Overdue, "today": st.DueToday, "no_due": st.NoDue,
+        })
+      }
+      fmt.Printf(tr("%s: %d overdue, %d today, %d without a due date")+"\n",
+        plural(st.Open, "task"), st.Overdue, st.DueToday, st.NoDue)
+      return nil
+    },
+  })
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+  "unicode/utf8"
+)
+
+// tableCell is a cell of a table printed by printTable. Its text may hold
+// color codes, width is the number of characters it takes up on screen
+type tableCell struct {
+  text  string
+  width int
+}
+
+// cell returns a table cell showing s in the given ANSI color code, or
+// uncolored if code is empty
+func cell(code string, s string) tableCell {
+  c := tableCell{text: s, width: utf8.RuneCountInString(s)}
+  if code != "" && s != "" {
+    c.text = colorize(code, s)
+  }
+  return c
+}
+
+// join concatenates cells into one
+func join(cells ...tableCell) tableCell {
+  var c tableCell
+  for _, part := range cells {
+    c.text += part.text
+    c.width += part.width
+  }
+  return c
+}
+
+// printTable prints rows with their columns aligned, two spaces apart.
+// Trailing empty cells leave no trailing spaces
+func printTable(rows [][]tableCell) {
+  var widths []int
+  for _, row := range rows {
+    for i, c := range row {
+      if i == len(widths) {
+        widths = append(widths, 0)
+      }
+      if c.width > widths[i] {
+        widths[i] = c.width
+      }
+    }
+  }
+  for _, row := range rows {
+    last := len(row) - 1
+    for last >= 0 && row[last].width == 0 {
+      last--
+    }
+    var line strings.Builder
+    for i, c := range row[:last+1] {
+      line.WriteString(c.text)
+      if i < last {
+        line.WriteString(strings.Repeat(" ", widths[i]-c.width+2))
+      }
+    }
+    fmt.Println(line.String())
+  }
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// splitTags separates words of the form +tag from the other words in
+// args. It returns the other words and the tags without their '+'
+func splitTags(args []string) ([]string, []string) {
+  var words, tags []string
+  for _, arg := range args {
+    for _, w := range strings.Fields(arg) {
+      if len(w) > 1 && strings.HasPrefix(w, "+") {
+        tags = appendTag(tags, strings.ToLower(w[1:]))
+      } else {
+        words = append(words, w)
+      }
+    }
+  }
+  return words, tags
+}
+
+// appendTag adds tag to tags unless it is already there
+func appendTag(tags []string, tag string) []string {
+  for _, t := range tags {
+    if strings.EqualFold(t, tag) {
+      return tags
+    }
+  }
+  return append(tags, tag)
+}
+
+// hasAllTags reports whether task is tagged with every one of tags
+func hasAllTags(task *todo.Task, tags []string) bool {
+  for _, tag := range tags {
+    if !task.HasTag(tag) {
+      return false
+    }
+  }
+  return true
+}
+
+// formatTags renders tags the way they are typed, as +tag
+func formatTags(tags []string) string {
+  var words []string
+  for _, tag := range tags {
+    words = append(words, colorize("36", "+"+tag))
+  }
+  return strings.Join(words, " ")
+}
+
+// Lists the tags used in items along with the number of tasks carrying
+// each of them
+func listTags(items []*todo.Task) {
+  counts := map[string]int{}
+  for _, task := range items {
+    for _, tag := range task.Tags {
+      counts[strings.ToLower(tag)]++
+    }
+  }
+  var tags []string
+  for tag := range counts {
+    tags = append(tags, tag)
+  }
+  sort.Strings(tags)
+  for _, tag := range tags {
+    fmt.Printf("+%s (%d)\n", tag, counts[tag])
+  }
+}
+
+func init() {
+  register(&command{
+    name:    "tags",
+    usage:   "tags",
+    summary: "List the tags used in your todo list",
+    run: func(cmd *command, args []string) error {
+      if _, err := parseFlags(cmd.flags(), args); err != nil {
+        return err
+      }
+      if c := loadCache(currentList()); c.ListId != "" {
+        startBackgroundSync(c)
+        listTags(c.Items)
+        return nil
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      items, err := s.items()
+      if err != nil {
+        return err
+      }
+      listTags(items)
+      return nil
+    },
+  })
+}
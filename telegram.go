@@ -0,0 +1,199 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "time"
+
+  "golang.org/x/net/context"
+)
+
+// telegramAPI is the address of the Telegram Bot API
+const telegramAPI = "https://api.telegram.org"
+
+// telegramPoll is how long a request for updates waits for messages
+const telegramPoll = 30 * time.Second
+
+// telegramBot answers the messages sent to a Telegram bot. Each Telegram
+// user acts as the account users maps their id to; others are turned
+// away
+type telegramBot struct {
+  api    string
+  token  string
+  client *http.Client
+  users  map[string]string
+  chats  map[string]*chat
+}
+
+// telegramUpdate is the part of an update of the Bot API the bot uses
+type telegramUpdate struct {
+  UpdateID int64 `json:"update_id"`
+  Message  *struct {
+    Chat struct {
+      ID int64 `json:"id"`
+    } `json:"chat"`
+    From struct {
+      ID int64 `json:"id"`
+    } `json:"from"`
+    Text string `json:"text"`
+  } `json:"message"`
+}
+
+// call sends a request for method to the Bot API and decodes its result
+// into v
+func (b *telegramBot) call(ctx context.Context, method string, params interface{}, v interface{}) error {
+  body, err := json.Marshal(params)
+  if err != nil {
+    return err
+  }
+  req, err := http.NewRequest(http.MethodPost, b.api+"/bot"+b.token+"/"+method, bytes.NewReader(body))
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Content-Type", "application/json")
+  res, err := b.client.Do(req.WithContext(ctx))
+  if err != nil {
+    // the error quotes the address, which holds the token
+    if ue, ok := err.(*url.Error); ok {
+      err = ue.Err
+    }
+    return &exitError{code: exitNetwork, err: fmt.Errorf("Telegram %s failed: %w", method, err)}
+  }
+  defer res.Body.Close()
+  var reply struct {
+    OK          bool            `json:"ok"`
+    Description string          `json:"description"`
+    Result      json.RawMessage `json:"result"`
+  }
+  if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+    return fmt.Errorf("Telegram %s failed: %s", method, res.Status)
+  }
+  if !reply.OK {
+    err := fmt.Errorf("Telegram %s failed: %s", method, reply.Description)
+    switch {
+    case res.StatusCode == http.StatusUnauthorized:
+      return fmt.Errorf("%v, check the bot token", err)
+    case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+      return &exitError{code: exitNetwork, err: err}
+    }
+    return err
+  }
+  if v == nil {
+    return nil
+  }
+  return json.Unmarshal(reply.Result, v)
+}
+
+// reply answers a message sent by the user with the given id
+func (b *telegramBot) reply(ctx context.Context, from string, text string) string {
+  c := b.chats[b.users[from]]
+  if c == nil {
+    return fmt.Sprintf("You are not allowed to use this bot, add your id %s to telegram_users", from)
+  }
+  answer, _, err := c.answer(ctx, text)
+  if err != nil {
+    return err.Error()
+  }
+  return answer
+}
+
+// run answers messages until ctx is done
+func (b *telegramBot) run(ctx context.Context) error {
+  var me struct {
+    Username string `json:"username"`
+  }
+  if err := b.call(ctx, "getMe", struct{}{}, &me); err != nil {
+    return err
+  }
+  infof("Answering messages to @%s", me.Username)
+
+  var offset int64
+  for {
+    var updates []telegramUpdate
+    params := map[string]interface{}{"offset": offset, "timeout": int(telegramPoll / time.Second),
+      "allowed_updates": []string{"message"}}
+    err := b.call(ctx, "getUpdates", params, &updates)
+    if ctx.Err() != nil {
+      return nil
+    }
+    if err != nil {
+      // only failures to reach Telegram pass
+      if exitCode(err) != exitNetwork {
+        return err
+      }
+      warnf("Unable to receive messages: %v", err)
+      select {
+      case <-ctx.Done():
+        return nil
+      case <-time.After(5 * time.Second):
+      }
+      continue
+    }
+    for _, u := range updates {
+      offset = u.UpdateID + 1
+      if u.Message == nil || u.Message.Text == "" {
+        continue
+      }
+      from := strconv.FormatInt(u.Message.From.ID, 10)
+      text := b.reply(ctx, from, u.Message.Text)
+      verbosef("Telegram user %s: %s", from, u.Message.Text)
+      err := b.call(ctx, "sendMessage", map[string]interface{}{"chat_id": u.Message.Chat.ID, "text": text}, nil)
+      if err != nil {
+        warnf("Unable to reply to Telegram user %s: %v", from, err)
+      }
+    }
+  }
+}
+
+func init() {
+  register(&command{
+    name:    "telegram",
+    usage:   "telegram [--token bot-token] [--api-url url]",
+    summary: "Run a Telegram bot adding, listing and completing tasks",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      api := fs.String("api-url", telegramAPI, "address of the Bot API server")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help telegram'", args[0])
+      }
+      // --token is the token of the bot here, so the todoist
+      // backend falls back to todoist_token
+      token := tokenFlag
+      tokenFlag = ""
+      c := loadConfig()
+      if token == "" {
+        token = c.TelegramToken
+      }
+      if token == "" {
+        return invalidf("Pass the token @BotFather gave your bot with --token, or set telegram_token")
+      }
+      users, err := parseChatUsers(c.TelegramUsers)
+      if err != nil {
+        return invalidf("Invalid telegram_users: %v", err)
+      }
+      if len(users) == 0 {
+        warnf("telegram_users is not set, so the bot only tells users their id to add to it")
+      }
+      var accounts []string
+      for _, account := range users {
+        accounts = append(accounts, account)
+      }
+      chats, err := chatAccounts(cmdCtx, accounts)
+      if err != nil {
+        return err
+      }
+      bot := &telegramBot{api: strings.TrimSuffix(*api, "/"), token: token, users: users, chats: chats,
+        client: &http.Client{Timeout: telegramPoll + 30*time.Second}}
+      return bot.run(cmdCtx)
+    },
+  })
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+
+  "golang.org/x/net/context"
+)
+
+// telemetrySendEvery is how often collected counts are sent to
+// telemetry_url, at the end of a command
+const telemetrySendEvery = 7 * 24 * time.Hour
+
+// telemetrySendTimeout bounds how long a command waits for counts to be sent
+const telemetrySendTimeout = 3 * time.Second
+
+// usageReport is what is sent to telemetry_url: how often each command
+// was run and how often runs failed by kind of error, without arguments,
+// task content or anything identifying the user or the machine
+type usageReport struct {
+  Version  string         `json:"version"`
+  OS       string         `json:"os"`
+  Arch     string         `json:"arch"`
+  Since    time.Time      `json:"since"`
+  Commands map[string]int `json:"commands"`
+  Errors   map[string]int `json:"errors"`
+}
+
+// usageBuffer is the local file counts are collected in until they are
+// sent
+type usageBuffer struct {
+  Report usageReport `json:"report"`
+  Sent   time.Time   `json:"sent,omitempty"`
+}
+
+// telemetryFile returns the path of the usage buffer
+func telemetryFile() (string, error) {
+  dir, err := dataDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "telemetry.json"), nil
+}
+
+// telemetryEnabled reports whether the user opted in to telemetry and did
+// not opt out of it everywhere with DO_NOT_TRACK
+func telemetryEnabled() bool {
+  if v := os.Getenv("DO_NOT_TRACK"); v != "" && v != "0" {
+    return false
+  }
+  return loadConfig().Telemetry
+}
+
+// loadUsage reads the usage buffer, which is empty if there is none
+func loadUsage() (*usageBuffer, error) {
+  b := &usageBuffer{}
+  file, err := telemetryFile()
+  if err != nil {
+    return nil, err
+  }
+  data, err := ioutil.ReadFile(file)
+  if os.IsNotExist(err) {
+    return b, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  if err := json.Unmarshal(data, b); err != nil {
+    return nil, fmt.Errorf("Invalid usage file %s: %w", file, err)
+  }
+  return b, nil
+}
+
+// save writes the usage buffer, replacing the file atomically
+func (b *usageBuffer) save() error {
+  file, err := telemetryFile()
+  if err != nil {
+    return err
+  }
+  data, err := json.MarshalIndent(b, "", "  ")
+  if err != nil {
+    return err
+  }
+  if err := ioutil.WriteFile(file+".tmp", data, 0600); err != nil {
+    return err
+  }
+  return os.Rename(file+".tmp", file)
+}
+
+// empty reports whether nothing was counted since the last report
+func (b *usageBuffer) empty() bool {
+  return len(b.Report.Commands) == 0 && len(b.Report.Errors) == 0
+}
+
+// recordUsage counts a run of the command named name, and the kind of
+// error it failed with, if telemetry is on. Counts are sent once they are
+// telemetrySendEvery old
+func recordUsage(name string, err error) {
+  if name == "telemetry" || !telemetryEnabled() {
+    return
+  }
+  b, lerr := loadUsage()
+  if lerr != nil {
+    verbosef("Unable to read usage counts: %v", lerr)
+    return
+  }
+  r := &b.Report
+  if r.Commands == nil {
+    r.Commands, r.Errors = map[string]int{}, map[string]int{}
+  }
+  if r.Since.IsZero() {
+    r.Since = time.Now().UTC().Truncate(24 * time.Hour)
+  }
+  r.Commands[name]++
+  if err != nil && err != flag.ErrHelp {
+    r.Errors[errorKinds[exitCode(err)]]++
+  }
+  if err := b.save(); err != nil {
+    verbosef("Unable to save usage counts: %v", err)
+    return
+  }
+  if loadConfig().TelemetryURL == "" || time.Since(b.Report.Since) < telemetrySendEvery || time.Since(b.Sent) < telemetrySendEvery {
+    return
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), telemetrySendTimeout)
+  defer cancel()
+  if err := sendUsage(ctx, b); err != nil {
+    verbosef("Unable to send usage counts: %v", err)
+  }
+}
+
+// pending returns the report to be sent next, stamped with the version and
+// platform of todo
+func (b *usageBuffer) pending() usageReport {
+  r := b.Report
+  build := currentBuild()
+  r.Version, r.OS, r.Arch = build.Version, build.OS, build.Arch
+  if r.Commands == nil {
+    r.Commands, r.Errors = map[string]int{}, map[string]int{}
+  }
+  if r.Since.IsZero() {
+    r.Since = time.Now().UTC().Truncate(24 * time.Hour)
+  }
+  return r
+}
+
+// sendUsage posts the counts of b to telemetry_url and starts counting
+// anew once they were received
+func sendUsage(ctx context.Context, b *usageBuffer) error {
+  u := loadConfig().TelemetryURL
+  if u == "" {
+    return invalidf("No telemetry_url to send usage counts to")
+  }
+  data, err := json.Marshal(b.pending())
+  if err != nil {
+    return err
+  }
+  req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Content-Type", "application/json")
+  req.Header.Set("User-Agent", "todo")
+  res, err := http.DefaultClient.Do(req.WithContext(ctx))
+  if err != nil {
+    return &exitError{code: exitNetwork, err: err}
+  }
+  res.Body.Close()
+  if res.StatusCode/100 != 2 {
+    return fmt.Errorf("%s answered %s", u, res.Status)
+  }
+  b.Report, b.Sent = usageReport{}, time.Now()
+  return b.save()
+}
+
+// setTelemetry turns telemetry on or off. Turning it off deletes the
+// counts collected so far
+func setTelemetry(on bool) error {
+  c, err := loadConfigFile()
+  if err != nil {
+    return err
+  }
+  c.Telemetry = on
+  if err := c.save(); err != nil {
+    return fmt.Errorf("Unable to save config file: %w", err)
+  }
+  if !on {
+    if err := clearUsage(); err != nil {
+      return err
+    }
+    infof("Telemetry is off, and the usage counts collected so far were deleted")
+    return nil
+  }
+  infof("Telemetry is on: todo counts the commands you run and the kinds of errors they fail with, never their arguments or your tasks. See what would be sent with 'todo telemetry show'")
+  if c.TelemetryURL == "" {
+    infof("Nothing is sent until telemetry_url is set")
+  }
+  if v := os.Getenv("DO_NOT_TRACK"); v != "" && v != "0" {
+    warnf("DO_NOT_TRACK is set, so nothing is counted")
+  }
+  return nil
+}
+
+// clearUsage deletes the usage buffer
+func clearUsage() error {
+  file, err := telemetryFile()
+  if err != nil {
+    return err
+  }
+  if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+    return err
+  }
+  return nil
+}
+
+// telemetryStatus prints whether telemetry is on and what was counted
+func telemetryStatus() error {
+  b, err := loadUsage()
+  if err != nil {
+    return err
+  }
+  file, err := telemetryFile()
+  if err != nil {
+    return err
+  }
+  c := loadConfig()
+  if c.Output == outputJSON {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(map[string]interface{}{"enabled": telemetryEnabled(), "url": c.TelemetryURL, "file": file,
+      "sent": b.Sent, "pending": b.pending()})
+  }
+  switch {
+  case telemetryEnabled():
+    fmt.Println("Telemetry is on")
+  case c.Telemetry:
+    fmt.Println("Telemetry is off, DO_NOT_TRACK is set")
+  default:
+    fmt.Println("Telemetry is off, turn it on with 'todo telemetry on'")
+  }
+  if c.TelemetryURL != "" {
+    fmt.Printf("Sending to %s", c.TelemetryURL)
+    if !b.Sent.IsZero() {
+      fmt.Printf(", last sent %s", formatDate(b.Sent.Local()))
+    }
+    fmt.Println()
+  } else if c.Telemetry {
+    fmt.Println("Not sending, telemetry_url is not set")
+  }
+  if b.empty() {
+    fmt.Println("Nothing counted yet")
+    return nil
+  }
+  var names []string
+  runs := 0
+  for name, n := range b.Report.Commands {
+    names = append(names, name)
+    runs += n
+  }
+  sort.Strings(names)
+  failed := 0
+  for _, n := range b.Report.Errors {
+    failed += n
+  }
+  fmt.Printf("Counted %s of %s since %s, %d failed\n", plural(runs, "run"), strings.Join(names, ", "),
+    formatDate(b.Report.Since.Local()), failed)
+  fmt.Println(colorize("2", fmt.Sprintf("In %s, see what would be sent with 'todo telemetry show'", file)))
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "telemetry",
+    usage:   "telemetry on | off | status | show | send | clear",
+    summary: "Opt in to sending anonymous counts of the commands you run and their errors, or out of it, or inspect them",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        args = []string{"status"}
+      }
+      if len(args) > 1 {
+        return invalidf("Unexpected argument '%s', see 'todo help telemetry'", args[1])
+      }
+      switch args[0] {
+      case "on":
+        return setTelemetry(true)
+      case "off":
+        return setTelemetry(false)
+      case "status":
+        return telemetryStatus()
+      case "show":
+        b, err := loadUsage()
+        if err != nil {
+          return err
+        }
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        return enc.Encode(b.pending())
+      case "send":
+        b, err := loadUsage()
+        if err != nil {
+          return err
+        }
+        if b.empty() {
+          infof("Nothing to send")
+          return nil
+        }
+        if err := sendUsage(cmdCtx, b); err != nil {
+          return err
+        }
+        infof("Sent the usage counts to %s", loadConfig().TelemetryURL)
+        return nil
+      case "clear":
+        if err := clearUsage(); err != nil {
+          return err
+        }
+        infof("Deleted the usage counts collected so far")
+        return nil
+      }
+      return invalidf("Unknown telemetry command '%s', expected on, off, status, show, send or clear", args[0])
+    },
+  })
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "regexp"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "gopkg.in/yaml.v3"
+)
+
+// templateName is what names of templates may consist of
+var templateName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// taskTemplate describes a task created from a template. Title and Notes
+// may refer to {title}, the words given to 'todo add --template', and to
+// {date}, today's date. Due is a date phrase such as "friday" or
+// "in 3 days", relative to when the template is used
+type taskTemplate struct {
+  Title    string          `yaml:"title"`
+  Notes    string          `yaml:"notes,omitempty"`
+  Tags     []string        `yaml:"tags,omitempty"`
+  Due      string          `yaml:"due,omitempty"`
+  Priority string          `yaml:"priority,omitempty"`
+  Subtasks []*taskTemplate `yaml:"subtasks,omitempty"`
+}
+
+// template is a saved definition of one or more tasks to add at once: the
+// task described by its own fields, if it has a title, and those in Tasks
+type template struct {
+  taskTemplate `yaml:",inline"`
+  Tasks        []*taskTemplate `yaml:"tasks,omitempty"`
+}
+
+// roots returns the top level tasks of t
+func (t *template) roots() []*taskTemplate {
+  if t.Title == "" {
+    return t.Tasks
+  }
+  return append([]*taskTemplate{&t.taskTemplate}, t.Tasks...)
+}
+
+// templateFile returns the path of the file the template with the given
+// name is saved in
+func templateFile(name string) (string, error) {
+  if !templateName.MatchString(name) {
+    return "", invalidf("Invalid template name '%s', use letters, digits, '-' and '_'", name)
+  }
+  dir, err := configDir("templates")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, name+".yaml"), nil
+}
+
+// parseTemplate decodes and checks the YAML definition of a template
+func parseTemplate(b []byte) (*template, error) {
+  t := &template{}
+  dec := yaml.NewDecoder(bytes.NewReader(b))
+  dec.KnownFields(true)
+  if err := dec.Decode(t); err != nil && err != io.EOF {
+    return nil, err
+  }
+  roots := t.roots()
+  if len(roots) == 0 {
+    return nil, fmt.Errorf("the template defines no task, give it a title or tasks")
+  }
+  var check func(tt *taskTemplate) error
+  check = func(tt *taskTemplate) error {
+    if strings.TrimSpace(tt.Title) == "" {
+      return fmt.Errorf("every task needs a title")
+    }
+    if tt.Due != "" {
+      if _, err := parseDate(tt.Due, time.Now()); err != nil {
+        return fmt.Errorf("task '%s': invalid due date: %v", tt.Title, err)
+      }
+    }
+    if _, err := todo.ParsePriority(tt.Priority); err != nil {
+      return fmt.Errorf("task '%s': %v", tt.Title, err)
+    }
+    for _, sub := range tt.Subtasks {
+      if err := check(sub); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+  for _, tt := range roots {
+    if err := check(tt); err != nil {
+      return nil, err
+    }
+  }
+  return t, nil
+}
+
+// loadTemplate reads the saved template with the given name
+func loadTemplate(name string) (*template, error) {
+  file, err := templateFile(name)
+  if err != nil {
+    return nil, err
+  }
+  b, err := ioutil.ReadFile(file)
+  if os.IsNotExist(err) {
+    return nil, notFoundf("No template named '%s', see 'todo template list'", name)
+  }
+  if err != nil {
+    return nil, err
+  }
+  t, err := parseTemplate(b)
+  if err != nil {
+    return nil, fmt.Errorf("Invalid template %s: %w", file, err)
+  }
+  return t, nil
+}
+
+// Saves the template definition read from r under the given name,
+// replacing a template of that name
+func saveTemplate(name string, r io.Reader) error {
+  file, err := templateFile(name)
+  if err != nil {
+    return err
+  }
+  b, err := ioutil.ReadAll(r)
+  if err != nil {
+    return fmt.Errorf("Unable to read template: %w", err)
+  }
+  t, err := parseTemplate(b)
+  if err != nil {
+    return invalidf("Invalid template: %v", err)
+  }
+  if err := ioutil.WriteFile(file, b, 0600); err != nil {
+    return fmt.Errorf("Unable to save template: %w", err)
+  }
+  n := 0
+  var count func(tts []*taskTemplate)
+  count = func(tts []*taskTemplate) {
+    for _, tt := range tts {
+      n++
+      count(tt.Subtasks)
+    }
+  }
+  count(t.roots())
+  infof("Template '%s' saved, it adds %d tasks", name, n)
+  return nil
+}
+
+// listTemplates prints the names of the saved templates
+func listTemplates() error {
+  dir, err := configDir("templates")
+  if err != nil {
+    return err
+  }
+  files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+  if err != nil {
+    return err
+  }
+  if len(files) == 0 {
+    fmt.Println("No templates yet, see 'todo help template'")
+    return nil
+  }
+  sort.Strings(files)
+  for _, f := range files {
+    fmt.Println(strings.TrimSuffix(filepath.Base(f), ".yaml"))
+  }
+  return nil
+}
+
+// Adds the tasks of the template with the given name to the todo list,
+// with title filling in its {title} placeholders
+func addFromTemplate(s *session, name string, title string) error {
+  t, err := loadTemplate(name)
+  if err != nil {
+    return err
+  }
+  now := time.Now()
+  fill := strings.NewReplacer("{title}", title, "{date}", formatDate(now)).Replace
+
+  added := 0
+  var add func(tt *taskTemplate, parent string) error
+  add = func(tt *taskTemplate, parent string) error {
+    task := &todo.Task{
+      Title:  strings.TrimSpace(fill(tt.Title)),
+      Notes:  fill(tt.Notes),
+      Tags:   tt.Tags,
+      Parent: parent,
+    }
+    // checked when the template was loaded
+    task.Priority, _ = todo.ParsePriority(tt.Priority)
+    if tt.Due != "" {
+      due, _ := parseDate(tt.Due, now)
+      task.Due = todo.Date(due)
+    }
+    created, err := s.insert(task)
+    if err != nil {
+      return fmt.Errorf("Could not create task %w", err)
+    }
+    added++
+    for _, sub := range tt.Subtasks {
+      if err := add(sub, created.ID); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+  for _, tt := range t.roots() {
+    if err := add(tt, ""); err != nil {
+      return err
+    }
+  }
+  if s.offline {
+    infof("%d tasks from template '%s' will be added to your %s list on next sync", added, name, s.listName)
+    return nil
+  }
+  infof("%d tasks from template '%s' added to your %s list", added, name, s.listName)
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "template",
+    usage:   "template [list | save <name> [file|-] | show <name> | rm <name>]",
+    summary: "Manage templates of tasks to add at once with 'todo add --template name'",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 || args[0] == "list" {
+        return listTemplates()
+      }
+      if len(args) < 2 {
+        return invalidf("Missing template name, see 'todo help template'")
+      }
+      switch args[0] {
+      case "save":
+        if len(args) > 3 {
+          return invalidf("Wrong number of arguments for 'template save', see 'todo help template'")
+        }
+        var r io.Reader = os.Stdin
+        if len(args) == 3 && args[2] != "-" {
+          f, err := os.Open(args[2])
+          if err != nil {
+            return invalidf("Unable to open %s: %v", args[2], err)
+          }
+          defer f.Close()
+          r = f
+        }
+        return saveTemplate(args[1], r)
+      case "show":
+        file, err := templateFile(args[1])
+        if err != nil {
+          return err
+        }
+        b, err := ioutil.ReadFile(file)
+        if os.IsNotExist(err) {
+          return notFoundf("No template named '%s', see 'todo template list'", args[1])
+        }
+        if err != nil {
+          return err
+        }
+        _, err = os.Stdout.Write(b)
+        return err
+      case "rm":
+        file, err := templateFile(args[1])
+        if err != nil {
+          return err
+        }
+        if err := os.Remove(file); os.IsNotExist(err) {
+          return notFoundf("No template named '%s', see 'todo template list'", args[1])
+        } else if err != nil {
+          return err
+        }
+        infof("Template '%s' deleted", args[1])
+        return nil
+      }
+      return invalidf("Unknown template command '%s', see 'todo help template'", args[0])
+    },
+  })
+}
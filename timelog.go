@@ -0,0 +1,298 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "path/filepath"
+  "sort"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// timeEntry records a stretch of time spent on a task, from Start to End,
+// or to now while End is zero. The title and tags of the task are kept
+// so that reports need not fetch it
+type timeEntry struct {
+  Task  string    `json:"task"`
+  Title string    `json:"title"`
+  List  string    `json:"list"`
+  Tags  []string  `json:"tags,omitempty"`
+  Start time.Time `json:"start"`
+  End   time.Time `json:"end,omitempty"`
+}
+
+// spent returns how long the entry lasted, until now if it is running
+func (e *timeEntry) spent(now time.Time) time.Duration {
+  if e.End.IsZero() {
+    return now.Sub(e.Start)
+  }
+  return e.End.Sub(e.Start)
+}
+
+// timeLogFile returns the path of the time log of the current account
+func timeLogFile() (string, error) {
+  dir, err := dataDir("time")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, stateName()+".json"), nil
+}
+
+// loadTimeLog reads the time log, oldest entry first. A missing log is
+// empty
+func loadTimeLog() ([]timeEntry, error) {
+  file, err := timeLogFile()
+  if err != nil {
+    return nil, err
+  }
+  b, err := readPrivate(file)
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  var entries []timeEntry
+  if err := json.Unmarshal(b, &entries); err != nil {
+    return nil, fmt.Errorf("Unable to read time log %s: %v", file, err)
+  }
+  return entries, nil
+}
+
+// saveTimeLog replaces the time log with entries
+func saveTimeLog(entries []timeEntry) error {
+  file, err := timeLogFile()
+  if err != nil {
+    return err
+  }
+  b, err := json.MarshalIndent(entries, "", "  ")
+  if err != nil {
+    return err
+  }
+  return writePrivate(file, b)
+}
+
+// stopTimer ends the running entry of entries, if any, at now and
+// returns it
+func stopTimer(entries []timeEntry, now time.Time) *timeEntry {
+  for i := range entries {
+    if entries[i].End.IsZero() {
+      entries[i].End = now
+      return &entries[i]
+    }
+  }
+  return nil
+}
+
+// timeSpent returns the time spent on the task with the given id
+func timeSpent(entries []timeEntry, id string, now time.Time) time.Duration {
+  var total time.Duration
+  for i := range entries {
+    if entries[i].Task == id {
+      total += entries[i].spent(now)
+    }
+  }
+  return total
+}
+
+// formatSpent prints d in hours and minutes, as in "2h 05m"
+func formatSpent(d time.Duration) string {
+  m := int(d.Round(time.Minute) / time.Minute)
+  if m < 60 {
+    return fmt.Sprintf("%dm", m)
+  }
+  return fmt.Sprintf("%dh %02dm", m/60, m%60)
+}
+
+// Starts tracking time spent on the todo item at arg, after stopping the
+// timer of any other task
+func startTimer(s *session, arg string) error {
+  items, err := s.items()
+  if err != nil {
+    return err
+  }
+  task, err := s.taskAt(items, arg)
+  if err != nil {
+    return err
+  }
+  if err := beginTimer(s, task); err != nil {
+    return err
+  }
+  infof("Started '%s'", task.Title)
+  return nil
+}
+
+// beginTimer logs that time spent on task starts now, stopping the timer
+// of any other task
+func beginTimer(s *session, task *todo.Task) error {
+  entries, err := loadTimeLog()
+  if err != nil {
+    return err
+  }
+  now := time.Now()
+  if stopped := stopTimer(entries, now); stopped != nil {
+    infof("Stopped '%s' after %s", stopped.Title, formatSpent(stopped.spent(now)))
+  }
+  entries = append(entries, timeEntry{Task: task.ID, Title: task.Title, List: s.listName,
+    Tags: task.Tags, Start: now})
+  return saveTimeLog(entries)
+}
+
+// Stops tracking time spent on the task whose timer is running
+func stopRunningTimer() error {
+  entries, err := loadTimeLog()
+  if err != nil {
+    return err
+  }
+  now := time.Now()
+  stopped := stopTimer(entries, now)
+  if stopped == nil {
+    return invalidf("No task is being timed, start one with 'todo start <index>'")
+  }
+  if err := saveTimeLog(entries); err != nil {
+    return err
+  }
+  infof("Stopped '%s' after %s, %s in total", stopped.Title, formatSpent(stopped.spent(now)),
+    formatSpent(timeSpent(entries, stopped.Task, now)))
+  return nil
+}
+
+// Prints the time spent since since per task and per tag, most time
+// first, with the time of entries started earlier left out
+func reportTime(since time.Time) error {
+  entries, err := loadTimeLog()
+  if err != nil {
+    return err
+  }
+  now := time.Now()
+  var keys, tags []string
+  titles := map[string]string{}
+  byTask := map[string]time.Duration{}
+  byTag := map[string]time.Duration{}
+  var total time.Duration
+  for i := range entries {
+    e := &entries[i]
+    if e.Start.Before(since) {
+      continue
+    }
+    d := e.spent(now)
+    if _, ok := byTask[e.Task]; !ok {
+      keys = append(keys, e.Task)
+    }
+    titles[e.Task] = e.Title
+    byTask[e.Task] += d
+    for _, tag := range e.Tags {
+      if _, ok := byTag[tag]; !ok {
+        tags = append(tags, tag)
+      }
+      byTag[tag] += d
+    }
+    total += d
+  }
+  if len(keys) == 0 && since.IsZero() {
+    fmt.Println("No time tracked yet, start with 'todo start <index>'")
+    return nil
+  }
+  if len(keys) == 0 {
+    fmt.Printf("No time tracked since %s\n", formatDate(since))
+    return nil
+  }
+
+  sort.SliceStable(keys, func(i, j int) bool { return byTask[keys[i]] > byTask[keys[j]] })
+  rows := [][]tableCell{{cell("2", "Task"), cell("2", "Time"), cell("2", "Hours")}}
+  for _, k := range keys {
+    rows = append(rows, []tableCell{cell("", titles[k]), cell("", formatSpent(byTask[k])),
+      cell("", fmt.Sprintf("%.2f", byTask[k].Hours()))})
+  }
+  rows = append(rows, []tableCell{cell("1", "Total"), cell("1", formatSpent(total)),
+    cell("1", fmt.Sprintf("%.2f", total.Hours()))})
+  printTable(rows)
+
+  if len(tags) > 0 {
+    sort.SliceStable(tags, func(i, j int) bool { return byTag[tags[i]] > byTag[tags[j]] })
+    fmt.Println()
+    rows = [][]tableCell{{cell("2", "Tag"), cell("2", "Time"), cell("2", "Hours")}}
+    for _, tag := range tags {
+      rows = append(rows, []tableCell{cell("36", "+"+tag), cell("", formatSpent(byTag[tag])),
+        cell("", fmt.Sprintf("%.2f", byTag[tag].Hours()))})
+    }
+    printTable(rows)
+  }
+  return nil
+}
+
+// startOfWeek returns the start of the first day of the week of now
+func startOfWeek(now time.Time) time.Time {
+  today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+  return today.AddDate(0, 0, -weekOffset(today))
+}
+
+func init() {
+  register(&command{
+    name:    "start",
+    usage:   "start <index>",
+    summary: "Start tracking time spent on a task",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 {
+        return invalidf("Expected a task index, see 'todo help start'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      return startTimer(s, args[0])
+    },
+  })
+  register(&command{
+    name:    "stop",
+    usage:   "stop",
+    summary: "Stop tracking time spent on the task started last",
+    run: func(cmd *command, args []string) error {
+      args, err := parseFlags(cmd.flags(), args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help stop'", args[0])
+      }
+      return stopRunningTimer()
+    },
+  })
+  register(&command{
+    name:    "report",
+    usage:   "report time [--week | --since 30d]",
+    summary: "Summarize the time spent per task and tag",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      week := fs.Bool("week", false, "report on this week, since its first day")
+      sinceFlag := fs.String("since", "", "report on the time since, such as 30d or 2024-03-01")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) != 1 || args[0] != "time" {
+        return invalidf("Unknown report, see 'todo help report'")
+      }
+      if *week && *sinceFlag != "" {
+        return invalidf("--week and --since cannot be used together")
+      }
+      now := time.Now()
+      var since time.Time
+      switch {
+      case *week:
+        since = startOfWeek(now)
+      case *sinceFlag != "":
+        if since, err = parseSince(*sinceFlag, now); err != nil {
+          return invalidf("Invalid --since: %v", err)
+        }
+      }
+      return reportTime(since)
+    },
+  })
+}
@@ -3,184 +3,790 @@ package main
 import (
   "encoding/json"
   "errors"
+  "flag"
   "fmt"
   "io/ioutil"
-  "log"
-  "net/http"
-  "net/url"
   "os"
-  "os/user"
-  "path/filepath"
   "strings"
+  "time"
 
+  "github.com/PedramPejman/todo/pkg/todo"
   "golang.org/x/net/context"
-  "golang.org/x/oauth2"
-  "golang.org/x/oauth2/google"
-  "google.golang.org/api/tasks/v1"
 )
 
 const (
+  // Todo is the name of the task list used when neither --list nor
+  // default_list in the config file name one
   Todo = "Todo"
 )
 
-// getClient uses a Context and Config to retrieve a Token
-// then generate a Client. It returns the generated Client.
-func getClient(ctx context.Context, config *oauth2.Config) *http.Client {
-  cacheFile, err := tokenCacheFile()
-  if err != nil {
-    log.Fatalf("Unable to get path to cached credential file. %v", err)
-  }
-  tok, err := tokenFromFile(cacheFile)
-  if err != nil {
-    tok = getTokenFromWeb(config)
-    saveToken(cacheFile, tok)
-  }
-  return config.Client(ctx, tok)
-}
+// listFlag is the task list named with --list
+var listFlag string
 
-// getTokenFromWeb uses Config to request a Token.
-// It returns the retrieved Token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-  authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-  fmt.Printf("Go to the following link in your browser then type the "+
-    "authorization code: \n%v\n", authURL)
+// noRetryFlag is set with --no-retry
+var noRetryFlag bool
 
-  var code string
-  if _, err := fmt.Scan(&code); err != nil {
-    log.Fatalf("Unable to read authorization code %v", err)
-  }
+// versionFlag is set with --version, which runs the version command
+var versionFlag bool
 
-  tok, err := config.Exchange(oauth2.NoContext, code)
-  if err != nil {
-    log.Fatalf("Unable to retrieve token from web %v", err)
+// currentList returns the name of the task list commands operate on:
+// the one given with --list, or else pinned by a .todo file, or else the
+// default one
+func currentList() string {
+  if listFlag != "" {
+    return listFlag
   }
-  return tok
+  if c := currentContext(); c != nil && c.List != "" {
+    return c.List
+  }
+  if name := loadConfig().DefaultList; name != "" {
+    return name
+  }
+  return Todo
 }
 
-// tokenCacheFile generates credential file path/filename.
-// It returns the generated credential path/filename.
-func tokenCacheFile() (string, error) {
-  usr, err := user.Current()
+// getTodoId gets id for TaskList with the given name
+// If this TaskList does not exist and create is set, it will be created,
+// otherwise todo.ErrNotFound is returned
+func getTodoId(ctx context.Context, client todo.Backend, name string, create bool) (string, error) {
+  todoList, err := client.FindList(ctx, name)
+  if err == todo.ErrNotFound && create {
+    todoList, err = client.CreateList(ctx, name)
+  }
   if err != nil {
     return "", err
   }
-  tokenCacheDir := filepath.Join(usr.HomeDir, ".credentials")
-  os.MkdirAll(tokenCacheDir, 0700)
-  return filepath.Join(tokenCacheDir,
-    url.QueryEscape("tasks-go-quickstart.json")), err
+  return todoList.ID, nil
 }
 
-// tokenFromFile retrieves a Token from a given file path.
-// It returns the retrieved Token and any read error encountered.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-  f, err := os.Open(file)
-  if err != nil {
-    return nil, err
-  }
-  t := &oauth2.Token{}
-  err = json.NewDecoder(f).Decode(t)
-  defer f.Close()
-  return t, err
+// listOptions selects and orders the tasks printed by listTodoItems
+type listOptions struct {
+  // sortBy is empty for list order, or comma separated sort keys such
+  // as "due,priority"
+  sortBy string
+  // reverse lists tasks in the opposite order
+  reverse bool
+  // tags a task must all carry to be listed
+  tags []string
+  // limit caps the number of tasks listed if positive
+  limit int
+  // plain lists tasks one per line instead of as a table
+  plain bool
+  // snoozed includes the tasks snoozed with 'snooze --hide'
+  snoozed bool
+  // unblocked leaves out the tasks blocked by others
+  unblocked bool
+  // open holds the tasks that may block the listed ones, the listed
+  // ones themselves if nil
+  open []*todo.Task
+  // ids shows the short id of each task
+  ids bool
+  // where is the --where expression tasks must match, if any
+  where query
+  // groupBy is empty, or due, tag or list to print tasks in sections
+  groupBy string
+  // starred only lists the starred tasks
+  starred bool
 }
 
-// saveToken uses a file path to create a file and store the
-// token in it.
-func saveToken(file string, token *oauth2.Token) {
-  fmt.Printf("Saving credential file to: %s\n", file)
-  f, err := os.Create(file)
+// Lists todo items to stdout as a table, numbered so they can be referred
+// to by index. Subtasks are indented below their parent, prioritized tasks
+// marked, due dates highlighted when today or overdue and tasks with notes
+// flagged, while blocked tasks are dimmed. Filtered or sorted tasks keep their index in the full list.
+// With opts.plain set, tasks are printed one per line instead, and with
+// output set to json as a JSON array. With opts.groupBy set, they are
+// printed in sections, see groupTasks
+func listTodoItems(items []*todo.Task, opts listOptions) error {
+  order, depth, blocked, err := listOrder(items, opts)
   if err != nil {
-    log.Fatalf("Unable to cache oauth token: %v", err)
+    return err
   }
-  defer f.Close()
-  json.NewEncoder(f).Encode(token)
+  if opts.groupBy != "" {
+    groups, err := groupTasks(items, order, depth, blocked, opts.groupBy)
+    if err != nil {
+      return err
+    }
+    return printGroups(groups, opts)
+  }
+
+  if loadConfig().Output == outputJSON {
+    tasks := []*todo.Task{}
+    for _, i := range order {
+      tasks = append(tasks, items[i])
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(tasks)
+  }
+  if opts.plain {
+    printTaskLines(items, order, depth, blocked, opts.ids)
+  } else {
+    printTaskTable(items, order, depth, blocked, opts.ids)
+  }
+  return nil
 }
 
-// getTodoId gets id for TaskList named "Todo"
-// If this TaskList does not exist, it will be created
-func getTodoId(srv *tasks.Service) (string, error){
-  userTasks, err := srv.Tasklists.List().Do()
+// listOrder returns the indexes of the tasks of items opts selects, in the
+// order they are listed, with the depth of each below its parent and the
+// ids of the blocked tasks
+func listOrder(items []*todo.Task, opts listOptions) ([]int, map[int]int, map[string]bool, error) {
+  keys, err := parseSortKeys(opts.sortBy)
   if err != nil {
-    log.Fatalf("Unable to retrieve task lists.", err)
+    return nil, nil, nil, err
+  }
+
+  open := opts.open
+  if open == nil {
+    open = items
   }
-  for _, i := range userTasks.Items {
-    if (i.Title == Todo) {
-      return i.Id, nil
+  blocked := blockedIDs(open)
+  var selected []int
+  now := time.Now()
+  env := &queryEnv{now: now, today: todo.Date(now), blocked: blocked}
+  for i, task := range items {
+    if hasAllTags(task, opts.tags) && (opts.snoozed || !snoozed(task, now)) &&
+      !(opts.unblocked && blocked[task.ID]) && (opts.where == nil || opts.where.match(task, env)) &&
+      (!opts.starred || task.Starred) {
+      selected = append(selected, i)
     }
   }
+  sortTasks(items, selected, keys)
+  if opts.reverse {
+    for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+      selected[i], selected[j] = selected[j], selected[i]
+    }
+  }
+  starredFirst(items, selected)
+  order, depth := treeOrder(items, selected)
+  if opts.limit > 0 && len(order) > opts.limit {
+    order = order[:opts.limit]
+  }
+  return order, depth, blocked, nil
+}
 
-  todoList, err := srv.Tasklists.Insert(&tasks.TaskList{
-    Title: Todo,
-  }).Do()
-  if err != nil {
-    return "", errors.New("No Todo tasklist found")
+// printTaskLines prints the tasks of items at the indexes in order one per
+// line, indenting each by its depth and marking those blocked. With ids
+// set, their short ids are shown as well
+func printTaskLines(items []*todo.Task, order []int, depth map[int]int, blocked map[string]bool, ids bool) {
+  now := time.Now()
+  today := now.Format("2006-01-02")
+  for _, i := range order {
+    task := items[i]
+    id := ""
+    if ids {
+      id = "[" + shortID(task.ID) + "] "
+    }
+    star := ""
+    if task.Starred {
+      star = "★ "
+    }
+    line := fmt.Sprintf("%s%d. %s%s%s%s", strings.Repeat("  ", depth[i]), i+1, id, star,
+      priorityMarker(task.Priority), task.Title)
+    if len(task.Tags) > 0 {
+      line += " " + formatTags(task.Tags)
+    }
+    var when []string
+    if !task.Due.IsZero() {
+      due := "due " + formatDate(task.Due)
+      if task.Due.Format("2006-01-02") < today {
+        due = colorize("31", due)
+      }
+      when = append(when, due)
+    }
+    if task.Every != nil {
+      when = append(when, "every "+task.Every.String())
+    }
+    if snoozed(task, now) {
+      when = append(when, "snoozed")
+    }
+    if blocked[task.ID] {
+      when = append(when, "blocked")
+    }
+    if len(taskLinks(task)) > 0 {
+      when = append(when, "link")
+    }
+    if len(when) > 0 {
+      line += " (" + strings.Join(when, ", ") + ")"
+    }
+    fmt.Println(line)
   }
-  return todoList.Id, nil
 }
 
-// Lists current uncompleted todo items to stdout
-func listTodoItems(srv *tasks.Service, todoId string) {
-  tasksObj, _ := srv.Tasks.List(todoId).ShowCompleted(false).Do();
+// printTaskTable prints the tasks of items at the indexes in order as an
+// aligned table, indenting each by its depth and dimming those blocked.
+// With ids set, a column shows their short ids
+func printTaskTable(items []*todo.Task, order []int, depth map[int]int, blocked map[string]bool, ids bool) {
+  today := time.Now().Format("2006-01-02")
+  rows := [][]tableCell{{cell("2", "#"), cell("2", tr("Task")), cell("2", tr("Due")), cell("2", tr("Tags"))}}
+  if ids {
+    rows[0] = append([]tableCell{rows[0][0], cell("2", "ID")}, rows[0][1:]...)
+  }
+  for _, i := range order {
+    task := items[i]
+    code := ""
+    if blocked[task.ID] {
+      code = "2"
+    }
+    title := join(cell("", strings.Repeat("  ", depth[i])), starCell(task), priorityCell(task.Priority), cell(code, task.Title))
 
-  for _, task:= range tasksObj.Items {
-    fmt.Printf("%s\n", task.Title);
+    var due tableCell
+    if !task.Due.IsZero() {
+      code := ""
+      switch day := task.Due.Format("2006-01-02"); {
+      case day < today:
+        code = "31"
+      case day == today:
+        code = "33"
+      }
+      due = cell(code, formatDate(task.Due))
+    }
+    if task.Every != nil {
+      if due.width > 0 {
+        due = join(due, cell("", " "))
+      }
+      due = join(due, cell("2", "every "+task.Every.String()))
+    }
+    if snoozed(task, time.Now()) {
+      if due.width > 0 {
+        due = join(due, cell("", " "))
+      }
+      due = join(due, cell("2", tr("snoozed")))
+    }
+    if blocked[task.ID] {
+      if due.width > 0 {
+        due = join(due, cell("", " "))
+      }
+      due = join(due, cell("2", tr("blocked")))
+    }
+
+    var tags []string
+    for _, tag := range task.Tags {
+      tags = append(tags, "+"+tag)
+    }
+    notes := ""
+    if len(taskLinks(task)) > 0 {
+      notes = "🔗"
+    } else if task.Notes != "" {
+      notes = "✎"
+    }
+    row := []tableCell{cell("", fmt.Sprintf("%d", i+1)), title, due, cell("36", strings.Join(tags, " ")), cell("2", notes)}
+    if ids {
+      row = append([]tableCell{row[0], cell("2", shortID(task.ID))}, row[1:]...)
+    }
+    rows = append(rows, row)
   }
+  printTable(rows)
 }
 
-// Adds a new todo item with given title to todo list
-func addTodoItem(srv *tasks.Service, todoId string, title string) {
-  taskObj := &tasks.Task{
-    Title: title,
+// starCell returns the marker shown before the title of task in a table
+// if it is starred
+func starCell(task *todo.Task) tableCell {
+  if task.Starred {
+    return join(cell("33", "★"), cell("", " "))
   }
+  return cell("", "")
+}
 
-  task, err := srv.Tasks.Insert(todoId, taskObj).Do()
-  if err != nil {
-    log.Fatalf("Could not create task %v", err)
+// priorityCell returns the marker shown before the title of tasks with
+// priority p in a table
+func priorityCell(p todo.Priority) tableCell {
+  switch p {
+  case todo.PriorityHigh:
+    return join(cell("31", "!!!"), cell("", " "))
+  case todo.PriorityMedium:
+    return join(cell("33", "!!"), cell("", " "))
+  case todo.PriorityLow:
+    return join(cell("34", "!"), cell("", " "))
   }
+  return tableCell{}
+}
 
-  if err != nil {
-    log.Fatalf("Could not add task to Todo list: %v", err)
+// treeOrder arranges the indexes in selected so that subtasks follow their
+// parent, keeping the order of selected among siblings. A subtask whose
+// parent is not selected is placed as if it had none. It returns the
+// arranged indexes and the nesting depth of each of them
+func treeOrder(items []*todo.Task, selected []int) ([]int, map[int]int) {
+  byID := map[string]int{}
+  for _, i := range selected {
+    byID[items[i].ID] = i
+  }
+  var roots []int
+  children := map[int][]int{}
+  for _, i := range selected {
+    if p, ok := byID[items[i].Parent]; ok && p != i {
+      children[p] = append(children[p], i)
+    } else {
+      roots = append(roots, i)
+    }
   }
 
-  fmt.Printf("Task '%s' successfully added to your %s list\n", task.Title, Todo)
+  var order []int
+  depth := map[int]int{}
+  var visit func(i int, d int)
+  visit = func(i int, d int) {
+    order = append(order, i)
+    depth[i] = d
+    for _, c := range children[i] {
+      visit(c, d+1)
+    }
+  }
+  for _, i := range roots {
+    visit(i, 0)
+  }
+  return order, depth
 }
 
-func main() {
-  var title string;
-  if len(os.Args) > 1 {
-    title = strings.Join(os.Args[1:], " ")
+// priorityMarker returns the marker printed before the title of tasks
+// with priority p
+func priorityMarker(p todo.Priority) string {
+  switch p {
+  case todo.PriorityHigh:
+    return colorize("31", "!!!") + " "
+  case todo.PriorityMedium:
+    return colorize("33", "!!") + " "
+  case todo.PriorityLow:
+    return colorize("34", "!") + " "
   }
+  return ""
+}
 
-  ctx := context.Background()
+// normalizeTitle returns title lower cased, with runs of spaces and
+// trailing punctuation dropped, to compare titles by
+func normalizeTitle(title string) string {
+  return strings.TrimRight(strings.ToLower(strings.Join(strings.Fields(title), " ")), ".!?;:,")
+}
 
-  dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+// readStdin reads all of standard input, first printing hint on stderr
+// when it is a terminal
+func readStdin(hint string) (string, error) {
+  if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+    fmt.Fprintln(os.Stderr, hint)
+  }
+  b, err := ioutil.ReadAll(os.Stdin)
   if err != nil {
-    log.Fatalf("Unable to find client secret file: %v", err)
+    return "", fmt.Errorf("Unable to read standard input: %w", err)
+  }
+  return string(b), nil
+}
+
+// splitStdinTask separates text read with 'todo add -' into the title, its
+// first non-empty line, and the notes, the lines after it
+func splitStdinTask(text string) (string, string) {
+  text = strings.TrimLeft(text, " \t\r\n")
+  i := strings.Index(text, "\n")
+  if i < 0 {
+    return strings.TrimSpace(text), ""
   }
+  return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+}
 
-  b, err := ioutil.ReadFile(filepath.Join(dir, "client_secret.json"))
+// Adds a new todo item to todo list.
+// Unless literal is set, a date phrase in its title such as "tomorrow" or
+// "next friday" is removed from it and used as the task's due date. With
+// unique set, a task whose normalized title is that of an uncompleted one
+// is not added; the existing task is given its due date instead, if it has
+// another one
+func addTodoItem(s *session, taskObj *todo.Task, literal bool, unique bool) error {
+  if !literal {
+    var due time.Time
+    taskObj.Title, due = parseDue(taskObj.Title, time.Now())
+    taskObj.Due = todo.Date(due)
+  }
+  if unique {
+    items, err := s.items()
+    if err != nil {
+      return err
+    }
+    for _, existing := range items {
+      if normalizeTitle(existing.Title) != normalizeTitle(taskObj.Title) {
+        continue
+      }
+      if taskObj.Due.IsZero() || taskObj.Due.Equal(existing.Due) {
+        infof("Task '%s' is already in your %s list, not adding it again", existing.Title, s.listName)
+        return nil
+      }
+      if _, err := s.update(existing, &todo.Patch{Due: &taskObj.Due}); err != nil {
+        return err
+      }
+      infof("Task '%s' is already in your %s list, moved its due date to %s", existing.Title, s.listName,
+        formatDate(taskObj.Due))
+      return nil
+    }
+  }
+
+  task, err := s.insert(taskObj)
   if err != nil {
-    log.Fatalf("Unable to read client secret file: %v", err)
+    return fmt.Errorf("Could not create task %w", err)
+  }
+
+  if s.offline {
+    infof("Task '%s' will be added to your %s list on next sync", task.Title, s.listName)
+    return nil
+  }
+  infof("Task '%s' successfully added to your %s list", task.Title, s.listName)
+  if !task.Due.IsZero() {
+    infof("Due %s", formatDate(task.Due))
   }
+  return nil
+}
 
-  config, err := google.ConfigFromJSON(b, tasks.TasksScope)
+// session holds the todo backend, the name and id of the
+// task list commands operate on and its local cache. An offline session
+// works on the cache alone and queues its writes
+type session struct {
+  ctx      context.Context
+  client   todo.Backend
+  listName string
+  todoId   string
+  cache    *cachedList
+  offline  bool
+  // daemon is set when a running 'todo daemon' provides the items
+  daemon bool
+}
+
+// newSession authenticates with Google and resolves the current task
+// list, replaying writes queued while offline. If Google Tasks can not be
+// reached but the list is cached, the session is offline. The list is
+// created if it is the default one and does not exist yet. When a daemon
+// runs, it does all of this instead.
+// It returns the resulting session.
+func newSession() (*session, error) {
+  name := currentList()
+  key := currentBackend() + "/" + currentAccount() + "/" + name
+  if s, ok := replSessions[key]; ok {
+    // commands run earlier in the REPL may have changed the cache on disk
+    s.cache = loadCache(name)
+    s.ctx = cmdCtx
+    s.replay()
+    return s, nil
+  }
+  client, err := newClient()
   if err != nil {
-    log.Fatalf("Unable to parse client secret file to config: %v", err)
+    return nil, err
   }
-  client := getClient(ctx, config)
 
-  srv, err := tasks.New(client)
+  s := &session{ctx: cmdCtx, client: client, listName: name, cache: loadCache(name)}
+  create := listFlag == "" || listFlag == loadConfig().DefaultList
+  if !bypassDaemon {
+    // the daemon has resolved the list and replays offline changes
+    if reply, err := askDaemon(&daemonRequest{Op: daemonItems, List: name, Create: create}); err == nil {
+      verbosef("Using the daemon's %s list", name)
+      s.todoId, s.offline, s.daemon = reply.ListId, reply.Offline, true
+      s.cache.ListId = reply.ListId
+    }
+  }
+  if s.daemon {
+    if replSessions != nil {
+      replSessions[key] = s
+    }
+    return s, nil
+  }
+  s.todoId, err = getTodoId(s.ctx, s.client, name, create)
+  if err == todo.ErrNotFound {
+    return nil, notFoundf("No task list named '%s', see 'todo lists'", name)
+  }
   if err != nil {
-    log.Fatalf("Unable to retrieve tasks Client %v", err)
+    if s.cache.ListId == "" || !isNetworkError(err) || errors.Is(err, context.Canceled) {
+      return nil, fmt.Errorf("Unable to retrieve todo task list: %w", err)
+    }
+    warnf("Working offline: %v", err)
+    s.todoId = s.cache.ListId
+    s.offline = true
+    return s, nil
   }
+  if s.cache.ListId != s.todoId {
+    // the list was recreated, nothing cached for it applies anymore
+    s.cache = &cachedList{ListId: s.todoId}
+  }
+  s.replay()
+  if replSessions != nil {
+    replSessions[key] = s
+  }
+  return s, nil
+}
 
-  todoId, err := getTodoId(srv)
+func init() {
+  register(&command{
+    name:    "add",
+    usage:   "add [--literal] [--unique] [--priority p] [--parent index] [--every rule] [--remind 30m] [--notes text] [--link url] (<title> | - | --stdin | --from-clipboard) [+tag...] | add --template name [title]",
+    summary: "Add a new task to your todo list",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      literal := fs.Bool("literal", false, "do not look for a due date in the title")
+      unique := fs.Bool("unique", loadConfig().Unique, "skip tasks already in the list, moving their due date instead if given one")
+      priority := fs.String("priority", "", "priority of the task: high, med or low")
+      parent := fs.String("parent", "", "index or title of the task to add a subtask to")
+      every := fs.String("every", "", "recur after completion, e.g. 3d, 2w, 1m, weekly or an RRULE")
+      remind := fs.Duration("remind", 0, "remind this long before the task is due, see 'todo help remind'")
+      notes := fs.String("notes", "", "notes of the task, see 'todo show'")
+      link := fs.String("link", "", "URL to add to the notes, opened by 'todo open'")
+      tmpl := fs.String("template", "", "add the tasks of a template instead, see 'todo help template'")
+      fromStdin := fs.Bool("stdin", false, "add a task for each line of standard input")
+      fromClipboard := fs.Bool("from-clipboard", false, "add a task titled with the first line of the clipboard, the rest being its notes")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if *tmpl != "" {
+        if _, err := loadTemplate(*tmpl); err != nil {
+          return err
+        }
+        s, err := newSession()
+        if err != nil {
+          return err
+        }
+        return addFromTemplate(s, *tmpl, strings.Join(args, " "))
+      }
+      words, tags := splitTags(args)
+      if *remind < 0 {
+        return invalidf("--remind must not be negative")
+      }
+      prio, err := todo.ParsePriority(*priority)
+      if err != nil {
+        return invalidf("%v", err)
+      }
+      var recurrence *todo.Recurrence
+      if *every != "" {
+        if recurrence, err = todo.ParseRecurrence(*every); err != nil {
+          return invalidf("%v", err)
+        }
+      }
+      lines, taskNotes := []string{strings.Join(words, " ")}, *notes
+      switch {
+      case *fromStdin:
+        if len(words) > 0 {
+          return invalidf("Unexpected argument '%s' with --stdin, tags to add to every task start with '+'", words[0])
+        }
+        text, err := readStdin("Type one task per line, then press Ctrl-D")
+        if err != nil {
+          return err
+        }
+        lines = strings.Split(text, "\n")
+      case *fromClipboard:
+        if len(words) > 0 {
+          return invalidf("Unexpected argument '%s' with --from-clipboard, tags to add start with '+'", words[0])
+        }
+        fallthrough
+      case len(words) == 1 && words[0] == "-":
+        var text string
+        if *fromClipboard {
+          text, err = readClipboard()
+        } else {
+          text, err = readStdin("Type the title, then the notes on the following lines, then press Ctrl-D")
+        }
+        if err != nil {
+          return err
+        }
+        title, body := splitStdinTask(text)
+        lines = []string{title}
+        if body != "" && taskNotes != "" {
+          taskNotes += "\n"
+        }
+        taskNotes += body
+      }
+      if *link != "" {
+        if err := checkLink(*link); err != nil {
+          return err
+        }
+        if taskNotes != "" {
+          taskNotes += "\n"
+        }
+        taskNotes += *link
+      }
+      var tasks []*todo.Task
+      for _, line := range lines {
+        lineWords, lineTags := splitTags([]string{line})
+        if len(lineWords) == 0 {
+          continue
+        }
+        task := &todo.Task{Title: strings.Join(lineWords, " "), Notes: taskNotes, Priority: prio, Every: recurrence,
+          Remind: *remind}
+        for _, tag := range append(contextTags(append([]string{}, tags...)), lineTags...) {
+          task.Tags = appendTag(task.Tags, tag)
+        }
+        tasks = append(tasks, task)
+      }
+      if len(tasks) == 0 {
+        if *fromStdin || len(words) > 0 {
+          return invalidf("No task title read from standard input")
+        }
+        return invalidf("Missing task title, see 'todo help add'")
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      if *parent != "" {
+        items, err := s.items()
+        if err != nil {
+          return err
+        }
+        p, err := findOne(s, items, *parent)
+        if err != nil {
+          return err
+        }
+        for _, task := range tasks {
+          task.Parent = p.ID
+        }
+      }
+      for _, task := range tasks {
+        if err := addTodoItem(s, task, *literal, *unique); err != nil {
+          return err
+        }
+      }
+      return nil
+    },
+  })
+
+  register(&command{
+    name:    "list",
+    aliases: []string{"ls"},
+    usage:   "list [--refresh] [--sort key,...] [--reverse] [--completed] [--snoozed] [--unblocked] [--ids] [--limit n] [--plain] [--where expr] [--group-by due|tag|list] [--starred] [+tag...]",
+    summary: "List uncompleted tasks in your todo list, optionally only those with all given tags",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      refresh := fs.Bool("refresh", false, "fetch tasks from Google instead of the local cache")
+      sortBy := fs.String("sort", "", "order tasks by due, created, updated, title or priority, or several such as due,priority, instead of the sort setting")
+      reverse := fs.Bool("reverse", false, "list tasks in the opposite order")
+      starred := fs.Bool("starred", false, "only list the tasks starred with 'todo star'")
+      groupBy := fs.String("group-by", "", "list tasks under headers by due date, tag, or list, listing all lists")
+      completed := fs.Bool("completed", false, "list completed tasks instead, most recent first")
+      limit := fs.Int("limit", 0, "list at most this many tasks")
+      plain := fs.Bool("plain", false, "print one uncolored line per task instead of a table")
+      showSnoozed := fs.Bool("snoozed", false, "include tasks snoozed with 'todo snooze --hide'")
+      unblocked := fs.Bool("unblocked", false, "leave out tasks blocked by uncompleted ones")
+      ids := fs.Bool("ids", false, "show the short id of each task, which commands accept like indexes")
+      where := fs.String("where", "", "only list tasks matching an expression, such as 'due < 3d && tag == work && !blocked'")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      words, tags := splitTags(args)
+      if len(words) > 0 {
+        return invalidf("Unexpected argument '%s', tags to filter by start with '+'", words[0])
+      }
+      if *limit < 0 {
+        return invalidf("--limit must not be negative")
+      }
+      if *plain {
+        noColorFlag = true
+      }
+      tags = contextTags(tags)
+      if *sortBy == "" {
+        *sortBy = loadConfig().Sort
+      }
+      opts := listOptions{sortBy: *sortBy, reverse: *reverse, groupBy: *groupBy, starred: *starred, tags: tags, limit: *limit, plain: *plain, snoozed: *showSnoozed,
+        unblocked: *unblocked, ids: *ids}
+      if *where != "" {
+        if opts.where, err = parseQuery(*where, time.Now()); err != nil {
+          return err
+        }
+      }
+      if *groupBy == "list" {
+        opts.groupBy = ""
+        return listAllLists(opts)
+      }
+      if *completed {
+        s, err := newSession()
+        if err != nil {
+          return err
+        }
+        return showHistory(s, time.Time{}, tags, *limit)
+      }
+      if c := loadCache(currentList()); !*refresh && c.ListId != "" {
+        verbosef("Listing the cached %s list, %s", currentList(), c.age())
+        // saved before the background sync loads the cache, so it keeps
+        // the listing
+        c.remember(c.Items, "")
+        if err := c.save(currentList()); err != nil {
+          warnf("Unable to update local cache: %v", err)
+        }
+        startBackgroundSync(c)
+        return listTodoItems(c.Items, opts)
+      }
+      s, err := newSession()
+      if err != nil {
+        return err
+      }
+      items, err := s.items()
+      if err != nil {
+        return err
+      }
+      s.cache.remember(items, "")
+      s.saveCache()
+      return listTodoItems(items, opts)
+    },
+  })
+
+}
+
+// run executes the command named by the first argument, listing tasks if
+// there is none
+func run(args []string) error {
+  if err := initConfig(); err != nil {
+    return err
+  }
+  if len(args) == 0 {
+    args = []string{"list"}
+  }
+  args, err := expandAlias(args)
   if err != nil {
-    log.Fatalf("Unable to retrieve todo task list: %v", err)
+    return err
   }
 
-  if title == "" {
-    listTodoItems(srv, todoId);
-  } else {
-    addTodoItem(srv, todoId, title);
+  cmd := lookupCommand(args[0])
+  if cmd == nil {
+    if plugin := findPlugin(args[0]); plugin != "" {
+      return runPlugin(plugin, args[0], args[1:])
+    }
+    usage()
+    return invalidf("unknown command '%s'", args[0])
+  }
+  ctx, cancel := commandContext()
+  defer cancel()
+  // commands run from the REPL get a context of their own
+  outer, outerCommand := cmdCtx, runningCommand
+  cmdCtx, runningCommand = ctx, strings.Join(args, " ")
+  defer func() { cmdCtx, runningCommand = outer, outerCommand }()
+  err = runWithHooks(cmd, args[1:])
+  recordUsage(cmd.name, err)
+  return err
+}
+
+func main() {
+  flag.CommandLine.Init("todo", flag.ContinueOnError)
+  flag.Usage = usage
+  flag.StringVar(&listFlag, "list", "", "task list to operate on")
+  flag.StringVar(&accountFlag, "account", "", "account to act as, see 'todo auth list'")
+  flag.BoolVar(&noRetryFlag, "no-retry", false, "do not retry failed Google Tasks requests")
+  flag.StringVar(&backendFlag, "backend", "", "where tasks are kept: google, local, todoist or caldav")
+  flag.StringVar(&tokenFlag, "token", "", "API token of the todoist backend")
+  flag.BoolVar(&noColorFlag, "no-color", false, "do not colorize output")
+  flag.StringVar(&clientSecretFlag, "client-secret", "", "OAuth client secret file to authorize todo with")
+  flag.BoolVar(&quietFlag, "quiet", false, "do not report what was changed")
+  flag.BoolVar(&quietFlag, "q", false, "short for --quiet")
+  flag.BoolVar(&verboseFlag, "verbose", false, "log HTTP requests, retries and cache use")
+  flag.BoolVar(&verboseFlag, "v", false, "short for --verbose")
+  flag.BoolVar(&debugFlag, "debug", false, "like --verbose, also logging HTTP headers")
+  flag.DurationVar(&timeoutFlag, "timeout", 0, "give up on the command after this long, e.g. 30s")
+  flag.StringVar(&outputFlag, "output", "", "output format: text or json, overriding the output setting")
+  flag.StringVar(&dateFormatFlag, "date-format", "", "Go time layout to print dates with, e.g. 'Jan 2'")
+  flag.BoolVar(&noContextFlag, "no-context", false, "ignore the .todo file of the working directory")
+  flag.BoolVar(&versionFlag, "version", false, "print the version of todo, like 'todo version'")
+  if err := flag.CommandLine.Parse(os.Args[1:]); err == flag.ErrHelp {
+    os.Exit(exitOK)
+  } else if err != nil {
+    os.Exit(exitInvalid)
+  }
+
+  args := flag.Args()
+  if versionFlag {
+    args = []string{"version"}
+  }
+  err := run(args)
+  if err == nil || err == flag.ErrHelp {
+    os.Exit(exitOK)
   }
+  reportError(err)
+  os.Exit(exitCode(err))
 }
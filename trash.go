@@ -0,0 +1,260 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// trashDays is how long deleted tasks stay in the trash
+const trashDays = 30
+
+// trashEntry is a task deleted with 'todo rm', kept with the subtasks
+// deleted along with it so all of them can be restored
+type trashEntry struct {
+  Task     *todo.Task   `json:"task"`
+  Subtasks []*todo.Task `json:"subtasks,omitempty"`
+  List     string       `json:"list"`
+  Deleted  time.Time    `json:"deleted"`
+}
+
+// trashFile returns the path of the trash of the current account
+func trashFile() (string, error) {
+  dir, err := dataDir("trash")
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, stateName()+".json"), nil
+}
+
+// loadTrash reads the trash, oldest entry first, leaving out entries
+// deleted more than trashDays ago
+func loadTrash() ([]trashEntry, error) {
+  file, err := trashFile()
+  if err != nil {
+    return nil, err
+  }
+  b, err := readPrivate(file)
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  var entries []trashEntry
+  if err := json.Unmarshal(b, &entries); err != nil {
+    return nil, fmt.Errorf("Unable to read %s: %w", file, err)
+  }
+  cutoff := time.Now().AddDate(0, 0, -trashDays)
+  var kept []trashEntry
+  for _, e := range entries {
+    if e.Deleted.After(cutoff) {
+      kept = append(kept, e)
+    }
+  }
+  return kept, nil
+}
+
+// saveTrash replaces the trash with entries
+func saveTrash(entries []trashEntry) error {
+  file, err := trashFile()
+  if err != nil {
+    return err
+  }
+  if entries == nil {
+    entries = []trashEntry{}
+  }
+  b, err := json.MarshalIndent(entries, "", "  ")
+  if err != nil {
+    return err
+  }
+  return writePrivate(file, b)
+}
+
+// trashTasks adds the deleted tasks of the todo list to the trash, with
+// their subtasks in items, purging entries older than trashDays. Failing
+// to is only warned of, since the tasks are deleted already
+func trashTasks(s *session, items []*todo.Task, deleted []*todo.Task) {
+  if len(deleted) == 0 {
+    return
+  }
+  entries, err := loadTrash()
+  if err != nil {
+    warnf("Unable to move deleted tasks to the trash: %v", err)
+    return
+  }
+  now := time.Now()
+  for _, task := range deleted {
+    entries = append(entries, trashEntry{Task: task, Subtasks: subtasks(items, task), List: s.listName, Deleted: now})
+  }
+  if err := saveTrash(entries); err != nil {
+    warnf("Unable to move deleted tasks to the trash: %v", err)
+  }
+}
+
+// untrash takes the task with the given id out of the trash, once its
+// deletion was undone
+func untrash(id string) {
+  entries, err := loadTrash()
+  if err != nil {
+    return
+  }
+  for i, e := range entries {
+    if e.Task.ID == id {
+      if err := saveTrash(append(entries[:i:i], entries[i+1:]...)); err != nil {
+        warnf("Unable to update the trash: %v", err)
+      }
+      return
+    }
+  }
+}
+
+// trashEntryAt returns the index in entries of the entry arg refers to:
+// its 1-based index in 'todo trash list', or a prefix of its short id
+func trashEntryAt(entries []trashEntry, arg string) (int, error) {
+  if i, err := strconv.Atoi(arg); err == nil {
+    if i < 1 || i > len(entries) {
+      return 0, invalidf("Invalid trash index '%s', see 'todo trash list'", arg)
+    }
+    return i - 1, nil
+  }
+  var matches []int
+  for i, e := range entries {
+    if id := shortID(e.Task.ID); id == arg || len(arg) >= minIDPrefix && strings.HasPrefix(id, arg) {
+      matches = append(matches, i)
+    }
+  }
+  switch len(matches) {
+  case 0:
+    return 0, notFoundf("No task in the trash has the id '%s', see 'todo trash list'", arg)
+  case 1:
+    return matches[0], nil
+  }
+  return 0, invalidf("'%s' matches %d tasks in the trash, give more of the id", arg, len(matches))
+}
+
+// Lists the tasks in the trash, most recently deleted first, with the ids
+// to restore them by, or as JSON with output set to json
+func listTrash() error {
+  entries, err := loadTrash()
+  if err != nil {
+    return err
+  }
+  if loadConfig().Output == outputJSON {
+    if entries == nil {
+      entries = []trashEntry{}
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(entries)
+  }
+  if len(entries) == 0 {
+    fmt.Println("The trash is empty")
+    return nil
+  }
+  rows := [][]tableCell{{cell("2", "#"), cell("2", "ID"), cell("2", "Task"), cell("2", "List"), cell("2", "Deleted")}}
+  for i := len(entries) - 1; i >= 0; i-- {
+    e := entries[i]
+    title := e.Task.Title
+    if n := len(e.Subtasks); n > 0 {
+      title += fmt.Sprintf(" (+%s)", plural(n, "subtask"))
+    }
+    rows = append(rows, []tableCell{cell("", strconv.Itoa(i+1)), cell("2", shortID(e.Task.ID)), cell("", title),
+      cell("", e.List), cell("", formatDate(e.Deleted.Local()))})
+  }
+  printTable(rows)
+  fmt.Println(colorize("2", fmt.Sprintf("Deleted tasks are kept for %d days", trashDays)))
+  return nil
+}
+
+// Adds the task in the trash arg refers to back to the list it was
+// deleted from, with its subtasks, and takes it out of the trash. The
+// restored tasks get new ids
+func restoreTrashed(arg string) error {
+  entries, err := loadTrash()
+  if err != nil {
+    return err
+  }
+  i, err := trashEntryAt(entries, arg)
+  if err != nil {
+    return err
+  }
+  e := entries[i]
+  client, err := newClient()
+  if err != nil {
+    return err
+  }
+  s := &session{ctx: cmdCtx, client: client, listName: e.List, cache: loadCache(e.List)}
+  if s.todoId, err = getTodoId(s.ctx, s.client, e.List, true); err != nil {
+    return fmt.Errorf("Unable to retrieve task list '%s': %w", e.List, err)
+  }
+  ids := map[string]string{}
+  for _, t := range append([]*todo.Task{e.Task}, reverse(e.Subtasks)...) {
+    c := *t
+    c.Parent = ids[t.Parent]
+    added, err := s.insert(&c)
+    if err != nil {
+      return fmt.Errorf("Unable to restore task '%s': %w", t.Title, err)
+    }
+    ids[t.ID] = added.ID
+  }
+  if err := saveTrash(append(entries[:i:i], entries[i+1:]...)); err != nil {
+    return err
+  }
+  infof("Task '%s' restored to your %s list", e.Task.Title, e.List)
+  return nil
+}
+
+// Forgets the tasks in the trash, after asking for confirmation unless
+// force is set
+func emptyTrash(force bool) error {
+  entries, err := loadTrash()
+  if err != nil {
+    return err
+  }
+  if len(entries) == 0 {
+    infof("The trash is empty")
+    return nil
+  }
+  if !force && !confirmf("Forget the %s in the trash for good?", plural(len(entries), "task")) {
+    return nil
+  }
+  if err := saveTrash(nil); err != nil {
+    return err
+  }
+  infof("Emptied the trash of %s", plural(len(entries), "task"))
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "trash",
+    usage:   "trash [list] | trash restore <id|index> | trash empty [--force]",
+    summary: fmt.Sprintf("List the tasks deleted in the last %d days, restore them or empty the trash", trashDays),
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      force := fs.Bool("force", false, "empty the trash without asking for confirmation")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      switch {
+      case len(args) == 0 || args[0] == "list" && len(args) == 1:
+        return listTrash()
+      case args[0] == "restore" && len(args) == 2:
+        return restoreTrashed(args[1])
+      case args[0] == "restore":
+        return invalidf("Give the id or index of one task to restore, see 'todo trash list'")
+      case args[0] == "empty" && len(args) == 1:
+        return emptyTrash(*force)
+      }
+      return invalidf("Unknown trash command '%s', see 'todo help trash'", strings.Join(args, " "))
+    },
+  })
+}
@@ -0,0 +1,722 @@
+package main
+
+import (
+  "bytes"
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/rand"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "github.com/zalando/go-keyring"
+  "golang.org/x/crypto/scrypt"
+  "golang.org/x/term"
+)
+
+// vaultMagic starts the files encrypted by the vault, telling them apart
+// from those written before it was set up. The scrypt parameters and the
+// salt of the key follow it, so that the files can be decrypted with the
+// passphrase alone, on any machine
+const vaultMagic = "todo-vault-2\n"
+
+// vaultMagicV1 started files encrypted before they carried the salt of
+// their key, which only the vault they were encrypted with decrypts
+const vaultMagicV1 = "todo-vault-1\n"
+
+// scrypt parameters of the keys of new vaults: N is 1<<vaultLogN
+const (
+  vaultLogN = 15
+  vaultR    = 8
+  vaultP    = 1
+)
+
+// vaultSaltSize is the length of the salt of vault keys
+const vaultSaltSize = 16
+
+// vaultHeaderSize is the length of the magic, scrypt parameters and salt
+// starting encrypted files
+const vaultHeaderSize = len(vaultMagic) + 3 + vaultSaltSize
+
+// vaultCheck is encrypted into the vault file to tell whether a
+// passphrase is the right one
+const vaultCheck = "todo vault"
+
+// vaultKeyringUser is the system keyring entry the key of an unlocked
+// vault is kept under
+const vaultKeyringUser = "vault"
+
+// errVaultLocked is returned when encrypted files are needed and there is
+// no way to ask for the passphrase
+var errVaultLocked = errors.New("Task data is encrypted and the vault is locked, run 'todo vault unlock' or set TODO_VAULT_PASSPHRASE")
+
+// vaultFile describes the vault, in vault.json in the config directory
+type vaultFile struct {
+  Salt  []byte `json:"salt"`
+  Check []byte `json:"check"`
+}
+
+// vaultKey is the key of an unlocked vault as kept in the system keyring
+type vaultKey struct {
+  Key   []byte    `json:"key"`
+  Until time.Time `json:"until"`
+}
+
+// vault encrypts and decrypts files with the key derived from the
+// passphrase. Header describes how the key was derived, and starts the
+// files it encrypts
+type vault struct {
+  key    []byte
+  header []byte
+  aead   cipher.AEAD
+}
+
+// vaultPath returns the path of the vault file
+func vaultPath() (string, error) {
+  dir, err := configDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "vault.json"), nil
+}
+
+// loadVaultFile reads the vault file, or returns nil if the vault is not
+// set up
+func loadVaultFile() (*vaultFile, error) {
+  file, err := vaultPath()
+  if err != nil {
+    return nil, err
+  }
+  b, err := ioutil.ReadFile(file)
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  f := &vaultFile{}
+  if err := json.Unmarshal(b, f); err != nil {
+    return nil, fmt.Errorf("Unable to read %s: %w", file, err)
+  }
+  return f, nil
+}
+
+// newVault returns a vault encrypting with key, derived as header says
+func newVault(key []byte, header []byte) (*vault, error) {
+  block, err := aes.NewCipher(key)
+  if err != nil {
+    return nil, err
+  }
+  aead, err := cipher.NewGCM(block)
+  if err != nil {
+    return nil, err
+  }
+  return &vault{key: key, header: header, aead: aead}, nil
+}
+
+// vaultHeader returns the header of the files encrypted with the key of
+// salt, derived with the parameters of new vaults
+func vaultHeader(salt []byte) []byte {
+  return append([]byte(vaultMagic+string([]byte{vaultLogN, vaultR, vaultP})), salt...)
+}
+
+// deriveKey derives the key of passphrase with the scrypt parameters and
+// salt of header
+func deriveKey(passphrase string, header []byte) ([]byte, error) {
+  params := header[len(vaultMagic):]
+  logN, r, p := int(params[0]), int(params[1]), int(params[2])
+  // bounded so that a crafted file can not exhaust memory
+  if logN < 10 || logN > 20 || r < 1 || r > 16 || p < 1 || p > 4 {
+    return nil, errors.New("Unsupported encryption parameters")
+  }
+  return scrypt.Key([]byte(passphrase), params[3:], 1<<uint(logN), r, p, 32)
+}
+
+// deriveVault returns the vault of passphrase, checking it against f
+func deriveVault(f *vaultFile, passphrase string) (*vault, error) {
+  header := vaultHeader(f.Salt)
+  key, err := deriveKey(passphrase, header)
+  if err != nil {
+    return nil, err
+  }
+  v, err := newVault(key, header)
+  if err != nil {
+    return nil, err
+  }
+  if b, err := v.open(f.Check); err != nil || string(b) != vaultCheck {
+    return nil, invalidf("Wrong vault passphrase")
+  }
+  return v, nil
+}
+
+// sealed reports whether b was encrypted by the vault
+func sealed(b []byte) bool {
+  return bytes.HasPrefix(b, []byte(vaultMagic)) || bytes.HasPrefix(b, []byte(vaultMagicV1))
+}
+
+// seal encrypts b, authenticating the header it starts with along with it
+func (v *vault) seal(b []byte) ([]byte, error) {
+  nonce := make([]byte, v.aead.NonceSize())
+  if _, err := rand.Read(nonce); err != nil {
+    return nil, err
+  }
+  out := append(append([]byte{}, v.header...), nonce...)
+  return v.aead.Seal(out, nonce, b, v.header), nil
+}
+
+// open decrypts b, which is returned as it is if it is not encrypted.
+// Files encrypted with another key, such as by the vault of another
+// machine, are decrypted with the key of their passphrase
+func (v *vault) open(b []byte) ([]byte, error) {
+  var header []byte
+  switch {
+  case bytes.HasPrefix(b, []byte(vaultMagicV1)):
+    b = b[len(vaultMagicV1):]
+  case !sealed(b):
+    return b, nil
+  case len(b) < vaultHeaderSize:
+    return nil, errors.New("Encrypted file is truncated")
+  case !bytes.Equal(b[:vaultHeaderSize], v.header):
+    other, err := foreignVault(b[:vaultHeaderSize])
+    if err != nil {
+      return nil, err
+    }
+    return other.open(b)
+  default:
+    header, b = v.header, b[vaultHeaderSize:]
+  }
+  n := v.aead.NonceSize()
+  if len(b) < n {
+    return nil, errors.New("Encrypted file is truncated")
+  }
+  out, err := v.aead.Open(nil, b[:n], b[n:], header)
+  if err != nil {
+    return nil, errors.New("Unable to decrypt task data, it was encrypted with another passphrase")
+  }
+  return out, nil
+}
+
+var (
+  foreignMu     sync.Mutex
+  foreignVaults = map[string]*vault{}
+)
+
+// foreignVault returns the vault of the files starting with header, which
+// were not encrypted by the vault of this machine, asking for their
+// passphrase once
+func foreignVault(header []byte) (*vault, error) {
+  foreignMu.Lock()
+  defer foreignMu.Unlock()
+  if v, ok := foreignVaults[string(header)]; ok {
+    return v, nil
+  }
+  passphrase, err := readPassphrase("Passphrase the data was encrypted with: ")
+  if err == errVaultLocked {
+    return nil, errors.New("Task data was encrypted by another vault, set TODO_VAULT_PASSPHRASE to its passphrase")
+  }
+  if err != nil {
+    return nil, err
+  }
+  key, err := deriveKey(passphrase, header)
+  if err != nil {
+    return nil, err
+  }
+  v, err := newVault(key, append([]byte{}, header...))
+  if err != nil {
+    return nil, err
+  }
+  foreignVaults[string(header)] = v
+  return v, nil
+}
+
+// readPassphrase returns TODO_VAULT_PASSPHRASE, or else asks for the
+// passphrase on a terminal
+func readPassphrase(prompt string) (string, error) {
+  if p, ok := os.LookupEnv("TODO_VAULT_PASSPHRASE"); ok {
+    return p, nil
+  }
+  if !term.IsTerminal(int(os.Stdin.Fd())) {
+    return "", errVaultLocked
+  }
+  fmt.Fprint(os.Stderr, prompt)
+  b, err := term.ReadPassword(int(os.Stdin.Fd()))
+  fmt.Fprintln(os.Stderr)
+  if err != nil {
+    return "", fmt.Errorf("Unable to read the passphrase: %w", err)
+  }
+  return string(b), nil
+}
+
+// unlockedKey returns the key kept in the system keyring by 'todo vault
+// unlock', or nil if there is none or it expired
+func unlockedKey() *vaultKey {
+  secret, err := keyring.Get(keyringService, vaultKeyringUser)
+  if err != nil {
+    return nil
+  }
+  k := &vaultKey{}
+  if json.Unmarshal([]byte(secret), k) != nil || time.Now().After(k.Until) {
+    return nil
+  }
+  return k
+}
+
+// unlockVault returns the vault described by f, with the key kept by
+// 'todo vault unlock' or else that of the passphrase
+func unlockVault(f *vaultFile) (*vault, error) {
+  if k := unlockedKey(); k != nil {
+    if v, err := newVault(k.Key, vaultHeader(f.Salt)); err == nil {
+      if b, err := v.open(f.Check); err == nil && string(b) == vaultCheck {
+        return v, nil
+      }
+    }
+  }
+  passphrase, err := readPassphrase("Vault passphrase: ")
+  if err != nil {
+    return nil, err
+  }
+  return deriveVault(f, passphrase)
+}
+
+var (
+  vaultOnce   sync.Once
+  openedVault *vault
+  vaultErr    error
+)
+
+// currentVault returns the vault task data is encrypted with, unlocking
+// it on first use, or nil if the vault is not set up
+func currentVault() (*vault, error) {
+  vaultOnce.Do(func() {
+    var f *vaultFile
+    if f, vaultErr = loadVaultFile(); f != nil && vaultErr == nil {
+      openedVault, vaultErr = unlockVault(f)
+    }
+  })
+  return openedVault, vaultErr
+}
+
+// sealPrivate encrypts b if the vault is set up
+func sealPrivate(b []byte) ([]byte, error) {
+  v, err := currentVault()
+  if err != nil || v == nil {
+    return b, err
+  }
+  return v.seal(b)
+}
+
+// openPrivate decrypts b if it was encrypted by the vault
+func openPrivate(b []byte) ([]byte, error) {
+  if !sealed(b) {
+    return b, nil
+  }
+  v, err := currentVault()
+  if err != nil {
+    return nil, err
+  }
+  if v != nil {
+    return v.open(b)
+  }
+  if bytes.HasPrefix(b, []byte(vaultMagicV1)) || len(b) < vaultHeaderSize {
+    return nil, errors.New("Task data is encrypted but the vault is gone, restore vault.json in the config directory")
+  }
+  other, err := foreignVault(b[:vaultHeaderSize])
+  if err != nil {
+    return nil, err
+  }
+  return other.open(b)
+}
+
+// readPrivate reads a file holding task data, decrypting it if needed
+func readPrivate(file string) ([]byte, error) {
+  b, err := ioutil.ReadFile(file)
+  if err != nil {
+    return nil, err
+  }
+  return openPrivate(b)
+}
+
+// writePrivate replaces a file holding task data with b, encrypted if
+// the vault is set up. The file is replaced atomically
+func writePrivate(file string, b []byte) error {
+  b, err := sealPrivate(b)
+  if err != nil {
+    return err
+  }
+  tmp := file + ".tmp"
+  if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+    return err
+  }
+  return os.Rename(tmp, file)
+}
+
+// privateSealer encrypts the file of the local backend like the other
+// files holding task data
+type privateSealer struct{}
+
+func (privateSealer) Seal(b []byte) ([]byte, error) { return sealPrivate(b) }
+func (privateSealer) Open(b []byte) ([]byte, error) { return openPrivate(b) }
+
+// bucketSealer encrypts the file of the local backend kept in a bucket
+// like privateSealer. On machines without a vault, the file is encrypted
+// again with the key it was read with rather than written in the clear
+type bucketSealer struct {
+  read *vault
+}
+
+func (s *bucketSealer) Seal(b []byte) ([]byte, error) {
+  if v, err := currentVault(); err == nil && v == nil && s.read != nil {
+    return s.read.seal(b)
+  }
+  return sealPrivate(b)
+}
+
+func (s *bucketSealer) Open(b []byte) ([]byte, error) {
+  if bytes.HasPrefix(b, []byte(vaultMagic)) && len(b) >= vaultHeaderSize {
+    if v, err := currentVault(); err == nil && v == nil {
+      read, err := foreignVault(b[:vaultHeaderSize])
+      if err != nil {
+        return nil, err
+      }
+      s.read = read
+    }
+  }
+  return openPrivate(b)
+}
+
+// privateFiles returns the files holding task data: the local backend,
+// the caches, the journal, the audit log, the trash, archives, the time
+// log and scheduled backups kept in the data directory
+func privateFiles() ([]string, error) {
+  var files []string
+  dirs := []func() (string, error){
+    func() (string, error) { return dataDir("local") },
+    func() (string, error) { return dataDir("journal") },
+    func() (string, error) { return dataDir("audit") },
+    func() (string, error) { return dataDir("trash") },
+    func() (string, error) { return dataDir("archive") },
+    func() (string, error) { return dataDir("time") },
+    func() (string, error) { return dataDir("backups") },
+    func() (string, error) { return cacheDir("lists") },
+    func() (string, error) { return cacheDir("http") },
+  }
+  for _, dir := range dirs {
+    root, err := dir()
+    if err != nil {
+      return nil, err
+    }
+    err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+      if err == nil && info.Mode().IsRegular() && (strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".jsonl")) {
+        files = append(files, path)
+      }
+      return err
+    })
+    if err != nil {
+      return nil, err
+    }
+  }
+  if file := loadConfig().LocalFile; file != "" && !isBucketURL(file) {
+    if _, err := os.Stat(file); err == nil {
+      files = append(files, file)
+    }
+  }
+  return files, nil
+}
+
+// privateObjects returns the objects holding task data outside of the
+// directories of todo: the file of the local backend if local_file is a
+// bucket URL, and the scheduled backups of backup_s3 or backup_dir
+func privateObjects() ([]todo.Storage, error) {
+  var objects []todo.Storage
+  if file := loadConfig().LocalFile; isBucketURL(file) {
+    obj, err := newS3Object(file)
+    if err != nil {
+      return nil, invalidf("Invalid local_file: %v", err)
+    }
+    objects = append(objects, obj)
+  }
+  backups, err := storedBackups()
+  if err != nil {
+    return nil, err
+  }
+  return append(objects, backups...), nil
+}
+
+// convertFiles rewrites the files holding task data with convert, and
+// returns how many of them it changed
+func convertFiles(convert func(b []byte) ([]byte, bool, error)) (int, error) {
+  files, err := privateFiles()
+  if err != nil {
+    return 0, err
+  }
+  n := 0
+  for _, file := range files {
+    b, err := ioutil.ReadFile(file)
+    if err != nil {
+      return n, err
+    }
+    var out []byte
+    var changed bool
+    if strings.HasSuffix(file, ".jsonl") {
+      out, changed, err = convertAuditLines(b, convert)
+    } else {
+      out, changed, err = convert(b)
+    }
+    if err != nil {
+      return n, fmt.Errorf("%s: %w", file, err)
+    }
+    if !changed {
+      continue
+    }
+    tmp := file + ".tmp"
+    if err := ioutil.WriteFile(tmp, out, 0600); err != nil {
+      return n, err
+    }
+    if err := os.Rename(tmp, file); err != nil {
+      return n, err
+    }
+    n++
+  }
+  objects, err := privateObjects()
+  if err != nil {
+    return n, err
+  }
+  for _, o := range objects {
+    b, version, err := o.Read()
+    if err != nil {
+      return n, err
+    }
+    if b == nil {
+      continue
+    }
+    out, changed, err := convert(b)
+    if err != nil {
+      return n, fmt.Errorf("%s: %w", o, err)
+    }
+    if !changed {
+      continue
+    }
+    if err := o.Write(out, version); err == todo.ErrConflict {
+      return n, fmt.Errorf("%s changed meanwhile, run the command again", o)
+    } else if err != nil {
+      return n, err
+    }
+    n++
+  }
+  return n, nil
+}
+
+// createVault sets up the vault with a new passphrase and encrypts the
+// files holding task data with it
+func createVault() error {
+  first, err := readPassphrase("New vault passphrase: ")
+  if err != nil {
+    return err
+  }
+  if first == "" {
+    return invalidf("The vault passphrase can not be empty")
+  }
+  if _, ok := os.LookupEnv("TODO_VAULT_PASSPHRASE"); !ok {
+    again, err := readPassphrase("Repeat the passphrase: ")
+    if err != nil {
+      return err
+    }
+    if again != first {
+      return invalidf("The passphrases differ")
+    }
+  }
+  f := &vaultFile{Salt: make([]byte, vaultSaltSize)}
+  if _, err := rand.Read(f.Salt); err != nil {
+    return err
+  }
+  header := vaultHeader(f.Salt)
+  key, err := deriveKey(first, header)
+  if err != nil {
+    return err
+  }
+  v, err := newVault(key, header)
+  if err != nil {
+    return err
+  }
+  if f.Check, err = v.seal([]byte(vaultCheck)); err != nil {
+    return err
+  }
+  // the vault is saved first, so that files encrypted with its key can
+  // be decrypted whatever happens next
+  b, err := json.MarshalIndent(f, "", "  ")
+  if err != nil {
+    return err
+  }
+  file, err := vaultPath()
+  if err != nil {
+    return err
+  }
+  if err := ioutil.WriteFile(file+".tmp", b, 0600); err != nil {
+    return err
+  }
+  if err := os.Rename(file+".tmp", file); err != nil {
+    return err
+  }
+  n, err := convertFiles(func(b []byte) ([]byte, bool, error) {
+    if sealed(b) {
+      return b, false, nil
+    }
+    out, err := v.seal(b)
+    return out, true, err
+  })
+  if err != nil {
+    // decrypt the files encrypted so far, and only then drop the vault
+    _, rerr := convertFiles(func(b []byte) ([]byte, bool, error) {
+      out, err := v.open(b)
+      return out, sealed(b), err
+    })
+    if rerr != nil {
+      return fmt.Errorf("Unable to encrypt task data: %v; some files are left encrypted, decrypt them with 'todo vault decrypt': %v", err, rerr)
+    }
+    if rerr := os.Remove(file); rerr != nil {
+      return fmt.Errorf("Unable to encrypt task data: %v; remove %s: %v", err, file, rerr)
+    }
+    return fmt.Errorf("Unable to encrypt task data: %w", err)
+  }
+  infof("Encrypted %s holding task data, todo asks for the passphrase until 'todo vault unlock'", plural(n, "file"))
+  return nil
+}
+
+// lockVault sets up the vault if needed, and otherwise forgets the key
+// kept by 'todo vault unlock'
+func lockVault() error {
+  f, err := loadVaultFile()
+  if err != nil {
+    return err
+  }
+  if f == nil {
+    return createVault()
+  }
+  // without a keyring there is no key to forget
+  keyring.Delete(keyringService, vaultKeyringUser)
+  infof("Vault locked")
+  return nil
+}
+
+// unlockVaultFor checks the passphrase and keeps the key in the system
+// keyring for the given duration
+func unlockVaultFor(d time.Duration) error {
+  f, err := loadVaultFile()
+  if err != nil {
+    return err
+  }
+  if f == nil {
+    return invalidf("The vault is not set up, 'todo vault lock' encrypts task data")
+  }
+  passphrase, err := readPassphrase("Vault passphrase: ")
+  if err != nil {
+    return err
+  }
+  v, err := deriveVault(f, passphrase)
+  if err != nil {
+    return err
+  }
+  until := time.Now().Add(d)
+  b, err := json.Marshal(&vaultKey{Key: v.key, Until: until})
+  if err != nil {
+    return err
+  }
+  if err := keyring.Set(keyringService, vaultKeyringUser, string(b)); err != nil {
+    return fmt.Errorf("System keyring unavailable, set TODO_VAULT_PASSPHRASE instead: %w", err)
+  }
+  infof("Vault unlocked until %s", until.Format("2006-01-02 15:04"))
+  return nil
+}
+
+// decryptVault decrypts the files holding task data and removes the vault
+func decryptVault() error {
+  f, err := loadVaultFile()
+  if err != nil {
+    return err
+  }
+  if f == nil {
+    return invalidf("The vault is not set up, task data is not encrypted")
+  }
+  v, err := unlockVault(f)
+  if err != nil {
+    return err
+  }
+  n, err := convertFiles(func(b []byte) ([]byte, bool, error) {
+    out, err := v.open(b)
+    return out, sealed(b), err
+  })
+  if err != nil {
+    return err
+  }
+  file, err := vaultPath()
+  if err != nil {
+    return err
+  }
+  if err := os.Remove(file); err != nil {
+    return err
+  }
+  keyring.Delete(keyringService, vaultKeyringUser)
+  infof("Decrypted %s, task data is no longer encrypted", plural(n, "file"))
+  return nil
+}
+
+// printVaultStatus tells whether the vault is set up and unlocked
+func printVaultStatus() error {
+  f, err := loadVaultFile()
+  if err != nil {
+    return err
+  }
+  k := unlockedKey()
+  switch {
+  case f == nil:
+    fmt.Println("Task data is not encrypted, 'todo vault lock' encrypts it")
+  case k != nil:
+    fmt.Printf("Task data is encrypted, the vault is unlocked until %s\n", k.Until.Format("2006-01-02 15:04"))
+  default:
+    fmt.Println("Task data is encrypted, the vault is locked")
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "vault",
+    usage:   "vault [status] | vault lock | vault unlock [--for 8h] | vault decrypt",
+    summary: "Encrypt the task data kept on this machine with a passphrase",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      d := fs.Duration("for", 8*time.Hour, "how long 'vault unlock' keeps the vault unlocked")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) == 0 {
+        args = []string{"status"}
+      }
+      if len(args) > 1 {
+        return invalidf("Unexpected argument '%s', see 'todo help vault'", args[1])
+      }
+      switch args[0] {
+      case "status":
+        return printVaultStatus()
+      case "lock":
+        return lockVault()
+      case "unlock":
+        if *d <= 0 {
+          return invalidf("--for must be positive")
+        }
+        return unlockVaultFor(*d)
+      case "decrypt":
+        return decryptVault()
+      }
+      return invalidf("Unknown vault command '%s', see 'todo help vault'", args[0])
+    },
+  })
+}
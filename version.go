@@ -0,0 +1,140 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "runtime"
+  "runtime/debug"
+  "strings"
+
+  "golang.org/x/net/context"
+)
+
+// Version of todo, the git commit it was built from and when, set when
+// building releases with
+// -ldflags "-X main.version=v1.2.0 -X main.commit=<sha> -X main.buildDate=<RFC 3339 time>"
+var (
+  version   = "dev"
+  commit    string
+  buildDate string
+)
+
+// buildInfo describes the build of the running binary, for packaging and
+// bug reports
+type buildInfo struct {
+  Version string `json:"version"`
+  Commit  string `json:"commit,omitempty"`
+  Date    string `json:"date,omitempty"`
+  Go      string `json:"go"`
+  OS      string `json:"os"`
+  Arch    string `json:"arch"`
+}
+
+// currentBuild returns the build info of the running binary. What was not
+// set with -ldflags is taken from what the go command recorded: the module
+// version for go install and the git commit for builds of a checkout
+func currentBuild() buildInfo {
+  b := buildInfo{Version: version, Commit: commit, Date: buildDate, Go: runtime.Version(), OS: runtime.GOOS, Arch: runtime.GOARCH}
+  info, ok := debug.ReadBuildInfo()
+  if !ok {
+    return b
+  }
+  if b.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+    b.Version = info.Main.Version
+  }
+  modified := false
+  for _, s := range info.Settings {
+    switch s.Key {
+    case "vcs.revision":
+      if b.Commit == "" {
+        b.Commit = s.Value
+      }
+    case "vcs.time":
+      if b.Date == "" {
+        b.Date = s.Value
+      }
+    case "vcs.modified":
+      modified = s.Value == "true"
+    }
+  }
+  if modified && commit == "" && b.Commit != "" {
+    b.Commit += "-dirty"
+  }
+  return b
+}
+
+// String describes the build on one line, such as
+// "todo v1.2.0 (commit 1a2b3c4d5e6f, built 2024-05-01T10:00:00Z, go1.22.2 linux/amd64)"
+func (b buildInfo) String() string {
+  var details []string
+  if b.Commit != "" {
+    c := b.Commit
+    if len(c) > 12 && !strings.HasSuffix(c, "-dirty") {
+      c = c[:12]
+    }
+    details = append(details, "commit "+c)
+  }
+  if b.Date != "" {
+    details = append(details, "built "+b.Date)
+  }
+  details = append(details, fmt.Sprintf("%s %s/%s", b.Go, b.OS, b.Arch))
+  return fmt.Sprintf("todo %s (%s)", b.Version, strings.Join(details, ", "))
+}
+
+// printVersion prints the build of todo and, with check set, whether a
+// newer release is available
+func printVersion(ctx context.Context, check bool) error {
+  b := currentBuild()
+  out := struct {
+    buildInfo
+    Latest string `json:"latest,omitempty"`
+    Update *bool  `json:"update,omitempty"`
+    URL    string `json:"url,omitempty"`
+  }{buildInfo: b}
+  if check {
+    r, err := latestRelease(ctx)
+    if err != nil {
+      return err
+    }
+    newer := compareVersions(r.TagName, b.Version) > 0
+    out.Latest, out.Update, out.URL = r.TagName, &newer, r.HTMLURL
+  }
+  if loadConfig().Output == outputJSON {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(out)
+  }
+  fmt.Println(b)
+  switch {
+  case out.Update == nil:
+  case *out.Update && releaseKey == "":
+    // self-update refuses to install what it can not verify
+    fmt.Printf("todo %s is available, install it from %s\n", out.Latest, out.URL)
+  case *out.Update:
+    fmt.Printf("todo %s is available, update with 'todo self-update', see %s\n", out.Latest, out.URL)
+  default:
+    fmt.Println("This is the latest version")
+  }
+  return nil
+}
+
+func init() {
+  register(&command{
+    name:    "version",
+    usage:   "version [--check]",
+    summary: "Print the version, git commit, build date and Go version of todo, or check whether a newer one was released",
+    run: func(cmd *command, args []string) error {
+      fs := cmd.flags()
+      check := fs.Bool("check", false, "check GitHub for a newer release")
+      args, err := parseFlags(fs, args)
+      if err != nil {
+        return err
+      }
+      if len(args) > 0 {
+        return invalidf("Unexpected argument '%s', see 'todo help version'", args[0])
+      }
+      return printVersion(cmdCtx, *check)
+    },
+  })
+}
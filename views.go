@@ -0,0 +1,124 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+)
+
+// dueView is a listing of the tasks due in a range of days, such as today
+type dueView struct {
+  name    string
+  summary string
+  // empty is what is printed when no task is in the view
+  empty string
+  // days selects the tasks of the view by how many days from today
+  // they are due, negative for overdue ones, given how many days are
+  // left in the week, today included
+  days func(n, week int) bool
+}
+
+var dueViews = []*dueView{
+  {name: "overdue", summary: "List tasks that are past their due date", empty: "Nothing is overdue",
+    days: func(n, week int) bool { return n < 0 }},
+  {name: "today", summary: "List tasks due today", empty: "Nothing is due today",
+    days: func(n, week int) bool { return n == 0 }},
+  {name: "week", summary: "List tasks due from today to the end of the week, see week_start", empty: "Nothing is due this week",
+    days: func(n, week int) bool { return n >= 0 && n < week }},
+}
+
+// daysUntil returns how many days from today due is
+func daysUntil(due time.Time, today time.Time) int {
+  return int(due.Sub(today).Hours() / 24)
+}
+
+// Lists the tasks of the todo list selected by view, soonest due first,
+// numbered so they can be referred to by index, and a summary line of
+// what is overdue and due soon. The week ends before the next week_start,
+// like the "This week" group of 'todo list --group-by due'. The tasks are
+// fetched with a due date filter, or taken from the cache when offline
+func showDueView(s *session, view *dueView, opts listOptions) error {
+  today := todo.Date(time.Now())
+  weekDays := 7 - weekOffset(today)
+  week := today.AddDate(0, 0, weekDays-1)
+  var items []*todo.Task
+  var err error
+  if s.offline {
+    for _, task := range s.cache.Items {
+      if !task.Due.IsZero() && !task.Due.After(week) {
+        items = append(items, task)
+      }
+    }
+  } else if items, err = s.client.Due(s.ctx, s.todoId, time.Time{}, week); err != nil {
+    return fmt.Errorf("Unable to retrieve tasks: %w", err)
+  }
+
+  var selected []*todo.Task
+  overdue, dueToday, dueWeek := 0, 0, 0
+  for _, task := range items {
+    n := daysUntil(task.Due, today)
+    switch {
+    case n < 0:
+      overdue++
+    case n == 0:
+      dueToday++
+      dueWeek++
+    default:
+      dueWeek++
+    }
+    if view.days(n, weekDays) && hasAllTags(task, opts.tags) {
+      selected = append(selected, task)
+    }
+  }
+  sort.SliceStable(selected, func(i, j int) bool {
+    return selected[i].Due.Before(selected[j].Due)
+  })
+
+  // tasks may be blocked by ones not due this week
+  opts.open = s.cache.Items
+  s.cache.remember(selected, view.name)
+  s.saveCache()
+  if loadConfig().Output == outputJSON {
+    return listTodoItems(selected, opts)
+  }
+  if len(selected) == 0 {
+    fmt.Printf("%s in your %s list\n", view.empty, s.listName)
+  } else if err := listTodoItems(selected, opts); err != nil {
+    return err
+  }
+  fmt.Println(colorize("2", fmt.Sprintf("%d overdue, %d due today, %d due this week", overdue, dueToday, dueWeek)))
+  return nil
+}
+
+func init() {
+  for _, view := range dueViews {
+    view := view
+    register(&command{
+      name:    view.name,
+      usage:   view.name + " [--plain] [+tag...]",
+      summary: view.summary,
+      run: func(cmd *command, args []string) error {
+        fs := cmd.flags()
+        plain := fs.Bool("plain", false, "print one uncolored line per task instead of a table")
+        args, err := parseFlags(fs, args)
+        if err != nil {
+          return err
+        }
+        words, tags := splitTags(args)
+        if len(words) > 0 {
+          return invalidf("Unexpected argument '%s', tags to filter by start with '+'", words[0])
+        }
+        if *plain {
+          noColorFlag = true
+        }
+        s, err := newSession()
+        if err != nil {
+          return err
+        }
+        return showDueView(s, view, listOptions{tags: tags, plain: *plain})
+      },
+    })
+  }
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+  "bytes"
+  "crypto/hmac"
+  "crypto/rand"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strings"
+  "time"
+
+  "github.com/PedramPejman/todo/pkg/todo"
+  "golang.org/x/net/context"
+)
+
+// Events sent to webhooks
+const (
+  eventCreated   = "task.created"
+  eventCompleted = "task.completed"
+  eventDeleted   = "task.deleted"
+)
+
+// webhookQueue is how many events wait for delivery before new ones are
+// dropped
+const webhookQueue = 256
+
+// webhookEvent is the JSON body POSTed to webhooks. Deleted tasks may only
+// carry their id
+type webhookEvent struct {
+  ID    string     `json:"id"`
+  Event string     `json:"event"`
+  Time  time.Time  `json:"time"`
+  List  string     `json:"list"`
+  Task  *todo.Task `json:"task"`
+}
+
+// webhooks POSTs events to the URLs of webhook_urls, in the order they
+// happened, signing them with webhook_secret if it is set. A nil
+// *webhooks sends nothing
+type webhooks struct {
+  urls   []string
+  secret string
+  client *http.Client
+  queue  chan *webhookEvent
+  done   chan struct{}
+}
+
+// newWebhooks starts delivering events to the configured webhooks, or
+// returns nil if there are none
+func newWebhooks() (*webhooks, error) {
+  c := loadConfig()
+  var urls []string
+  for _, u := range strings.Split(c.WebhookURLs, ",") {
+    if u = strings.TrimSpace(u); u == "" {
+      continue
+    }
+    if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+      return nil, invalidf("Invalid webhook URL '%s' in webhook_urls", u)
+    }
+    urls = append(urls, u)
+  }
+  if len(urls) == 0 {
+    return nil, nil
+  }
+  h := &webhooks{urls: urls, secret: c.WebhookSecret,
+    client: &http.Client{Transport: retryTransport(http.DefaultTransport), Timeout: time.Minute},
+    queue:  make(chan *webhookEvent, webhookQueue), done: make(chan struct{})}
+  go h.run()
+  infof("Sending task events to %s", plural(len(urls), "webhook"))
+  return h, nil
+}
+
+// send queues an event about task of the named list
+func (h *webhooks) send(event string, list string, task *todo.Task) {
+  if h == nil {
+    return
+  }
+  id := make([]byte, 8)
+  rand.Read(id)
+  e := &webhookEvent{ID: hex.EncodeToString(id), Event: event, Time: time.Now().UTC(), List: list, Task: task}
+  select {
+  case h.queue <- e:
+  default:
+    warnf("Webhook queue full, dropping %s of '%s'", event, task.Title)
+  }
+}
+
+// close waits for queued events to be delivered, for at most timeout
+func (h *webhooks) close(timeout time.Duration) {
+  if h == nil {
+    return
+  }
+  close(h.queue)
+  select {
+  case <-h.done:
+  case <-time.After(timeout):
+    warnf("Gave up delivering %s to webhooks", plural(len(h.queue), "event"))
+  }
+}
+
+// run delivers queued events until the queue is closed
+func (h *webhooks) run() {
+  defer close(h.done)
+  for e := range h.queue {
+    body, err := json.Marshal(e)
+    if err != nil {
+      warnf("Unable to encode %s: %v", e.Event, err)
+      continue
+    }
+    for _, u := range h.urls {
+      if err := h.deliver(u, e, body); err != nil {
+        warnf("Unable to send %s of '%s' to %s: %v", e.Event, e.Task.Title, u, err)
+      } else {
+        verbosef("Sent %s of '%s' to %s", e.Event, e.Task.Title, u)
+      }
+    }
+  }
+}
+
+// deliver POSTs the encoded event to url
+func (h *webhooks) deliver(url string, e *webhookEvent, body []byte) error {
+  req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+  if err != nil {
+    return err
+  }
+  req.Header.Set("Content-Type", "application/json")
+  req.Header.Set("User-Agent", "todo")
+  req.Header.Set("X-Todo-Event", e.Event)
+  req.Header.Set("X-Todo-Delivery", e.ID)
+  if h.secret != "" {
+    req.Header.Set("X-Todo-Signature", signWebhook(h.secret, body))
+  }
+  res, err := h.client.Do(req)
+  if err != nil {
+    return err
+  }
+  res.Body.Close()
+  if res.StatusCode >= 300 {
+    return fmt.Errorf("%s", res.Status)
+  }
+  return nil
+}
+
+// signWebhook returns the X-Todo-Signature of body: sha256= followed by
+// the hex encoded HMAC-SHA256 of body keyed with secret
+func signWebhook(secret string, body []byte) string {
+  mac := hmac.New(sha256.New, []byte(secret))
+  mac.Write(body)
+  return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// taskEvents sends an event for each task of items that is not in known,
+// and for each task of known no longer in items, completed if it is among
+// the tasks of the list completed since then, deleted otherwise
+func taskEvents(ctx context.Context, h *webhooks, client todo.Backend, listId string, list string,
+  known map[string]*todo.Task, items []*todo.Task, since time.Time) {
+  current := map[string]bool{}
+  for _, task := range items {
+    current[task.ID] = true
+    if known[task.ID] == nil {
+      h.send(eventCreated, list, task)
+    }
+  }
+  var gone []*todo.Task
+  for id, task := range known {
+    if !current[id] {
+      gone = append(gone, task)
+    }
+  }
+  if len(gone) == 0 {
+    return
+  }
+  completed := map[string]*todo.Task{}
+  done, err := client.Completed(ctx, listId, since, time.Time{})
+  if err != nil {
+    warnf("Unable to retrieve completed tasks, reporting gone ones as deleted: %v", err)
+  }
+  for _, task := range done {
+    completed[task.ID] = task
+  }
+  for _, task := range gone {
+    if c := completed[task.ID]; c != nil {
+      h.send(eventCompleted, list, c)
+    } else {
+      h.send(eventDeleted, list, task)
+    }
+  }
+}